@@ -2,23 +2,40 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"net/url"
+	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
+	"github.com/abduss/godrive/internal/audit"
 	"github.com/abduss/godrive/internal/auth"
 	"github.com/abduss/godrive/internal/bucket"
+	"github.com/abduss/godrive/internal/buildinfo"
 	"github.com/abduss/godrive/internal/config"
+	"github.com/abduss/godrive/internal/events"
 	"github.com/abduss/godrive/internal/file"
+	"github.com/abduss/godrive/internal/metrics"
+	"github.com/abduss/godrive/internal/presigned"
 	"github.com/abduss/godrive/internal/server"
+	"github.com/abduss/godrive/internal/share"
 	"github.com/abduss/godrive/internal/storage"
+	"github.com/abduss/godrive/migrations"
 	"github.com/joho/godotenv"
+	"github.com/minio/minio-go/v7"
 )
 
+// forceCloseTimeout bounds the final connection shutdown once draining has finished.
+const forceCloseTimeout = 5 * time.Second
+
 func main() {
+	startedAt := time.Now()
+
 	// Load .env file if it exists (ignore error if file doesn't exist)
 	_ = godotenv.Load()
 
@@ -36,45 +53,143 @@ func main() {
 	}
 	defer dbPool.Close()
 
-	minioClient, err := storage.NewMinIOClient(cfg.MinIO)
+	if cfg.Postgres.AutoMigrate {
+		version, err := migrations.Up(ctx, dbPool)
+		if err != nil {
+			log.Fatalf("migrate database: %v", err)
+		}
+		log.Printf("database schema at version %d", version)
+	}
+
+	objects, err := newObjectBackend(ctx, cfg)
 	if err != nil {
-		log.Fatalf("connect minio: %v", err)
+		log.Fatalf("object storage: %v", err)
+	}
+	var tenants *storage.TenantBuckets
+	if len(cfg.Storage.TenantBuckets) > 0 {
+		byOwner, err := storage.ParseTenantBuckets(cfg.Storage.TenantBuckets)
+		if err != nil {
+			log.Fatalf("tenant buckets: %v", err)
+		}
+		tenants = storage.NewTenantBuckets(objects.bucket, byOwner, objects.ensure)
 	}
 
-	if err := storage.EnsureBucket(ctx, minioClient, cfg.MinIO.Bucket, cfg.MinIO.Region); err != nil {
-		log.Fatalf("ensure bucket: %v", err)
+	// Repositories share an instrumented handle so query durations reach the metrics endpoint.
+	db := storage.Instrument(dbPool, metrics.ObserveDBQuery)
+	queryTimeouts := storage.QueryTimeouts{
+		Lookup: cfg.Postgres.LookupTimeout,
+		List:   cfg.Postgres.ListTimeout,
+		Write:  cfg.Postgres.WriteTimeout,
 	}
 
-	authRepo := auth.NewRepository(dbPool)
+	authRepo := auth.NewRepository(db, queryTimeouts)
 	authService := auth.NewService(authRepo, cfg.Auth)
 
-	bucketRepo := bucket.NewRepository(dbPool)
-	fileRepo := file.NewRepository(dbPool)
+	bucketRepo := bucket.NewRepository(db, queryTimeouts)
+	fileRepo := file.NewRepository(db, queryTimeouts)
+
+	auditService := audit.NewService(audit.NewRepository(db, queryTimeouts))
+	defer auditService.Close()
+
+	bus := events.NewBus(0)
+	defer bus.Close()
+	bus.Subscribe(metrics.ObserveUpload, events.FileUploaded)
+
+	bucketService := bucket.NewService(bucketRepo, fileRepo, objects.store, objects.bucket)
+	bucketService.SetAuditor(auditService)
+	bucketService.SetPublisher(bus)
+	bucketService.SetMaxDescriptionLength(cfg.Bucket.MaxDescriptionLength)
+	bucketService.SetPublicBucketsEnabled(cfg.Features.PublicBuckets)
+	bucketService.SetStoragePrice(cfg.Bucket.StoragePricePerGB)
+	bucketService.SetImmutableRetention(cfg.Bucket.ImmutableRetention)
+	bucketService.SetTenantBuckets(tenants)
+	if cfg.Bucket.CreateDefault {
+		authService.SetProvisioner(bucket.DefaultBucketProvisioner{Service: bucketService, Name: cfg.Bucket.DefaultName})
+	}
+	fileService := file.NewService(fileRepo, bucketRepo, objects.store, objects.bucket)
+	fileService.SetMaxFileSize(cfg.Upload.MaxFileSize)
+	fileService.SetMaxBatchSize(cfg.Upload.MaxBatchSize)
+	fileService.SetMaxAccountBytes(cfg.Upload.MaxAccountBytes)
+	fileService.SetUploadRetryPolicy(objects.uploadRetry)
+	fileService.SetAllowEmptyFiles(cfg.Upload.AllowEmptyFiles)
+	fileService.SetIdempotencyTTL(cfg.Upload.IdempotencyTTL)
+	fileService.SetRequireKnownSize(cfg.Upload.RequireUploadSize)
+	fileService.SetUploadFields(cfg.Upload.FormFields)
+	fileService.SetBlockedContentTypes(cfg.Upload.BlockedContentTypes)
+	fileService.SetBlockedExtensions(cfg.Upload.BlockedExtensions)
+	if cfg.Upload.ClamAVAddress != "" {
+		fileService.SetScanner(file.NewClamAVScanner(cfg.Upload.ClamAVAddress, cfg.Upload.ClamAVTimeout))
+	}
+	fileService.SetImmutableRetention(cfg.Bucket.ImmutableRetention)
+	fileService.SetTenantBuckets(tenants)
+	fileService.SetReplicaBucket(cfg.Storage.ReplicaBucket)
+	fileService.SetAuditor(auditService)
+	fileService.SetPublisher(bus)
+	fileService.SetObjectCache(file.NewObjectCache(cfg.Cache.ObjectCacheBytes, cfg.Cache.ObjectCacheMaxObjectBytes))
+	fileService.SetMetadataCacheTTL(cfg.Cache.MetadataCacheTTL)
+	if err := fileService.SetKeyLayout(file.KeyLayout(cfg.Upload.ObjectKeyLayout)); err != nil {
+		log.Fatalf("object key layout %q: %v", cfg.Upload.ObjectKeyLayout, err)
+	}
+	if err := fileService.SetDedupScope(file.DedupScope(cfg.Upload.DedupScope)); err != nil {
+		log.Fatalf("dedup scope %q: %v", cfg.Upload.DedupScope, err)
+	}
+	// "backfill-checksums" hashes files stored without a checksum once and exits instead of serving.
+	if len(os.Args) > 1 && os.Args[1] == "backfill-checksums" {
+		result, err := fileService.BackfillChecksums(ctx, cfg.Maintenance.ChecksumBackfillBatchSize)
+		if err != nil {
+			log.Fatalf("backfill checksums: %v", err)
+		}
+		log.Printf("backfill checksums: %d updated, %d failed, %d skipped", result.Updated, result.Failed, result.Skipped)
+		return
+	}
+	presignService := presigned.NewService(fileService, objects.signer, cfg.Presign)
+	presignService.SetAuditLog(presigned.NewRepository(db, queryTimeouts))
+	fileService.SetPresigner(presignService)
+	shareService := share.NewService(share.NewRepository(db, queryTimeouts), fileService)
 
-	bucketService := bucket.NewService(bucketRepo, fileRepo, minioClient, cfg.MinIO.Bucket)
-	fileStore := file.NewMinIOStore(minioClient)
-	fileService := file.NewService(fileRepo, bucketRepo, fileStore, cfg.MinIO.Bucket)
+	metrics.InitMetrics()
+	go server.MonitorDependencies(ctx, cfg.Metrics.DependencyCheckInterval, dbPool, objects.store, cfg.Storage.Provider)
+	go fileService.RunChecksumBackfill(ctx, cfg.Maintenance.ChecksumBackfillInterval, cfg.Maintenance.ChecksumBackfillBatchSize)
+	go fileService.RunIdempotencyCleanup(ctx, cfg.Maintenance.IdempotencyCleanupInterval)
 
+	drainer := server.NewDrainer()
 	router := server.NewRouter(server.Dependencies{
-		Config:        cfg,
-		DB:            dbPool,
-		ObjectStore:   minioClient,
-		AuthService:   authService,
-		BucketService: bucketService,
-		FileService:   fileService,
+		Config:         cfg,
+		DB:             dbPool,
+		ObjectStore:    objects.store,
+		AuthService:    authService,
+		BucketService:  bucketService,
+		FileService:    fileService,
+		PresignService: presignService,
+		AuditService:   auditService,
+		ShareService:   shareService,
+		Drainer:        drainer,
+		StartedAt:      startedAt,
 	})
 
 	httpServer := &http.Server{
-		Addr:         cfg.Server.Address(),
-		Handler:      router,
-		ReadTimeout:  cfg.Server.ReadTimeout,
-		WriteTimeout: cfg.Server.WriteTimeout,
-		IdleTimeout:  cfg.Server.IdleTimeout,
+		Addr:              cfg.Server.Address(),
+		Handler:           router,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+		MaxHeaderBytes:    cfg.Server.MaxHeaderBytes,
+	}
+	if !cfg.Server.EnableHTTP2 {
+		// A non-nil, empty map stops net/http from negotiating HTTP/2 over TLS.
+		httpServer.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){}
 	}
 
 	go func() {
-		log.Printf("GoDrive API listening on %s", cfg.Server.Address())
-		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Printf("GoDrive API %s (%s) listening on %s", buildinfo.Version, buildinfo.Commit, cfg.Server.Address())
+		var err error
+		if cfg.Server.TLSEnabled() {
+			err = httpServer.ListenAndServeTLS(cfg.Server.TLSCertFile, cfg.Server.TLSKeyFile)
+		} else {
+			err = httpServer.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			log.Fatalf("http server: %v", err)
 		}
 	}()
@@ -82,11 +197,85 @@ func main() {
 	<-ctx.Done()
 	stop()
 
-	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownGrace)
 	defer cancel()
 
 	fmt.Println("shutting down gracefully...")
-	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+	drained, err := drainer.Drain(shutdownCtx)
+	if err != nil {
+		log.Printf("shutdown grace period elapsed with %d of %d requests still in flight", drainer.Active(), drained)
+	} else {
+		log.Printf("drained %d in-flight requests", drained)
+	}
+
+	closeCtx, cancelClose := context.WithTimeout(context.Background(), forceCloseTimeout)
+	defer cancelClose()
+	if err := httpServer.Shutdown(closeCtx); err != nil {
 		log.Printf("shutdown error: %v", err)
+		_ = httpServer.Close()
+	}
+}
+
+// objectStore is the storage surface shared by the MinIO and S3 adapters.
+type objectStore interface {
+	PutObject(ctx context.Context, bucketName, objectName string, reader io.Reader, objectSize int64, opts minio.PutObjectOptions) (minio.UploadInfo, error)
+	GetObject(ctx context.Context, bucketName, objectName string, opts minio.GetObjectOptions) (io.ReadCloser, error)
+	RemoveObject(ctx context.Context, bucketName, objectName string, opts minio.RemoveObjectOptions) error
+	CopyObject(ctx context.Context, bucketName, srcObject, dstObject string) error
+	ListObjects(ctx context.Context, bucketName, prefix string) ([]minio.ObjectInfo, error)
+	server.ObjectStorePinger
+}
+
+// urlSigner produces presigned object URLs.
+type urlSigner interface {
+	PresignedGetObject(ctx context.Context, bucketName, objectName string, expires time.Duration, reqParams url.Values) (*url.URL, error)
+	PresignedPutObject(ctx context.Context, bucketName, objectName string, expires time.Duration) (*url.URL, error)
+}
+
+type objectBackend struct {
+	store  objectStore
+	signer urlSigner
+	bucket string
+	// ensure creates tenant buckets on first use; nil when the provider's buckets are managed
+	// outside GoDrive.
+	ensure storage.EnsureFunc
+	// uploadRetry resends uploads that failed transiently; the store cannot replay a streamed
+	// upload itself.
+	uploadRetry file.RetryPolicy
+}
+
+// newObjectBackend connects to the configured storage provider. MinIO remains the default.
+func newObjectBackend(ctx context.Context, cfg config.Config) (objectBackend, error) {
+	if cfg.Storage.Provider == config.StorageProviderS3 {
+		client, err := storage.NewS3Client(ctx, cfg.S3)
+		if err != nil {
+			return objectBackend{}, fmt.Errorf("connect s3: %w", err)
+		}
+		store := file.NewS3Store(client, cfg.S3.Bucket)
+		return objectBackend{store: store, signer: store, bucket: cfg.S3.Bucket}, nil
+	}
+
+	client, err := storage.NewMinIOClient(cfg.MinIO)
+	if err != nil {
+		return objectBackend{}, fmt.Errorf("connect minio: %w", err)
+	}
+	if err := storage.EnsureBucket(ctx, client, cfg.MinIO.Bucket, cfg.MinIO.Region); err != nil {
+		return objectBackend{}, fmt.Errorf("ensure bucket: %w", err)
+	}
+	if len(cfg.MinIO.CORSAllowedOrigins) > 0 {
+		corsClient, err := storage.NewMinIOCORSClient(client, cfg.MinIO)
+		if err != nil {
+			return objectBackend{}, err
+		}
+		if err := storage.EnsureBucketCORS(ctx, corsClient, cfg.MinIO.Bucket, cfg.MinIO.CORSAllowedOrigins); err != nil {
+			return objectBackend{}, fmt.Errorf("configure bucket cors: %w", err)
+		}
+	}
+	store := file.NewMinIOStore(client)
+	retry := file.RetryPolicy{Attempts: cfg.MinIO.RetryAttempts, Backoff: cfg.MinIO.RetryBackoff}
+	store.SetRetryPolicy(retry)
+	ensure := func(ctx context.Context, bucket string) error {
+		return storage.EnsureBucket(ctx, client, bucket, cfg.MinIO.Region)
 	}
+	return objectBackend{store: store, signer: client, bucket: cfg.MinIO.Bucket, ensure: ensure, uploadRetry: retry}, nil
 }
@@ -46,7 +46,7 @@ func main() {
 		logg.Fatal("connect minio", zap.Error(err))
 	}
 
-	if err := storage.EnsureBucket(ctx, minioClient, cfg.MinIO.Bucket); err != nil {
+	if err := storage.EnsureBucket(ctx, minioClient, cfg.MinIO.Bucket, cfg.MinIO.Region); err != nil {
 		logg.Fatal("ensure bucket", zap.Error(err))
 	}
 
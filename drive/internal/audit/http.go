@@ -0,0 +1,108 @@
+package audit
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/abduss/godrive/internal/auth"
+	"github.com/abduss/godrive/internal/pagination"
+	"github.com/gin-gonic/gin"
+)
+
+// RegisterRoutes mounts the caller's audit trail under the provided authenticated group.
+func RegisterRoutes(group *gin.RouterGroup, service *Service) {
+	handler := &httpHandler{service: service}
+	group.GET("/me/audit", handler.listOwn)
+	group.GET("/me/activity", handler.listActivity)
+}
+
+// RegisterAdminRoutes mounts the audit trail across all users under /admin; RequireAdmin is
+// applied here.
+func RegisterAdminRoutes(group *gin.RouterGroup, service *Service) {
+	handler := &httpHandler{service: service}
+	admin := group.Group("/admin", auth.RequireAdmin())
+	admin.GET("/audit", handler.listAll)
+}
+
+type httpHandler struct {
+	service *Service
+}
+
+func (h *httpHandler) listOwn(c *gin.Context) {
+	userID, _, ok := auth.RequireUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	page, err := pagination.Parse(c.Request.URL.Query())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	entries, err := h.service.ListForUser(c.Request.Context(), userID, ListOptions{Limit: page.FetchLimit(), Offset: page.Offset})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list audit log"})
+		return
+	}
+	c.JSON(http.StatusOK, pagination.NewPage(entries, page))
+}
+
+// listActivity serves the caller's recent activity, newest first. Pages are keyed by
+// (occurred_at, id): pass the response's next_cursor as ?cursor= to continue.
+func (h *httpHandler) listActivity(c *gin.Context) {
+	userID, _, ok := auth.RequireUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	query := c.Request.URL.Query()
+	limit, err := pagination.ParseLimit(query)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var after *pagination.Keyset
+	if raw := strings.TrimSpace(query.Get("cursor")); raw != "" {
+		key, err := pagination.DecodeKeyset(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		after = &key
+	}
+
+	events, err := h.service.Activity(c.Request.Context(), userID, after, limit+1)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list activity"})
+		return
+	}
+
+	page := pagination.Page[Activity]{Items: events}
+	if page.Items == nil {
+		page.Items = []Activity{}
+	}
+	if len(events) > limit {
+		last := events[limit-1]
+		page.Items = events[:limit]
+		page.NextCursor = pagination.EncodeKeyset(pagination.Keyset{CreatedAt: last.OccurredAt, ID: last.ID})
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+func (h *httpHandler) listAll(c *gin.Context) {
+	page, err := pagination.Parse(c.Request.URL.Query())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	entries, err := h.service.ListAll(c.Request.Context(), ListOptions{Limit: page.FetchLimit(), Offset: page.Offset})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list audit log"})
+		return
+	}
+	c.JSON(http.StatusOK, pagination.NewPage(entries, page))
+}
@@ -0,0 +1,56 @@
+package audit
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Actions recorded in the audit log.
+const (
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionDelete = "delete"
+)
+
+// Resource types recorded in the audit log.
+const (
+	ResourceBucket = "bucket"
+	ResourceFile   = "file"
+)
+
+// Entry is a single audited operation.
+type Entry struct {
+	ID           uuid.UUID      `json:"id"`
+	UserID       uuid.UUID      `json:"user_id"`
+	Action       string         `json:"action"`
+	ResourceType string         `json:"resource_type"`
+	ResourceID   uuid.UUID      `json:"resource_id"`
+	Metadata     map[string]any `json:"metadata,omitempty"`
+	CreatedAt    time.Time      `json:"created_at"`
+}
+
+// ListOptions windows an audit listing; newest entries come first.
+type ListOptions struct {
+	Limit  int
+	Offset int
+}
+
+// Activity types reported in a user's activity feed. Other audited actions appear under their
+// action name.
+const (
+	ActivityUpload   = "upload"
+	ActivityDownload = "download"
+	ActivityShare    = "share"
+)
+
+// Activity is one event in a user's recent activity feed. Downloads are those made through
+// presigned URLs, and shares are read from the share links themselves.
+type Activity struct {
+	ID           uuid.UUID      `json:"id"`
+	Type         string         `json:"type"`
+	ResourceType string         `json:"resource_type"`
+	ResourceID   uuid.UUID      `json:"resource_id"`
+	Metadata     map[string]any `json:"metadata,omitempty"`
+	OccurredAt   time.Time      `json:"occurred_at"`
+}
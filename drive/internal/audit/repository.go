@@ -0,0 +1,151 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/abduss/godrive/internal/pagination"
+	"github.com/abduss/godrive/internal/storage"
+	"github.com/google/uuid"
+)
+
+// Repository persists audit entries.
+type Repository struct {
+	db       storage.Querier
+	timeouts storage.QueryTimeouts
+}
+
+// NewRepository builds a new audit repository.
+func NewRepository(db storage.Querier, timeouts storage.QueryTimeouts) *Repository {
+	return &Repository{db: db, timeouts: timeouts.WithDefaults()}
+}
+
+// Insert stores a single audit entry.
+func (r *Repository) Insert(ctx context.Context, entry Entry) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	query := `
+INSERT INTO audit_log (id, user_id, action, resource_type, resource_id, metadata, created_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7);`
+
+	if _, err := r.db.Exec(ctx, query,
+		entry.ID,
+		entry.UserID,
+		entry.Action,
+		entry.ResourceType,
+		entry.ResourceID,
+		entry.Metadata,
+		entry.CreatedAt,
+	); err != nil {
+		return fmt.Errorf("insert audit entry: %w", err)
+	}
+	return nil
+}
+
+// ListByUser returns the entries recorded for one user's actions.
+func (r *Repository) ListByUser(ctx context.Context, userID uuid.UUID, opts ListOptions) ([]Entry, error) {
+	query := `
+SELECT id, user_id, action, resource_type, resource_id, metadata, created_at
+FROM audit_log
+WHERE user_id = $1
+ORDER BY created_at DESC, id DESC
+LIMIT $2 OFFSET $3;`
+	return r.list(ctx, query, userID, opts.Limit, opts.Offset)
+}
+
+// ListAll returns entries across every user.
+func (r *Repository) ListAll(ctx context.Context, opts ListOptions) ([]Entry, error) {
+	query := `
+SELECT id, user_id, action, resource_type, resource_id, metadata, created_at
+FROM audit_log
+ORDER BY created_at DESC, id DESC
+LIMIT $1 OFFSET $2;`
+	return r.list(ctx, query, opts.Limit, opts.Offset)
+}
+
+// Activity merges the user's audit entries, presigned downloads, and created shares, newest
+// first, continuing after the event identified by after when set. Events are ordered by
+// (occurred_at, id), so events sharing a timestamp are neither skipped nor repeated across pages.
+func (r *Repository) Activity(ctx context.Context, userID uuid.UUID, after *pagination.Keyset, limit int) ([]Activity, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.List)
+	defer cancel()
+
+	query := `
+SELECT id, type, resource_type, resource_id, metadata, occurred_at
+FROM (
+    SELECT id, CASE WHEN resource_type = 'file' AND action = 'create' THEN 'upload' ELSE action END AS type,
+           resource_type, resource_id, metadata, created_at AS occurred_at
+    FROM audit_log
+    WHERE user_id = $1 AND ($2::timestamptz IS NULL OR (created_at, id) < ($2, $3))
+    UNION ALL
+    SELECT id, 'download', 'file', file_id, NULL, created_at
+    FROM presign_audit
+    WHERE owner_id = $1 AND method = 'GET' AND ($2::timestamptz IS NULL OR (created_at, id) < ($2, $3))
+    UNION ALL
+    SELECT id, 'share', 'file', file_id, NULL, created_at
+    FROM file_shares
+    WHERE owner_id = $1 AND ($2::timestamptz IS NULL OR (created_at, id) < ($2, $3))
+) activity
+ORDER BY occurred_at DESC, id DESC
+LIMIT $4;`
+
+	var (
+		afterOccurred *time.Time
+		afterID       uuid.UUID
+	)
+	if after != nil {
+		afterOccurred, afterID = &after.CreatedAt, after.ID
+	}
+	rows, err := r.db.Query(ctx, query, userID, afterOccurred, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("list activity: %w", err)
+	}
+	defer rows.Close()
+
+	var events []Activity
+	for rows.Next() {
+		var event Activity
+		if err := rows.Scan(&event.ID, &event.Type, &event.ResourceType, &event.ResourceID, &event.Metadata, &event.OccurredAt); err != nil {
+			return nil, fmt.Errorf("scan activity: %w", err)
+		}
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate activity: %w", err)
+	}
+	return events, nil
+}
+
+func (r *Repository) list(ctx context.Context, query string, args ...any) ([]Entry, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.List)
+	defer cancel()
+
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list audit entries: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []Entry
+	for rows.Next() {
+		var entry Entry
+		if err := rows.Scan(
+			&entry.ID,
+			&entry.UserID,
+			&entry.Action,
+			&entry.ResourceType,
+			&entry.ResourceID,
+			&entry.Metadata,
+			&entry.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("scan audit entry: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate audit entries: %w", err)
+	}
+	return entries, nil
+}
@@ -0,0 +1,119 @@
+package audit
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/abduss/godrive/internal/pagination"
+	"github.com/abduss/godrive/internal/storage"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// testPool connects to the database named by GODRIVE_TEST_DATABASE_URL, which must
+// already be migrated. Repository tests are skipped when it is unset.
+func testPool(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+	dsn := os.Getenv("GODRIVE_TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("GODRIVE_TEST_DATABASE_URL not set")
+	}
+	pool, err := pgxpool.New(context.Background(), dsn)
+	if err != nil {
+		t.Fatalf("connect test database: %v", err)
+	}
+	t.Cleanup(pool.Close)
+	return pool
+}
+
+func TestRepositoryActivityIsNewestFirstAndScopedToUser(t *testing.T) {
+	pool := testPool(t)
+	repo := NewRepository(pool, storage.QueryTimeouts{})
+	ctx := context.Background()
+
+	seedUser := func() uuid.UUID {
+		t.Helper()
+		var id uuid.UUID
+		if err := pool.QueryRow(ctx, `INSERT INTO users (email, password_hash) VALUES ($1, 'x') RETURNING id;`,
+			"activity-"+uuid.NewString()+"@example.com").Scan(&id); err != nil {
+			t.Fatalf("seed user: %v", err)
+		}
+		t.Cleanup(func() { _, _ = pool.Exec(context.Background(), `DELETE FROM users WHERE id = $1;`, id) })
+		return id
+	}
+	userID, otherID := seedUser(), seedUser()
+
+	var bucketID, fileID uuid.UUID
+	if err := pool.QueryRow(ctx, `INSERT INTO buckets (owner_id, name) VALUES ($1, 'activity') RETURNING id;`, userID).Scan(&bucketID); err != nil {
+		t.Fatalf("seed bucket: %v", err)
+	}
+	if err := pool.QueryRow(ctx, `
+INSERT INTO files (bucket_id, object_name, original_filename, size_bytes, content_type)
+VALUES ($1, $2, 'report.pdf', 10, 'application/pdf') RETURNING id;`, bucketID, bucketID.String()+"/report").Scan(&fileID); err != nil {
+		t.Fatalf("seed file: %v", err)
+	}
+
+	base := time.Now().UTC().Add(-time.Hour).Truncate(time.Microsecond)
+	at := func(minutes int) time.Time { return base.Add(time.Duration(minutes) * time.Minute) }
+	for _, entry := range []Entry{
+		{ID: uuid.New(), UserID: userID, Action: ActionCreate, ResourceType: ResourceFile, ResourceID: fileID, CreatedAt: at(0)},
+		{ID: uuid.New(), UserID: userID, Action: ActionDelete, ResourceType: ResourceFile, ResourceID: uuid.New(), CreatedAt: at(30)},
+		{ID: uuid.New(), UserID: userID, Action: ActionDelete, ResourceType: ResourceFile, ResourceID: uuid.New(), CreatedAt: at(30)},
+		{ID: uuid.New(), UserID: otherID, Action: ActionCreate, ResourceType: ResourceFile, ResourceID: uuid.New(), CreatedAt: at(40)},
+	} {
+		if err := repo.Insert(ctx, entry); err != nil {
+			t.Fatalf("insert audit entry: %v", err)
+		}
+	}
+	if _, err := pool.Exec(ctx, `
+INSERT INTO presign_audit (owner_id, bucket_id, file_id, method, expires_at, created_at)
+VALUES ($1, $2, $3, 'GET', $4, $4), ($1, $2, $3, 'PUT', $5, $5);`, userID, bucketID, fileID, at(20), at(25)); err != nil {
+		t.Fatalf("seed presign audit: %v", err)
+	}
+	if _, err := pool.Exec(ctx, `
+INSERT INTO file_shares (owner_id, bucket_id, file_id, token_hash, expires_at, created_at)
+VALUES ($1, $2, $3, $4, $5, $5);`, userID, bucketID, fileID, uuid.NewString(), at(10)); err != nil {
+		t.Fatalf("seed share: %v", err)
+	}
+
+	events, err := repo.Activity(ctx, userID, nil, 10)
+	if err != nil {
+		t.Fatalf("Activity returned error: %v", err)
+	}
+	want := []string{"delete", "delete", ActivityDownload, ActivityShare, ActivityUpload}
+	if len(events) != len(want) {
+		t.Fatalf("expected %d events, got %+v", len(want), events)
+	}
+	for i, event := range events {
+		if event.Type != want[i] {
+			t.Fatalf("event %d: expected %s, got %s", i, want[i], event.Type)
+		}
+		if i > 0 && event.OccurredAt.After(events[i-1].OccurredAt) {
+			t.Fatalf("expected reverse-chronological order, got %v after %v", event.OccurredAt, events[i-1].OccurredAt)
+		}
+	}
+
+	// The two deletes share a timestamp; paging one event at a time must still visit both.
+	var paged []Activity
+	var after *pagination.Keyset
+	for range want {
+		page, err := repo.Activity(ctx, userID, after, 1)
+		if err != nil {
+			t.Fatalf("Activity returned error: %v", err)
+		}
+		if len(page) != 1 {
+			t.Fatalf("expected one event per page, got %+v", page)
+		}
+		paged = append(paged, page[0])
+		after = &pagination.Keyset{CreatedAt: page[0].OccurredAt, ID: page[0].ID}
+	}
+	if !reflect.DeepEqual(paged, events) {
+		t.Fatalf("expected paging to visit every event once in order, got %+v, want %+v", paged, events)
+	}
+	if rest, err := repo.Activity(ctx, userID, after, 1); err != nil || len(rest) != 0 {
+		t.Fatalf("expected nothing after the oldest event, got %+v, %v", rest, err)
+	}
+}
@@ -0,0 +1,135 @@
+package audit
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/abduss/godrive/internal/pagination"
+	"github.com/google/uuid"
+)
+
+const defaultQueueSize = 256
+
+// defaultOverflowWait is how long Record waits for room in a full queue before dropping the entry.
+const defaultOverflowWait = 50 * time.Millisecond
+
+type store interface {
+	Insert(ctx context.Context, entry Entry) error
+	ListByUser(ctx context.Context, userID uuid.UUID, opts ListOptions) ([]Entry, error)
+	ListAll(ctx context.Context, opts ListOptions) ([]Entry, error)
+	Activity(ctx context.Context, userID uuid.UUID, after *pagination.Keyset, limit int) ([]Activity, error)
+}
+
+// Service records audit entries in the background so auditing never delays the audited
+// operation, and serves audit listings.
+type Service struct {
+	repo         store
+	queue        chan Entry
+	done         chan struct{}
+	mu           sync.RWMutex
+	closed       bool
+	overflowWait time.Duration
+	dropped      atomic.Int64
+	nowFunc      func() time.Time
+}
+
+// NewService constructs an audit service and starts its background writer. Call Close on
+// shutdown to flush queued entries.
+func NewService(repo store) *Service {
+	s := &Service{
+		repo:         repo,
+		queue:        make(chan Entry, defaultQueueSize),
+		done:         make(chan struct{}),
+		overflowWait: defaultOverflowWait,
+		nowFunc:      time.Now,
+	}
+	go s.run()
+	return s
+}
+
+// Record queues an audit entry for userID acting on a resource. It never blocks on the database:
+// entries are written by a background worker. When the queue is full Record waits up to
+// overflowWait for room and then drops the entry, logging it and counting it in Dropped, so a
+// stalled database cannot pile up unbounded work. The request context is not used for the
+// write, since it is usually cancelled by the time the entry is persisted.
+func (s *Service) Record(ctx context.Context, userID uuid.UUID, action, resourceType string, resourceID uuid.UUID, metadata map[string]any) {
+	entry := Entry{
+		ID:           uuid.New(),
+		UserID:       userID,
+		Action:       action,
+		ResourceType: resourceType,
+		ResourceID:   resourceID,
+		Metadata:     metadata,
+		CreatedAt:    s.nowFunc().UTC(),
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		s.write(entry)
+		return
+	}
+
+	select {
+	case s.queue <- entry:
+		return
+	default:
+	}
+
+	timer := time.NewTimer(s.overflowWait)
+	defer timer.Stop()
+	select {
+	case s.queue <- entry:
+	case <-timer.C:
+		dropped := s.dropped.Add(1)
+		log.Printf("audit: queue full, dropped %s %s %s (%d dropped so far)", entry.Action, entry.ResourceType, entry.ResourceID, dropped)
+	}
+}
+
+// Dropped reports how many entries Record has dropped because the queue stayed full.
+func (s *Service) Dropped() int64 {
+	return s.dropped.Load()
+}
+
+// Close stops accepting queued entries and waits for queued writes to finish.
+func (s *Service) Close() {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.queue)
+	}
+	s.mu.Unlock()
+	<-s.done
+}
+
+// ListForUser returns the audit trail of the user's own actions.
+func (s *Service) ListForUser(ctx context.Context, userID uuid.UUID, opts ListOptions) ([]Entry, error) {
+	return s.repo.ListByUser(ctx, userID, opts)
+}
+
+// Activity returns up to limit of the user's events, newest first, continuing after the event
+// identified by after. A nil after starts from the most recent event.
+func (s *Service) Activity(ctx context.Context, userID uuid.UUID, after *pagination.Keyset, limit int) ([]Activity, error) {
+	return s.repo.Activity(ctx, userID, after, limit)
+}
+
+// ListAll returns the audit trail across all users.
+func (s *Service) ListAll(ctx context.Context, opts ListOptions) ([]Entry, error) {
+	return s.repo.ListAll(ctx, opts)
+}
+
+func (s *Service) run() {
+	defer close(s.done)
+	for entry := range s.queue {
+		s.write(entry)
+	}
+}
+
+func (s *Service) write(entry Entry) {
+	if err := s.repo.Insert(context.Background(), entry); err != nil {
+		log.Printf("audit: record %s %s %s: %v", entry.Action, entry.ResourceType, entry.ResourceID, err)
+	}
+}
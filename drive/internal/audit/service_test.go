@@ -0,0 +1,89 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/abduss/godrive/internal/pagination"
+	"github.com/google/uuid"
+)
+
+func TestRecordDropsEntriesOnceTheQueueStaysFull(t *testing.T) {
+	store := &fakeStore{release: make(chan struct{})}
+	service := NewService(store)
+	service.overflowWait = time.Millisecond
+
+	userID := uuid.New()
+	total := defaultQueueSize + 5
+	start := time.Now()
+	for i := 0; i < total; i++ {
+		service.Record(context.Background(), userID, ActionCreate, ResourceFile, uuid.New(), nil)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("expected Record to stay fast while the store is stuck, took %s", elapsed)
+	}
+
+	close(store.release)
+	service.Close()
+
+	// The worker may hold one entry in Insert, so 4 or 5 entries overflow.
+	written, dropped := store.count(), int(service.Dropped())
+	if written+dropped != total || dropped < 4 || dropped > 5 {
+		t.Fatalf("expected the overflow dropped and the rest written, got %d written and %d dropped", written, dropped)
+	}
+}
+
+func TestRecordAfterCloseStillWrites(t *testing.T) {
+	store := &fakeStore{}
+	service := NewService(store)
+	service.Close()
+
+	store.err = errors.New("insert failed")
+	service.Record(context.Background(), uuid.New(), ActionDelete, ResourceBucket, uuid.New(), nil)
+	if store.attempts != 1 {
+		t.Fatalf("expected a synchronous write attempt after close, got %d", store.attempts)
+	}
+}
+
+type fakeStore struct {
+	mu       sync.Mutex
+	release  chan struct{}
+	entries  []Entry
+	attempts int
+	err      error
+}
+
+func (f *fakeStore) Insert(ctx context.Context, entry Entry) error {
+	if f.release != nil {
+		<-f.release
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.attempts++
+	if f.err != nil {
+		return f.err
+	}
+	f.entries = append(f.entries, entry)
+	return nil
+}
+
+func (f *fakeStore) count() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.entries)
+}
+
+func (f *fakeStore) ListByUser(ctx context.Context, userID uuid.UUID, opts ListOptions) ([]Entry, error) {
+	return nil, nil
+}
+
+func (f *fakeStore) ListAll(ctx context.Context, opts ListOptions) ([]Entry, error) {
+	return nil, nil
+}
+
+func (f *fakeStore) Activity(ctx context.Context, userID uuid.UUID, after *pagination.Keyset, limit int) ([]Activity, error) {
+	return nil, nil
+}
@@ -11,4 +11,10 @@ var (
 	ErrUserNotFound = errors.New("user not found")
 	// ErrUnauthorized represents missing or invalid authentication tokens.
 	ErrUnauthorized = errors.New("unauthorized")
+	// ErrSessionNotFound indicates the session does not exist or belongs to another user.
+	ErrSessionNotFound = errors.New("session not found")
+	// ErrRegistrationClosed is returned when open registration is disabled and no invite is given.
+	ErrRegistrationClosed = errors.New("registration is closed")
+	// ErrInvalidInvite indicates an invite token that is unknown, expired, or already used.
+	ErrInvalidInvite = errors.New("invalid invite")
 )
@@ -2,9 +2,15 @@ package auth
 
 import (
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
 
+	"github.com/abduss/godrive/internal/bind"
+	"github.com/abduss/godrive/internal/pagination"
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 )
 
 // RegisterRoutes mounts authentication endpoints under /auth.
@@ -17,19 +23,43 @@ func RegisterRoutes(router *gin.RouterGroup, service *Service) {
 	}
 }
 
+// RegisterSessionRoutes mounts session management endpoints; the group must be authenticated.
+func RegisterSessionRoutes(router *gin.RouterGroup, service *Service) {
+	handler := &httpHandler{service: service}
+	router.GET("/me/sessions", handler.listSessions)
+	router.DELETE("/me/sessions/:id", handler.revokeSession)
+}
+
+// RegisterAdminRoutes mounts administrative user, session and invite endpoints under /admin; the group must be
+// authenticated and RequireAdmin is applied here.
+func RegisterAdminRoutes(router *gin.RouterGroup, service *Service) {
+	handler := &httpHandler{service: service}
+	admin := router.Group("/admin", RequireAdmin())
+	admin.GET("/users", handler.adminListUsers)
+	admin.GET("/users/:id/sessions", handler.adminListSessions)
+	admin.DELETE("/users/:id/sessions", handler.adminRevokeSessions)
+	admin.POST("/invites", handler.adminCreateInvite)
+}
+
+// maxUserAgentLength caps the stored user agent so clients cannot bloat the sessions table.
+const maxUserAgentLength = 256
+
 type httpHandler struct {
 	service *Service
 }
 
+// Passwords are bound by maxPasswordLength here; Register also applies the active hasher's
+// limit.
 type registerRequest struct {
 	Email       string  `json:"email" binding:"required,email"`
-	Password    string  `json:"password" binding:"required,min=8,max=72"`
+	Password    string  `json:"password" binding:"required,min=8,max=1024"`
 	DisplayName *string `json:"display_name" binding:"omitempty,max=128"`
+	InviteToken string  `json:"invite_token" binding:"omitempty,max=128"`
 }
 
 type loginRequest struct {
 	Email    string `json:"email" binding:"required,email"`
-	Password string `json:"password" binding:"required,min=8,max=72"`
+	Password string `json:"password" binding:"required,min=8,max=1024"`
 }
 
 type authResponse struct {
@@ -50,8 +80,7 @@ type authResponse struct {
 
 func (h *httpHandler) register(c *gin.Context) {
 	var req registerRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bind.JSON(c, &req) {
 		return
 	}
 
@@ -59,9 +88,15 @@ func (h *httpHandler) register(c *gin.Context) {
 		Email:       req.Email,
 		Password:    req.Password,
 		DisplayName: req.DisplayName,
+		InviteToken: req.InviteToken,
+		Client:      clientInfo(c),
 	})
 	if err != nil {
 		switch err {
+		case ErrRegistrationClosed:
+			c.JSON(http.StatusForbidden, gin.H{"error": "registration requires an invite"})
+		case ErrInvalidInvite:
+			c.JSON(http.StatusForbidden, gin.H{"error": "invite is invalid, expired, or already used"})
 		case ErrEmailAlreadyExists:
 			c.JSON(http.StatusConflict, gin.H{"error": "email already registered"})
 		case ErrInvalidCredentials:
@@ -81,14 +116,14 @@ func (h *httpHandler) register(c *gin.Context) {
 
 func (h *httpHandler) login(c *gin.Context) {
 	var req loginRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bind.JSON(c, &req) {
 		return
 	}
 
 	result, err := h.service.Login(c.Request.Context(), LoginInput{
 		Email:    req.Email,
 		Password: req.Password,
+		Client:   clientInfo(c),
 	})
 	if err != nil {
 		switch err {
@@ -107,6 +142,190 @@ func (h *httpHandler) login(c *gin.Context) {
 	c.JSON(http.StatusOK, marshalAuthResponse(result))
 }
 
+func (h *httpHandler) listSessions(c *gin.Context) {
+	userID, _, ok := RequireUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	sessions, err := h.service.ListSessions(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list sessions"})
+		return
+	}
+	if sessions == nil {
+		sessions = []Session{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"sessions": sessions})
+}
+
+func (h *httpHandler) revokeSession(c *gin.Context) {
+	userID, _, ok := RequireUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	sessionID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid session id"})
+		return
+	}
+
+	if err := h.service.RevokeSession(c.Request.Context(), userID, sessionID); err != nil {
+		switch err {
+		case ErrSessionNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke session"})
+		}
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// adminUser is a user as shown in the admin listing.
+type adminUser struct {
+	ID          uuid.UUID `json:"id"`
+	Email       string    `json:"email"`
+	DisplayName *string   `json:"display_name,omitempty"`
+	IsAdmin     bool      `json:"is_admin"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// adminListUsers pages through users newest first. The cursor is a keyset on created_at so
+// pages stay stable while users register; q filters by email substring and admin_only=true
+// keeps administrators.
+func (h *httpHandler) adminListUsers(c *gin.Context) {
+	query := c.Request.URL.Query()
+	limit, err := pagination.ParseLimit(query)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	filter := UserFilter{Query: query.Get("q"), Limit: limit + 1}
+	if raw := strings.TrimSpace(query.Get("cursor")); raw != "" {
+		after, err := pagination.DecodeKeyset(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		filter.After = &after
+	}
+	if raw := query.Get("admin_only"); raw != "" {
+		if filter.AdminOnly, err = strconv.ParseBool(raw); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "admin_only must be a boolean"})
+			return
+		}
+	}
+
+	users, err := h.service.ListUsers(c.Request.Context(), filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list users"})
+		return
+	}
+
+	page := pagination.Page[adminUser]{Items: make([]adminUser, 0, min(len(users), limit))}
+	for i, user := range users {
+		if i == limit {
+			last := users[limit-1]
+			page.NextCursor = pagination.EncodeKeyset(pagination.Keyset{CreatedAt: last.CreatedAt, ID: last.ID})
+			break
+		}
+		page.Items = append(page.Items, adminUser{
+			ID:          user.ID,
+			Email:       user.Email,
+			DisplayName: user.DisplayName,
+			IsAdmin:     user.IsAdmin,
+			CreatedAt:   user.CreatedAt,
+		})
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+func (h *httpHandler) adminListSessions(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+		return
+	}
+
+	sessions, err := h.service.UserSessions(c.Request.Context(), userID)
+	if err != nil {
+		switch err {
+		case ErrUserNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list sessions"})
+		}
+		return
+	}
+	if sessions == nil {
+		sessions = []Session{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"sessions": sessions})
+}
+
+func (h *httpHandler) adminRevokeSessions(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+		return
+	}
+
+	revoked, err := h.service.RevokeAllSessions(c.Request.Context(), userID)
+	if err != nil {
+		switch err {
+		case ErrUserNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke sessions"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"revoked": revoked})
+}
+
+func (h *httpHandler) adminCreateInvite(c *gin.Context) {
+	adminID, _, ok := RequireUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	invite, err := h.service.CreateInvite(c.Request.Context(), adminID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create invite"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, invite)
+}
+
+func clientInfo(c *gin.Context) ClientInfo {
+	return ClientInfo{UserAgent: truncateUserAgent(c.Request.UserAgent()), IPAddress: c.ClientIP()}
+}
+
+// truncateUserAgent drops invalid UTF-8, which Postgres would refuse, and cuts the result to at
+// most maxUserAgentLength bytes without splitting a character.
+func truncateUserAgent(userAgent string) string {
+	userAgent = strings.ToValidUTF8(userAgent, "")
+	if len(userAgent) <= maxUserAgentLength {
+		return userAgent
+	}
+	cut := maxUserAgentLength
+	for cut > 0 && !utf8.RuneStart(userAgent[cut]) {
+		cut--
+	}
+	return userAgent[:cut]
+}
+
 func marshalAuthResponse(result AuthResult) authResponse {
 	resp := authResponse{}
 	resp.User.ID = result.User.ID.String()
@@ -39,7 +39,7 @@ func AuthMiddleware(service *Service) gin.HandlerFunc {
 			return
 		}
 
-		c.Set(string(userContextKey), ContextUser{
+		SetCurrentUser(c, ContextUser{
 			ID:      claims.UserID.String(),
 			Email:   claims.Email,
 			IsAdmin: claims.IsAdmin,
@@ -49,6 +49,28 @@ func AuthMiddleware(service *Service) gin.HandlerFunc {
 	}
 }
 
+// RequireAdmin rejects requests from authenticated users who are not administrators.
+// It must run after AuthMiddleware.
+func RequireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := CurrentUser(c)
+		if !ok {
+			c.AbortWithStatusJSON(401, gin.H{"error": "unauthorized"})
+			return
+		}
+		if !user.IsAdmin {
+			c.AbortWithStatusJSON(403, gin.H{"error": "admin privileges required"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// SetCurrentUser stores the authenticated user in the context.
+func SetCurrentUser(c *gin.Context, user ContextUser) {
+	c.Set(string(userContextKey), user)
+}
+
 // CurrentUser extracts the authenticated user from the context.
 func CurrentUser(c *gin.Context) (ContextUser, bool) {
 	value, exists := c.Get(string(userContextKey))
@@ -3,6 +3,7 @@ package auth
 import (
 	"time"
 
+	"github.com/abduss/godrive/internal/pagination"
 	"github.com/google/uuid"
 )
 
@@ -23,6 +24,16 @@ func (u User) SafeUser() User {
 	return u
 }
 
+// UserFilter selects a page of users for the admin listing.
+type UserFilter struct {
+	// Query, when set, keeps users whose email contains it, ignoring case.
+	Query     string
+	AdminOnly bool
+	// After continues the listing past the last user of the previous page.
+	After *pagination.Keyset
+	Limit int
+}
+
 // TokenPair bundles access and refresh tokens.
 type TokenPair struct {
 	AccessToken        string
@@ -30,3 +41,26 @@ type TokenPair struct {
 	RefreshToken       string
 	RefreshTokenExpiry time.Time
 }
+
+// ClientInfo describes the client that requested a token pair.
+type ClientInfo struct {
+	UserAgent string
+	IPAddress string
+}
+
+// Session is an active refresh token as exposed to its owner.
+type Session struct {
+	ID         uuid.UUID `json:"id"`
+	Identifier string    `json:"identifier"`
+	UserAgent  *string   `json:"user_agent,omitempty"`
+	IPAddress  *string   `json:"ip_address,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// Invite is a freshly minted single-use registration token. Only its hash is stored, so the
+// token is returned to the admin once.
+type Invite struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
@@ -0,0 +1,162 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/abduss/godrive/internal/config"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// HasherBcrypt selects bcrypt password hashing.
+	HasherBcrypt = "bcrypt"
+	// HasherArgon2id selects Argon2id password hashing.
+	HasherArgon2id = "argon2id"
+
+	argon2idPrefix = "$argon2id$"
+	// pepperedMarker flags hashes whose input was HMAC'd with the configured pepper.
+	pepperedMarker  = "$pepper"
+	argon2SaltBytes = 16
+	argon2KeyBytes  = 32
+	// bcryptMaxPasswordLength is the most input bcrypt hashes; it rejects anything longer.
+	bcryptMaxPasswordLength = 72
+)
+
+// passwordHasher hashes and verifies passwords for a single algorithm.
+// Encoded hashes carry an algorithm prefix so several hashers can coexist.
+type passwordHasher interface {
+	Hash(password string) (string, error)
+	Verify(encoded, password string) error
+	Handles(encoded string) bool
+	// MaxPasswordLength is the longest input, in bytes, the algorithm accepts.
+	MaxPasswordLength() int
+}
+
+func newPasswordHasher(cfg config.AuthConfig) passwordHasher {
+	if strings.EqualFold(cfg.PasswordHasher, HasherArgon2id) {
+		return newArgon2idHasher(cfg)
+	}
+	return bcryptHasher{cost: cfg.BcryptCost}
+}
+
+type bcryptHasher struct {
+	cost int
+}
+
+func (h bcryptHasher) Hash(password string) (string, error) {
+	if len(password) > bcryptMaxPasswordLength {
+		return "", fmt.Errorf("password exceeds maximum length of %d characters", bcryptMaxPasswordLength)
+	}
+	bytes, err := bcrypt.GenerateFromPassword([]byte(password), h.cost)
+	if err != nil {
+		return "", err
+	}
+	return string(bytes), nil
+}
+
+func (h bcryptHasher) Verify(encoded, password string) error {
+	if err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password)); err != nil {
+		return ErrInvalidCredentials
+	}
+	return nil
+}
+
+func (h bcryptHasher) Handles(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2")
+}
+
+func (h bcryptHasher) MaxPasswordLength() int {
+	return bcryptMaxPasswordLength
+}
+
+type argon2idHasher struct {
+	memory      uint32
+	time        uint32
+	parallelism uint8
+}
+
+func newArgon2idHasher(cfg config.AuthConfig) argon2idHasher {
+	h := argon2idHasher{memory: 64 * 1024, time: 3, parallelism: 2}
+	if cfg.Argon2Memory > 0 {
+		h.memory = uint32(cfg.Argon2Memory)
+	}
+	if cfg.Argon2Time > 0 {
+		h.time = uint32(cfg.Argon2Time)
+	}
+	if cfg.Argon2Parallelism > 0 && cfg.Argon2Parallelism <= 255 {
+		h.parallelism = uint8(cfg.Argon2Parallelism)
+	}
+	return h
+}
+
+func (h argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, argon2SaltBytes)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, h.time, h.memory, h.parallelism, argon2KeyBytes)
+
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2idPrefix, argon2.Version, h.memory, h.time, h.parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (h argon2idHasher) Verify(encoded, password string) error {
+	// $argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 {
+		return ErrInvalidCredentials
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return ErrInvalidCredentials
+	}
+
+	var memory, time uint32
+	var parallelism uint8
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &parallelism); err != nil {
+		return ErrInvalidCredentials
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return ErrInvalidCredentials
+	}
+	expected, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return ErrInvalidCredentials
+	}
+
+	actual := argon2.IDKey([]byte(password), salt, time, memory, parallelism, uint32(len(expected)))
+	if subtle.ConstantTimeCompare(actual, expected) != 1 {
+		return ErrInvalidCredentials
+	}
+	return nil
+}
+
+func (h argon2idHasher) Handles(encoded string) bool {
+	return strings.HasPrefix(encoded, argon2idPrefix)
+}
+
+// MaxPasswordLength is the common cap: Argon2id has no input limit of its own.
+func (h argon2idHasher) MaxPasswordLength() int {
+	return maxPasswordLength
+}
+
+// pepperPassword mixes the server-held pepper into the password. The base64 form
+// keeps the input well under bcrypt's 72-byte limit.
+func pepperPassword(password, pepper string) string {
+	mac := hmac.New(sha256.New, []byte(pepper))
+	mac.Write([]byte(password))
+	return base64.RawStdEncoding.EncodeToString(mac.Sum(nil))
+}
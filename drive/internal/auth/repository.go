@@ -6,35 +6,38 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/abduss/godrive/internal/storage"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
-	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-const defaultQueryTimeout = 5 * time.Second
-
 // Repository provides database access for authentication concerns.
 type Repository struct {
-	pool *pgxpool.Pool
+	db       storage.Querier
+	timeouts storage.QueryTimeouts
 }
 
 // NewRepository constructs a new Repository.
-func NewRepository(pool *pgxpool.Pool) *Repository {
-	return &Repository{pool: pool}
+func NewRepository(db storage.Querier, timeouts storage.QueryTimeouts) *Repository {
+	return &Repository{db: db, timeouts: timeouts.WithDefaults()}
 }
 
+const createUserQuery = `
+INSERT INTO users (email, password_hash, display_name)
+VALUES ($1, $2, $3)
+RETURNING id, email, password_hash, display_name, is_admin, created_at, updated_at;`
+
 // CreateUser persists a new user record.
 func (r *Repository) CreateUser(ctx context.Context, email, passwordHash string, displayName *string) (User, error) {
-	ctx, cancel := context.WithTimeout(ctx, defaultQueryTimeout)
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Write)
 	defer cancel()
 
-	query := `
-INSERT INTO users (email, password_hash, display_name)
-VALUES ($1, $2, $3)
-RETURNING id, email, password_hash, display_name, is_admin, created_at, updated_at;`
+	return insertUser(ctx, r.db, email, passwordHash, displayName)
+}
 
-	row := r.pool.QueryRow(ctx, query, email, passwordHash, displayName)
+func insertUser(ctx context.Context, db storage.Querier, email, passwordHash string, displayName *string) (User, error) {
+	row := db.QueryRow(ctx, createUserQuery, email, passwordHash, displayName)
 
 	var user User
 	if err := row.Scan(&user.ID, &user.Email, &user.PasswordHash, &user.DisplayName, &user.IsAdmin, &user.CreatedAt, &user.UpdatedAt); err != nil {
@@ -47,9 +50,64 @@ RETURNING id, email, password_hash, display_name, is_admin, created_at, updated_
 	return user, nil
 }
 
+// CreateInvite stores the hash of a registration invite minted by createdBy.
+func (r *Repository) CreateInvite(ctx context.Context, tokenHash string, createdBy uuid.UUID, expiresAt time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	query := `
+INSERT INTO invites (token_hash, created_by, expires_at)
+VALUES ($1, $2, $3);`
+
+	if _, err := r.db.Exec(ctx, query, tokenHash, createdBy, expiresAt); err != nil {
+		return fmt.Errorf("create invite: %w", err)
+	}
+	return nil
+}
+
+// CreateUserWithInvite redeems the invite and creates the user in one transaction. The invite
+// row is locked by the claiming update, so concurrent redemptions cannot both succeed, and a
+// failed user insert leaves the invite unused.
+func (r *Repository) CreateUserWithInvite(ctx context.Context, email, passwordHash string, displayName *string, inviteHash string) (User, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	claim := `
+UPDATE invites
+SET used_at = NOW()
+WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+RETURNING id;`
+
+	var user User
+	err := storage.WithinTx(ctx, r.db, func(tx pgx.Tx) error {
+		var inviteID uuid.UUID
+		if err := tx.QueryRow(ctx, claim, inviteHash).Scan(&inviteID); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return ErrInvalidInvite
+			}
+			return fmt.Errorf("claim invite: %w", err)
+		}
+
+		var err error
+		user, err = insertUser(ctx, tx, email, passwordHash, displayName)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(ctx, `UPDATE invites SET used_by = $2 WHERE id = $1;`, inviteID, user.ID); err != nil {
+			return fmt.Errorf("record invite use: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return User{}, err
+	}
+	return user, nil
+}
+
 // FindUserByEmail fetches a user by email.
 func (r *Repository) FindUserByEmail(ctx context.Context, email string) (User, error) {
-	ctx, cancel := context.WithTimeout(ctx, defaultQueryTimeout)
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Lookup)
 	defer cancel()
 
 	query := `
@@ -58,7 +116,7 @@ FROM users
 WHERE email = $1;`
 
 	var user User
-	err := r.pool.QueryRow(ctx, query, email).Scan(
+	err := r.db.QueryRow(ctx, query, email).Scan(
 		&user.ID,
 		&user.Email,
 		&user.PasswordHash,
@@ -77,18 +135,120 @@ WHERE email = $1;`
 	return user, nil
 }
 
-// StoreRefreshToken saves or updates a refresh token hash for the user.
-func (r *Repository) StoreRefreshToken(ctx context.Context, userID uuid.UUID, tokenHash string, expiresAt time.Time) error {
-	ctx, cancel := context.WithTimeout(ctx, defaultQueryTimeout)
+// FindUserByID fetches a user by identifier.
+func (r *Repository) FindUserByID(ctx context.Context, userID uuid.UUID) (User, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Lookup)
 	defer cancel()
 
 	query := `
-INSERT INTO refresh_tokens (user_id, token_hash, expires_at, revoked_at)
-VALUES ($1, $2, $3, NULL)
+SELECT id, email, password_hash, display_name, is_admin, created_at, updated_at
+FROM users
+WHERE id = $1;`
+
+	var user User
+	err := r.db.QueryRow(ctx, query, userID).Scan(
+		&user.ID,
+		&user.Email,
+		&user.PasswordHash,
+		&user.DisplayName,
+		&user.IsAdmin,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return User{}, ErrUserNotFound
+		}
+		return User{}, fmt.Errorf("find user by id: %w", err)
+	}
+
+	return user, nil
+}
+
+// ListUsersPaged returns up to filter.Limit users, newest first, continuing after filter.After
+// when set. Query matches a case-insensitive substring of the email.
+func (r *Repository) ListUsersPaged(ctx context.Context, filter UserFilter) ([]User, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.List)
+	defer cancel()
+
+	query := `
+SELECT id, email, password_hash, display_name, is_admin, created_at, updated_at
+FROM users
+WHERE ($1 = '' OR strpos(lower(email), lower($1)) > 0)
+  AND (NOT $2 OR is_admin)
+  AND ($3::timestamptz IS NULL OR (created_at, id) < ($3, $4))
+ORDER BY created_at DESC, id DESC
+LIMIT $5;`
+
+	var (
+		afterCreated *time.Time
+		afterID      uuid.UUID
+	)
+	if filter.After != nil {
+		afterCreated, afterID = &filter.After.CreatedAt, filter.After.ID
+	}
+
+	rows, err := r.db.Query(ctx, query, filter.Query, filter.AdminOnly, afterCreated, afterID, filter.Limit)
+	if err != nil {
+		return nil, fmt.Errorf("list users: %w", err)
+	}
+	defer rows.Close()
+
+	var users []User
+	for rows.Next() {
+		var user User
+		if err := rows.Scan(
+			&user.ID,
+			&user.Email,
+			&user.PasswordHash,
+			&user.DisplayName,
+			&user.IsAdmin,
+			&user.CreatedAt,
+			&user.UpdatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("scan user: %w", err)
+		}
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate users: %w", err)
+	}
+	return users, nil
+}
+
+// UpdatePasswordHash replaces the stored password hash for the user.
+func (r *Repository) UpdatePasswordHash(ctx context.Context, userID uuid.UUID, passwordHash string) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	query := `
+UPDATE users
+SET password_hash = $2, updated_at = NOW()
+WHERE id = $1;`
+
+	tag, err := r.db.Exec(ctx, query, userID, passwordHash)
+	if err != nil {
+		return fmt.Errorf("update password hash: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// StoreRefreshToken saves or updates a refresh token hash for the user along with client metadata.
+func (r *Repository) StoreRefreshToken(ctx context.Context, userID uuid.UUID, tokenHash string, expiresAt time.Time, client ClientInfo) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	query := `
+INSERT INTO refresh_tokens (user_id, token_hash, expires_at, revoked_at, user_agent, ip_address)
+VALUES ($1, $2, $3, NULL, NULLIF($4, ''), NULLIF($5, ''))
 ON CONFLICT (user_id, token_hash)
-DO UPDATE SET expires_at = EXCLUDED.expires_at, revoked_at = NULL, created_at = NOW();`
+DO UPDATE SET expires_at = EXCLUDED.expires_at, revoked_at = NULL, created_at = NOW(),
+              user_agent = EXCLUDED.user_agent, ip_address = EXCLUDED.ip_address;`
 
-	if _, err := r.pool.Exec(ctx, query, userID, tokenHash, expiresAt); err != nil {
+	if _, err := r.db.Exec(ctx, query, userID, tokenHash, expiresAt, client.UserAgent, client.IPAddress); err != nil {
 		return fmt.Errorf("store refresh token: %w", err)
 	}
 
@@ -105,7 +265,7 @@ func isUniqueViolation(err error) bool {
 
 // RevokeToken marks a refresh token as revoked.
 func (r *Repository) RevokeToken(ctx context.Context, userID uuid.UUID, tokenHash string) error {
-	ctx, cancel := context.WithTimeout(ctx, defaultQueryTimeout)
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Write)
 	defer cancel()
 
 	query := `
@@ -113,9 +273,77 @@ UPDATE refresh_tokens
 SET revoked_at = NOW()
 WHERE user_id = $1 AND token_hash = $2;`
 
-	if _, err := r.pool.Exec(ctx, query, userID, tokenHash); err != nil {
+	if _, err := r.db.Exec(ctx, query, userID, tokenHash); err != nil {
 		return fmt.Errorf("revoke token: %w", err)
 	}
 
 	return nil
 }
+
+// RevokeAllTokens revokes every active refresh token of the user and reports how many were revoked.
+func (r *Repository) RevokeAllTokens(ctx context.Context, userID uuid.UUID) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	query := `
+UPDATE refresh_tokens
+SET revoked_at = NOW()
+WHERE user_id = $1 AND revoked_at IS NULL;`
+
+	tag, err := r.db.Exec(ctx, query, userID)
+	if err != nil {
+		return 0, fmt.Errorf("revoke all tokens: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// ListSessions returns the user's refresh tokens that are neither revoked nor expired.
+func (r *Repository) ListSessions(ctx context.Context, userID uuid.UUID) ([]Session, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.List)
+	defer cancel()
+
+	query := `
+SELECT id, LEFT(token_hash, $2), user_agent, ip_address, created_at, expires_at
+FROM refresh_tokens
+WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+ORDER BY created_at DESC;`
+
+	rows, err := r.db.Query(ctx, query, userID, sessionIdentifierLength)
+	if err != nil {
+		return nil, fmt.Errorf("list sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var sessions []Session
+	for rows.Next() {
+		var session Session
+		if err := rows.Scan(&session.ID, &session.Identifier, &session.UserAgent, &session.IPAddress, &session.CreatedAt, &session.ExpiresAt); err != nil {
+			return nil, fmt.Errorf("scan session: %w", err)
+		}
+		sessions = append(sessions, session)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate sessions: %w", err)
+	}
+	return sessions, nil
+}
+
+// RevokeSession revokes a single active refresh token owned by the user.
+func (r *Repository) RevokeSession(ctx context.Context, userID, sessionID uuid.UUID) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	query := `
+UPDATE refresh_tokens
+SET revoked_at = NOW()
+WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL;`
+
+	tag, err := r.db.Exec(ctx, query, sessionID, userID)
+	if err != nil {
+		return fmt.Errorf("revoke session: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abduss/godrive/internal/pagination"
+	"github.com/abduss/godrive/internal/storage"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// testPool connects to the database named by GODRIVE_TEST_DATABASE_URL, which must
+// already be migrated. Repository tests are skipped when it is unset.
+func testPool(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+	dsn := os.Getenv("GODRIVE_TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("GODRIVE_TEST_DATABASE_URL not set")
+	}
+	pool, err := pgxpool.New(context.Background(), dsn)
+	if err != nil {
+		t.Fatalf("connect test database: %v", err)
+	}
+	t.Cleanup(pool.Close)
+	return pool
+}
+
+func TestRepositoryStoreRefreshTokenRecordsClient(t *testing.T) {
+	pool := testPool(t)
+	repo := NewRepository(pool, storage.QueryTimeouts{})
+	ctx := context.Background()
+
+	user, err := repo.CreateUser(ctx, "repo-test-"+uuid.NewString()+"@example.com", "x", nil)
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	t.Cleanup(func() {
+		_, _ = pool.Exec(context.Background(), `DELETE FROM users WHERE id = $1;`, user.ID)
+	})
+
+	client := ClientInfo{UserAgent: "godrive-cli/1.0", IPAddress: "203.0.113.7"}
+	if err := repo.StoreRefreshToken(ctx, user.ID, "0123456789abcdef", time.Now().Add(time.Hour), client); err != nil {
+		t.Fatalf("StoreRefreshToken returned error: %v", err)
+	}
+
+	var userAgent, ipAddress string
+	err = pool.QueryRow(ctx,
+		`SELECT user_agent, ip_address FROM refresh_tokens WHERE user_id = $1;`, user.ID,
+	).Scan(&userAgent, &ipAddress)
+	if err != nil {
+		t.Fatalf("read refresh token: %v", err)
+	}
+	if ipAddress != client.IPAddress || userAgent != client.UserAgent {
+		t.Fatalf("unexpected client metadata: ip=%q ua=%q", ipAddress, userAgent)
+	}
+
+	sessions, err := repo.ListSessions(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("ListSessions returned error: %v", err)
+	}
+	if len(sessions) != 1 || sessions[0].IPAddress == nil || *sessions[0].IPAddress != client.IPAddress {
+		t.Fatalf("expected session to expose captured IP, got %+v", sessions)
+	}
+}
+
+func TestRepositoryListUsersPagedFilters(t *testing.T) {
+	pool := testPool(t)
+	repo := NewRepository(pool, storage.QueryTimeouts{})
+	ctx := context.Background()
+
+	marker := "list-" + uuid.NewString()[:8]
+	var created []User
+	for _, local := range []string{"alice", "bob", "carol"} {
+		user, err := repo.CreateUser(ctx, local+"-"+marker+"@example.com", "x", nil)
+		if err != nil {
+			t.Fatalf("create user: %v", err)
+		}
+		created = append(created, user)
+	}
+	t.Cleanup(func() {
+		for _, user := range created {
+			_, _ = pool.Exec(context.Background(), `DELETE FROM users WHERE id = $1;`, user.ID)
+		}
+	})
+	if _, err := pool.Exec(ctx, `UPDATE users SET is_admin = TRUE WHERE id = $1;`, created[1].ID); err != nil {
+		t.Fatalf("promote user: %v", err)
+	}
+
+	users, err := repo.ListUsersPaged(ctx, UserFilter{Query: strings.ToUpper(marker), Limit: 10})
+	if err != nil {
+		t.Fatalf("ListUsersPaged returned error: %v", err)
+	}
+	if len(users) != len(created) {
+		t.Fatalf("expected the email search to match %d users, got %d", len(created), len(users))
+	}
+
+	admins, err := repo.ListUsersPaged(ctx, UserFilter{Query: marker, AdminOnly: true, Limit: 10})
+	if err != nil {
+		t.Fatalf("ListUsersPaged returned error: %v", err)
+	}
+	if len(admins) != 1 || admins[0].ID != created[1].ID {
+		t.Fatalf("expected only the promoted user, got %+v", admins)
+	}
+
+	first, err := repo.ListUsersPaged(ctx, UserFilter{Query: marker, Limit: 2})
+	if err != nil || len(first) != 2 {
+		t.Fatalf("expected a first page of 2, got %d (%v)", len(first), err)
+	}
+	last := first[len(first)-1]
+	rest, err := repo.ListUsersPaged(ctx, UserFilter{Query: marker, After: &pagination.Keyset{CreatedAt: last.CreatedAt, ID: last.ID}, Limit: 2})
+	if err != nil {
+		t.Fatalf("ListUsersPaged returned error: %v", err)
+	}
+	if len(rest) != 1 || rest[0].ID == first[0].ID || rest[0].ID == first[1].ID {
+		t.Fatalf("expected the remaining user after the cursor, got %+v", rest)
+	}
+}
@@ -9,26 +9,47 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"log"
 	"strings"
 	"time"
 
 	"github.com/abduss/godrive/internal/config"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
-	"golang.org/x/crypto/bcrypt"
 )
 
 const (
 	refreshTokenLength = 48
-	maxPasswordLength  = 72 // bcrypt limit
+	inviteTokenLength  = 32
+	// maxPasswordLength caps passwords for every hasher; bcrypt allows less, see passwordLimit.
+	maxPasswordLength = 1024
+
+	// sessionIdentifierLength is how much of the token hash is shown when listing sessions.
+	sessionIdentifierLength = 8
+
+	defaultTokenIssuer   = "godrive"
+	defaultTokenAudience = "godrive-api"
 )
 
 // userStore abstracts the persistence layer.
 type userStore interface {
 	CreateUser(ctx context.Context, email, passwordHash string, displayName *string) (User, error)
 	FindUserByEmail(ctx context.Context, email string) (User, error)
-	StoreRefreshToken(ctx context.Context, userID uuid.UUID, tokenHash string, expiresAt time.Time) error
+	FindUserByID(ctx context.Context, userID uuid.UUID) (User, error)
+	StoreRefreshToken(ctx context.Context, userID uuid.UUID, tokenHash string, expiresAt time.Time, client ClientInfo) error
 	RevokeToken(ctx context.Context, userID uuid.UUID, tokenHash string) error
+	ListSessions(ctx context.Context, userID uuid.UUID) ([]Session, error)
+	ListUsersPaged(ctx context.Context, filter UserFilter) ([]User, error)
+	RevokeSession(ctx context.Context, userID, sessionID uuid.UUID) error
+	RevokeAllTokens(ctx context.Context, userID uuid.UUID) (int64, error)
+	UpdatePasswordHash(ctx context.Context, userID uuid.UUID, passwordHash string) error
+	CreateInvite(ctx context.Context, tokenHash string, createdBy uuid.UUID, expiresAt time.Time) error
+	CreateUserWithInvite(ctx context.Context, email, passwordHash string, displayName *string, inviteHash string) (User, error)
+}
+
+// userProvisioner sets up resources for a newly registered user, such as a default bucket.
+type userProvisioner interface {
+	ProvisionUser(ctx context.Context, userID uuid.UUID) error
 }
 
 // Service encapsulates authentication use cases.
@@ -37,31 +58,66 @@ type Service struct {
 	cfg      config.AuthConfig
 	nowFunc  func() time.Time
 	idIssuer string
+	audience string
 	parser   *jwt.Parser
+	hasher   passwordHasher
+	// verifiers recognize every supported hash format so older hashes keep working.
+	verifiers []passwordHasher
+	// provisioner, when set, runs after each successful registration.
+	provisioner userProvisioner
 }
 
 // NewService creates a Service with dependencies.
 func NewService(store userStore, cfg config.AuthConfig) *Service {
+	issuer := cfg.TokenIssuer
+	if issuer == "" {
+		issuer = defaultTokenIssuer
+	}
+	audience := cfg.TokenAudience
+	if audience == "" {
+		audience = defaultTokenAudience
+	}
+
 	return &Service{
 		store:    store,
 		cfg:      cfg,
 		nowFunc:  time.Now,
-		idIssuer: "godrive",
-		parser:   jwt.NewParser(jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Name})),
+		idIssuer: issuer,
+		audience: audience,
+		hasher:   newPasswordHasher(cfg),
+		verifiers: []passwordHasher{
+			bcryptHasher{cost: cfg.BcryptCost},
+			newArgon2idHasher(cfg),
+		},
+		parser: jwt.NewParser(
+			jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Name}),
+			jwt.WithIssuer(issuer),
+			jwt.WithAudience(audience),
+		),
 	}
 }
 
+// SetProvisioner runs p for every newly registered user. Provisioning failures are logged and
+// never fail the registration. A nil provisioner disables it.
+func (s *Service) SetProvisioner(p userProvisioner) {
+	s.provisioner = p
+}
+
 // RegisterInput carries data for user registration.
 type RegisterInput struct {
 	Email       string
 	Password    string
 	DisplayName *string
+	// InviteToken is required when open registration is disabled and ignored otherwise.
+	InviteToken string
+	Client      ClientInfo
 }
 
 // LoginInput carries login credentials.
 type LoginInput struct {
 	Email    string
 	Password string
+	Client   ClientInfo
 }
 
 // AuthResult contains user and token information.
@@ -79,26 +135,47 @@ type UserClaims struct {
 	IssuedAt  time.Time
 }
 
-// Register creates a new user, hashing the password and issuing tokens.
+// Register creates a new user, hashing the password and issuing tokens. When open
+// registration is disabled, the input must carry an invite token, which is consumed.
 func (s *Service) Register(ctx context.Context, input RegisterInput) (AuthResult, error) {
-	if err := validateCredentials(input.Email, input.Password); err != nil {
+	inviteToken := strings.TrimSpace(input.InviteToken)
+	if s.cfg.InviteOnly && inviteToken == "" {
+		return AuthResult{}, ErrRegistrationClosed
+	}
+
+	email := s.normalizeEmail(input.Email)
+	if err := validateCredentials(email, input.Password, s.passwordLimit()); err != nil {
 		return AuthResult{}, err
 	}
 
-	hashedPassword, err := hashPassword(input.Password, s.cfg.BcryptCost)
+	hashedPassword, err := s.hashPassword(input.Password)
 	if err != nil {
 		return AuthResult{}, fmt.Errorf("hash password: %w", err)
 	}
 
-	user, err := s.store.CreateUser(ctx, strings.ToLower(input.Email), hashedPassword, input.DisplayName)
+	var user User
+	if s.cfg.InviteOnly {
+		user, err = s.store.CreateUserWithInvite(ctx, email, hashedPassword, input.DisplayName, hashInviteToken(inviteToken))
+	} else {
+		user, err = s.store.CreateUser(ctx, email, hashedPassword, input.DisplayName)
+	}
 	if err != nil {
-		if errors.Is(err, ErrEmailAlreadyExists) {
+		switch {
+		case errors.Is(err, ErrEmailAlreadyExists):
 			return AuthResult{}, ErrEmailAlreadyExists
+		case errors.Is(err, ErrInvalidInvite):
+			return AuthResult{}, ErrInvalidInvite
 		}
 		return AuthResult{}, fmt.Errorf("create user: %w", err)
 	}
 
-	result, err := s.issueTokens(ctx, user)
+	if s.provisioner != nil {
+		if err := s.provisioner.ProvisionUser(ctx, user.ID); err != nil {
+			log.Printf("provision user %s: %v", user.ID, err)
+		}
+	}
+
+	result, err := s.issueTokens(ctx, user, input.Client)
 	if err != nil {
 		return AuthResult{}, err
 	}
@@ -108,11 +185,14 @@ func (s *Service) Register(ctx context.Context, input RegisterInput) (AuthResult
 
 // Login authenticates credentials and issues a fresh token pair.
 func (s *Service) Login(ctx context.Context, input LoginInput) (AuthResult, error) {
-	if err := validateCredentials(input.Email, input.Password); err != nil {
+	// Any length a supported hasher could have stored is let through to verification, so
+	// switching the active hasher does not lock out existing passwords.
+	email := s.normalizeEmail(input.Email)
+	if err := validateCredentials(email, input.Password, maxPasswordLength); err != nil {
 		return AuthResult{}, ErrInvalidCredentials
 	}
 
-	user, err := s.store.FindUserByEmail(ctx, strings.ToLower(input.Email))
+	user, err := s.store.FindUserByEmail(ctx, email)
 	if err != nil {
 		if errors.Is(err, ErrUserNotFound) {
 			return AuthResult{}, ErrInvalidCredentials
@@ -120,14 +200,74 @@ func (s *Service) Login(ctx context.Context, input LoginInput) (AuthResult, erro
 		return AuthResult{}, fmt.Errorf("find user: %w", err)
 	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(input.Password)); err != nil {
+	if err := s.verifyPassword(user.PasswordHash, input.Password); err != nil {
 		return AuthResult{}, ErrInvalidCredentials
 	}
 
-	return s.issueTokens(ctx, user)
+	if s.needsRehash(user.PasswordHash) {
+		// transparently upgrade hashes produced by a previous algorithm or pepper setting
+		if rehashed, err := s.hashPassword(input.Password); err == nil {
+			if err := s.store.UpdatePasswordHash(ctx, user.ID, rehashed); err == nil {
+				user.PasswordHash = rehashed
+			}
+		}
+	}
+
+	return s.issueTokens(ctx, user, input.Client)
+}
+
+// CreateInvite mints a single-use registration invite on behalf of an admin. The token is
+// returned once; only its hash is stored.
+func (s *Service) CreateInvite(ctx context.Context, createdBy uuid.UUID) (Invite, error) {
+	raw := make([]byte, inviteTokenLength)
+	if _, err := rand.Read(raw); err != nil {
+		return Invite{}, fmt.Errorf("generate invite token: %w", err)
+	}
+	invite := Invite{
+		Token:     base64.RawURLEncoding.EncodeToString(raw),
+		ExpiresAt: s.nowFunc().Add(s.cfg.InviteTTL).UTC(),
+	}
+	if err := s.store.CreateInvite(ctx, hashInviteToken(invite.Token), createdBy, invite.ExpiresAt); err != nil {
+		return Invite{}, err
+	}
+	return invite, nil
+}
+
+// ListSessions returns the user's active sessions.
+func (s *Service) ListSessions(ctx context.Context, userID uuid.UUID) ([]Session, error) {
+	return s.store.ListSessions(ctx, userID)
+}
+
+// RevokeSession revokes one of the user's sessions. Sessions of other users are
+// reported as ErrSessionNotFound.
+func (s *Service) RevokeSession(ctx context.Context, userID, sessionID uuid.UUID) error {
+	return s.store.RevokeSession(ctx, userID, sessionID)
 }
 
-// ValidateAccessToken verifies the token signature and extracts user claims.
+// UserSessions returns another user's active sessions for administrative inspection.
+func (s *Service) UserSessions(ctx context.Context, userID uuid.UUID) ([]Session, error) {
+	if _, err := s.store.FindUserByID(ctx, userID); err != nil {
+		return nil, err
+	}
+	return s.store.ListSessions(ctx, userID)
+}
+
+// ListUsers returns a page of users for administrative review, newest first.
+func (s *Service) ListUsers(ctx context.Context, filter UserFilter) ([]User, error) {
+	filter.Query = strings.TrimSpace(filter.Query)
+	return s.store.ListUsersPaged(ctx, filter)
+}
+
+// RevokeAllSessions forcibly logs a user out by revoking every refresh token they hold.
+// Access tokens already issued remain valid until they expire.
+func (s *Service) RevokeAllSessions(ctx context.Context, userID uuid.UUID) (int64, error) {
+	if _, err := s.store.FindUserByID(ctx, userID); err != nil {
+		return 0, err
+	}
+	return s.store.RevokeAllTokens(ctx, userID)
+}
+
+// ValidateAccessToken verifies the token signature, issuer, and audience and extracts user claims.
 func (s *Service) ValidateAccessToken(tokenString string) (UserClaims, error) {
 	if strings.TrimSpace(tokenString) == "" {
 		return UserClaims{}, ErrUnauthorized
@@ -185,7 +325,7 @@ func (s *Service) ValidateAccessToken(tokenString string) (UserClaims, error) {
 	}, nil
 }
 
-func (s *Service) issueTokens(ctx context.Context, user User) (AuthResult, error) {
+func (s *Service) issueTokens(ctx context.Context, user User, client ClientInfo) (AuthResult, error) {
 	now := s.nowFunc()
 
 	accessToken, accessExpiry, err := s.generateAccessToken(user, now)
@@ -199,7 +339,7 @@ func (s *Service) issueTokens(ctx context.Context, user User) (AuthResult, error
 	}
 
 	refreshHash := hashRefreshToken(refreshToken, s.cfg.RefreshTokenSecret)
-	if err := s.store.StoreRefreshToken(ctx, user.ID, refreshHash, refreshExpiry); err != nil {
+	if err := s.store.StoreRefreshToken(ctx, user.ID, refreshHash, refreshExpiry, client); err != nil {
 		return AuthResult{}, fmt.Errorf("store refresh token: %w", err)
 	}
 
@@ -219,7 +359,7 @@ func (s *Service) generateAccessToken(user User, now time.Time) (string, time.Ti
 	claims := jwt.MapClaims{
 		"sub":      user.ID.String(),
 		"iss":      s.idIssuer,
-		"aud":      "godrive-api",
+		"aud":      s.audience,
 		"iat":      now.Unix(),
 		"exp":      expiresAt.Unix(),
 		"email":    user.Email,
@@ -247,15 +387,30 @@ func (s *Service) generateRefreshToken(now time.Time) (string, time.Time, error)
 	return token, expiresAt, nil
 }
 
-func hashPassword(password string, cost int) (string, error) {
-	if len(password) > maxPasswordLength {
-		return "", fmt.Errorf("password exceeds maximum length of %d characters", maxPasswordLength)
+func (s *Service) hashPassword(password string) (string, error) {
+	if s.cfg.PasswordPepper == "" {
+		return s.hasher.Hash(password)
 	}
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), cost)
+	hashed, err := s.hasher.Hash(pepperPassword(password, s.cfg.PasswordPepper))
 	if err != nil {
 		return "", err
 	}
-	return string(bytes), nil
+	return pepperedMarker + hashed, nil
+}
+
+func (s *Service) verifyPassword(encoded, password string) error {
+	if inner, peppered := strings.CutPrefix(encoded, pepperedMarker); peppered {
+		if s.cfg.PasswordPepper == "" {
+			return ErrInvalidCredentials
+		}
+		encoded, password = inner, pepperPassword(password, s.cfg.PasswordPepper)
+	}
+	for _, verifier := range s.verifiers {
+		if verifier.Handles(encoded) {
+			return verifier.Verify(encoded, password)
+		}
+	}
+	return ErrInvalidCredentials
 }
 
 func hashRefreshToken(token, secret string) string {
@@ -264,12 +419,53 @@ func hashRefreshToken(token, secret string) string {
 	return hex.EncodeToString(mac.Sum(nil))
 }
 
-func validateCredentials(email, password string) error {
+// hashInviteToken derives the stored form of an invite. Tokens carry 256 bits of entropy, so
+// an unkeyed SHA-256 suffices.
+func hashInviteToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// normalizeEmail trims and lowercases the address and, when configured, strips a +tag suffix
+// from the local part so that aliases map to the same account.
+func (s *Service) normalizeEmail(email string) string {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if !s.cfg.StripEmailTags {
+		return email
+	}
+	local, domain, ok := strings.Cut(email, "@")
+	if !ok {
+		return email
+	}
+	if tagged, _, found := strings.Cut(local, "+"); found && tagged != "" {
+		local = tagged
+	}
+	return local + "@" + domain
+}
+
+func (s *Service) needsRehash(encoded string) bool {
+	inner, peppered := strings.CutPrefix(encoded, pepperedMarker)
+	if peppered != (s.cfg.PasswordPepper != "") {
+		return true
+	}
+	return !s.hasher.Handles(inner)
+}
+
+// passwordLimit returns the longest password the active hasher can store. A peppered password
+// reaches the hasher as a fixed-length HMAC, so only the common cap applies then.
+func (s *Service) passwordLimit() int {
+	if s.cfg.PasswordPepper != "" {
+		return maxPasswordLength
+	}
+	return s.hasher.MaxPasswordLength()
+}
+
+func validateCredentials(email, password string, maxLength int) error {
 	if len(strings.TrimSpace(email)) == 0 || len(strings.TrimSpace(password)) == 0 {
 		return ErrInvalidCredentials
 	}
 
-	if len(password) < 8 || len(password) > maxPasswordLength {
+	if len(password) < 8 || len(password) > maxLength {
 		return ErrInvalidCredentials
 	}
 	return nil
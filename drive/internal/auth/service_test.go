@@ -2,10 +2,19 @@ package auth
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/abduss/godrive/internal/config"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 )
 
@@ -42,6 +51,69 @@ func TestRegisterSuccess(t *testing.T) {
 	}
 }
 
+func TestRegisterProvisionsNewUsers(t *testing.T) {
+	store := newMemoryStore()
+	cfg := config.AuthConfig{
+		AccessTokenSecret:  "access-secret",
+		RefreshTokenSecret: "refresh-secret",
+		AccessTokenTTL:     time.Minute,
+		RefreshTokenTTL:    time.Hour,
+		BcryptCost:         4,
+	}
+
+	service := NewService(store, cfg)
+	provisioner := &fakeProvisioner{}
+	service.SetProvisioner(provisioner)
+
+	result, err := service.Register(context.Background(), RegisterInput{Email: "first@example.com", Password: "StrongPass1!"})
+	if err != nil {
+		t.Fatalf("register returned error: %v", err)
+	}
+	if len(provisioner.users) != 1 || provisioner.users[0] != result.User.ID {
+		t.Fatalf("expected the new user to be provisioned, got %v", provisioner.users)
+	}
+
+	provisioner.err = errors.New("bucket store unavailable")
+	if _, err := service.Register(context.Background(), RegisterInput{Email: "second@example.com", Password: "StrongPass1!"}); err != nil {
+		t.Fatalf("expected registration to survive a provisioning failure, got %v", err)
+	}
+	if len(store.users) != 2 {
+		t.Fatalf("expected both users stored; got %d", len(store.users))
+	}
+}
+
+func TestRegisterReportsInvalidFieldsByJSONName(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := newMemoryStore()
+	service := NewService(store, config.AuthConfig{AccessTokenSecret: "access-secret", RefreshTokenSecret: "refresh-secret", BcryptCost: 4})
+	router := gin.New()
+	RegisterRoutes(router.Group("/v1"), service)
+
+	body := `{"email":"not-an-email","password":"StrongPass1!"}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/auth/register", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d: %s", rec.Code, rec.Body.String())
+	}
+	want := `{"error":"validation failed","errors":{"email":"must be a valid email"}}`
+	if rec.Body.String() != want {
+		t.Fatalf("expected %s, got %s", want, rec.Body.String())
+	}
+}
+
+type fakeProvisioner struct {
+	users []uuid.UUID
+	err   error
+}
+
+func (f *fakeProvisioner) ProvisionUser(ctx context.Context, userID uuid.UUID) error {
+	f.users = append(f.users, userID)
+	return f.err
+}
+
 func TestRegisterDuplicateEmail(t *testing.T) {
 	store := newMemoryStore()
 	cfg := config.AuthConfig{
@@ -136,16 +208,556 @@ func TestLoginInvalidPassword(t *testing.T) {
 	}
 }
 
+func TestEmailNormalizationMapsToSameAccount(t *testing.T) {
+	store := newMemoryStore()
+	cfg := config.AuthConfig{
+		AccessTokenSecret:  "access-secret",
+		RefreshTokenSecret: "refresh-secret",
+		AccessTokenTTL:     time.Minute,
+		RefreshTokenTTL:    time.Hour,
+		BcryptCost:         4,
+	}
+
+	service := NewService(store, cfg)
+	registered, err := service.Register(context.Background(), RegisterInput{
+		Email:    "User@Example.com ",
+		Password: "StrongPass1!",
+	})
+	if err != nil {
+		t.Fatalf("register returned error: %v", err)
+	}
+	if registered.User.Email != "user@example.com" {
+		t.Fatalf("expected normalized email, got %q", registered.User.Email)
+	}
+
+	loggedIn, err := service.Login(context.Background(), LoginInput{
+		Email:    "user@example.com",
+		Password: "StrongPass1!",
+	})
+	if err != nil {
+		t.Fatalf("login returned error: %v", err)
+	}
+	if loggedIn.User.ID != registered.User.ID {
+		t.Fatalf("expected login to resolve the registered account")
+	}
+
+	_, err = service.Register(context.Background(), RegisterInput{
+		Email:    "  USER@example.COM",
+		Password: "AnotherPass2!",
+	})
+	if err != ErrEmailAlreadyExists {
+		t.Fatalf("expected ErrEmailAlreadyExists for case variant, got %v", err)
+	}
+}
+
+func TestEmailNormalizationStripsTagsWhenEnabled(t *testing.T) {
+	store := newMemoryStore()
+	cfg := config.AuthConfig{
+		AccessTokenSecret:  "access-secret",
+		RefreshTokenSecret: "refresh-secret",
+		AccessTokenTTL:     time.Minute,
+		RefreshTokenTTL:    time.Hour,
+		BcryptCost:         4,
+		StripEmailTags:     true,
+	}
+
+	service := NewService(store, cfg)
+	if _, err := service.Register(context.Background(), RegisterInput{
+		Email:    "user+news@example.com",
+		Password: "StrongPass1!",
+	}); err != nil {
+		t.Fatalf("register returned error: %v", err)
+	}
+
+	if _, ok := store.users["user@example.com"]; !ok {
+		t.Fatalf("expected tag stripped from stored email")
+	}
+
+	_, err := service.Register(context.Background(), RegisterInput{
+		Email:    "User+Other@Example.com",
+		Password: "StrongPass1!",
+	})
+	if err != ErrEmailAlreadyExists {
+		t.Fatalf("expected ErrEmailAlreadyExists for tagged alias, got %v", err)
+	}
+}
+
+func TestValidateAccessTokenRejectsWrongAudienceAndIssuer(t *testing.T) {
+	cfg := config.AuthConfig{
+		AccessTokenSecret:  "access-secret",
+		RefreshTokenSecret: "refresh-secret",
+		AccessTokenTTL:     time.Minute,
+		RefreshTokenTTL:    time.Hour,
+		BcryptCost:         4,
+	}
+	service := NewService(newMemoryStore(), cfg)
+
+	sign := func(iss, aud string) string {
+		now := time.Now()
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"sub": uuid.NewString(),
+			"iss": iss,
+			"aud": aud,
+			"iat": now.Unix(),
+			"exp": now.Add(time.Minute).Unix(),
+		})
+		signed, err := token.SignedString([]byte(cfg.AccessTokenSecret))
+		if err != nil {
+			t.Fatalf("sign token: %v", err)
+		}
+		return signed
+	}
+
+	if _, err := service.ValidateAccessToken(sign("godrive", "godrive-api")); err != nil {
+		t.Fatalf("expected matching token to validate, got %v", err)
+	}
+	if _, err := service.ValidateAccessToken(sign("godrive", "other-api")); err != ErrUnauthorized {
+		t.Fatalf("expected ErrUnauthorized for wrong audience, got %v", err)
+	}
+	if _, err := service.ValidateAccessToken(sign("someone-else", "godrive-api")); err != ErrUnauthorized {
+		t.Fatalf("expected ErrUnauthorized for wrong issuer, got %v", err)
+	}
+}
+
+func TestMixedPasswordHashesVerifyAndUpgrade(t *testing.T) {
+	store := newMemoryStore()
+	bcryptCfg := config.AuthConfig{
+		AccessTokenSecret:  "access-secret",
+		RefreshTokenSecret: "refresh-secret",
+		AccessTokenTTL:     time.Minute,
+		RefreshTokenTTL:    time.Hour,
+		BcryptCost:         4,
+		PasswordHasher:     HasherBcrypt,
+	}
+	argonCfg := bcryptCfg
+	argonCfg.PasswordHasher = HasherArgon2id
+	argonCfg.Argon2Memory = 1024
+	argonCfg.Argon2Time = 1
+	argonCfg.Argon2Parallelism = 1
+
+	legacy := NewService(store, bcryptCfg)
+	if _, err := legacy.Register(context.Background(), RegisterInput{
+		Email:    "legacy@example.com",
+		Password: "StrongPass1!",
+	}); err != nil {
+		t.Fatalf("register returned error: %v", err)
+	}
+
+	current := NewService(store, argonCfg)
+	if _, err := current.Register(context.Background(), RegisterInput{
+		Email:    "modern@example.com",
+		Password: "StrongPass1!",
+	}); err != nil {
+		t.Fatalf("register returned error: %v", err)
+	}
+	if !strings.HasPrefix(store.users["modern@example.com"].PasswordHash, argon2idPrefix) {
+		t.Fatalf("expected argon2id hash for new registration")
+	}
+
+	if _, err := current.Login(context.Background(), LoginInput{Email: "legacy@example.com", Password: "StrongPass1!"}); err != nil {
+		t.Fatalf("expected bcrypt hash to verify under argon2id config, got %v", err)
+	}
+	if !strings.HasPrefix(store.users["legacy@example.com"].PasswordHash, argon2idPrefix) {
+		t.Fatalf("expected legacy bcrypt hash to be upgraded to argon2id")
+	}
+	if _, err := current.Login(context.Background(), LoginInput{Email: "legacy@example.com", Password: "StrongPass1!"}); err != nil {
+		t.Fatalf("expected upgraded hash to verify, got %v", err)
+	}
+	if _, err := current.Login(context.Background(), LoginInput{Email: "legacy@example.com", Password: "WrongPass1!"}); err != ErrInvalidCredentials {
+		t.Fatalf("expected ErrInvalidCredentials for wrong password, got %v", err)
+	}
+
+	if _, err := legacy.Login(context.Background(), LoginInput{Email: "modern@example.com", Password: "StrongPass1!"}); err != nil {
+		t.Fatalf("expected argon2id hash to verify under bcrypt config, got %v", err)
+	}
+}
+
+func TestPasswordLimitFollowsTheActiveHasher(t *testing.T) {
+	store := newMemoryStore()
+	bcryptCfg := config.AuthConfig{
+		AccessTokenSecret:  "access-secret",
+		RefreshTokenSecret: "refresh-secret",
+		AccessTokenTTL:     time.Minute,
+		RefreshTokenTTL:    time.Hour,
+		BcryptCost:         4,
+		PasswordHasher:     HasherBcrypt,
+	}
+	argonCfg := bcryptCfg
+	argonCfg.PasswordHasher = HasherArgon2id
+	argonCfg.Argon2Memory = 1024
+	argonCfg.Argon2Time = 1
+	argonCfg.Argon2Parallelism = 1
+	pepperedCfg := bcryptCfg
+	pepperedCfg.PasswordPepper = "server-secret"
+
+	long := strings.Repeat("passphrase ", 10)
+	bcryptService := NewService(store, bcryptCfg)
+	if _, err := bcryptService.Register(context.Background(), RegisterInput{Email: "bcrypt@example.com", Password: long}); err != ErrInvalidCredentials {
+		t.Fatalf("expected bcrypt to reject a %d-byte password, got %v", len(long), err)
+	}
+	if _, err := NewService(store, pepperedCfg).Register(context.Background(), RegisterInput{Email: "peppered@example.com", Password: long}); err != nil {
+		t.Fatalf("expected a peppered bcrypt registration to accept a long password, got %v", err)
+	}
+	if _, err := NewService(store, argonCfg).Register(context.Background(), RegisterInput{Email: "argon@example.com", Password: long}); err != nil {
+		t.Fatalf("expected argon2id to accept a long password, got %v", err)
+	}
+	if _, err := NewService(store, argonCfg).Register(context.Background(), RegisterInput{Email: "huge@example.com", Password: strings.Repeat("x", maxPasswordLength+1)}); err != ErrInvalidCredentials {
+		t.Fatalf("expected argon2id to reject a password over the common cap, got %v", err)
+	}
+
+	if _, err := bcryptService.Login(context.Background(), LoginInput{Email: "argon@example.com", Password: long}); err != nil {
+		t.Fatalf("expected a long argon2id password to verify under bcrypt config, got %v", err)
+	}
+}
+
+func TestPepperedAndLegacyHashes(t *testing.T) {
+	store := newMemoryStore()
+	legacyCfg := config.AuthConfig{
+		AccessTokenSecret:  "access-secret",
+		RefreshTokenSecret: "refresh-secret",
+		AccessTokenTTL:     time.Minute,
+		RefreshTokenTTL:    time.Hour,
+		BcryptCost:         4,
+	}
+	pepperedCfg := legacyCfg
+	pepperedCfg.PasswordPepper = "server-secret"
+
+	legacy := NewService(store, legacyCfg)
+	if _, err := legacy.Register(context.Background(), RegisterInput{Email: "legacy@example.com", Password: "StrongPass1!"}); err != nil {
+		t.Fatalf("register returned error: %v", err)
+	}
+
+	peppered := NewService(store, pepperedCfg)
+	if _, err := peppered.Register(context.Background(), RegisterInput{Email: "new@example.com", Password: "StrongPass1!"}); err != nil {
+		t.Fatalf("register returned error: %v", err)
+	}
+	if !strings.HasPrefix(store.users["new@example.com"].PasswordHash, pepperedMarker) {
+		t.Fatalf("expected peppered hash to be flagged")
+	}
+	if _, err := peppered.Login(context.Background(), LoginInput{Email: "new@example.com", Password: "StrongPass1!"}); err != nil {
+		t.Fatalf("expected peppered login to succeed, got %v", err)
+	}
+
+	if _, err := peppered.Login(context.Background(), LoginInput{Email: "legacy@example.com", Password: "StrongPass1!"}); err != nil {
+		t.Fatalf("expected legacy hash to verify, got %v", err)
+	}
+	if !strings.HasPrefix(store.users["legacy@example.com"].PasswordHash, pepperedMarker) {
+		t.Fatalf("expected legacy hash to be upgraded to a peppered hash")
+	}
+
+	rotatedCfg := pepperedCfg
+	rotatedCfg.PasswordPepper = "different-secret"
+	rotated := NewService(store, rotatedCfg)
+	if _, err := rotated.Login(context.Background(), LoginInput{Email: "new@example.com", Password: "StrongPass1!"}); err != ErrInvalidCredentials {
+		t.Fatalf("expected changed pepper to invalidate peppered hashes, got %v", err)
+	}
+	if _, err := legacy.Login(context.Background(), LoginInput{Email: "new@example.com", Password: "StrongPass1!"}); err != ErrInvalidCredentials {
+		t.Fatalf("expected peppered hash to fail without a pepper, got %v", err)
+	}
+}
+
+func TestSessionsAreScopedToOwner(t *testing.T) {
+	svc := NewService(newMemoryStore(), config.AuthConfig{
+		AccessTokenSecret:  "access-secret",
+		RefreshTokenSecret: "refresh-secret",
+		AccessTokenTTL:     time.Minute,
+		RefreshTokenTTL:    time.Hour,
+		BcryptCost:         4,
+	})
+	ctx := context.Background()
+
+	alice, err := svc.Register(ctx, RegisterInput{
+		Email:    "alice@example.com",
+		Password: "Password123!",
+		Client:   ClientInfo{UserAgent: "test-agent", IPAddress: "10.0.0.1"},
+	})
+	if err != nil {
+		t.Fatalf("register alice: %v", err)
+	}
+	bob, err := svc.Register(ctx, RegisterInput{Email: "bob@example.com", Password: "Password123!"})
+	if err != nil {
+		t.Fatalf("register bob: %v", err)
+	}
+
+	sessions, err := svc.ListSessions(ctx, alice.User.ID)
+	if err != nil {
+		t.Fatalf("ListSessions returned error: %v", err)
+	}
+	if len(sessions) != 1 || *sessions[0].UserAgent != "test-agent" {
+		t.Fatalf("unexpected sessions for alice: %+v", sessions)
+	}
+
+	if err := svc.RevokeSession(ctx, bob.User.ID, sessions[0].ID); err != ErrSessionNotFound {
+		t.Fatalf("expected ErrSessionNotFound revoking another user's session, got %v", err)
+	}
+	if err := svc.RevokeSession(ctx, alice.User.ID, sessions[0].ID); err != nil {
+		t.Fatalf("RevokeSession returned error: %v", err)
+	}
+
+	sessions, err = svc.ListSessions(ctx, alice.User.ID)
+	if err != nil {
+		t.Fatalf("ListSessions returned error: %v", err)
+	}
+	if len(sessions) != 0 {
+		t.Fatalf("expected revoked session to be hidden, got %d", len(sessions))
+	}
+}
+
+func TestLoginHandlerCapturesClientMetadata(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := newMemoryStore()
+	svc := NewService(store, config.AuthConfig{
+		AccessTokenSecret:  "access-secret",
+		RefreshTokenSecret: "refresh-secret",
+		AccessTokenTTL:     time.Minute,
+		RefreshTokenTTL:    time.Hour,
+		BcryptCost:         4,
+	})
+	router := gin.New()
+	RegisterRoutes(router.Group("/v1"), svc)
+
+	body := `{"email":"client@example.com","password":"Password123!"}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/auth/register", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "godrive-cli/1.0")
+	req.RemoteAddr = "203.0.113.7:41000"
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	user := store.users["client@example.com"]
+	sessions, err := svc.ListSessions(context.Background(), user.ID)
+	if err != nil {
+		t.Fatalf("ListSessions returned error: %v", err)
+	}
+	if len(sessions) != 1 {
+		t.Fatalf("expected one session, got %d", len(sessions))
+	}
+	if got := *sessions[0].IPAddress; got != "203.0.113.7" {
+		t.Fatalf("expected captured IP 203.0.113.7, got %q", got)
+	}
+	if got := *sessions[0].UserAgent; got != "godrive-cli/1.0" {
+		t.Fatalf("expected captured user agent, got %q", got)
+	}
+}
+
+func TestTruncateUserAgentKeepsValidUTF8(t *testing.T) {
+	long := strings.Repeat("a", maxUserAgentLength-1) + "é"
+	got := truncateUserAgent(long)
+	if got != strings.Repeat("a", maxUserAgentLength-1) {
+		t.Fatalf("expected the split character dropped, got %d bytes ending %q", len(got), got[len(got)-2:])
+	}
+	if got := truncateUserAgent("curl/8.0 \xff"); got != "curl/8.0 " {
+		t.Fatalf("expected invalid bytes dropped, got %q", got)
+	}
+	if got := truncateUserAgent("godrive-cli/1.0"); got != "godrive-cli/1.0" {
+		t.Fatalf("expected a short user agent kept, got %q", got)
+	}
+}
+
+func TestAdminCanRevokeAnotherUsersSessions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := newMemoryStore()
+	svc := NewService(store, config.AuthConfig{
+		AccessTokenSecret:  "access-secret",
+		RefreshTokenSecret: "refresh-secret",
+		AccessTokenTTL:     time.Minute,
+		RefreshTokenTTL:    time.Hour,
+		BcryptCost:         4,
+	})
+
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		if _, err := svc.Register(ctx, RegisterInput{Email: fmt.Sprintf("victim%d@example.com", i), Password: "Password123!"}); err != nil {
+			t.Fatalf("Register returned error: %v", err)
+		}
+	}
+	victim := store.users["victim0@example.com"]
+	if _, err := svc.Login(ctx, LoginInput{Email: victim.Email, Password: "Password123!"}); err != nil {
+		t.Fatalf("Login returned error: %v", err)
+	}
+	bystander := store.users["victim1@example.com"]
+
+	router := gin.New()
+	var caller ContextUser
+	protected := router.Group("/v1", func(c *gin.Context) { SetCurrentUser(c, caller) })
+	RegisterAdminRoutes(protected, svc)
+	do := func(method, path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+		return rec
+	}
+	path := fmt.Sprintf("/v1/admin/users/%s/sessions", victim.ID)
+
+	caller = ContextUser{ID: bystander.ID.String()}
+	if rec := do(http.MethodDelete, path); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for non-admin, got %d", rec.Code)
+	}
+
+	caller = ContextUser{ID: uuid.NewString(), IsAdmin: true}
+	if rec := do(http.MethodGet, fmt.Sprintf("/v1/admin/users/%s/sessions", uuid.New())); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for unknown user, got %d", rec.Code)
+	}
+	if rec := do(http.MethodGet, path); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"identifier"`) {
+		t.Fatalf("expected admin to inspect sessions, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec := do(http.MethodDelete, path)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"revoked":2`) {
+		t.Fatalf("expected both sessions revoked, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if sessions, _ := svc.ListSessions(ctx, victim.ID); len(sessions) != 0 {
+		t.Fatalf("expected no active sessions after revocation, got %d", len(sessions))
+	}
+	if sessions, _ := svc.ListSessions(ctx, bystander.ID); len(sessions) != 1 {
+		t.Fatalf("expected other users' sessions untouched, got %d", len(sessions))
+	}
+}
+
+func TestAdminListUsersPagesAndFilters(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := newMemoryStore()
+	svc := NewService(store, config.AuthConfig{AccessTokenSecret: "access-secret", RefreshTokenSecret: "refresh-secret", BcryptCost: 4})
+
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, email := range []string{"ann@example.com", "bob@example.com", "carol@corp.example", "dave@corp.example"} {
+		store.users[email] = User{ID: uuid.New(), Email: email, IsAdmin: i%2 == 1, CreatedAt: created.Add(time.Duration(i) * time.Hour)}
+	}
+
+	router := gin.New()
+	protected := router.Group("/v1", func(c *gin.Context) { SetCurrentUser(c, ContextUser{ID: uuid.NewString(), IsAdmin: true}) })
+	RegisterAdminRoutes(protected, svc)
+	list := func(query string) (emails []string, next string) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/admin/users?"+query, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d: %s", query, rec.Code, rec.Body.String())
+		}
+		var page struct {
+			Items []struct {
+				Email string `json:"email"`
+			} `json:"items"`
+			NextCursor string `json:"next_cursor"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+			t.Fatalf("decode page: %v", err)
+		}
+		for _, item := range page.Items {
+			emails = append(emails, item.Email)
+		}
+		return emails, page.NextCursor
+	}
+
+	first, next := list("limit=3")
+	if strings.Join(first, ",") != "dave@corp.example,carol@corp.example,bob@example.com" || next == "" {
+		t.Fatalf("unexpected first page %v (next %q)", first, next)
+	}
+	second, next := list("limit=3&cursor=" + next)
+	if strings.Join(second, ",") != "ann@example.com" || next != "" {
+		t.Fatalf("unexpected second page %v (next %q)", second, next)
+	}
+
+	if got, _ := list("q=CORP"); strings.Join(got, ",") != "dave@corp.example,carol@corp.example" {
+		t.Fatalf("expected email search to match corp users, got %v", got)
+	}
+	if got, _ := list("admin_only=true"); strings.Join(got, ",") != "dave@corp.example,bob@example.com" {
+		t.Fatalf("expected only admins, got %v", got)
+	}
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/admin/users?cursor=bogus", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a malformed cursor, got %d", rec.Code)
+	}
+}
+
+func TestInviteOnlyRegistration(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := newMemoryStore()
+	svc := NewService(store, config.AuthConfig{
+		AccessTokenSecret:  "access-secret",
+		RefreshTokenSecret: "refresh-secret",
+		AccessTokenTTL:     time.Minute,
+		RefreshTokenTTL:    time.Hour,
+		BcryptCost:         4,
+		InviteOnly:         true,
+		InviteTTL:          time.Hour,
+	})
+
+	router := gin.New()
+	v1 := router.Group("/v1")
+	RegisterRoutes(v1, svc)
+	RegisterAdminRoutes(v1.Group("", func(c *gin.Context) {
+		SetCurrentUser(c, ContextUser{ID: uuid.NewString(), IsAdmin: true})
+	}), svc)
+	register := func(email, invite string) *httptest.ResponseRecorder {
+		body := fmt.Sprintf(`{"email":%q,"password":"Password123!","invite_token":%q}`, email, invite)
+		req := httptest.NewRequest(http.MethodPost, "/v1/auth/register", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := register("open@example.com", ""); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 without an invite, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := register("forged@example.com", "not-a-real-invite"); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for an unknown invite, got %d", rec.Code)
+	}
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/admin/invites", nil))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201 minting an invite, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var invite Invite
+	if err := json.Unmarshal(rec.Body.Bytes(), &invite); err != nil || invite.Token == "" {
+		t.Fatalf("expected an invite token, got %s (%v)", rec.Body.String(), err)
+	}
+	if _, stored := store.invites[invite.Token]; stored {
+		t.Fatalf("expected only the token hash to be stored")
+	}
+
+	if rec := register("invited@example.com", invite.Token); rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201 with a valid invite, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := register("second@example.com", invite.Token); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 reusing an invite, got %d", rec.Code)
+	}
+	if _, ok := store.users["second@example.com"]; ok {
+		t.Fatalf("expected a reused invite not to create a user")
+	}
+}
+
 // memoryStore implements userStore for tests.
 type memoryStore struct {
 	users         map[string]User
 	refreshTokens map[string]time.Time
+	sessions      map[uuid.UUID]memorySession
+	invites       map[string]memoryInvite
+}
+
+type memoryInvite struct {
+	expiresAt time.Time
+	used      bool
+}
+
+type memorySession struct {
+	userID  uuid.UUID
+	session Session
+	revoked bool
 }
 
 func newMemoryStore() *memoryStore {
 	return &memoryStore{
 		users:         make(map[string]User),
 		refreshTokens: make(map[string]time.Time),
+		sessions:      make(map[uuid.UUID]memorySession),
+		invites:       make(map[string]memoryInvite),
 	}
 }
 
@@ -173,12 +785,126 @@ func (m *memoryStore) FindUserByEmail(ctx context.Context, email string) (User,
 	return user, nil
 }
 
-func (m *memoryStore) StoreRefreshToken(ctx context.Context, userID uuid.UUID, tokenHash string, expiresAt time.Time) error {
+func (m *memoryStore) FindUserByID(ctx context.Context, userID uuid.UUID) (User, error) {
+	for _, user := range m.users {
+		if user.ID == userID {
+			return user, nil
+		}
+	}
+	return User{}, ErrUserNotFound
+}
+
+func (m *memoryStore) ListUsersPaged(ctx context.Context, filter UserFilter) ([]User, error) {
+	var users []User
+	for _, user := range m.users {
+		if filter.Query != "" && !strings.Contains(strings.ToLower(user.Email), strings.ToLower(filter.Query)) {
+			continue
+		}
+		if filter.AdminOnly && !user.IsAdmin {
+			continue
+		}
+		users = append(users, user)
+	}
+	newer := func(a, b User) bool {
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.After(b.CreatedAt)
+		}
+		return a.ID.String() > b.ID.String()
+	}
+	sort.Slice(users, func(i, j int) bool { return newer(users[i], users[j]) })
+	if filter.After != nil {
+		after := User{CreatedAt: filter.After.CreatedAt, ID: filter.After.ID}
+		for len(users) > 0 && !newer(after, users[0]) {
+			users = users[1:]
+		}
+	}
+	if len(users) > filter.Limit {
+		users = users[:filter.Limit]
+	}
+	return users, nil
+}
+
+func (m *memoryStore) StoreRefreshToken(ctx context.Context, userID uuid.UUID, tokenHash string, expiresAt time.Time, client ClientInfo) error {
 	m.refreshTokens[tokenHash] = expiresAt
+	id := uuid.New()
+	userAgent, ipAddress := client.UserAgent, client.IPAddress
+	m.sessions[id] = memorySession{
+		userID: userID,
+		session: Session{
+			ID:         id,
+			Identifier: tokenHash[:sessionIdentifierLength],
+			UserAgent:  &userAgent,
+			IPAddress:  &ipAddress,
+			CreatedAt:  time.Now(),
+			ExpiresAt:  expiresAt,
+		},
+	}
+	return nil
+}
+
+func (m *memoryStore) ListSessions(ctx context.Context, userID uuid.UUID) ([]Session, error) {
+	var sessions []Session
+	for _, stored := range m.sessions {
+		if stored.userID == userID && !stored.revoked {
+			sessions = append(sessions, stored.session)
+		}
+	}
+	return sessions, nil
+}
+
+func (m *memoryStore) RevokeSession(ctx context.Context, userID, sessionID uuid.UUID) error {
+	stored, ok := m.sessions[sessionID]
+	if !ok || stored.userID != userID || stored.revoked {
+		return ErrSessionNotFound
+	}
+	stored.revoked = true
+	m.sessions[sessionID] = stored
 	return nil
 }
 
+func (m *memoryStore) RevokeAllTokens(ctx context.Context, userID uuid.UUID) (int64, error) {
+	var revoked int64
+	for id, stored := range m.sessions {
+		if stored.userID == userID && !stored.revoked {
+			stored.revoked = true
+			m.sessions[id] = stored
+			revoked++
+		}
+	}
+	return revoked, nil
+}
+
 func (m *memoryStore) RevokeToken(ctx context.Context, userID uuid.UUID, tokenHash string) error {
 	delete(m.refreshTokens, tokenHash)
 	return nil
 }
+
+func (m *memoryStore) UpdatePasswordHash(ctx context.Context, userID uuid.UUID, passwordHash string) error {
+	for email, user := range m.users {
+		if user.ID == userID {
+			user.PasswordHash = passwordHash
+			m.users[email] = user
+			return nil
+		}
+	}
+	return ErrUserNotFound
+}
+
+func (m *memoryStore) CreateInvite(ctx context.Context, tokenHash string, createdBy uuid.UUID, expiresAt time.Time) error {
+	m.invites[tokenHash] = memoryInvite{expiresAt: expiresAt}
+	return nil
+}
+
+func (m *memoryStore) CreateUserWithInvite(ctx context.Context, email, passwordHash string, displayName *string, inviteHash string) (User, error) {
+	invite, ok := m.invites[inviteHash]
+	if !ok || invite.used || !invite.expiresAt.After(time.Now()) {
+		return User{}, ErrInvalidInvite
+	}
+	user, err := m.CreateUser(ctx, email, passwordHash, displayName)
+	if err != nil {
+		return User{}, err
+	}
+	invite.used = true
+	m.invites[inviteHash] = invite
+	return user, nil
+}
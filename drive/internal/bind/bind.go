@@ -0,0 +1,132 @@
+// Package bind decodes JSON request bodies and turns binding failures into client-facing
+// errors keyed by JSON field name, instead of the validator's messages about Go struct fields.
+package bind
+
+import (
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+var (
+	registerTagNames sync.Once
+	textUnmarshaler  = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// JSON binds the request body into dst. On failure it writes a 400 response built by Response
+// and returns false.
+func JSON(c *gin.Context, dst any) bool {
+	useJSONFieldNames()
+	if err := c.ShouldBindJSON(dst); err != nil {
+		c.JSON(http.StatusBadRequest, Response(err))
+		return false
+	}
+	return true
+}
+
+// Response describes a binding error. Validation failures and type mismatches are reported
+// per field under "errors"; anything else, such as malformed JSON, gets a generic message.
+func Response(err error) gin.H {
+	var validationErrs validator.ValidationErrors
+	if errors.As(err, &validationErrs) {
+		fields := make(map[string]string, len(validationErrs))
+		for _, fieldErr := range validationErrs {
+			fields[fieldName(fieldErr)] = message(fieldErr)
+		}
+		return gin.H{"error": "validation failed", "errors": fields}
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		return gin.H{"error": "validation failed", "errors": map[string]string{
+			typeErr.Field: "must be " + jsonType(typeErr.Type),
+		}}
+	}
+	return gin.H{"error": "invalid request body"}
+}
+
+// useJSONFieldNames makes gin's validator report fields by their JSON names.
+func useJSONFieldNames() {
+	registerTagNames.Do(func() {
+		engine, ok := binding.Validator.Engine().(*validator.Validate)
+		if !ok {
+			return
+		}
+		engine.RegisterTagNameFunc(func(field reflect.StructField) string {
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "-" {
+				return ""
+			}
+			return name
+		})
+	})
+}
+
+// fieldName drops the request struct's name from the error's namespace, keeping the path for
+// nested fields such as "allowed_content_types[2]".
+func fieldName(fieldErr validator.FieldError) string {
+	if _, path, ok := strings.Cut(fieldErr.Namespace(), "."); ok {
+		return path
+	}
+	return fieldErr.Field()
+}
+
+func message(fieldErr validator.FieldError) string {
+	switch fieldErr.Tag() {
+	case "required":
+		return "is required"
+	case "email":
+		return "must be a valid email"
+	case "min":
+		return "must be at least " + limit(fieldErr)
+	case "max":
+		return "must be at most " + limit(fieldErr)
+	default:
+		return "is invalid"
+	}
+}
+
+// limit phrases a min or max bound in the field's unit.
+func limit(fieldErr validator.FieldError) string {
+	switch fieldErr.Kind() {
+	case reflect.String:
+		return fmt.Sprintf("%s characters", fieldErr.Param())
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return fmt.Sprintf("%s items", fieldErr.Param())
+	default:
+		return fieldErr.Param()
+	}
+}
+
+// jsonType names the JSON value that decodes into t.
+func jsonType(t reflect.Type) string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if reflect.PointerTo(t).Implements(textUnmarshaler) {
+		return "a string"
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	default:
+		return "an object"
+	}
+}
@@ -0,0 +1,75 @@
+package bind
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type sampleRequest struct {
+	Name     string    `json:"name" binding:"required,max=5"`
+	Tags     []string  `json:"tags" binding:"omitempty,max=2,dive,min=2"`
+	BucketID uuid.UUID `json:"bucket_id"`
+	Limit    int       `json:"limit"`
+}
+
+func TestJSONReportsFieldKeyedErrors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cases := []struct {
+		name string
+		body string
+		want map[string]string
+	}{
+		{
+			name: "validation",
+			body: `{"name":"too long","tags":["ok","x"]}`,
+			want: map[string]string{"name": "must be at most 5 characters", "tags[1]": "must be at least 2 characters"},
+		},
+		{name: "missing", body: `{}`, want: map[string]string{"name": "is required"}},
+		{name: "wrong type", body: `{"name":"a","limit":"ten"}`, want: map[string]string{"limit": "must be a number"}},
+		{name: "wrong uuid type", body: `{"name":"a","bucket_id":5}`, want: map[string]string{"bucket_id": "must be a string"}},
+		{name: "malformed", body: `{"name":`, want: nil},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(rec)
+			c.Request = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tc.body))
+			c.Request.Header.Set("Content-Type", "application/json")
+
+			var req sampleRequest
+			if JSON(c, &req) {
+				t.Fatalf("expected binding to fail")
+			}
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("expected 400, got %d", rec.Code)
+			}
+
+			var resp struct {
+				Error  string            `json:"error"`
+				Errors map[string]string `json:"errors"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if resp.Error == "" || len(resp.Errors) != len(tc.want) {
+				t.Fatalf("expected %v, got %s", tc.want, rec.Body.String())
+			}
+			for field, msg := range tc.want {
+				if resp.Errors[field] != msg {
+					t.Fatalf("expected %s: %q, got %s", field, msg, rec.Body.String())
+				}
+			}
+			if strings.Contains(rec.Body.String(), "sampleRequest") {
+				t.Fatalf("response leaks the struct name: %s", rec.Body.String())
+			}
+		})
+	}
+}
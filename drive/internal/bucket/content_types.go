@@ -0,0 +1,80 @@
+package bucket
+
+import (
+	"mime"
+	"strings"
+)
+
+// AllowsContentType reports whether the bucket accepts uploads of the given content type.
+// Buckets without restrictions accept everything.
+func (b Bucket) AllowsContentType(contentType string) bool {
+	if len(b.AllowedContentTypes) == 0 {
+		return true
+	}
+	mediaType := normalizeMediaType(contentType)
+	for _, pattern := range b.AllowedContentTypes {
+		if matchContentType(pattern, mediaType) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchContentType(pattern, mediaType string) bool {
+	if pattern == "*/*" || pattern == mediaType {
+		return true
+	}
+	if prefix, ok := strings.CutSuffix(pattern, "/*"); ok {
+		return strings.HasPrefix(mediaType, prefix+"/")
+	}
+	return false
+}
+
+// normalizeContentTypePatterns validates patterns of the form type/subtype, type/* or */*.
+func normalizeContentTypePatterns(patterns []string) ([]string, error) {
+	normalized := make([]string, 0, len(patterns))
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		typ, subtype, ok := strings.Cut(pattern, "/")
+		if !ok || !isMediaToken(typ, true) || !isMediaToken(subtype, true) || (typ == "*" && subtype != "*") {
+			return nil, ErrInvalidContentType
+		}
+		normalized = append(normalized, pattern)
+	}
+	return normalized, nil
+}
+
+// normalizeDefaultContentType validates a concrete (non-wildcard) content type.
+func normalizeDefaultContentType(contentType string) (string, error) {
+	mediaType := normalizeMediaType(contentType)
+	typ, subtype, ok := strings.Cut(mediaType, "/")
+	if !ok || !isMediaToken(typ, false) || !isMediaToken(subtype, false) {
+		return "", ErrInvalidContentType
+	}
+	return mediaType, nil
+}
+
+func normalizeMediaType(contentType string) string {
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		return mediaType
+	}
+	return strings.ToLower(strings.TrimSpace(contentType))
+}
+
+func isMediaToken(token string, allowWildcard bool) bool {
+	if token == "" {
+		return false
+	}
+	if token == "*" {
+		return allowWildcard
+	}
+	for _, r := range token {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+		case strings.ContainsRune("!#$&-^_.+", r):
+		default:
+			return false
+		}
+	}
+	return true
+}
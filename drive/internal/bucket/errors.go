@@ -7,4 +7,25 @@ var (
 	ErrBucketNotFound = errors.New("bucket not found")
 	// ErrBucketNameExists is returned when a user attempts to create a duplicate bucket name.
 	ErrBucketNameExists = errors.New("bucket name already exists")
+	// ErrInvalidSort is returned for unsupported listing sort fields or directions.
+	ErrInvalidSort = errors.New("invalid sort")
+	// ErrInvalidMaxFileSize is returned when a bucket's upload size limit is not positive.
+	ErrInvalidMaxFileSize = errors.New("invalid max file size")
+	// ErrInvalidContentType is returned for malformed content-type restrictions.
+	ErrInvalidContentType = errors.New("invalid content type")
+	// ErrInvalidDescription is returned when a description exceeds the configured maximum length.
+	ErrInvalidDescription = errors.New("invalid description")
+	// ErrEmptyBatch is returned when a batch request names no buckets.
+	ErrEmptyBatch = errors.New("bucket batch is empty")
+	// ErrBatchTooLarge is returned when a batch request names more than MaxBatchDeleteSize buckets.
+	ErrBatchTooLarge = errors.New("bucket batch too large")
+	// ErrVersionMismatch is returned when a conditional update targets a stale version.
+	ErrVersionMismatch = errors.New("bucket version mismatch")
+	// ErrPublicBucketsDisabled is returned when making a bucket public while the feature is off.
+	ErrPublicBucketsDisabled = errors.New("public buckets are disabled")
+	// ErrImmutableBucket is returned when turning off an immutable bucket's immutable flag.
+	ErrImmutableBucket = errors.New("bucket is immutable")
+	// ErrRetentionActive is returned when deleting an immutable bucket that still holds files
+	// within the retention window.
+	ErrRetentionActive = errors.New("bucket holds files under retention")
 )
@@ -0,0 +1,51 @@
+package bucket
+
+import (
+	"math"
+
+	"github.com/google/uuid"
+)
+
+// bytesPerGB is the gigabyte storage is billed by; object stores price per GiB.
+const bytesPerGB = 1 << 30
+
+// CostEstimate projects the monthly storage bill for an account at a flat price per GB.
+type CostEstimate struct {
+	PricePerGBMonth float64      `json:"price_per_gb_month"`
+	TotalBytes      int64        `json:"total_bytes"`
+	MonthlyCost     float64      `json:"estimated_monthly_cost"`
+	Buckets         []BucketCost `json:"buckets"`
+}
+
+// BucketCost is one bucket's share of a CostEstimate.
+type BucketCost struct {
+	BucketID    uuid.UUID `json:"bucket_id"`
+	Name        string    `json:"name"`
+	TotalBytes  int64     `json:"total_bytes"`
+	MonthlyCost float64   `json:"estimated_monthly_cost"`
+}
+
+// EstimateCost prices the account total and each bucket at pricePerGB per month. Costs are
+// rounded to a hundredth of a cent, so small buckets do not all show as free; the total is
+// priced from the account usage rather than summed from the rounded bucket costs.
+func EstimateCost(usage AccountUsage, buckets []Bucket, pricePerGB float64) CostEstimate {
+	estimate := CostEstimate{
+		PricePerGBMonth: pricePerGB,
+		TotalBytes:      usage.TotalBytes,
+		MonthlyCost:     monthlyCost(usage.TotalBytes, pricePerGB),
+		Buckets:         make([]BucketCost, 0, len(buckets)),
+	}
+	for _, b := range buckets {
+		estimate.Buckets = append(estimate.Buckets, BucketCost{
+			BucketID:    b.ID,
+			Name:        b.Name,
+			TotalBytes:  b.Usage.TotalBytes,
+			MonthlyCost: monthlyCost(b.Usage.TotalBytes, pricePerGB),
+		})
+	}
+	return estimate
+}
+
+func monthlyCost(bytes int64, pricePerGB float64) float64 {
+	return math.Round(float64(bytes)/bytesPerGB*pricePerGB*10_000) / 10_000
+}
@@ -1,9 +1,16 @@
 package bucket
 
 import (
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/abduss/godrive/internal/auth"
+	"github.com/abduss/godrive/internal/bind"
+	"github.com/abduss/godrive/internal/etag"
+	"github.com/abduss/godrive/internal/negotiate"
+	"github.com/abduss/godrive/internal/pagination"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 )
@@ -12,9 +19,16 @@ import (
 func RegisterRoutes(group *gin.RouterGroup, service *Service) {
 	handler := &httpHandler{service: service}
 	group.POST("/buckets", handler.createBucket)
+	group.POST("/buckets/batch-delete", handler.batchDelete)
 	group.GET("/buckets", handler.listBuckets)
 	group.GET("/buckets/:bucketID", handler.getBucket)
+	group.PATCH("/buckets/:bucketID", handler.updateBucket)
 	group.DELETE("/buckets/:bucketID", handler.deleteBucket)
+	group.GET("/buckets/:bucketID/stats", handler.bucketStats)
+	group.GET("/buckets/:bucketID/delete-preview", handler.deletePreview)
+	group.POST("/buckets/:bucketID/recompute-usage", handler.recomputeUsage)
+	group.GET("/me/usage", handler.accountUsage)
+	group.GET("/me/usage/estimate", handler.usageEstimate)
 }
 
 type httpHandler struct {
@@ -22,8 +36,13 @@ type httpHandler struct {
 }
 
 type createBucketRequest struct {
-	Name        string  `json:"name" binding:"required"`
-	Description *string `json:"description" binding:"omitempty,max=255"`
+	Name                string   `json:"name" binding:"required"`
+	Description         *string  `json:"description" binding:"omitempty,max=255"`
+	AllowedContentTypes []string `json:"allowed_content_types" binding:"omitempty,max=64,dive,max=255"`
+	DefaultContentType  *string  `json:"default_content_type" binding:"omitempty,max=255"`
+	MaxFileSizeBytes    *int64   `json:"max_file_size_bytes"`
+	Region              *string  `json:"region" binding:"omitempty,max=64"`
+	Immutable           bool     `json:"immutable"`
 }
 
 func (h *httpHandler) createBucket(c *gin.Context) {
@@ -33,26 +52,79 @@ func (h *httpHandler) createBucket(c *gin.Context) {
 		return
 	}
 
+	// get_existing=true turns the create into create-or-get for idempotent tooling: an existing
+	// bucket of the same name is returned with 200 instead of a 409.
+	getExisting := false
+	if raw := c.Query("get_existing"); raw != "" {
+		parsed, err := strconv.ParseBool(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "get_existing must be a boolean"})
+			return
+		}
+		getExisting = parsed
+	}
+
 	var req createBucketRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bind.JSON(c, &req) {
 		return
 	}
 
-	bucket, err := h.service.CreateBucket(c.Request.Context(), userID, req.Name, req.Description)
+	input := CreateInput{
+		Name:                req.Name,
+		Description:         req.Description,
+		AllowedContentTypes: req.AllowedContentTypes,
+		DefaultContentType:  req.DefaultContentType,
+		MaxFileSizeBytes:    req.MaxFileSizeBytes,
+		Region:              req.Region,
+		Immutable:           req.Immutable,
+	}
+	var (
+		bucket  Bucket
+		created = true
+		err     error
+	)
+	if getExisting {
+		bucket, created, err = h.service.CreateOrGetBucket(c.Request.Context(), userID, input)
+	} else {
+		bucket, err = h.service.CreateBucket(c.Request.Context(), userID, input)
+	}
 	if err != nil {
 		switch err {
 		case ErrBucketNameExists:
-			c.JSON(http.StatusConflict, gin.H{"error": "bucket name already exists"})
+			c.JSON(http.StatusConflict, gin.H{
+				"error": "bucket name already exists",
+				"name":  strings.TrimSpace(req.Name),
+			})
+		case ErrInvalidContentType:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid content type restriction"})
+		case ErrInvalidMaxFileSize:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "max_file_size_bytes must be positive"})
+		case ErrInvalidDescription:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "description too long"})
 		default:
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create bucket"})
 		}
 		return
 	}
 
+	if !created {
+		c.JSON(http.StatusOK, bucket)
+		return
+	}
 	c.JSON(http.StatusCreated, bucket)
 }
 
+const (
+	defaultPreviewLimit = 3
+	maxPreviewLimit     = 10
+)
+
+// bucketWithPreview is a bucket listed with include=recent_files.
+type bucketWithPreview struct {
+	Bucket
+	RecentFiles []FilePreview `json:"recent_files"`
+}
+
 func (h *httpHandler) listBuckets(c *gin.Context) {
 	userID, _, ok := auth.RequireUser(c)
 	if !ok {
@@ -60,13 +132,73 @@ func (h *httpHandler) listBuckets(c *gin.Context) {
 		return
 	}
 
-	buckets, err := h.service.ListBuckets(c.Request.Context(), userID)
+	opts := ListOptions{
+		Sort:  c.Query("sort"),
+		Order: c.Query("order"),
+	}
+	page, err := pagination.Parse(c.Request.URL.Query())
 	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	paginated := pagination.Requested(c.Request.URL.Query())
+	if paginated {
+		opts.Limit, opts.Offset = page.FetchLimit(), page.Offset
+	}
+
+	includePreview := c.Query("include") == "recent_files"
+	previewLimit := defaultPreviewLimit
+	if raw := c.Query("preview_limit"); raw != "" {
+		previewLimit, err = strconv.Atoi(raw)
+		if err != nil || previewLimit < 1 || previewLimit > maxPreviewLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "preview_limit must be between 1 and 10"})
+			return
+		}
+	}
+
+	buckets, err := h.service.ListBuckets(c.Request.Context(), userID, opts)
+	if err != nil {
+		if err == ErrInvalidSort {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid sort or order"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list buckets"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"buckets": buckets})
+	if !includePreview {
+		if paginated {
+			negotiate.Respond(c, http.StatusOK, pagination.NewPage(buckets, page))
+			return
+		}
+		negotiate.Respond(c, http.StatusOK, gin.H{"buckets": buckets})
+		return
+	}
+
+	previewTargets := buckets
+	if paginated && len(buckets) > page.Limit {
+		// The look-ahead row is dropped by NewPage, so it needs no preview.
+		previewTargets = buckets[:page.Limit]
+	}
+	previews, err := h.service.RecentFiles(c.Request.Context(), userID, previewTargets, previewLimit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list buckets"})
+		return
+	}
+	withPreviews := make([]bucketWithPreview, len(buckets))
+	for i, b := range buckets {
+		files := previews[b.ID]
+		if files == nil {
+			files = []FilePreview{}
+		}
+		withPreviews[i] = bucketWithPreview{Bucket: b, RecentFiles: files}
+	}
+
+	if paginated {
+		negotiate.Respond(c, http.StatusOK, pagination.NewPage(withPreviews, page))
+		return
+	}
+	negotiate.Respond(c, http.StatusOK, gin.H{"buckets": withPreviews})
 }
 
 func (h *httpHandler) getBucket(c *gin.Context) {
@@ -92,9 +224,180 @@ func (h *httpHandler) getBucket(c *gin.Context) {
 		return
 	}
 
+	c.Header("ETag", etag.FromTime(bucket.UpdatedAt))
+	c.JSON(http.StatusOK, bucket)
+}
+
+func (h *httpHandler) bucketStats(c *gin.Context) {
+	userID, _, ok := auth.RequireUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	bucketID, err := uuid.Parse(c.Param("bucketID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid bucket id"})
+		return
+	}
+
+	stats, err := h.service.BucketStats(c.Request.Context(), userID, bucketID)
+	if err != nil {
+		if err == ErrBucketNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "bucket not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load bucket stats"})
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
+
+func (h *httpHandler) deletePreview(c *gin.Context) {
+	userID, _, ok := auth.RequireUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	bucketID, err := uuid.Parse(c.Param("bucketID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid bucket id"})
+		return
+	}
+
+	preview, err := h.service.DeletePreview(c.Request.Context(), userID, bucketID)
+	if err != nil {
+		if err == ErrBucketNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "bucket not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load delete preview"})
+		return
+	}
+
+	c.JSON(http.StatusOK, preview)
+}
+
+type updateBucketRequest struct {
+	Description *string `json:"description" binding:"omitempty,max=255"`
+	IsPublic    *bool   `json:"is_public"`
+	Immutable   *bool   `json:"immutable"`
+}
+
+func (h *httpHandler) updateBucket(c *gin.Context) {
+	userID, _, ok := auth.RequireUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	bucketID, err := uuid.Parse(c.Param("bucketID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid bucket id"})
+		return
+	}
+
+	var req updateBucketRequest
+	if !bind.JSON(c, &req) {
+		return
+	}
+
+	input := UpdateInput{
+		Description: req.Description,
+		IsPublic:    req.IsPublic,
+		Immutable:   req.Immutable,
+	}
+	if updatedAt, ok, err := etag.ParseIfMatch(c.GetHeader("If-Match")); err != nil {
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": "invalid If-Match header"})
+		return
+	} else if ok {
+		input.IfUpdatedAt = &updatedAt
+	}
+
+	bucket, err := h.service.UpdateBucket(c.Request.Context(), userID, bucketID, input)
+	if err != nil {
+		switch err {
+		case ErrBucketNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": "bucket not found"})
+		case ErrVersionMismatch:
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": "bucket was modified since it was read"})
+		case ErrInvalidDescription:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "description too long"})
+		case ErrPublicBucketsDisabled:
+			c.JSON(http.StatusForbidden, gin.H{"error": "public buckets are disabled"})
+		case ErrImmutableBucket:
+			c.JSON(http.StatusForbidden, gin.H{"error": "immutable buckets cannot be made mutable"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update bucket"})
+		}
+		return
+	}
+
+	c.Header("ETag", etag.FromTime(bucket.UpdatedAt))
 	c.JSON(http.StatusOK, bucket)
 }
 
+func (h *httpHandler) accountUsage(c *gin.Context) {
+	userID, _, ok := auth.RequireUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	usage, err := h.service.AccountUsage(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load usage"})
+		return
+	}
+
+	c.JSON(http.StatusOK, usage)
+}
+
+func (h *httpHandler) recomputeUsage(c *gin.Context) {
+	userID, user, ok := auth.RequireUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	bucketID, err := uuid.Parse(c.Param("bucketID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid bucket id"})
+		return
+	}
+
+	usage, err := h.service.RecomputeUsage(c.Request.Context(), userID, bucketID, user.IsAdmin)
+	if err != nil {
+		switch err {
+		case ErrBucketNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": "bucket not found"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to recompute usage"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, usage)
+}
+
+func (h *httpHandler) usageEstimate(c *gin.Context) {
+	userID, _, ok := auth.RequireUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	estimate, err := h.service.EstimateCost(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to estimate usage cost"})
+		return
+	}
+
+	c.JSON(http.StatusOK, estimate)
+}
+
 func (h *httpHandler) deleteBucket(c *gin.Context) {
 	userID, _, ok := auth.RequireUser(c)
 	if !ok {
@@ -112,6 +415,8 @@ func (h *httpHandler) deleteBucket(c *gin.Context) {
 		switch err {
 		case ErrBucketNotFound:
 			c.JSON(http.StatusNotFound, gin.H{"error": "bucket not found"})
+		case ErrRetentionActive:
+			c.JSON(http.StatusForbidden, gin.H{"error": "bucket holds immutable files under retention"})
 		default:
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete bucket"})
 		}
@@ -120,3 +425,40 @@ func (h *httpHandler) deleteBucket(c *gin.Context) {
 
 	c.Status(http.StatusNoContent)
 }
+
+type batchDeleteRequest struct {
+	BucketIDs []uuid.UUID `json:"bucket_ids" binding:"required"`
+}
+
+func (h *httpHandler) batchDelete(c *gin.Context) {
+	userID, _, ok := auth.RequireUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var req batchDeleteRequest
+	if !bind.JSON(c, &req) {
+		return
+	}
+
+	results, err := h.service.DeleteBuckets(c.Request.Context(), userID, req.BucketIDs)
+	if err != nil {
+		switch err {
+		case ErrEmptyBatch:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bucket_ids is required"})
+		case ErrBatchTooLarge:
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("at most %d buckets may be deleted per batch", MaxBatchDeleteSize)})
+		default:
+			if results != nil {
+				// Deletions already happened; only the usage snapshot failed.
+				c.JSON(http.StatusOK, gin.H{"buckets": results})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete buckets"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"buckets": results})
+}
@@ -0,0 +1,170 @@
+package bucket
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abduss/godrive/internal/auth"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+func TestUpdateBucketRejectsStaleIfMatch(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	repo := newFakeRepo()
+	service := NewService(repo, &fakeFileIndex{}, nil, "storage")
+
+	ownerID, bucketID := uuid.New(), uuid.New()
+	repo.buckets[bucketID] = Bucket{ID: bucketID, OwnerID: ownerID, Name: "shared", UpdatedAt: time.Now().UTC().Truncate(time.Microsecond)}
+
+	router := gin.New()
+	RegisterRoutes(router.Group("/v1", func(c *gin.Context) {
+		auth.SetCurrentUser(c, auth.ContextUser{ID: ownerID.String()})
+	}), service)
+	path := fmt.Sprintf("/v1/buckets/%s", bucketID)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	tag := rec.Header().Get("ETag")
+	if rec.Code != http.StatusOK || tag == "" {
+		t.Fatalf("expected 200 with an ETag, got %d %q", rec.Code, tag)
+	}
+
+	patch := func(ifMatch, description string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPatch, path, bytes.NewBufferString(fmt.Sprintf(`{"description":%q}`, description)))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("If-Match", ifMatch)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	first := patch(tag, "first editor")
+	if first.Code != http.StatusOK {
+		t.Fatalf("expected 200 for a current If-Match, got %d: %s", first.Code, first.Body.String())
+	}
+	if newTag := first.Header().Get("ETag"); newTag == "" || newTag == tag {
+		t.Fatalf("expected a new ETag after the update, got %q", newTag)
+	}
+
+	if rec := patch(tag, "second editor"); rec.Code != http.StatusPreconditionFailed {
+		t.Fatalf("expected 412 for a stale If-Match, got %d", rec.Code)
+	}
+	if got := *repo.buckets[bucketID].Description; got != "first editor" {
+		t.Fatalf("expected the stale update to be dropped, got description %q", got)
+	}
+}
+
+func TestDeletePreviewReportsSeededUsage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	repo := newFakeRepo()
+	service := NewService(repo, &fakeFileIndex{}, nil, "storage")
+
+	ownerID, otherID, bucketID := uuid.New(), uuid.New(), uuid.New()
+	repo.buckets[bucketID] = Bucket{ID: bucketID, OwnerID: ownerID, Name: "photos", Usage: UsageStats{TotalBytes: 3_200_000_000, FileCount: 1204}}
+
+	currentUser := ownerID
+	router := gin.New()
+	RegisterRoutes(router.Group("/v1", func(c *gin.Context) {
+		auth.SetCurrentUser(c, auth.ContextUser{ID: currentUser.String()})
+	}), service)
+	path := fmt.Sprintf("/v1/buckets/%s/delete-preview", bucketID)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var preview DeletePreview
+	if err := json.Unmarshal(rec.Body.Bytes(), &preview); err != nil {
+		t.Fatalf("decode preview: %v", err)
+	}
+	if want := (DeletePreview{FileCount: 1204, TotalBytes: 3_200_000_000}); preview != want {
+		t.Fatalf("expected %+v, got %+v", want, preview)
+	}
+
+	currentUser = otherID
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for another user's bucket, got %d", rec.Code)
+	}
+	if _, ok := repo.buckets[bucketID]; !ok {
+		t.Fatalf("expected the preview to leave the bucket in place")
+	}
+}
+
+func TestCreateBucketWithGetExistingReturnsOwnedBucket(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	repo := newFakeRepo()
+	service := NewService(repo, &fakeFileIndex{}, nil, "storage")
+
+	ownerID := uuid.New()
+	router := gin.New()
+	RegisterRoutes(router.Group("/v1", func(c *gin.Context) {
+		auth.SetCurrentUser(c, auth.ContextUser{ID: ownerID.String()})
+	}), service)
+	create := func(path, name string) (*httptest.ResponseRecorder, Bucket) {
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewBufferString(fmt.Sprintf(`{"name":%q}`, name)))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		var b Bucket
+		_ = json.Unmarshal(rec.Body.Bytes(), &b)
+		return rec, b
+	}
+
+	rec, first := create("/v1/buckets?get_existing=true", "releases")
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201 creating a new bucket, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec, again := create("/v1/buckets?get_existing=true", "Releases")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 for an existing bucket, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if again.ID != first.ID || len(repo.buckets) != 1 {
+		t.Fatalf("expected the existing bucket %s returned without a new one, got %s (%d buckets)", first.ID, again.ID, len(repo.buckets))
+	}
+
+	if rec, _ := create("/v1/buckets", "releases"); rec.Code != http.StatusConflict {
+		t.Fatalf("expected plain POST to stay create-only with 409, got %d", rec.Code)
+	}
+	if rec, _ := create("/v1/buckets?get_existing=maybe", "releases"); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a malformed get_existing, got %d", rec.Code)
+	}
+}
+
+func TestRecomputeUsageAllowsOwnerAndAdminOnly(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	repo := newFakeRepo()
+	service := NewService(repo, &fakeFileIndex{}, nil, "storage")
+
+	ownerID, bucketID := uuid.New(), uuid.New()
+	repo.buckets[bucketID] = Bucket{ID: bucketID, OwnerID: ownerID, Name: "logs", Usage: UsageStats{TotalBytes: 10, FileCount: 1}}
+
+	var caller auth.ContextUser
+	router := gin.New()
+	RegisterRoutes(router.Group("/v1", func(c *gin.Context) { auth.SetCurrentUser(c, caller) }), service)
+	recompute := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, fmt.Sprintf("/v1/buckets/%s/recompute-usage", bucketID), nil))
+		return rec
+	}
+
+	caller = auth.ContextUser{ID: uuid.NewString()}
+	if rec := recompute(); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for another user, got %d", rec.Code)
+	}
+	for _, caller = range []auth.ContextUser{{ID: ownerID.String()}, {ID: uuid.NewString(), IsAdmin: true}} {
+		if rec := recompute(); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"total_bytes":10`) {
+			t.Fatalf("expected 200 with usage for %+v, got %d: %s", caller, rec.Code, rec.Body.String())
+		}
+	}
+}
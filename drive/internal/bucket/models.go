@@ -1,6 +1,8 @@
 package bucket
 
 import (
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -8,13 +10,47 @@ import (
 
 // Bucket represents a logical container for user files.
 type Bucket struct {
-	ID          uuid.UUID  `json:"id"`
-	OwnerID     uuid.UUID  `json:"owner_id"`
-	Name        string     `json:"name"`
-	Description *string    `json:"description,omitempty"`
-	CreatedAt   time.Time  `json:"created_at"`
-	UpdatedAt   time.Time  `json:"updated_at"`
-	Usage       UsageStats `json:"usage"`
+	ID                  uuid.UUID  `json:"id"`
+	OwnerID             uuid.UUID  `json:"owner_id"`
+	Name                string     `json:"name"`
+	Description         *string    `json:"description,omitempty"`
+	AllowedContentTypes []string   `json:"allowed_content_types,omitempty"`
+	DefaultContentType  *string    `json:"default_content_type,omitempty"`
+	MaxFileSizeBytes    *int64     `json:"max_file_size_bytes,omitempty"`
+	IsPublic            bool       `json:"is_public"`
+	Immutable           bool       `json:"immutable"`
+	Region              *string    `json:"region,omitempty"` // requested storage region; informational until per-region placement exists
+	CreatedAt           time.Time  `json:"created_at"`
+	UpdatedAt           time.Time  `json:"updated_at"`
+	Usage               UsageStats `json:"usage"`
+}
+
+// CreateInput carries the attributes of a new bucket.
+type CreateInput struct {
+	Name                string
+	Description         *string
+	AllowedContentTypes []string
+	DefaultContentType  *string
+	MaxFileSizeBytes    *int64
+	Region              *string
+	Immutable           bool
+}
+
+// UpdateInput carries bucket attributes to change; nil fields are left untouched.
+type UpdateInput struct {
+	Description *string
+	IsPublic    *bool
+	// Immutable can only be switched on; an immutable bucket stays immutable.
+	Immutable *bool
+	// IfUpdatedAt, when set, applies the update only if the bucket's updated_at still matches.
+	IfUpdatedAt *time.Time
+}
+
+// DeleteResult is the outcome for one bucket in a batch delete. Error is set when Deleted is false.
+type DeleteResult struct {
+	BucketID uuid.UUID `json:"bucket_id"`
+	Deleted  bool      `json:"deleted"`
+	Error    string    `json:"error,omitempty"`
 }
 
 // UsageStats reflects aggregate file statistics for a bucket.
@@ -22,3 +58,99 @@ type UsageStats struct {
 	TotalBytes int64 `json:"total_bytes"`
 	FileCount  int64 `json:"file_count"`
 }
+
+// DeletePreview summarizes what deleting a bucket would remove.
+type DeletePreview struct {
+	FileCount  int64 `json:"file_count"`
+	TotalBytes int64 `json:"total_bytes"`
+}
+
+// FilePreview is a compact view of a file shown alongside its bucket.
+type FilePreview struct {
+	ID               uuid.UUID `json:"id"`
+	OriginalFilename string    `json:"original_filename"`
+	SizeBytes        int64     `json:"size_bytes"`
+	ContentType      string    `json:"content_type"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+// AccountUsage aggregates usage across all of a user's buckets.
+type AccountUsage struct {
+	TotalBytes  int64 `json:"total_bytes"`
+	FileCount   int64 `json:"file_count"`
+	BucketCount int64 `json:"bucket_count"`
+}
+
+// ContentTypeStat aggregates a bucket's files sharing one content type.
+type ContentTypeStat struct {
+	ContentType string `json:"content_type"`
+	FileCount   int64  `json:"file_count"`
+	TotalBytes  int64  `json:"total_bytes"`
+}
+
+// SizeRangeStat aggregates a bucket's files within one size range of the histogram.
+type SizeRangeStat struct {
+	Range      string `json:"range"`
+	FileCount  int64  `json:"file_count"`
+	TotalBytes int64  `json:"total_bytes"`
+}
+
+// Size ranges reported by the bucket stats histogram.
+const (
+	SizeRangeSmall  = "<1MB"
+	SizeRangeMedium = "1-10MB"
+	SizeRangeLarge  = ">10MB"
+)
+
+// Stats breaks down what a bucket holds. ContentTypes is sorted by total bytes descending and
+// SizeHistogram always lists every range, smallest first.
+type Stats struct {
+	BucketID      uuid.UUID         `json:"bucket_id"`
+	ContentTypes  []ContentTypeStat `json:"content_types"`
+	SizeHistogram []SizeRangeStat   `json:"size_histogram"`
+}
+
+// ListOptions controls the ordering and window of bucket listings. A zero Limit returns all rows.
+type ListOptions struct {
+	Sort   string
+	Order  string
+	Limit  int
+	Offset int
+}
+
+// sortColumns maps accepted sort keys to trusted SQL expressions.
+var sortColumns = map[string]string{
+	"name":        "b.name",
+	"created_at":  "b.created_at",
+	"updated_at":  "b.updated_at",
+	"total_bytes": "total_bytes",
+	"file_count":  "file_count",
+}
+
+// normalize applies defaults and validates the options against the allowlist.
+func (o ListOptions) normalize() (ListOptions, error) {
+	o.Sort = strings.ToLower(strings.TrimSpace(o.Sort))
+	o.Order = strings.ToLower(strings.TrimSpace(o.Order))
+	if o.Sort == "" {
+		o.Sort = "created_at"
+	}
+	if o.Order == "" {
+		o.Order = "desc"
+	}
+	if _, ok := sortColumns[o.Sort]; !ok {
+		return ListOptions{}, ErrInvalidSort
+	}
+	if o.Order != "asc" && o.Order != "desc" {
+		return ListOptions{}, ErrInvalidSort
+	}
+	return o, nil
+}
+
+// orderBy renders the ORDER BY clause; options must already be normalized.
+func (o ListOptions) orderBy() string {
+	direction := "DESC"
+	if o.Order == "asc" {
+		direction = "ASC"
+	}
+	return fmt.Sprintf("ORDER BY %s %s, b.id %s", sortColumns[o.Sort], direction, direction)
+}
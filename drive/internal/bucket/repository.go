@@ -7,41 +7,61 @@ import (
 	"strings"
 	"time"
 
+	"github.com/abduss/godrive/internal/storage"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
-	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-const repositoryTimeout = 5 * time.Second
-
 // Repository allows access to bucket persistence.
 type Repository struct {
-	pool *pgxpool.Pool
+	db       storage.Querier
+	timeouts storage.QueryTimeouts
 }
 
 // NewRepository constructs a bucket repository.
-func NewRepository(pool *pgxpool.Pool) *Repository {
-	return &Repository{pool: pool}
+func NewRepository(db storage.Querier, timeouts storage.QueryTimeouts) *Repository {
+	return &Repository{db: db, timeouts: timeouts.WithDefaults()}
 }
 
+// bucketColumns lists the bucket fields selected alongside usage statistics.
+const bucketColumns = `
+       b.id,
+       b.owner_id,
+       b.name,
+       b.description,
+       b.allowed_content_types,
+       b.default_content_type,
+       b.max_file_size_bytes,
+       b.is_public,
+       b.immutable,
+       b.region,
+       b.created_at,
+       b.updated_at,
+       COALESCE(u.total_bytes, 0) AS total_bytes,
+       COALESCE(u.file_count, 0) AS file_count`
+
 // Create inserts a new bucket for the owner.
-func (r *Repository) Create(ctx context.Context, ownerID uuid.UUID, name string, description *string) (Bucket, error) {
-	ctx, cancel := context.WithTimeout(ctx, repositoryTimeout)
+func (r *Repository) Create(ctx context.Context, ownerID uuid.UUID, input CreateInput) (Bucket, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Write)
 	defer cancel()
 
-	name = strings.TrimSpace(name)
+	name := strings.TrimSpace(input.Name)
 	bucketID := uuid.New()
+	allowed := input.AllowedContentTypes
+	if allowed == nil {
+		allowed = []string{}
+	}
 
 	query := `
-INSERT INTO buckets (id, owner_id, name, description)
-VALUES ($1, $2, $3, $4)
-RETURNING id, owner_id, name, description, created_at, updated_at;`
+INSERT INTO buckets (id, owner_id, name, description, allowed_content_types, default_content_type, max_file_size_bytes, region, immutable)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+RETURNING id, owner_id, name, description, allowed_content_types, default_content_type, max_file_size_bytes, is_public, immutable, region, created_at, updated_at;`
 
-	row := r.pool.QueryRow(ctx, query, bucketID, ownerID, name, description)
+	row := r.db.QueryRow(ctx, query, bucketID, ownerID, name, input.Description, allowed, input.DefaultContentType, input.MaxFileSizeBytes, input.Region, input.Immutable)
 
 	var bucket Bucket
-	if err := row.Scan(&bucket.ID, &bucket.OwnerID, &bucket.Name, &bucket.Description, &bucket.CreatedAt, &bucket.UpdatedAt); err != nil {
+	if err := row.Scan(&bucket.ID, &bucket.OwnerID, &bucket.Name, &bucket.Description, &bucket.AllowedContentTypes, &bucket.DefaultContentType, &bucket.MaxFileSizeBytes, &bucket.IsPublic, &bucket.Immutable, &bucket.Region, &bucket.CreatedAt, &bucket.UpdatedAt); err != nil {
 		if isUniqueViolation(err) {
 			return Bucket{}, ErrBucketNameExists
 		}
@@ -55,26 +75,67 @@ RETURNING id, owner_id, name, description, created_at, updated_at;`
 	return bucket, nil
 }
 
-// List returns all buckets owned by the user.
-func (r *Repository) List(ctx context.Context, ownerID uuid.UUID) ([]Bucket, error) {
-	ctx, cancel := context.WithTimeout(ctx, repositoryTimeout)
+// ExistsByName reports whether the owner already has a bucket with the given
+// name, compared case-insensitively.
+func (r *Repository) ExistsByName(ctx context.Context, ownerID uuid.UUID, name string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Lookup)
+	defer cancel()
+
+	query := `SELECT EXISTS (SELECT 1 FROM buckets WHERE owner_id = $1 AND lower(name) = lower($2));`
+
+	var exists bool
+	if err := r.db.QueryRow(ctx, query, ownerID, strings.TrimSpace(name)).Scan(&exists); err != nil {
+		return false, fmt.Errorf("check bucket name: %w", err)
+	}
+	return exists, nil
+}
+
+// GetByName returns the owner's bucket whose name matches case-insensitively.
+func (r *Repository) GetByName(ctx context.Context, ownerID uuid.UUID, name string) (Bucket, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Lookup)
 	defer cancel()
 
 	query := `
-SELECT b.id,
-       b.owner_id,
-       b.name,
-       b.description,
-       b.created_at,
-       b.updated_at,
-       COALESCE(u.total_bytes, 0) AS total_bytes,
-       COALESCE(u.file_count, 0) AS file_count
+SELECT` + bucketColumns + `
+FROM buckets b
+LEFT JOIN bucket_usage u ON u.bucket_id = b.id
+WHERE b.owner_id = $1 AND lower(b.name) = lower($2);`
+
+	bucket, err := scanBucket(r.db.QueryRow(ctx, query, ownerID, strings.TrimSpace(name)))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Bucket{}, ErrBucketNotFound
+		}
+		return Bucket{}, fmt.Errorf("get bucket by name: %w", err)
+	}
+
+	return bucket, nil
+}
+
+// List returns all buckets owned by the user in the requested order.
+func (r *Repository) List(ctx context.Context, ownerID uuid.UUID, opts ListOptions) ([]Bucket, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.List)
+	defer cancel()
+
+	opts, err := opts.normalize()
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+SELECT` + bucketColumns + `
 FROM buckets b
 LEFT JOIN bucket_usage u ON u.bucket_id = b.id
 WHERE b.owner_id = $1
-ORDER BY b.created_at DESC;`
+` + opts.orderBy()
 
-	rows, err := r.pool.Query(ctx, query, ownerID)
+	args := []any{ownerID}
+	if opts.Limit > 0 {
+		query += " LIMIT $2 OFFSET $3"
+		args = append(args, opts.Limit, opts.Offset)
+	}
+
+	rows, err := r.db.Query(ctx, query+";", args...)
 	if err != nil {
 		return nil, fmt.Errorf("list buckets: %w", err)
 	}
@@ -82,8 +143,8 @@ ORDER BY b.created_at DESC;`
 
 	var buckets []Bucket
 	for rows.Next() {
-		var bucket Bucket
-		if err := rows.Scan(&bucket.ID, &bucket.OwnerID, &bucket.Name, &bucket.Description, &bucket.CreatedAt, &bucket.UpdatedAt, &bucket.Usage.TotalBytes, &bucket.Usage.FileCount); err != nil {
+		bucket, err := scanBucket(rows)
+		if err != nil {
 			return nil, fmt.Errorf("scan bucket: %w", err)
 		}
 		buckets = append(buckets, bucket)
@@ -94,35 +155,61 @@ ORDER BY b.created_at DESC;`
 	return buckets, nil
 }
 
+// RecentFiles returns up to limit of the newest files in each of the owner's buckets, keyed by
+// bucket ID, using a single windowed query rather than one query per bucket.
+func (r *Repository) RecentFiles(ctx context.Context, ownerID uuid.UUID, bucketIDs []uuid.UUID, limit int) (map[uuid.UUID][]FilePreview, error) {
+	previews := make(map[uuid.UUID][]FilePreview, len(bucketIDs))
+	if len(bucketIDs) == 0 || limit <= 0 {
+		return previews, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.List)
+	defer cancel()
+
+	query := `
+SELECT bucket_id, id, original_filename, size_bytes, content_type, created_at
+FROM (
+    SELECT f.bucket_id, f.id, f.original_filename, f.size_bytes, COALESCE(f.content_type, '') AS content_type, f.created_at,
+           ROW_NUMBER() OVER (PARTITION BY f.bucket_id ORDER BY f.created_at DESC, f.id DESC) AS rank
+    FROM files f
+    JOIN buckets b ON b.id = f.bucket_id
+    WHERE b.owner_id = $1 AND f.bucket_id = ANY($2)
+) ranked
+WHERE rank <= $3
+ORDER BY bucket_id, rank;`
+
+	rows, err := r.db.Query(ctx, query, ownerID, bucketIDs, limit)
+	if err != nil {
+		return nil, fmt.Errorf("recent files: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var bucketID uuid.UUID
+		var preview FilePreview
+		if err := rows.Scan(&bucketID, &preview.ID, &preview.OriginalFilename, &preview.SizeBytes, &preview.ContentType, &preview.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan recent file: %w", err)
+		}
+		previews[bucketID] = append(previews[bucketID], preview)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate recent files: %w", err)
+	}
+	return previews, nil
+}
+
 // Get fetches a single bucket ensuring ownership.
 func (r *Repository) Get(ctx context.Context, ownerID, bucketID uuid.UUID) (Bucket, error) {
-	ctx, cancel := context.WithTimeout(ctx, repositoryTimeout)
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Lookup)
 	defer cancel()
 
 	query := `
-SELECT b.id,
-       b.owner_id,
-       b.name,
-       b.description,
-       b.created_at,
-       b.updated_at,
-       COALESCE(u.total_bytes, 0) AS total_bytes,
-       COALESCE(u.file_count, 0) AS file_count
+SELECT` + bucketColumns + `
 FROM buckets b
 LEFT JOIN bucket_usage u ON u.bucket_id = b.id
 WHERE b.id = $1 AND b.owner_id = $2;`
 
-	var bucket Bucket
-	err := r.pool.QueryRow(ctx, query, bucketID, ownerID).Scan(
-		&bucket.ID,
-		&bucket.OwnerID,
-		&bucket.Name,
-		&bucket.Description,
-		&bucket.CreatedAt,
-		&bucket.UpdatedAt,
-		&bucket.Usage.TotalBytes,
-		&bucket.Usage.FileCount,
-	)
+	bucket, err := scanBucket(r.db.QueryRow(ctx, query, bucketID, ownerID))
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return Bucket{}, ErrBucketNotFound
@@ -133,12 +220,44 @@ WHERE b.id = $1 AND b.owner_id = $2;`
 	return bucket, nil
 }
 
+// Update applies the non-nil fields of input to a bucket owned by the user. When
+// input.IfUpdatedAt is set the row is only changed if its updated_at still equals it; otherwise
+// ErrVersionMismatch is returned.
+func (r *Repository) Update(ctx context.Context, ownerID, bucketID uuid.UUID, input UpdateInput) (Bucket, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	query := `
+UPDATE buckets
+SET description = COALESCE($3, description),
+    is_public   = COALESCE($4, is_public),
+    immutable   = immutable OR COALESCE($6, FALSE),
+    updated_at  = NOW()
+WHERE id = $1 AND owner_id = $2
+  AND ($5::timestamptz IS NULL OR updated_at = $5);`
+
+	commandTag, err := r.db.Exec(ctx, query, bucketID, ownerID, input.Description, input.IsPublic, input.IfUpdatedAt, input.Immutable)
+	if err != nil {
+		return Bucket{}, fmt.Errorf("update bucket: %w", err)
+	}
+	if commandTag.RowsAffected() == 0 {
+		if input.IfUpdatedAt == nil {
+			return Bucket{}, ErrBucketNotFound
+		}
+		if _, err := r.Get(ctx, ownerID, bucketID); err != nil {
+			return Bucket{}, err
+		}
+		return Bucket{}, ErrVersionMismatch
+	}
+	return r.Get(ctx, ownerID, bucketID)
+}
+
 // Delete removes a bucket owned by the user.
 func (r *Repository) Delete(ctx context.Context, ownerID, bucketID uuid.UUID) error {
-	ctx, cancel := context.WithTimeout(ctx, repositoryTimeout)
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Write)
 	defer cancel()
 
-	commandTag, err := r.pool.Exec(ctx, `DELETE FROM buckets WHERE id = $1 AND owner_id = $2;`, bucketID, ownerID)
+	commandTag, err := r.db.Exec(ctx, `DELETE FROM buckets WHERE id = $1 AND owner_id = $2;`, bucketID, ownerID)
 	if err != nil {
 		return fmt.Errorf("delete bucket: %w", err)
 	}
@@ -148,9 +267,23 @@ func (r *Repository) Delete(ctx context.Context, ownerID, bucketID uuid.UUID) er
 	return nil
 }
 
+// HasFilesSince reports whether the bucket holds any file created after since.
+func (r *Repository) HasFilesSince(ctx context.Context, bucketID uuid.UUID, since time.Time) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Lookup)
+	defer cancel()
+
+	query := `SELECT EXISTS (SELECT 1 FROM files WHERE bucket_id = $1 AND created_at > $2);`
+
+	var exists bool
+	if err := r.db.QueryRow(ctx, query, bucketID, since).Scan(&exists); err != nil {
+		return false, fmt.Errorf("check retained files: %w", err)
+	}
+	return exists, nil
+}
+
 // UpdateUsage increments or decrements usage statistics.
 func (r *Repository) UpdateUsage(ctx context.Context, bucketID uuid.UUID, deltaBytes int64, deltaFiles int64) error {
-	ctx, cancel := context.WithTimeout(ctx, repositoryTimeout)
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Write)
 	defer cancel()
 
 	query := `
@@ -162,36 +295,159 @@ DO UPDATE SET
     file_count  = GREATEST(bucket_usage.file_count + EXCLUDED.file_count, 0),
     updated_at  = NOW();`
 
-	if _, err := r.pool.Exec(ctx, query, bucketID, deltaBytes, deltaFiles); err != nil {
+	if _, err := r.db.Exec(ctx, query, bucketID, deltaBytes, deltaFiles); err != nil {
 		return fmt.Errorf("update usage: %w", err)
 	}
 	return nil
 }
 
-// RecordUsageSnapshot inserts an aggregate usage snapshot for the owner.
-func (r *Repository) RecordUsageSnapshot(ctx context.Context, ownerID uuid.UUID) error {
-	ctx, cancel := context.WithTimeout(ctx, repositoryTimeout)
+// RecomputeUsage overwrites the bucket's usage counters with totals summed from its file rows,
+// repairing counters that drifted from the incremental updates, and returns the corrected
+// usage. Like those updates it counts only file rows, not derived objects such as thumbnails.
+// It reports ErrBucketNotFound when the bucket does not exist.
+func (r *Repository) RecomputeUsage(ctx context.Context, bucketID uuid.UUID) (UsageStats, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Write)
 	defer cancel()
 
 	query := `
+INSERT INTO bucket_usage (bucket_id, total_bytes, file_count, updated_at)
+SELECT b.id, COALESCE(SUM(f.size_bytes), 0), COUNT(f.id), NOW()
+FROM buckets b
+LEFT JOIN files f ON f.bucket_id = b.id
+WHERE b.id = $1
+GROUP BY b.id
+ON CONFLICT (bucket_id)
+DO UPDATE SET
+    total_bytes = EXCLUDED.total_bytes,
+    file_count  = EXCLUDED.file_count,
+    updated_at  = NOW()
+RETURNING total_bytes, file_count;`
+
+	var usage UsageStats
+	if err := r.db.QueryRow(ctx, query, bucketID).Scan(&usage.TotalBytes, &usage.FileCount); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return UsageStats{}, ErrBucketNotFound
+		}
+		return UsageStats{}, fmt.Errorf("recompute usage: %w", err)
+	}
+	return usage, nil
+}
+
+// ownerUsageCTE sums bucket usage for the owner bound to $1.
+const ownerUsageCTE = `
 WITH stats AS (
     SELECT COALESCE(SUM(u.total_bytes), 0) AS total_bytes,
-           COALESCE(SUM(u.file_count), 0) AS file_count
+           COALESCE(SUM(u.file_count), 0) AS file_count,
+           COUNT(b.id) AS bucket_count
     FROM buckets b
     LEFT JOIN bucket_usage u ON u.bucket_id = b.id
     WHERE b.owner_id = $1
-)
+)`
+
+// AggregateUsage sums usage across all buckets owned by the user.
+func (r *Repository) AggregateUsage(ctx context.Context, ownerID uuid.UUID) (AccountUsage, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.List)
+	defer cancel()
+
+	query := ownerUsageCTE + `
+SELECT stats.total_bytes, stats.file_count, stats.bucket_count FROM stats;`
+
+	var usage AccountUsage
+	if err := r.db.QueryRow(ctx, query, ownerID).Scan(&usage.TotalBytes, &usage.FileCount, &usage.BucketCount); err != nil {
+		return AccountUsage{}, fmt.Errorf("aggregate usage: %w", err)
+	}
+	return usage, nil
+}
+
+// Stats groups the bucket's files by content type and by size range. Only buckets owned by
+// ownerID contribute rows.
+func (r *Repository) Stats(ctx context.Context, ownerID, bucketID uuid.UUID) (Stats, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.List)
+	defer cancel()
+
+	stats := Stats{BucketID: bucketID, ContentTypes: []ContentTypeStat{}}
+
+	typeQuery := `
+SELECT f.content_type, COUNT(*), COALESCE(SUM(f.size_bytes), 0)
+FROM files f
+JOIN buckets b ON b.id = f.bucket_id
+WHERE f.bucket_id = $1 AND b.owner_id = $2
+GROUP BY f.content_type
+ORDER BY 3 DESC, f.content_type;`
+
+	rows, err := r.db.Query(ctx, typeQuery, bucketID, ownerID)
+	if err != nil {
+		return Stats{}, fmt.Errorf("query content type stats: %w", err)
+	}
+	for rows.Next() {
+		var row ContentTypeStat
+		if err := rows.Scan(&row.ContentType, &row.FileCount, &row.TotalBytes); err != nil {
+			rows.Close()
+			return Stats{}, fmt.Errorf("scan content type stats: %w", err)
+		}
+		stats.ContentTypes = append(stats.ContentTypes, row)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return Stats{}, fmt.Errorf("iterate content type stats: %w", err)
+	}
+
+	sizeQuery := `
+SELECT
+    CASE
+        WHEN f.size_bytes < 1048576 THEN $3
+        WHEN f.size_bytes <= 10485760 THEN $4
+        ELSE $5
+    END AS size_range,
+    COUNT(*),
+    COALESCE(SUM(f.size_bytes), 0)
+FROM files f
+JOIN buckets b ON b.id = f.bucket_id
+WHERE f.bucket_id = $1 AND b.owner_id = $2
+GROUP BY size_range;`
+
+	ranges := map[string]SizeRangeStat{}
+	rows, err = r.db.Query(ctx, sizeQuery, bucketID, ownerID, SizeRangeSmall, SizeRangeMedium, SizeRangeLarge)
+	if err != nil {
+		return Stats{}, fmt.Errorf("query size stats: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var row SizeRangeStat
+		if err := rows.Scan(&row.Range, &row.FileCount, &row.TotalBytes); err != nil {
+			return Stats{}, fmt.Errorf("scan size stats: %w", err)
+		}
+		ranges[row.Range] = row
+	}
+	if err := rows.Err(); err != nil {
+		return Stats{}, fmt.Errorf("iterate size stats: %w", err)
+	}
+
+	for _, name := range []string{SizeRangeSmall, SizeRangeMedium, SizeRangeLarge} {
+		row := ranges[name]
+		row.Range = name
+		stats.SizeHistogram = append(stats.SizeHistogram, row)
+	}
+	return stats, nil
+}
+
+// RecordUsageSnapshot inserts an aggregate usage snapshot for the owner.
+func (r *Repository) RecordUsageSnapshot(ctx context.Context, ownerID uuid.UUID) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	query := ownerUsageCTE + `
 INSERT INTO usage_snapshots (user_id, total_bytes, file_count)
 SELECT $1, stats.total_bytes, stats.file_count FROM stats;`
 
-	if _, err := r.pool.Exec(ctx, query, ownerID); err != nil {
+	if _, err := r.db.Exec(ctx, query, ownerID); err != nil {
 		return fmt.Errorf("record usage snapshot: %w", err)
 	}
 	return nil
 }
 
 func (r *Repository) ensureUsageRow(ctx context.Context, bucketID uuid.UUID) error {
-	if _, err := r.pool.Exec(ctx, `
+	if _, err := r.db.Exec(ctx, `
 INSERT INTO bucket_usage (bucket_id, total_bytes, file_count)
 VALUES ($1, 0, 0)
 ON CONFLICT (bucket_id) DO NOTHING;
@@ -201,6 +457,27 @@ ON CONFLICT (bucket_id) DO NOTHING;
 	return nil
 }
 
+func scanBucket(row pgx.Row) (Bucket, error) {
+	var bucket Bucket
+	err := row.Scan(
+		&bucket.ID,
+		&bucket.OwnerID,
+		&bucket.Name,
+		&bucket.Description,
+		&bucket.AllowedContentTypes,
+		&bucket.DefaultContentType,
+		&bucket.MaxFileSizeBytes,
+		&bucket.IsPublic,
+		&bucket.Immutable,
+		&bucket.Region,
+		&bucket.CreatedAt,
+		&bucket.UpdatedAt,
+		&bucket.Usage.TotalBytes,
+		&bucket.Usage.FileCount,
+	)
+	return bucket, err
+}
+
 func isUniqueViolation(err error) bool {
 	var pgErr *pgconn.PgError
 	if errors.As(err, &pgErr) {
@@ -0,0 +1,463 @@
+package bucket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/abduss/godrive/internal/metrics"
+	"github.com/abduss/godrive/internal/storage"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// testPool connects to the database named by GODRIVE_TEST_DATABASE_URL, which must
+// already be migrated. Repository tests are skipped when it is unset.
+func testPool(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+	dsn := os.Getenv("GODRIVE_TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("GODRIVE_TEST_DATABASE_URL not set")
+	}
+	pool, err := pgxpool.New(context.Background(), dsn)
+	if err != nil {
+		t.Fatalf("connect test database: %v", err)
+	}
+	t.Cleanup(pool.Close)
+	return pool
+}
+
+// seedUser inserts a throwaway user; its buckets are removed by cascade on cleanup.
+func seedUser(t *testing.T, pool *pgxpool.Pool) uuid.UUID {
+	t.Helper()
+	ctx := context.Background()
+	var userID uuid.UUID
+	err := pool.QueryRow(ctx,
+		`INSERT INTO users (email, password_hash) VALUES ($1, 'x') RETURNING id;`,
+		"repo-test-"+uuid.NewString()+"@example.com",
+	).Scan(&userID)
+	if err != nil {
+		t.Fatalf("seed user: %v", err)
+	}
+	t.Cleanup(func() {
+		_, _ = pool.Exec(context.Background(), `DELETE FROM users WHERE id = $1;`, userID)
+	})
+	return userID
+}
+
+func TestRepositoryAggregateUsageSumsBuckets(t *testing.T) {
+	pool := testPool(t)
+	repo := NewRepository(pool, storage.QueryTimeouts{})
+	ctx := context.Background()
+	ownerID := seedUser(t, pool)
+	otherOwner := seedUser(t, pool)
+
+	for i, usage := range []struct{ bytes, files int64 }{{100, 2}, {250, 3}} {
+		created, err := repo.Create(ctx, ownerID, CreateInput{Name: fmt.Sprintf("bucket-%d", i)})
+		if err != nil {
+			t.Fatalf("create bucket: %v", err)
+		}
+		if err := repo.UpdateUsage(ctx, created.ID, usage.bytes, usage.files); err != nil {
+			t.Fatalf("update usage: %v", err)
+		}
+	}
+	foreign, err := repo.Create(ctx, otherOwner, CreateInput{Name: "foreign"})
+	if err != nil {
+		t.Fatalf("create foreign bucket: %v", err)
+	}
+	if err := repo.UpdateUsage(ctx, foreign.ID, 999, 9); err != nil {
+		t.Fatalf("update usage: %v", err)
+	}
+
+	usage, err := repo.AggregateUsage(ctx, ownerID)
+	if err != nil {
+		t.Fatalf("AggregateUsage returned error: %v", err)
+	}
+	want := AccountUsage{TotalBytes: 350, FileCount: 5, BucketCount: 2}
+	if usage != want {
+		t.Fatalf("expected %+v, got %+v", want, usage)
+	}
+}
+
+func TestRepositoryGetLoadsUsageForDeletePreview(t *testing.T) {
+	pool := testPool(t)
+	repo := NewRepository(pool, storage.QueryTimeouts{})
+	ctx := context.Background()
+	ownerID := seedUser(t, pool)
+
+	created, err := repo.Create(ctx, ownerID, CreateInput{Name: "doomed"})
+	if err != nil {
+		t.Fatalf("create bucket: %v", err)
+	}
+	if err := repo.UpdateUsage(ctx, created.ID, 4096, 7); err != nil {
+		t.Fatalf("update usage: %v", err)
+	}
+
+	service := NewService(repo, &fakeFileIndex{}, nil, "storage")
+	preview, err := service.DeletePreview(ctx, ownerID, created.ID)
+	if err != nil {
+		t.Fatalf("DeletePreview returned error: %v", err)
+	}
+	if want := (DeletePreview{FileCount: 7, TotalBytes: 4096}); preview != want {
+		t.Fatalf("expected %+v, got %+v", want, preview)
+	}
+	if _, err := service.DeletePreview(ctx, seedUser(t, pool), created.ID); err != ErrBucketNotFound {
+		t.Fatalf("expected ErrBucketNotFound for another owner, got %v", err)
+	}
+}
+
+func TestRepositoryRecentFilesUsesWindowPerBucket(t *testing.T) {
+	pool := testPool(t)
+	repo := NewRepository(pool, storage.QueryTimeouts{})
+	ctx := context.Background()
+	ownerID := seedUser(t, pool)
+
+	busy, err := repo.Create(ctx, ownerID, CreateInput{Name: "busy"})
+	if err != nil {
+		t.Fatalf("create bucket: %v", err)
+	}
+	quiet, err := repo.Create(ctx, ownerID, CreateInput{Name: "quiet"})
+	if err != nil {
+		t.Fatalf("create bucket: %v", err)
+	}
+	empty, err := repo.Create(ctx, ownerID, CreateInput{Name: "empty"})
+	if err != nil {
+		t.Fatalf("create bucket: %v", err)
+	}
+
+	insert := func(bucketID uuid.UUID, name string, age time.Duration) {
+		t.Helper()
+		_, err := pool.Exec(ctx, `
+INSERT INTO files (bucket_id, object_name, original_filename, size_bytes, content_type, created_at)
+VALUES ($1, $2, $3, 1, 'text/plain', NOW() - $4::interval);`,
+			bucketID, bucketID.String()+"/"+uuid.NewString(), name, fmt.Sprintf("%d seconds", int(age.Seconds())))
+		if err != nil {
+			t.Fatalf("insert file: %v", err)
+		}
+	}
+	for i := 0; i < 5; i++ {
+		insert(busy.ID, fmt.Sprintf("busy-%d", i), time.Duration(i)*time.Minute)
+	}
+	insert(quiet.ID, "quiet-0", time.Hour)
+
+	previews, err := repo.RecentFiles(ctx, ownerID, []uuid.UUID{busy.ID, quiet.ID, empty.ID}, 3)
+	if err != nil {
+		t.Fatalf("RecentFiles returned error: %v", err)
+	}
+
+	got := previews[busy.ID]
+	if len(got) != 3 {
+		t.Fatalf("expected 3 previews for busy bucket, got %d", len(got))
+	}
+	for i, want := range []string{"busy-0", "busy-1", "busy-2"} {
+		if got[i].OriginalFilename != want {
+			t.Fatalf("preview %d: expected %s, got %s", i, want, got[i].OriginalFilename)
+		}
+	}
+	if len(previews[quiet.ID]) != 1 {
+		t.Fatalf("expected 1 preview for quiet bucket, got %d", len(previews[quiet.ID]))
+	}
+	if len(previews[empty.ID]) != 0 {
+		t.Fatalf("expected no previews for empty bucket, got %d", len(previews[empty.ID]))
+	}
+
+	if foreign, err := repo.RecentFiles(ctx, seedUser(t, pool), []uuid.UUID{busy.ID}, 3); err != nil || len(foreign) != 0 {
+		t.Fatalf("expected other owners to see no previews, got %v (%v)", foreign, err)
+	}
+}
+
+func TestRepositoryListOrdersByTotalBytes(t *testing.T) {
+	pool := testPool(t)
+	repo := NewRepository(pool, storage.QueryTimeouts{})
+	ctx := context.Background()
+	ownerID := seedUser(t, pool)
+
+	sizes := map[string]int64{"small": 10, "large": 1000, "medium": 100}
+	for name, size := range sizes {
+		created, err := repo.Create(ctx, ownerID, CreateInput{Name: name})
+		if err != nil {
+			t.Fatalf("create bucket %s: %v", name, err)
+		}
+		if err := repo.UpdateUsage(ctx, created.ID, size, 1); err != nil {
+			t.Fatalf("update usage: %v", err)
+		}
+	}
+
+	buckets, err := repo.List(ctx, ownerID, ListOptions{Sort: "total_bytes", Order: "desc"})
+	if err != nil {
+		t.Fatalf("List returned error: %v", err)
+	}
+	want := []string{"large", "medium", "small"}
+	if len(buckets) != len(want) {
+		t.Fatalf("expected %d buckets, got %d", len(want), len(buckets))
+	}
+	for i, name := range want {
+		if buckets[i].Name != name {
+			t.Fatalf("position %d: expected %s, got %s", i, name, buckets[i].Name)
+		}
+	}
+
+	buckets, err = repo.List(ctx, ownerID, ListOptions{Sort: "total_bytes", Order: "asc"})
+	if err != nil {
+		t.Fatalf("List returned error: %v", err)
+	}
+	if buckets[0].Name != "small" {
+		t.Fatalf("expected ascending order to start with small, got %s", buckets[0].Name)
+	}
+}
+
+func TestRepositoryStatsGroupsByTypeAndSize(t *testing.T) {
+	pool := testPool(t)
+	repo := NewRepository(pool, storage.QueryTimeouts{})
+	ctx := context.Background()
+	ownerID := seedUser(t, pool)
+
+	target, err := repo.Create(ctx, ownerID, CreateInput{Name: "mixed"})
+	if err != nil {
+		t.Fatalf("create bucket: %v", err)
+	}
+	other, err := repo.Create(ctx, ownerID, CreateInput{Name: "other"})
+	if err != nil {
+		t.Fatalf("create bucket: %v", err)
+	}
+
+	const mb = 1024 * 1024
+	insert := func(bucketID uuid.UUID, contentType string, size int64) {
+		t.Helper()
+		_, err := pool.Exec(ctx, `
+INSERT INTO files (bucket_id, object_name, original_filename, size_bytes, content_type)
+VALUES ($1, $2, 'seed', $3, $4);`,
+			bucketID, bucketID.String()+"/"+uuid.NewString(), size, contentType)
+		if err != nil {
+			t.Fatalf("insert file: %v", err)
+		}
+	}
+	insert(target.ID, "text/plain", 100)
+	insert(target.ID, "text/plain", 200)
+	insert(target.ID, "image/png", 2*mb)
+	insert(target.ID, "video/mp4", 50*mb)
+	insert(target.ID, "image/png", 512)
+	insert(other.ID, "text/plain", 99*mb)
+
+	stats, err := repo.Stats(ctx, ownerID, target.ID)
+	if err != nil {
+		t.Fatalf("Stats returned error: %v", err)
+	}
+
+	wantTypes := []ContentTypeStat{
+		{ContentType: "video/mp4", FileCount: 1, TotalBytes: 50 * mb},
+		{ContentType: "image/png", FileCount: 2, TotalBytes: 2*mb + 512},
+		{ContentType: "text/plain", FileCount: 2, TotalBytes: 300},
+	}
+	if len(stats.ContentTypes) != len(wantTypes) {
+		t.Fatalf("expected %d content types, got %+v", len(wantTypes), stats.ContentTypes)
+	}
+	for i, want := range wantTypes {
+		if stats.ContentTypes[i] != want {
+			t.Fatalf("content type %d: expected %+v, got %+v", i, want, stats.ContentTypes[i])
+		}
+	}
+
+	wantSizes := []SizeRangeStat{
+		{Range: SizeRangeSmall, FileCount: 3, TotalBytes: 812},
+		{Range: SizeRangeMedium, FileCount: 1, TotalBytes: 2 * mb},
+		{Range: SizeRangeLarge, FileCount: 1, TotalBytes: 50 * mb},
+	}
+	for i, want := range wantSizes {
+		if stats.SizeHistogram[i] != want {
+			t.Fatalf("size range %d: expected %+v, got %+v", i, want, stats.SizeHistogram[i])
+		}
+	}
+
+	foreign, err := repo.Stats(ctx, seedUser(t, pool), target.ID)
+	if err != nil {
+		t.Fatalf("Stats returned error: %v", err)
+	}
+	if len(foreign.ContentTypes) != 0 || foreign.SizeHistogram[0].FileCount != 0 {
+		t.Fatalf("expected other owners to see no rows, got %+v", foreign)
+	}
+}
+
+func TestRepositoryUpdateRejectsStaleVersion(t *testing.T) {
+	pool := testPool(t)
+	repo := NewRepository(pool, storage.QueryTimeouts{})
+	ctx := context.Background()
+	ownerID := seedUser(t, pool)
+
+	created, err := repo.Create(ctx, ownerID, CreateInput{Name: "versioned"})
+	if err != nil {
+		t.Fatalf("create bucket: %v", err)
+	}
+	first := "first"
+	updated, err := repo.Update(ctx, ownerID, created.ID, UpdateInput{Description: &first, IfUpdatedAt: &created.UpdatedAt})
+	if err != nil {
+		t.Fatalf("update with current version: %v", err)
+	}
+
+	second := "second"
+	if _, err := repo.Update(ctx, ownerID, created.ID, UpdateInput{Description: &second, IfUpdatedAt: &created.UpdatedAt}); err != ErrVersionMismatch {
+		t.Fatalf("expected ErrVersionMismatch for a stale version, got %v", err)
+	}
+	current, err := repo.Get(ctx, ownerID, created.ID)
+	if err != nil {
+		t.Fatalf("get bucket: %v", err)
+	}
+	if current.Description == nil || *current.Description != first || !current.UpdatedAt.Equal(updated.UpdatedAt) {
+		t.Fatalf("expected the stale update to leave the bucket untouched, got %+v", current)
+	}
+
+	if _, err := repo.Update(ctx, ownerID, uuid.New(), UpdateInput{Description: &second, IfUpdatedAt: &created.UpdatedAt}); err != ErrBucketNotFound {
+		t.Fatalf("expected ErrBucketNotFound for a missing bucket, got %v", err)
+	}
+}
+
+func TestInstrumentedRepositoryRecordsQueryDuration(t *testing.T) {
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(metrics.DBQueryDuration)
+
+	repo := NewRepository(storage.Instrument(noRowsQuerier{}, metrics.ObserveDBQuery), storage.QueryTimeouts{})
+	if _, err := repo.Get(context.Background(), uuid.New(), uuid.New()); err != ErrBucketNotFound {
+		t.Fatalf("expected ErrBucketNotFound, got %v", err)
+	}
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("gather metrics: %v", err)
+	}
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetValue() == "bucket.Get" && metric.GetHistogram().GetSampleCount() > 0 {
+					return
+				}
+			}
+		}
+	}
+	t.Fatalf("expected a db_query_duration_seconds sample for bucket.Get, got %v", families)
+}
+
+// noRowsQuerier answers every single-row query with pgx.ErrNoRows.
+type noRowsQuerier struct {
+	storage.Querier
+}
+
+func (noRowsQuerier) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	return noRow{}
+}
+
+type noRow struct{}
+
+func (noRow) Scan(dest ...any) error { return pgx.ErrNoRows }
+
+func TestRepositoryBoundsListingsByTheListTimeout(t *testing.T) {
+	repo := NewRepository(slowQuerier{delay: 50 * time.Millisecond}, storage.QueryTimeouts{
+		Lookup: 10 * time.Millisecond,
+		List:   time.Second,
+	})
+
+	if _, err := repo.List(context.Background(), uuid.New(), ListOptions{}); err != nil {
+		t.Fatalf("expected the slow listing to finish within the list timeout, got %v", err)
+	}
+	if _, err := repo.Get(context.Background(), uuid.New(), uuid.New()); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the slow lookup to hit the lookup timeout, got %v", err)
+	}
+}
+
+// slowQuerier answers every query with no rows after delay, or with the context's error if it
+// ends first.
+type slowQuerier struct {
+	storage.Querier
+	delay time.Duration
+}
+
+func (q slowQuerier) wait(ctx context.Context) error {
+	select {
+	case <-time.After(q.delay):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (q slowQuerier) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	if err := q.wait(ctx); err != nil {
+		return nil, err
+	}
+	return emptyRows{}, nil
+}
+
+func (q slowQuerier) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	if err := q.wait(ctx); err != nil {
+		return errRow{err: err}
+	}
+	return noRow{}
+}
+
+type errRow struct{ err error }
+
+func (r errRow) Scan(dest ...any) error { return r.err }
+
+// emptyRows is a result set without rows.
+type emptyRows struct {
+	pgx.Rows
+}
+
+func (emptyRows) Next() bool { return false }
+func (emptyRows) Err() error { return nil }
+func (emptyRows) Close()     {}
+
+func TestRepositoryRecomputeUsageCorrectsDriftedCounters(t *testing.T) {
+	pool := testPool(t)
+	repo := NewRepository(pool, storage.QueryTimeouts{})
+	ctx := context.Background()
+	ownerID := seedUser(t, pool)
+
+	drifted, err := repo.Create(ctx, ownerID, CreateInput{Name: "drifted"})
+	if err != nil {
+		t.Fatalf("create bucket: %v", err)
+	}
+	for _, size := range []int64{100, 250, 4096} {
+		_, err := pool.Exec(ctx, `
+INSERT INTO files (bucket_id, object_name, original_filename, size_bytes, content_type)
+VALUES ($1, $2, 'seed', $3, 'text/plain');`,
+			drifted.ID, drifted.ID.String()+"/"+uuid.NewString(), size)
+		if err != nil {
+			t.Fatalf("insert file: %v", err)
+		}
+	}
+	if err := repo.UpdateUsage(ctx, drifted.ID, 999_999, 42); err != nil {
+		t.Fatalf("update usage: %v", err)
+	}
+
+	usage, err := repo.RecomputeUsage(ctx, drifted.ID)
+	if err != nil {
+		t.Fatalf("RecomputeUsage returned error: %v", err)
+	}
+	want := UsageStats{TotalBytes: 4446, FileCount: 3}
+	if usage != want {
+		t.Fatalf("expected recomputed %+v, got %+v", want, usage)
+	}
+	stored, err := repo.Get(ctx, ownerID, drifted.ID)
+	if err != nil {
+		t.Fatalf("get bucket: %v", err)
+	}
+	if stored.Usage.TotalBytes != want.TotalBytes || stored.Usage.FileCount != want.FileCount {
+		t.Fatalf("expected stored usage overwritten with %+v, got %+v", want, stored.Usage)
+	}
+
+	fresh, err := repo.Create(ctx, ownerID, CreateInput{Name: "no-usage-row"})
+	if err != nil {
+		t.Fatalf("create bucket: %v", err)
+	}
+	if usage, err := repo.RecomputeUsage(ctx, fresh.ID); err != nil || usage != (UsageStats{}) {
+		t.Fatalf("expected zero usage for an empty bucket, got %+v, %v", usage, err)
+	}
+	if _, err := repo.RecomputeUsage(ctx, uuid.New()); err != ErrBucketNotFound {
+		t.Fatalf("expected ErrBucketNotFound for an unknown bucket, got %v", err)
+	}
+}
@@ -2,9 +2,16 @@ package bucket
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
 
+	"github.com/abduss/godrive/internal/audit"
+	"github.com/abduss/godrive/internal/events"
+	"github.com/abduss/godrive/internal/storage"
 	"github.com/google/uuid"
 	"github.com/minio/minio-go/v7"
 )
@@ -20,44 +27,253 @@ type FileIndex interface {
 	ListObjectsForBucket(ctx context.Context, bucketID uuid.UUID) ([]FileObject, error)
 }
 
+// objectRemover deletes stored objects; satisfied by *minio.Client and the file package's stores.
+type objectRemover interface {
+	RemoveObject(ctx context.Context, bucketName, objectName string, opts minio.RemoveObjectOptions) error
+}
+
+// auditor records mutating operations; *audit.Service writes them asynchronously.
+type auditor interface {
+	Record(ctx context.Context, userID uuid.UUID, action, resourceType string, resourceID uuid.UUID, metadata map[string]any)
+}
+
+// publisher announces bucket lifecycle events; *events.Bus delivers them asynchronously.
+type publisher interface {
+	Publish(ctx context.Context, e events.Event)
+}
+
 type repository interface {
-	Create(ctx context.Context, ownerID uuid.UUID, name string, description *string) (Bucket, error)
-	List(ctx context.Context, ownerID uuid.UUID) ([]Bucket, error)
+	Create(ctx context.Context, ownerID uuid.UUID, input CreateInput) (Bucket, error)
+	ExistsByName(ctx context.Context, ownerID uuid.UUID, name string) (bool, error)
+	GetByName(ctx context.Context, ownerID uuid.UUID, name string) (Bucket, error)
+	List(ctx context.Context, ownerID uuid.UUID, opts ListOptions) ([]Bucket, error)
 	Get(ctx context.Context, ownerID, bucketID uuid.UUID) (Bucket, error)
+	Update(ctx context.Context, ownerID, bucketID uuid.UUID, input UpdateInput) (Bucket, error)
 	Delete(ctx context.Context, ownerID, bucketID uuid.UUID) error
+	HasFilesSince(ctx context.Context, bucketID uuid.UUID, since time.Time) (bool, error)
 	RecordUsageSnapshot(ctx context.Context, ownerID uuid.UUID) error
+	RecomputeUsage(ctx context.Context, bucketID uuid.UUID) (UsageStats, error)
+	AggregateUsage(ctx context.Context, ownerID uuid.UUID) (AccountUsage, error)
+	RecentFiles(ctx context.Context, ownerID uuid.UUID, bucketIDs []uuid.UUID, limit int) (map[uuid.UUID][]FilePreview, error)
+	Stats(ctx context.Context, ownerID, bucketID uuid.UUID) (Stats, error)
 }
 
+// DefaultMaxDescriptionLength is the longest bucket description accepted unless overridden.
+const DefaultMaxDescriptionLength = 255
+
+// DefaultImmutableRetention is how long files in an immutable bucket are protected unless
+// overridden.
+const DefaultImmutableRetention = 30 * 24 * time.Hour
+
 // Service orchestrates bucket operations.
 type Service struct {
-	repo         repository
-	files        FileIndex
-	objectStore  *minio.Client
-	objectBucket string
+	repo           repository
+	files          FileIndex
+	objectStore    objectRemover
+	objectBucket   string
+	auditor        auditor
+	publisher      publisher
+	maxDescription int
+	publicDisabled bool
+	pricePerGB     float64
+	retention      time.Duration
+	tenants        *storage.TenantBuckets
 }
 
 // NewService constructs a bucket service.
-func NewService(repo repository, files FileIndex, store *minio.Client, objectBucket string) *Service {
+func NewService(repo repository, files FileIndex, store objectRemover, objectBucket string) *Service {
 	return &Service{
-		repo:         repo,
-		files:        files,
-		objectStore:  store,
-		objectBucket: objectBucket,
+		repo:           repo,
+		files:          files,
+		objectStore:    store,
+		objectBucket:   objectBucket,
+		maxDescription: DefaultMaxDescriptionLength,
+		retention:      DefaultImmutableRetention,
+	}
+}
+
+// SetMaxDescriptionLength caps bucket descriptions at limit characters. Non-positive values
+// restore the default.
+func (s *Service) SetMaxDescriptionLength(limit int) {
+	if limit <= 0 {
+		limit = DefaultMaxDescriptionLength
+	}
+	s.maxDescription = limit
+}
+
+// SetPublicBucketsEnabled controls whether buckets may be made public. Disabling it leaves
+// existing public buckets flagged; their public routes are gated separately.
+func (s *Service) SetPublicBucketsEnabled(enabled bool) {
+	s.publicDisabled = !enabled
+}
+
+// SetTenantBuckets removes a deleted bucket's objects from the physical bucket t maps its owner
+// to. It must match the file service's mapping; nil uses the shared bucket.
+func (s *Service) SetTenantBuckets(t *storage.TenantBuckets) {
+	s.tenants = t
+}
+
+// SetImmutableRetention sets how long after upload a file in an immutable bucket stays
+// protected; an immutable bucket cannot be deleted while it holds such files. Non-positive values
+// restore the default.
+func (s *Service) SetImmutableRetention(retention time.Duration) {
+	if retention <= 0 {
+		retention = DefaultImmutableRetention
+	}
+	s.retention = retention
+}
+
+// normalizeDescription trims surrounding whitespace and enforces the length limit, counted in
+// characters rather than bytes.
+func (s *Service) normalizeDescription(description *string) (*string, error) {
+	if description == nil {
+		return nil, nil
+	}
+	trimmed := strings.TrimSpace(*description)
+	if utf8.RuneCountInString(trimmed) > s.maxDescription {
+		return nil, ErrInvalidDescription
 	}
+	return &trimmed, nil
+}
+
+// SetAuditor records bucket creates, updates, and deletes. A nil auditor disables auditing.
+func (s *Service) SetAuditor(a auditor) {
+	s.auditor = a
+}
+
+// SetPublisher announces bucket creation and deletion. A nil publisher disables events.
+func (s *Service) SetPublisher(p publisher) {
+	s.publisher = p
+}
+
+func (s *Service) publish(ctx context.Context, eventType events.Type, ownerID uuid.UUID, b Bucket) {
+	if s.publisher == nil {
+		return
+	}
+	s.publisher.Publish(ctx, events.Event{Type: eventType, UserID: ownerID, BucketID: b.ID, Name: b.Name, SizeBytes: b.Usage.TotalBytes})
+}
+
+func (s *Service) audit(ctx context.Context, ownerID uuid.UUID, action string, b Bucket) {
+	if s.auditor == nil {
+		return
+	}
+	s.auditor.Record(ctx, ownerID, action, audit.ResourceBucket, b.ID, map[string]any{"name": b.Name})
 }
 
 // CreateBucket creates a new bucket for the owner.
-func (s *Service) CreateBucket(ctx context.Context, ownerID uuid.UUID, name string, description *string) (Bucket, error) {
-	name = strings.TrimSpace(name)
-	if name == "" {
+func (s *Service) CreateBucket(ctx context.Context, ownerID uuid.UUID, input CreateInput) (Bucket, error) {
+	input.Name = strings.TrimSpace(input.Name)
+	if input.Name == "" {
 		return Bucket{}, fmt.Errorf("bucket name required")
 	}
-	return s.repo.Create(ctx, ownerID, name, description)
+
+	description, err := s.normalizeDescription(input.Description)
+	if err != nil {
+		return Bucket{}, err
+	}
+	if description != nil && *description == "" {
+		description = nil
+	}
+	input.Description = description
+
+	allowed, err := normalizeContentTypePatterns(input.AllowedContentTypes)
+	if err != nil {
+		return Bucket{}, err
+	}
+	input.AllowedContentTypes = allowed
+
+	if input.DefaultContentType != nil {
+		defaultType, err := normalizeDefaultContentType(*input.DefaultContentType)
+		if err != nil {
+			return Bucket{}, err
+		}
+		if !(Bucket{AllowedContentTypes: allowed}).AllowsContentType(defaultType) {
+			return Bucket{}, ErrInvalidContentType
+		}
+		input.DefaultContentType = &defaultType
+	}
+
+	if input.MaxFileSizeBytes != nil && *input.MaxFileSizeBytes <= 0 {
+		return Bucket{}, ErrInvalidMaxFileSize
+	}
+
+	if input.Region != nil {
+		region := strings.ToLower(strings.TrimSpace(*input.Region))
+		if region == "" {
+			input.Region = nil
+		} else {
+			input.Region = &region
+		}
+	}
+
+	// The pre-check gives a clear conflict for the common case; the unique
+	// index still guards against concurrent creates.
+	exists, err := s.repo.ExistsByName(ctx, ownerID, input.Name)
+	if err != nil {
+		return Bucket{}, err
+	}
+	if exists {
+		return Bucket{}, ErrBucketNameExists
+	}
+
+	created, err := s.repo.Create(ctx, ownerID, input)
+	if err != nil {
+		return Bucket{}, err
+	}
+	s.audit(ctx, ownerID, audit.ActionCreate, created)
+	s.publish(ctx, events.BucketCreated, ownerID, created)
+	return created, nil
 }
 
-// ListBuckets returns the user's buckets.
-func (s *Service) ListBuckets(ctx context.Context, ownerID uuid.UUID) ([]Bucket, error) {
-	return s.repo.List(ctx, ownerID)
+// DefaultBucketProvisioner creates a bucket called Name for newly registered users so their
+// first upload has somewhere to go.
+type DefaultBucketProvisioner struct {
+	Service *Service
+	Name    string
+}
+
+// ProvisionUser creates the default bucket for userID.
+func (p DefaultBucketProvisioner) ProvisionUser(ctx context.Context, userID uuid.UUID) error {
+	_, err := p.Service.CreateBucket(ctx, userID, CreateInput{Name: p.Name})
+	return err
+}
+
+// CreateOrGetBucket creates the bucket like CreateBucket, but when the owner already has a
+// bucket of that name it returns that bucket instead of ErrBucketNameExists. created reports
+// which happened. The existing bucket is returned as is, even if input describes it differently.
+func (s *Service) CreateOrGetBucket(ctx context.Context, ownerID uuid.UUID, input CreateInput) (b Bucket, created bool, err error) {
+	b, err = s.CreateBucket(ctx, ownerID, input)
+	if err == nil {
+		return b, true, nil
+	}
+	if !errors.Is(err, ErrBucketNameExists) {
+		return Bucket{}, false, err
+	}
+	// A concurrent create may also land here through the unique index, so look the bucket up
+	// rather than trusting the earlier existence check.
+	b, err = s.repo.GetByName(ctx, ownerID, input.Name)
+	if err != nil {
+		return Bucket{}, false, err
+	}
+	return b, false, nil
+}
+
+// ListBuckets returns the user's buckets ordered according to opts.
+func (s *Service) ListBuckets(ctx context.Context, ownerID uuid.UUID, opts ListOptions) ([]Bucket, error) {
+	opts, err := opts.normalize()
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.List(ctx, ownerID, opts)
+}
+
+// RecentFiles returns the newest files of each listed bucket, keyed by bucket ID.
+func (s *Service) RecentFiles(ctx context.Context, ownerID uuid.UUID, buckets []Bucket, limit int) (map[uuid.UUID][]FilePreview, error) {
+	ids := make([]uuid.UUID, len(buckets))
+	for i, b := range buckets {
+		ids[i] = b.ID
+	}
+	return s.repo.RecentFiles(ctx, ownerID, ids, limit)
 }
 
 // GetBucket returns a bucket ensuring ownership.
@@ -65,38 +281,211 @@ func (s *Service) GetBucket(ctx context.Context, ownerID, bucketID uuid.UUID) (B
 	return s.repo.Get(ctx, ownerID, bucketID)
 }
 
+// UpdateBucket changes mutable bucket attributes such as the description and public-read flag.
+// A bucket can be made immutable but never made mutable again.
+func (s *Service) UpdateBucket(ctx context.Context, ownerID, bucketID uuid.UUID, input UpdateInput) (Bucket, error) {
+	description, err := s.normalizeDescription(input.Description)
+	if err != nil {
+		return Bucket{}, err
+	}
+	input.Description = description
+	if s.publicDisabled && input.IsPublic != nil && *input.IsPublic {
+		return Bucket{}, ErrPublicBucketsDisabled
+	}
+	if input.Immutable != nil && !*input.Immutable {
+		existing, err := s.repo.Get(ctx, ownerID, bucketID)
+		if err != nil {
+			return Bucket{}, err
+		}
+		if existing.Immutable {
+			return Bucket{}, ErrImmutableBucket
+		}
+	}
+
+	updated, err := s.repo.Update(ctx, ownerID, bucketID, input)
+	if err != nil {
+		return Bucket{}, err
+	}
+	s.audit(ctx, ownerID, audit.ActionUpdate, updated)
+	return updated, nil
+}
+
+// BucketStats returns content type and size breakdowns for one of the owner's buckets.
+func (s *Service) BucketStats(ctx context.Context, ownerID, bucketID uuid.UUID) (Stats, error) {
+	if _, err := s.repo.Get(ctx, ownerID, bucketID); err != nil {
+		return Stats{}, err
+	}
+	return s.repo.Stats(ctx, ownerID, bucketID)
+}
+
+// DeletePreview reports how many files and bytes deleting the owner's bucket would remove. It
+// reads the tracked usage loaded with the bucket, so it costs a single query.
+func (s *Service) DeletePreview(ctx context.Context, ownerID, bucketID uuid.UUID) (DeletePreview, error) {
+	b, err := s.repo.Get(ctx, ownerID, bucketID)
+	if err != nil {
+		return DeletePreview{}, err
+	}
+	return DeletePreview{FileCount: b.Usage.FileCount, TotalBytes: b.Usage.TotalBytes}, nil
+}
+
+// AccountUsage returns the user's storage usage summed across all buckets.
+func (s *Service) AccountUsage(ctx context.Context, ownerID uuid.UUID) (AccountUsage, error) {
+	return s.repo.AggregateUsage(ctx, ownerID)
+}
+
+// RecomputeUsage rebuilds the bucket's usage counters from its files. Owners may recompute
+// their own buckets; admins may recompute any bucket.
+func (s *Service) RecomputeUsage(ctx context.Context, userID, bucketID uuid.UUID, isAdmin bool) (UsageStats, error) {
+	if !isAdmin {
+		if _, err := s.repo.Get(ctx, userID, bucketID); err != nil {
+			return UsageStats{}, err
+		}
+	}
+	return s.repo.RecomputeUsage(ctx, bucketID)
+}
+
+// SetStoragePrice sets the price per GB-month used by EstimateCost. Negative prices are
+// treated as zero.
+func (s *Service) SetStoragePrice(pricePerGB float64) {
+	s.pricePerGB = max(pricePerGB, 0)
+}
+
+// EstimateCost projects the owner's monthly storage cost, in total and per bucket, from the
+// stored usage counters.
+func (s *Service) EstimateCost(ctx context.Context, ownerID uuid.UUID) (CostEstimate, error) {
+	usage, err := s.repo.AggregateUsage(ctx, ownerID)
+	if err != nil {
+		return CostEstimate{}, err
+	}
+	buckets, err := s.repo.List(ctx, ownerID, ListOptions{Sort: "total_bytes", Order: "desc"})
+	if err != nil {
+		return CostEstimate{}, err
+	}
+	return EstimateCost(usage, buckets, s.pricePerGB), nil
+}
+
 // DeleteBucket removes a bucket, its metadata, and stored objects.
 func (s *Service) DeleteBucket(ctx context.Context, ownerID, bucketID uuid.UUID) error {
-	if _, err := s.repo.Get(ctx, ownerID, bucketID); err != nil {
+	if err := s.deleteBucket(ctx, ownerID, bucketID); err != nil {
+		return err
+	}
+	if err := s.repo.RecordUsageSnapshot(ctx, ownerID); err != nil {
 		return err
 	}
+	return nil
+}
+
+// cleanupConcurrency bounds how many objects deleteObjects removes at once.
+const cleanupConcurrency = 8
+
+// MaxBatchDeleteSize caps how many buckets one batch delete may name.
+const MaxBatchDeleteSize = 100
+
+// DeleteBuckets deletes each of the owner's buckets in turn and reports a result per requested
+// ID in request order. A failure on one bucket does not stop the others. The usage snapshot is
+// recorded once at the end if anything was deleted.
+func (s *Service) DeleteBuckets(ctx context.Context, ownerID uuid.UUID, bucketIDs []uuid.UUID) ([]DeleteResult, error) {
+	if len(bucketIDs) == 0 {
+		return nil, ErrEmptyBatch
+	}
+	if len(bucketIDs) > MaxBatchDeleteSize {
+		return nil, ErrBatchTooLarge
+	}
+
+	results := make([]DeleteResult, len(bucketIDs))
+	seen := make(map[uuid.UUID]bool, len(bucketIDs))
+	deleted := 0
+	for i, bucketID := range bucketIDs {
+		results[i].BucketID = bucketID
+		if seen[bucketID] {
+			results[i].Error = "duplicate bucket id"
+			continue
+		}
+		seen[bucketID] = true
+
+		if err := s.deleteBucket(ctx, ownerID, bucketID); err != nil {
+			if err == ErrBucketNotFound || err == ErrRetentionActive {
+				results[i].Error = err.Error()
+			} else {
+				results[i].Error = "failed to delete bucket"
+			}
+			continue
+		}
+		results[i].Deleted = true
+		deleted++
+	}
 
-	if err := s.deleteObjects(ctx, bucketID); err != nil {
+	if deleted > 0 {
+		if err := s.repo.RecordUsageSnapshot(ctx, ownerID); err != nil {
+			return results, err
+		}
+	}
+	return results, nil
+}
+
+func (s *Service) deleteBucket(ctx context.Context, ownerID, bucketID uuid.UUID) error {
+	existing, err := s.repo.Get(ctx, ownerID, bucketID)
+	if err != nil {
 		return err
 	}
+	if existing.Immutable {
+		retained, err := s.repo.HasFilesSince(ctx, bucketID, time.Now().Add(-s.retention))
+		if err != nil {
+			return err
+		}
+		if retained {
+			return ErrRetentionActive
+		}
+	}
 
-	if err := s.repo.Delete(ctx, ownerID, bucketID); err != nil {
+	if err := s.deleteObjects(ctx, ownerID, bucketID); err != nil {
 		return err
 	}
 
-	if err := s.repo.RecordUsageSnapshot(ctx, ownerID); err != nil {
+	if err := s.repo.Delete(ctx, ownerID, bucketID); err != nil {
 		return err
 	}
+	s.audit(ctx, ownerID, audit.ActionDelete, existing)
+	s.publish(ctx, events.BucketDeleted, ownerID, existing)
 	return nil
 }
 
-func (s *Service) deleteObjects(ctx context.Context, bucketID uuid.UUID) error {
+// deleteObjects removes every object in the bucket with at most cleanupConcurrency removals in
+// flight. Individual failures do not stop the rest; they are joined into the returned error so
+// the caller can keep the bucket metadata and the delete can be retried.
+func (s *Service) deleteObjects(ctx context.Context, ownerID, bucketID uuid.UUID) error {
 	if s.objectStore == nil || s.files == nil {
 		return nil
 	}
+	objectBucket := s.objectBucket
+	if s.tenants != nil {
+		resolved, err := s.tenants.Resolve(ctx, ownerID)
+		if err != nil {
+			return fmt.Errorf("resolve object bucket: %w", err)
+		}
+		objectBucket = resolved
+	}
 	objects, err := s.files.ListObjectsForBucket(ctx, bucketID)
 	if err != nil {
 		return fmt.Errorf("list bucket objects: %w", err)
 	}
-	for _, obj := range objects {
-		if err := s.objectStore.RemoveObject(ctx, s.objectBucket, obj.ObjectName, minio.RemoveObjectOptions{}); err != nil {
-			return fmt.Errorf("remove object %s: %w", obj.ObjectName, err)
-		}
+
+	errs := make([]error, len(objects))
+	sem := make(chan struct{}, cleanupConcurrency)
+	var wg sync.WaitGroup
+	for i, obj := range objects {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, objectName string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if err := s.objectStore.RemoveObject(ctx, objectBucket, objectName, minio.RemoveObjectOptions{}); err != nil {
+				errs[i] = fmt.Errorf("remove object %s: %w", objectName, err)
+			}
+		}(i, obj.ObjectName)
 	}
-	return nil
+	wg.Wait()
+	return errors.Join(errs...)
 }
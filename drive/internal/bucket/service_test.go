@@ -2,9 +2,17 @@ package bucket
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/abduss/godrive/internal/audit"
+	"github.com/abduss/godrive/internal/pagination"
 	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
 )
 
 func TestCreateAndListBuckets(t *testing.T) {
@@ -13,7 +21,7 @@ func TestCreateAndListBuckets(t *testing.T) {
 
 	ownerID := uuid.New()
 	description := "personal docs"
-	created, err := service.CreateBucket(context.Background(), ownerID, "documents", &description)
+	created, err := service.CreateBucket(context.Background(), ownerID, CreateInput{Name: "documents", Description: &description})
 	if err != nil {
 		t.Fatalf("CreateBucket returned error: %v", err)
 	}
@@ -22,7 +30,7 @@ func TestCreateAndListBuckets(t *testing.T) {
 		t.Fatalf("expected bucket name documents, got %s", created.Name)
 	}
 
-	buckets, err := service.ListBuckets(context.Background(), ownerID)
+	buckets, err := service.ListBuckets(context.Background(), ownerID, ListOptions{})
 	if err != nil {
 		t.Fatalf("ListBuckets returned error: %v", err)
 	}
@@ -37,22 +45,40 @@ func TestCreateBucketDuplicateName(t *testing.T) {
 	service := NewService(repo, &fakeFileIndex{}, nil, "storage")
 
 	ownerID := uuid.New()
-	if _, err := service.CreateBucket(context.Background(), ownerID, "photos", nil); err != nil {
+	if _, err := service.CreateBucket(context.Background(), ownerID, CreateInput{Name: "photos"}); err != nil {
 		t.Fatalf("unexpected error creating bucket: %v", err)
 	}
 
-	if _, err := service.CreateBucket(context.Background(), ownerID, "photos", nil); err != ErrBucketNameExists {
+	if _, err := service.CreateBucket(context.Background(), ownerID, CreateInput{Name: "photos"}); err != ErrBucketNameExists {
 		t.Fatalf("expected ErrBucketNameExists, got %v", err)
 	}
 }
 
+func TestDefaultBucketProvisionerCreatesBucket(t *testing.T) {
+	repo := newFakeRepo()
+	service := NewService(repo, &fakeFileIndex{}, nil, "storage")
+	provisioner := DefaultBucketProvisioner{Service: service, Name: "default"}
+
+	userID := uuid.New()
+	if err := provisioner.ProvisionUser(context.Background(), userID); err != nil {
+		t.Fatalf("ProvisionUser returned error: %v", err)
+	}
+	buckets, err := service.ListBuckets(context.Background(), userID, ListOptions{})
+	if err != nil {
+		t.Fatalf("ListBuckets returned error: %v", err)
+	}
+	if len(buckets) != 1 || buckets[0].Name != "default" {
+		t.Fatalf("expected a default bucket, got %+v", buckets)
+	}
+}
+
 func TestDeleteBucketInvokesFileCleanup(t *testing.T) {
 	repo := newFakeRepo()
 	fileIndex := &fakeFileIndex{}
 	service := NewService(repo, fileIndex, nil, "storage")
 
 	ownerID := uuid.New()
-	bucket, err := service.CreateBucket(context.Background(), ownerID, "temp", nil)
+	bucket, err := service.CreateBucket(context.Background(), ownerID, CreateInput{Name: "temp"})
 	if err != nil {
 		t.Fatalf("CreateBucket returned error: %v", err)
 	}
@@ -66,11 +92,281 @@ func TestDeleteBucketInvokesFileCleanup(t *testing.T) {
 	}
 }
 
+func TestDeleteImmutableBucketIsRejectedDuringRetention(t *testing.T) {
+	repo := newFakeRepo()
+	service := NewService(repo, &fakeFileIndex{}, nil, "storage")
+	service.SetImmutableRetention(24 * time.Hour)
+
+	ownerID := uuid.New()
+	bucket, err := service.CreateBucket(context.Background(), ownerID, CreateInput{Name: "ledger", Immutable: true})
+	if err != nil {
+		t.Fatalf("CreateBucket returned error: %v", err)
+	}
+	repo.newestFile = map[uuid.UUID]time.Time{bucket.ID: time.Now().Add(-time.Hour)}
+
+	if err := service.DeleteBucket(context.Background(), ownerID, bucket.ID); err != ErrRetentionActive {
+		t.Fatalf("expected ErrRetentionActive, got %v", err)
+	}
+	if _, err := repo.Get(context.Background(), ownerID, bucket.ID); err != nil {
+		t.Fatalf("expected the bucket to be kept, got %v", err)
+	}
+
+	mutable := false
+	if _, err := service.UpdateBucket(context.Background(), ownerID, bucket.ID, UpdateInput{Immutable: &mutable}); err != ErrImmutableBucket {
+		t.Fatalf("expected ErrImmutableBucket when clearing the flag, got %v", err)
+	}
+
+	repo.newestFile[bucket.ID] = time.Now().Add(-48 * time.Hour)
+	if err := service.DeleteBucket(context.Background(), ownerID, bucket.ID); err != nil {
+		t.Fatalf("expected delete to succeed once retention lapsed, got %v", err)
+	}
+}
+
+func TestDeleteBucketKeepsMetadataWhenSomeObjectsFail(t *testing.T) {
+	repo := newFakeRepo()
+	fileIndex := &fakeFileIndex{}
+	for i := 0; i < 20; i++ {
+		fileIndex.objects = append(fileIndex.objects, FileObject{ObjectName: fmt.Sprintf("obj-%d", i)})
+	}
+	remover := &failingRemover{fail: map[string]bool{"obj-3": true, "obj-17": true}, attempts: map[string]bool{}}
+	service := NewService(repo, fileIndex, remover, "storage")
+
+	ownerID := uuid.New()
+	created, err := service.CreateBucket(context.Background(), ownerID, CreateInput{Name: "large"})
+	if err != nil {
+		t.Fatalf("CreateBucket returned error: %v", err)
+	}
+
+	err = service.DeleteBucket(context.Background(), ownerID, created.ID)
+	if err == nil {
+		t.Fatalf("expected an error when objects fail to delete")
+	}
+	for name := range remover.fail {
+		if !strings.Contains(err.Error(), name) {
+			t.Fatalf("expected the error to name %s, got %v", name, err)
+		}
+	}
+	if len(remover.attempts) != len(fileIndex.objects) {
+		t.Fatalf("expected every object to be attempted, got %d of %d", len(remover.attempts), len(fileIndex.objects))
+	}
+	if _, err := repo.Get(context.Background(), ownerID, created.ID); err != nil {
+		t.Fatalf("expected the bucket metadata to remain for a retry, got %v", err)
+	}
+}
+
+func TestDeleteBucketsReportsPerBucketResults(t *testing.T) {
+	repo := newFakeRepo()
+	fileIndex := &fakeFileIndex{}
+	service := NewService(repo, fileIndex, nil, "storage")
+
+	ownerID, otherOwner := uuid.New(), uuid.New()
+	var ids []uuid.UUID
+	for _, name := range []string{"old-logs", "old-backups"} {
+		created, err := service.CreateBucket(context.Background(), ownerID, CreateInput{Name: name})
+		if err != nil {
+			t.Fatalf("CreateBucket returned error: %v", err)
+		}
+		ids = append(ids, created.ID)
+	}
+	foreign, err := service.CreateBucket(context.Background(), otherOwner, CreateInput{Name: "theirs"})
+	if err != nil {
+		t.Fatalf("CreateBucket returned error: %v", err)
+	}
+
+	request := []uuid.UUID{ids[0], foreign.ID, uuid.New(), ids[1]}
+	results, err := service.DeleteBuckets(context.Background(), ownerID, request)
+	if err != nil {
+		t.Fatalf("DeleteBuckets returned error: %v", err)
+	}
+	for i, want := range []bool{true, false, false, true} {
+		if results[i].BucketID != request[i] || results[i].Deleted != want {
+			t.Fatalf("result %d: expected deleted=%v for %s, got %+v", i, want, request[i], results[i])
+		}
+		if !want && results[i].Error != ErrBucketNotFound.Error() {
+			t.Fatalf("result %d: expected not-found error, got %q", i, results[i].Error)
+		}
+	}
+
+	if _, ok := repo.buckets[foreign.ID]; !ok {
+		t.Fatalf("expected the other owner's bucket to survive")
+	}
+	for _, id := range ids {
+		if _, ok := repo.buckets[id]; ok {
+			t.Fatalf("expected owned bucket %s to be deleted", id)
+		}
+	}
+	if repo.snapshots != 1 {
+		t.Fatalf("expected a single usage snapshot, got %d", repo.snapshots)
+	}
+}
+
+func TestDeleteBucketRecordsAuditEntry(t *testing.T) {
+	repo := newFakeRepo()
+	auditStore := &fakeAuditStore{}
+	auditor := audit.NewService(auditStore)
+	service := NewService(repo, &fakeFileIndex{}, nil, "storage")
+	service.SetAuditor(auditor)
+
+	ownerID := uuid.New()
+	created, err := service.CreateBucket(context.Background(), ownerID, CreateInput{Name: "reports"})
+	if err != nil {
+		t.Fatalf("CreateBucket returned error: %v", err)
+	}
+	if err := service.DeleteBucket(context.Background(), ownerID, created.ID); err != nil {
+		t.Fatalf("DeleteBucket returned error: %v", err)
+	}
+	auditor.Close()
+
+	if len(auditStore.entries) != 2 {
+		t.Fatalf("expected create and delete audit rows, got %+v", auditStore.entries)
+	}
+	deleted := auditStore.entries[1]
+	if deleted.Action != audit.ActionDelete || deleted.ResourceType != audit.ResourceBucket ||
+		deleted.ResourceID != created.ID || deleted.UserID != ownerID {
+		t.Fatalf("unexpected delete audit row: %+v", deleted)
+	}
+	if deleted.Metadata["name"] != "reports" {
+		t.Fatalf("expected bucket name in audit metadata, got %+v", deleted.Metadata)
+	}
+}
+
+func TestCreateBucketValidatesContentTypes(t *testing.T) {
+	repo := newFakeRepo()
+	service := NewService(repo, &fakeFileIndex{}, nil, "storage")
+	ownerID := uuid.New()
+
+	invalid := [][]string{{"image"}, {"*/png"}, {"image/pn g"}}
+	for _, patterns := range invalid {
+		if _, err := service.CreateBucket(context.Background(), ownerID, CreateInput{Name: "bad", AllowedContentTypes: patterns}); err != ErrInvalidContentType {
+			t.Fatalf("patterns %v: expected ErrInvalidContentType, got %v", patterns, err)
+		}
+	}
+
+	textDefault := "text/plain"
+	if _, err := service.CreateBucket(context.Background(), ownerID, CreateInput{
+		Name:                "images",
+		AllowedContentTypes: []string{"image/*"},
+		DefaultContentType:  &textDefault,
+	}); err != ErrInvalidContentType {
+		t.Fatalf("expected default outside allowlist to be rejected, got %v", err)
+	}
+
+	pngDefault := "Image/PNG"
+	created, err := service.CreateBucket(context.Background(), ownerID, CreateInput{
+		Name:                "images",
+		AllowedContentTypes: []string{" Image/* "},
+		DefaultContentType:  &pngDefault,
+	})
+	if err != nil {
+		t.Fatalf("CreateBucket returned error: %v", err)
+	}
+	if created.AllowedContentTypes[0] != "image/*" || *created.DefaultContentType != "image/png" {
+		t.Fatalf("expected normalized restrictions, got %v / %s", created.AllowedContentTypes, *created.DefaultContentType)
+	}
+	if !created.AllowsContentType("image/jpeg") || created.AllowsContentType("text/plain") {
+		t.Fatalf("unexpected AllowsContentType results")
+	}
+}
+
+func TestListOptionsRejectsUnknownSort(t *testing.T) {
+	service := NewService(newFakeRepo(), &fakeFileIndex{}, nil, "storage")
+
+	for _, opts := range []ListOptions{
+		{Sort: "name; DROP TABLE buckets"},
+		{Sort: "owner_id"},
+		{Sort: "name", Order: "sideways"},
+	} {
+		if _, err := service.ListBuckets(context.Background(), uuid.New(), opts); err != ErrInvalidSort {
+			t.Fatalf("options %+v: expected ErrInvalidSort, got %v", opts, err)
+		}
+	}
+
+	opts, err := ListOptions{Sort: "Total_Bytes", Order: "ASC"}.normalize()
+	if err != nil {
+		t.Fatalf("normalize returned error: %v", err)
+	}
+	if got := opts.orderBy(); got != "ORDER BY total_bytes ASC, b.id ASC" {
+		t.Fatalf("unexpected order clause %q", got)
+	}
+}
+
+func TestCreateBucketRejectsNameDifferingOnlyInCase(t *testing.T) {
+	repo := newFakeRepo()
+	service := NewService(repo, &fakeFileIndex{}, nil, "storage")
+	ownerID := uuid.New()
+
+	if _, err := service.CreateBucket(context.Background(), ownerID, CreateInput{Name: "Photos"}); err != nil {
+		t.Fatalf("CreateBucket returned error: %v", err)
+	}
+	if _, err := service.CreateBucket(context.Background(), ownerID, CreateInput{Name: "  photos "}); err != ErrBucketNameExists {
+		t.Fatalf("expected ErrBucketNameExists, got %v", err)
+	}
+	if repo.existsCalls != 2 {
+		t.Fatalf("expected name pre-check on every create, got %d calls", repo.existsCalls)
+	}
+
+	if _, err := service.CreateBucket(context.Background(), uuid.New(), CreateInput{Name: "photos"}); err != nil {
+		t.Fatalf("other owners should be able to reuse the name: %v", err)
+	}
+}
+
+func TestBucketDescriptionIsTrimmedAndLimited(t *testing.T) {
+	repo := newFakeRepo()
+	service := NewService(repo, &fakeFileIndex{}, nil, "storage")
+	service.SetMaxDescriptionLength(10)
+	ownerID := uuid.New()
+
+	long := strings.Repeat("é", 11)
+	if _, err := service.CreateBucket(context.Background(), ownerID, CreateInput{Name: "notes", Description: &long}); err != ErrInvalidDescription {
+		t.Fatalf("expected ErrInvalidDescription on create, got %v", err)
+	}
+
+	padded := "  ten chars \n"
+	created, err := service.CreateBucket(context.Background(), ownerID, CreateInput{Name: "notes", Description: &padded})
+	if err != nil {
+		t.Fatalf("create bucket: %v", err)
+	}
+	if created.Description == nil || *created.Description != "ten chars" {
+		t.Fatalf("expected a trimmed description, got %v", created.Description)
+	}
+
+	if _, err := service.UpdateBucket(context.Background(), ownerID, created.ID, UpdateInput{Description: &long}); err != ErrInvalidDescription {
+		t.Fatalf("expected ErrInvalidDescription on update, got %v", err)
+	}
+	if got := *repo.buckets[created.ID].Description; got != "ten chars" {
+		t.Fatalf("expected the rejected update to leave the description, got %q", got)
+	}
+}
+
 // --- fakes ----
 
+func TestUpdateBucketRefusesPublicWhenDisabled(t *testing.T) {
+	repo := newFakeRepo()
+	service := NewService(repo, &fakeFileIndex{}, nil, "storage")
+	service.SetPublicBucketsEnabled(false)
+	ownerID := uuid.New()
+
+	created, err := service.CreateBucket(context.Background(), ownerID, CreateInput{Name: "site"})
+	if err != nil {
+		t.Fatalf("create bucket: %v", err)
+	}
+	public, private := true, false
+	if _, err := service.UpdateBucket(context.Background(), ownerID, created.ID, UpdateInput{IsPublic: &public}); err != ErrPublicBucketsDisabled {
+		t.Fatalf("expected ErrPublicBucketsDisabled, got %v", err)
+	}
+	if _, err := service.UpdateBucket(context.Background(), ownerID, created.ID, UpdateInput{IsPublic: &private}); err != nil {
+		t.Fatalf("expected making a bucket private to stay allowed, got %v", err)
+	}
+}
+
 type fakeRepo struct {
 	buckets map[uuid.UUID]Bucket
 	byName  map[uuid.UUID]map[string]uuid.UUID
+	// newestFile holds the latest file creation time per bucket, for retention checks.
+	newestFile map[uuid.UUID]time.Time
+
+	existsCalls int
+	snapshots   int
 }
 
 func newFakeRepo() *fakeRepo {
@@ -80,26 +376,45 @@ func newFakeRepo() *fakeRepo {
 	}
 }
 
-func (f *fakeRepo) Create(ctx context.Context, ownerID uuid.UUID, name string, description *string) (Bucket, error) {
+func (f *fakeRepo) Create(ctx context.Context, ownerID uuid.UUID, input CreateInput) (Bucket, error) {
 	if _, ok := f.byName[ownerID]; !ok {
 		f.byName[ownerID] = make(map[string]uuid.UUID)
 	}
-	if _, exists := f.byName[ownerID][name]; exists {
+	if _, exists := f.byName[ownerID][strings.ToLower(input.Name)]; exists {
 		return Bucket{}, ErrBucketNameExists
 	}
 	id := uuid.New()
 	b := Bucket{
-		ID:          id,
-		OwnerID:     ownerID,
-		Name:        name,
-		Description: description,
+		ID:                  id,
+		OwnerID:             ownerID,
+		Name:                input.Name,
+		Description:         input.Description,
+		AllowedContentTypes: input.AllowedContentTypes,
+		DefaultContentType:  input.DefaultContentType,
+		MaxFileSizeBytes:    input.MaxFileSizeBytes,
+		Region:              input.Region,
+		Immutable:           input.Immutable,
 	}
-	f.byName[ownerID][name] = id
+	f.byName[ownerID][strings.ToLower(input.Name)] = id
 	f.buckets[id] = b
 	return b, nil
 }
 
-func (f *fakeRepo) List(ctx context.Context, ownerID uuid.UUID) ([]Bucket, error) {
+func (f *fakeRepo) ExistsByName(ctx context.Context, ownerID uuid.UUID, name string) (bool, error) {
+	f.existsCalls++
+	_, exists := f.byName[ownerID][strings.ToLower(name)]
+	return exists, nil
+}
+
+func (f *fakeRepo) GetByName(ctx context.Context, ownerID uuid.UUID, name string) (Bucket, error) {
+	id, ok := f.byName[ownerID][strings.ToLower(strings.TrimSpace(name))]
+	if !ok {
+		return Bucket{}, ErrBucketNotFound
+	}
+	return f.buckets[id], nil
+}
+
+func (f *fakeRepo) List(ctx context.Context, ownerID uuid.UUID, opts ListOptions) ([]Bucket, error) {
 	var buckets []Bucket
 	for _, bucket := range f.buckets {
 		if bucket.OwnerID == ownerID {
@@ -117,6 +432,33 @@ func (f *fakeRepo) Get(ctx context.Context, ownerID, bucketID uuid.UUID) (Bucket
 	return b, nil
 }
 
+func (f *fakeRepo) Update(ctx context.Context, ownerID, bucketID uuid.UUID, input UpdateInput) (Bucket, error) {
+	b, ok := f.buckets[bucketID]
+	if !ok || b.OwnerID != ownerID {
+		return Bucket{}, ErrBucketNotFound
+	}
+	if input.IfUpdatedAt != nil && !b.UpdatedAt.Equal(*input.IfUpdatedAt) {
+		return Bucket{}, ErrVersionMismatch
+	}
+	if input.Description != nil {
+		b.Description = input.Description
+	}
+	if input.IsPublic != nil {
+		b.IsPublic = *input.IsPublic
+	}
+	if input.Immutable != nil && *input.Immutable {
+		b.Immutable = true
+	}
+	b.UpdatedAt = b.UpdatedAt.Add(time.Second)
+	f.buckets[bucketID] = b
+	return b, nil
+}
+
+func (f *fakeRepo) HasFilesSince(ctx context.Context, bucketID uuid.UUID, since time.Time) (bool, error) {
+	newest, ok := f.newestFile[bucketID]
+	return ok && newest.After(since), nil
+}
+
 func (f *fakeRepo) Delete(ctx context.Context, ownerID, bucketID uuid.UUID) error {
 	b, ok := f.buckets[bucketID]
 	if !ok || b.OwnerID != ownerID {
@@ -124,22 +466,128 @@ func (f *fakeRepo) Delete(ctx context.Context, ownerID, bucketID uuid.UUID) erro
 	}
 	delete(f.buckets, bucketID)
 	if nameMap, ok := f.byName[ownerID]; ok {
-		delete(nameMap, b.Name)
+		delete(nameMap, strings.ToLower(b.Name))
 	}
 	return nil
 }
 
+func (f *fakeRepo) AggregateUsage(ctx context.Context, ownerID uuid.UUID) (AccountUsage, error) {
+	var usage AccountUsage
+	for _, b := range f.buckets {
+		if b.OwnerID == ownerID {
+			usage.TotalBytes += b.Usage.TotalBytes
+			usage.FileCount += b.Usage.FileCount
+			usage.BucketCount++
+		}
+	}
+	return usage, nil
+}
+
+func (f *fakeRepo) RecentFiles(ctx context.Context, ownerID uuid.UUID, bucketIDs []uuid.UUID, limit int) (map[uuid.UUID][]FilePreview, error) {
+	return map[uuid.UUID][]FilePreview{}, nil
+}
+
+func (f *fakeRepo) Stats(ctx context.Context, ownerID, bucketID uuid.UUID) (Stats, error) {
+	return Stats{BucketID: bucketID}, nil
+}
+
+func (f *fakeRepo) RecomputeUsage(ctx context.Context, bucketID uuid.UUID) (UsageStats, error) {
+	b, ok := f.buckets[bucketID]
+	if !ok {
+		return UsageStats{}, ErrBucketNotFound
+	}
+	return b.Usage, nil
+}
+
 func (f *fakeRepo) RecordUsageSnapshot(ctx context.Context, ownerID uuid.UUID) error {
+	f.snapshots++
 	return nil
 }
 
 type fakeFileIndex struct {
 	wasCalled bool
+	objects   []FileObject
 }
 
 func (f *fakeFileIndex) ListObjectsForBucket(ctx context.Context, bucketID uuid.UUID) ([]FileObject, error) {
 	f.wasCalled = true
+	if f.objects != nil {
+		return f.objects, nil
+	}
 	return []FileObject{
 		{ObjectName: "obj", SizeBytes: 42},
 	}, nil
 }
+
+// failingRemover fails removals of the objects in fail and records every attempt.
+type failingRemover struct {
+	mu       sync.Mutex
+	fail     map[string]bool
+	attempts map[string]bool
+}
+
+func (f *failingRemover) RemoveObject(ctx context.Context, bucketName, objectName string, opts minio.RemoveObjectOptions) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.attempts[objectName] = true
+	if f.fail[objectName] {
+		return errors.New("storage unavailable")
+	}
+	return nil
+}
+
+type fakeAuditStore struct {
+	mu      sync.Mutex
+	entries []audit.Entry
+}
+
+func (f *fakeAuditStore) Insert(ctx context.Context, entry audit.Entry) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.entries = append(f.entries, entry)
+	return nil
+}
+
+func (f *fakeAuditStore) ListByUser(ctx context.Context, userID uuid.UUID, opts audit.ListOptions) ([]audit.Entry, error) {
+	return nil, nil
+}
+
+func (f *fakeAuditStore) ListAll(ctx context.Context, opts audit.ListOptions) ([]audit.Entry, error) {
+	return nil, nil
+}
+
+func (f *fakeAuditStore) Activity(ctx context.Context, userID uuid.UUID, after *pagination.Keyset, limit int) ([]audit.Activity, error) {
+	return nil, nil
+}
+
+func TestEstimateCostPricesAccountAndBuckets(t *testing.T) {
+	photos, backups, empty := uuid.New(), uuid.New(), uuid.New()
+	buckets := []Bucket{
+		{ID: backups, Name: "backups", Usage: UsageStats{TotalBytes: 150 << 30}},
+		{ID: photos, Name: "photos", Usage: UsageStats{TotalBytes: 512 << 20}},
+		{ID: empty, Name: "empty"},
+	}
+	usage := AccountUsage{TotalBytes: 150<<30 + 512<<20, BucketCount: 3}
+
+	estimate := EstimateCost(usage, buckets, 0.023)
+	if estimate.MonthlyCost != 3.4615 {
+		t.Fatalf("expected 150.5 GB at $0.023 to cost 3.4615, got %v", estimate.MonthlyCost)
+	}
+	want := []BucketCost{
+		{BucketID: backups, Name: "backups", TotalBytes: 150 << 30, MonthlyCost: 3.45},
+		{BucketID: photos, Name: "photos", TotalBytes: 512 << 20, MonthlyCost: 0.0115},
+		{BucketID: empty, Name: "empty", TotalBytes: 0, MonthlyCost: 0},
+	}
+	if len(estimate.Buckets) != len(want) {
+		t.Fatalf("expected %d bucket costs, got %+v", len(want), estimate.Buckets)
+	}
+	for i := range want {
+		if estimate.Buckets[i] != want[i] {
+			t.Fatalf("bucket %d: expected %+v, got %+v", i, want[i], estimate.Buckets[i])
+		}
+	}
+
+	if free := EstimateCost(usage, nil, 0); free.MonthlyCost != 0 || len(free.Buckets) != 0 {
+		t.Fatalf("expected a zero price to cost nothing, got %+v", free)
+	}
+}
@@ -0,0 +1,15 @@
+// Package buildinfo holds build metadata injected at link time, e.g.
+//
+//	go build -ldflags "-X github.com/abduss/godrive/internal/buildinfo.Version=v1.2.0 \
+//	  -X github.com/abduss/godrive/internal/buildinfo.Commit=$(git rev-parse --short HEAD) \
+//	  -X github.com/abduss/godrive/internal/buildinfo.BuildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+package buildinfo
+
+var (
+	// Version is the release version of the binary.
+	Version = "dev"
+	// Commit is the VCS revision the binary was built from.
+	Commit = "unknown"
+	// BuildTime is the UTC time the binary was built, in RFC 3339 format.
+	BuildTime = "unknown"
+)
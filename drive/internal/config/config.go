@@ -2,28 +2,71 @@ package config
 
 import (
 	"fmt"
+	"log"
+	"net"
 	"os"
 	"strconv"
 	"strings"
 	"time"
 )
 
+// Supported object storage providers.
+const (
+	StorageProviderMinIO = "minio"
+	StorageProviderS3    = "s3"
+)
+
 // Config aggregates runtime configuration for the GoDrive API.
 type Config struct {
 	Server   ServerConfig
 	Postgres PostgresConfig
+	Storage  StorageConfig
 	MinIO    MinIOConfig
+	S3       S3Config
 	Auth     AuthConfig
+	Upload   UploadConfig
+	Bucket   BucketConfig
+	Presign  PresignConfig
+	Cache    CacheConfig
 	Metrics  MetricsConfig
+	Features FeaturesConfig
+	// Maintenance schedules background repair jobs.
+	Maintenance MaintenanceConfig
 }
 
 // ServerConfig parameterizes the HTTP server.
 type ServerConfig struct {
-	Host         string
-	Port         int
-	ReadTimeout  time.Duration
-	WriteTimeout time.Duration
-	IdleTimeout  time.Duration
+	Host          string
+	Port          int
+	ReadTimeout   time.Duration
+	WriteTimeout  time.Duration
+	IdleTimeout   time.Duration
+	ShutdownGrace time.Duration
+	// ReadHeaderTimeout bounds how long a client may take to send request headers, separately
+	// from ReadTimeout, so slow header senders cannot hold connections open.
+	ReadHeaderTimeout time.Duration
+	// StreamReadTimeout replaces ReadTimeout as the body read deadline on the routes listed in
+	// RequestTimeoutExempt, so large uploads are not cut off while headers stay tightly bounded.
+	StreamReadTimeout time.Duration
+	MaxHeaderBytes    int
+	// TLSCertFile and TLSKeyFile enable TLS when both are set; HTTP/2 is then negotiated
+	// unless EnableHTTP2 is false.
+	TLSCertFile string
+	TLSKeyFile  string
+	EnableHTTP2 bool
+	// RequestTimeout bounds each request; routes listed in RequestTimeoutExempt
+	// as "METHOD /path/pattern" (e.g. streaming transfers) are not limited.
+	RequestTimeout       time.Duration
+	RequestTimeoutExempt []string
+	// TrustedProxies lists the proxy IPs or CIDRs whose X-Forwarded-For headers are honored.
+	TrustedProxies []string
+	// MaxJSONBodyBytes caps non-multipart request bodies; upload routes are limited separately.
+	MaxJSONBodyBytes int64
+}
+
+// TLSEnabled reports whether the server should serve HTTPS.
+func (s ServerConfig) TLSEnabled() bool {
+	return s.TLSCertFile != "" && s.TLSKeyFile != ""
 }
 
 // Address returns the listen address in host:port form.
@@ -39,6 +82,13 @@ type PostgresConfig struct {
 	Password string
 	Database string
 	SSLMode  string
+	// AutoMigrate applies pending embedded schema migrations at startup.
+	AutoMigrate bool
+	// LookupTimeout, ListTimeout, and WriteTimeout bound repository queries that fetch a single
+	// row, fetch many rows, and modify rows respectively.
+	LookupTimeout time.Duration
+	ListTimeout   time.Duration
+	WriteTimeout  time.Duration
 }
 
 // DSN returns the PostgreSQL DSN string.
@@ -55,31 +105,210 @@ type MinIOConfig struct {
 	Bucket          string
 	UseSSL          bool
 	Region          string
+	// RetryAttempts bounds tries per object operation, including the first; 1 disables retries.
+	RetryAttempts int
+	// RetryBackoff is the initial wait between retries; it doubles after each attempt.
+	RetryBackoff time.Duration
+	// DialTimeout, TLSHandshakeTimeout, and ResponseHeaderTimeout bound each stage of a request
+	// so a slow object store cannot hang callers; zero keeps the SDK default.
+	DialTimeout           time.Duration
+	TLSHandshakeTimeout   time.Duration
+	ResponseHeaderTimeout time.Duration
+	// CORSAllowedOrigins, when set, is applied at startup as the storage bucket's CORS policy so
+	// browsers can use presigned URLs directly. It does not affect the API's own CORS handling.
+	CORSAllowedOrigins []string
+}
+
+// StorageConfig selects the object storage backend.
+type StorageConfig struct {
+	Provider string
+	// TenantBuckets lists "ownerID=bucket" entries routing an owner's objects to a dedicated
+	// physical bucket; owners not listed use the provider's shared bucket. Objects an owner
+	// stored before being mapped stay in the shared bucket: downloads fall back to it and
+	// deletes clean it up, but presigned URLs and moves only see the tenant bucket until the
+	// objects are copied across under the same names.
+	TenantBuckets []string
+	// ReplicaBucket, when set, is a secondary physical bucket downloads fall back to when an
+	// object is missing from its primary bucket. Empty disables the fallback.
+	ReplicaBucket string
+}
+
+// S3Config carries settings for the AWS SDK backed object store.
+type S3Config struct {
+	Bucket          string
+	Region          string
+	Endpoint        string
+	AccessKeyID     string
+	SecretAccessKey string
+	UsePathStyle    bool
 }
 
 // AuthConfig groups authentication-related settings.
 type AuthConfig struct {
 	AccessTokenSecret  string
 	RefreshTokenSecret string
+	TokenIssuer        string
+	TokenAudience      string
 	AccessTokenTTL     time.Duration
 	RefreshTokenTTL    time.Duration
 	BcryptCost         int
+	PasswordHasher     string
+	Argon2Memory       int
+	Argon2Time         int
+	Argon2Parallelism  int
+	StripEmailTags     bool
+	// PasswordPepper is a server-held secret mixed into passwords before hashing.
+	// Changing it invalidates every existing peppered hash.
+	PasswordPepper string
+	// InviteOnly closes open sign-up so registering requires an invite. It is set by
+	// GODRIVE_ALLOW_REGISTRATION=false.
+	InviteOnly bool
+	// InviteTTL is how long an admin-minted invite token stays redeemable.
+	InviteTTL time.Duration
+}
+
+// UploadConfig bounds upload processing.
+type UploadConfig struct {
+	MaxConcurrentUploads int
+	// MaxFileSize is the default per-file limit in bytes; buckets may override it.
+	MaxFileSize int64
+	// MaxBatchSize caps the combined size of files in one batch upload.
+	MaxBatchSize int64
+	// MaxAccountBytes caps the total bytes stored across all of a user's buckets; 0 means unlimited.
+	MaxAccountBytes int64
+	// AllowEmptyFiles accepts zero-byte uploads; parts without a filename are always rejected.
+	AllowEmptyFiles bool
+	// RequireUploadSize rejects chunked uploads and parts of unknown size with 411 instead of
+	// enforcing limits while streaming.
+	RequireUploadSize bool
+	// BlockedContentTypes and BlockedExtensions reject matching uploads in every bucket; the
+	// declared and sniffed types are both checked.
+	BlockedContentTypes []string
+	BlockedExtensions   []string
+	// FormFields are the multipart field names uploads are read from, in order of preference.
+	FormFields []string
+	// IdempotencyTTL is how long an Idempotency-Key on an upload is remembered.
+	IdempotencyTTL time.Duration
+	// ObjectKeyLayout selects how object names are built: flat, date-partitioned, or hashed.
+	ObjectKeyLayout string
+	// DedupScope selects where identical uploads share one object: none, bucket, or account.
+	DedupScope string
+	// ClamAVAddress is the clamd daemon uploads are scanned with, as "host:port" or a unix
+	// socket path. Empty disables scanning.
+	ClamAVAddress string
+	// ClamAVTimeout bounds each scan; uploads that cannot be scanned in time are rejected.
+	ClamAVTimeout time.Duration
+}
+
+// BucketConfig bounds bucket attributes.
+type BucketConfig struct {
+	// MaxDescriptionLength caps descriptions in characters; the HTTP binding separately caps them at 255.
+	MaxDescriptionLength int
+	// CreateDefault gives every newly registered user a bucket named DefaultName.
+	CreateDefault bool
+	DefaultName   string
+	// StoragePricePerGB is the price per GB-month used for usage cost estimates.
+	StoragePricePerGB float64
+	// ImmutableRetention is how long after upload files in immutable buckets cannot be deleted or
+	// moved. Replacing them is refused regardless of age.
+	ImmutableRetention time.Duration
+}
+
+// PresignConfig controls presigned URL generation.
+type PresignConfig struct {
+	AllowedMethods []string
+	DefaultTTL     time.Duration
+	MaxTTL         time.Duration
+	// RateLimit is how many presign requests per second each user may make, with bursts of up
+	// to RateBurst; 0 disables the limit.
+	RateLimit float64
+	RateBurst int
+}
+
+// CacheConfig sizes the in-memory caches used on the download path.
+type CacheConfig struct {
+	// ObjectCacheBytes is the total memory the object cache may use; 0 disables it.
+	ObjectCacheBytes int64
+	// ObjectCacheMaxObjectBytes is the largest object admitted to the cache.
+	ObjectCacheMaxObjectBytes int64
+	// MetadataCacheTTL keeps file metadata for download fallbacks during database outages; 0 disables it.
+	MetadataCacheTTL time.Duration
 }
 
 // MetricsConfig groups observability settings.
 type MetricsConfig struct {
-	PrometheusPath string
+	PrometheusPath          string
+	DependencyCheckInterval time.Duration
+}
+
+// MaintenanceConfig schedules background repair jobs.
+type MaintenanceConfig struct {
+	// ChecksumBackfillInterval is how often files stored without a checksum are hashed; zero
+	// disables the schedule. The job can still be run once with the backfill-checksums command.
+	ChecksumBackfillInterval time.Duration
+	// ChecksumBackfillBatchSize is how many files each backfill loads at a time.
+	ChecksumBackfillBatchSize int
+	// IdempotencyCleanupInterval is how often expired upload idempotency keys are deleted; zero
+	// disables the cleanup.
+	IdempotencyCleanupInterval time.Duration
+}
+
+// Names of optional features, as reported by FeaturesConfig.Enabled.
+const (
+	FeatureSharing       = "sharing"
+	FeaturePublicBuckets = "public_buckets"
+	FeatureDedup         = "dedup"
+)
+
+// FeaturesConfig switches optional features on and off. Routes of a disabled feature answer
+// with DisabledStatus, which is either 404 or 403.
+type FeaturesConfig struct {
+	Sharing       bool
+	PublicBuckets bool
+	// Dedup enables looking up existing files by checksum before uploading.
+	Dedup          bool
+	DisabledStatus int
+}
+
+// Enabled reports each optional feature by name.
+func (f FeaturesConfig) Enabled() map[string]bool {
+	return map[string]bool{
+		FeatureSharing:       f.Sharing,
+		FeaturePublicBuckets: f.PublicBuckets,
+		FeatureDedup:         f.Dedup,
+	}
 }
 
 // Load reads configuration values from environment variables, applying defaults.
 func Load() (Config, error) {
 	cfg := Config{
 		Server: ServerConfig{
-			Host:         getString("GODRIVE_API_HOST", "0.0.0.0"),
-			Port:         getInt("GODRIVE_API_PORT", 8080),
-			ReadTimeout:  getDuration("GODRIVE_API_READ_TIMEOUT", 15*time.Second),
-			WriteTimeout: getDuration("GODRIVE_API_WRITE_TIMEOUT", 15*time.Second),
-			IdleTimeout:  getDuration("GODRIVE_API_IDLE_TIMEOUT", 60*time.Second),
+			Host:              getString("GODRIVE_API_HOST", "0.0.0.0"),
+			Port:              getInt("GODRIVE_API_PORT", 8080),
+			ReadTimeout:       getDuration("GODRIVE_API_READ_TIMEOUT", 15*time.Second),
+			WriteTimeout:      getDuration("GODRIVE_API_WRITE_TIMEOUT", 15*time.Second),
+			IdleTimeout:       getDuration("GODRIVE_API_IDLE_TIMEOUT", 60*time.Second),
+			ShutdownGrace:     getDuration("GODRIVE_SHUTDOWN_GRACE", 30*time.Second),
+			ReadHeaderTimeout: getDuration("GODRIVE_API_READ_HEADER_TIMEOUT", 5*time.Second),
+			StreamReadTimeout: getDuration("GODRIVE_API_STREAM_READ_TIMEOUT", time.Hour),
+			MaxHeaderBytes:    getInt("GODRIVE_API_MAX_HEADER_BYTES", 1<<20),
+			TLSCertFile:       getString("GODRIVE_API_TLS_CERT_FILE", ""),
+			TLSKeyFile:        getString("GODRIVE_API_TLS_KEY_FILE", ""),
+			EnableHTTP2:       getBool("GODRIVE_API_HTTP2", true),
+			RequestTimeout:    getDuration("GODRIVE_REQUEST_TIMEOUT", 30*time.Second),
+			RequestTimeoutExempt: getStringSlice("GODRIVE_REQUEST_TIMEOUT_EXEMPT", []string{
+				"POST /v1/buckets/:bucketID/files",
+				"POST /v1/buckets/:bucketID/files/batch",
+				"POST /v1/buckets/:bucketID/files/archive",
+				"GET /v1/buckets/:bucketID/files",
+				"GET /v1/buckets/:bucketID/manifest",
+				"GET /v1/buckets/:bucketID/files/:fileID/download",
+				"GET /v1/public/buckets/:bucketID/files/:fileID/download",
+				"GET /v1/share/:token/download",
+				"GET /v1/buckets/:bucketID/uploads/:uploadID/progress",
+			}),
+			TrustedProxies:   getStringSlice("GODRIVE_TRUSTED_PROXIES", []string{"127.0.0.1", "::1"}),
+			MaxJSONBodyBytes: getInt64("GODRIVE_MAX_JSON_BODY_BYTES", 1024*1024),
 		},
 		Postgres: PostgresConfig{
 			Host:     getString("POSTGRES_HOST", "localhost"),
@@ -88,6 +317,11 @@ func Load() (Config, error) {
 			Password: getString("POSTGRES_PASSWORD", "change-me"),
 			Database: getString("POSTGRES_DB", "godrive"),
 			SSLMode:  strings.ToLower(getString("POSTGRES_SSL_MODE", "disable")),
+
+			AutoMigrate:   getBool("GODRIVE_AUTO_MIGRATE", false),
+			LookupTimeout: getDuration("GODRIVE_DB_LOOKUP_TIMEOUT", 5*time.Second),
+			ListTimeout:   getDuration("GODRIVE_DB_LIST_TIMEOUT", 5*time.Second),
+			WriteTimeout:  getDuration("GODRIVE_DB_WRITE_TIMEOUT", 5*time.Second),
 		},
 		MinIO: MinIOConfig{
 			Endpoint:        getString("MINIO_ENDPOINT", "localhost:9000"),
@@ -96,16 +330,112 @@ func Load() (Config, error) {
 			Bucket:          getString("MINIO_BUCKET", "godrive"),
 			UseSSL:          getBool("MINIO_USE_SSL", false),
 			Region:          getString("MINIO_REGION", ""),
+			RetryAttempts:   getInt("MINIO_RETRY_ATTEMPTS", 3),
+			RetryBackoff:    getDuration("MINIO_RETRY_BACKOFF", 200*time.Millisecond),
+
+			DialTimeout:           getDuration("MINIO_DIAL_TIMEOUT", 5*time.Second),
+			TLSHandshakeTimeout:   getDuration("MINIO_TLS_HANDSHAKE_TIMEOUT", 10*time.Second),
+			ResponseHeaderTimeout: getDuration("MINIO_RESPONSE_HEADER_TIMEOUT", 30*time.Second),
+
+			CORSAllowedOrigins: getStringSlice("MINIO_CORS_ALLOWED_ORIGINS", nil),
+		},
+		Storage: StorageConfig{
+			Provider:      strings.ToLower(getString("STORAGE_PROVIDER", StorageProviderMinIO)),
+			TenantBuckets: getStringSlice("STORAGE_TENANT_BUCKETS", nil),
+			ReplicaBucket: getString("STORAGE_REPLICA_BUCKET", ""),
+		},
+		S3: S3Config{
+			Bucket:          getString("S3_BUCKET", "godrive"),
+			Region:          getString("S3_REGION", "us-east-1"),
+			Endpoint:        getString("S3_ENDPOINT", ""),
+			AccessKeyID:     getString("S3_ACCESS_KEY_ID", ""),
+			SecretAccessKey: getString("S3_SECRET_ACCESS_KEY", ""),
+			UsePathStyle:    getBool("S3_USE_PATH_STYLE", false),
 		},
 		Auth: loadAuthConfig(),
+		Upload: UploadConfig{
+			MaxConcurrentUploads: getInt("GODRIVE_MAX_CONCURRENT_UPLOADS", 16),
+			MaxFileSize:          getInt64("GODRIVE_MAX_FILE_SIZE", 100*1024*1024),
+			MaxBatchSize:         getInt64("GODRIVE_MAX_BATCH_UPLOAD_SIZE", 500*1024*1024),
+			MaxAccountBytes:      getInt64("GODRIVE_MAX_ACCOUNT_BYTES", 0),
+			AllowEmptyFiles:      getBool("GODRIVE_ALLOW_EMPTY_FILES", false),
+			RequireUploadSize:    getBool("GODRIVE_REQUIRE_UPLOAD_SIZE", false),
+			BlockedContentTypes:  getStringSlice("GODRIVE_BLOCKED_CONTENT_TYPES", nil),
+			BlockedExtensions:    getStringSlice("GODRIVE_BLOCKED_EXTENSIONS", nil),
+			FormFields:           getStringSlice("GODRIVE_UPLOAD_FORM_FIELDS", []string{"file"}),
+			IdempotencyTTL:       getDuration("GODRIVE_IDEMPOTENCY_TTL", 24*time.Hour),
+			ObjectKeyLayout:      strings.ToLower(getString("GODRIVE_OBJECT_KEY_LAYOUT", "flat")),
+			DedupScope:           strings.ToLower(getString("GODRIVE_DEDUP_SCOPE", "none")),
+			ClamAVAddress:        getString("GODRIVE_CLAMAV_ADDRESS", ""),
+			ClamAVTimeout:        getDuration("GODRIVE_CLAMAV_TIMEOUT", 5*time.Minute),
+		},
+		Bucket: BucketConfig{
+			MaxDescriptionLength: getInt("GODRIVE_BUCKET_DESCRIPTION_MAX_LENGTH", 255),
+			CreateDefault:        getBool("GODRIVE_CREATE_DEFAULT_BUCKET", false),
+			DefaultName:          getString("GODRIVE_DEFAULT_BUCKET_NAME", "default"),
+			StoragePricePerGB:    getFloat("GODRIVE_STORAGE_PRICE_PER_GB", 0.023),
+			ImmutableRetention:   getDuration("GODRIVE_IMMUTABLE_RETENTION", 30*24*time.Hour),
+		},
+		Presign: PresignConfig{
+			AllowedMethods: getStringSlice("GODRIVE_PRESIGN_ALLOWED_METHODS", []string{"GET", "PUT"}),
+			DefaultTTL:     getDuration("GODRIVE_PRESIGN_DEFAULT_TTL", 15*time.Minute),
+			MaxTTL:         getDuration("GODRIVE_PRESIGN_MAX_TTL", 24*time.Hour),
+			RateLimit:      getFloat("GODRIVE_PRESIGN_RATE_LIMIT", 5),
+			RateBurst:      getInt("GODRIVE_PRESIGN_RATE_BURST", 20),
+		},
+		Cache: CacheConfig{
+			ObjectCacheBytes:          getInt64("GODRIVE_OBJECT_CACHE_BYTES", 0),
+			ObjectCacheMaxObjectBytes: getInt64("GODRIVE_OBJECT_CACHE_MAX_OBJECT_BYTES", 1024*1024),
+			MetadataCacheTTL:          getDuration("GODRIVE_METADATA_CACHE_TTL", 0),
+		},
 		Metrics: MetricsConfig{
-			PrometheusPath: getString("GODRIVE_METRICS_PATH", "/metrics"),
+			PrometheusPath:          getString("GODRIVE_METRICS_PATH", "/metrics"),
+			DependencyCheckInterval: getDuration("GODRIVE_DEPENDENCY_CHECK_INTERVAL", 30*time.Second),
+		},
+		Maintenance: MaintenanceConfig{
+			ChecksumBackfillInterval:   getDuration("GODRIVE_CHECKSUM_BACKFILL_INTERVAL", 0),
+			ChecksumBackfillBatchSize:  getInt("GODRIVE_CHECKSUM_BACKFILL_BATCH_SIZE", 100),
+			IdempotencyCleanupInterval: getDuration("GODRIVE_IDEMPOTENCY_CLEANUP_INTERVAL", time.Hour),
+		},
+		Features: FeaturesConfig{
+			Sharing:        getBool("GODRIVE_FEATURE_SHARING", true),
+			PublicBuckets:  getBool("GODRIVE_FEATURE_PUBLIC_BUCKETS", true),
+			Dedup:          getBool("GODRIVE_FEATURE_DEDUP", true),
+			DisabledStatus: getInt("GODRIVE_FEATURE_DISABLED_STATUS", 404),
 		},
 	}
 
+	if err := validateTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		return Config{}, err
+	}
+	if (cfg.Server.TLSCertFile == "") != (cfg.Server.TLSKeyFile == "") {
+		return Config{}, fmt.Errorf("GODRIVE_API_TLS_CERT_FILE and GODRIVE_API_TLS_KEY_FILE must be set together")
+	}
+	if cfg.Features.DisabledStatus != 403 && cfg.Features.DisabledStatus != 404 {
+		return Config{}, fmt.Errorf("GODRIVE_FEATURE_DISABLED_STATUS must be 403 or 404, got %d", cfg.Features.DisabledStatus)
+	}
+	if cfg.Storage.Provider != StorageProviderMinIO && cfg.Storage.Provider != StorageProviderS3 {
+		return Config{}, fmt.Errorf("unsupported STORAGE_PROVIDER %q", cfg.Storage.Provider)
+	}
+
 	return cfg, nil
 }
 
+func validateTrustedProxies(proxies []string) error {
+	for _, proxy := range proxies {
+		if strings.Contains(proxy, "/") {
+			if _, _, err := net.ParseCIDR(proxy); err != nil {
+				return fmt.Errorf("invalid GODRIVE_TRUSTED_PROXIES entry %q: %w", proxy, err)
+			}
+			continue
+		}
+		if net.ParseIP(proxy) == nil {
+			return fmt.Errorf("invalid GODRIVE_TRUSTED_PROXIES entry %q", proxy)
+		}
+	}
+	return nil
+}
+
 func getString(key, fallback string) string {
 	if val, ok := os.LookupEnv(key); ok {
 		return val
@@ -122,6 +452,24 @@ func getInt(key string, fallback int) int {
 	return fallback
 }
 
+func getInt64(key string, fallback int64) int64 {
+	if val, ok := os.LookupEnv(key); ok {
+		if parsed, err := strconv.ParseInt(val, 10, 64); err == nil {
+			return parsed
+		}
+	}
+	return fallback
+}
+
+func getFloat(key string, fallback float64) float64 {
+	if val, ok := os.LookupEnv(key); ok {
+		if parsed, err := strconv.ParseFloat(val, 64); err == nil {
+			return parsed
+		}
+	}
+	return fallback
+}
+
 func getBool(key string, fallback bool) bool {
 	if val, ok := os.LookupEnv(key); ok {
 		val = strings.ToLower(strings.TrimSpace(val))
@@ -135,6 +483,20 @@ func getBool(key string, fallback bool) bool {
 	return fallback
 }
 
+func getStringSlice(key string, fallback []string) []string {
+	val, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+	var out []string
+	for _, part := range strings.Split(val, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
 func getDuration(key string, fallback time.Duration) time.Duration {
 	if val, ok := os.LookupEnv(key); ok {
 		if parsed, err := time.ParseDuration(val); err == nil {
@@ -144,17 +506,56 @@ func getDuration(key string, fallback time.Duration) time.Duration {
 	return fallback
 }
 
+// Token lifetime defaults and the range an access token's lifetime must fall in.
+const (
+	defaultAccessTokenTTL  = 15 * time.Minute
+	defaultRefreshTokenTTL = 720 * time.Hour
+	minAccessTokenTTL      = time.Minute
+	maxAccessTokenTTL      = 24 * time.Hour
+)
+
 func loadAuthConfig() AuthConfig {
 	cost := getInt("GODRIVE_AUTH_BCRYPT_COST", 12)
 	if cost < 4 || cost > 31 {
 		cost = 12
 	}
+	accessTTL, refreshTTL := validateTokenTTLs(
+		getDuration("GODRIVE_AUTH_ACCESS_TOKEN_TTL", defaultAccessTokenTTL),
+		getDuration("GODRIVE_AUTH_REFRESH_TOKEN_TTL", defaultRefreshTokenTTL),
+	)
 
 	return AuthConfig{
 		AccessTokenSecret:  getString("GODRIVE_JWT_SECRET", "change-me-to-a-32-byte-secret"),
 		RefreshTokenSecret: getString("GODRIVE_JWT_REFRESH_SECRET", "change-me-to-a-64-byte-secret"),
-		AccessTokenTTL:     getDuration("GODRIVE_AUTH_ACCESS_TOKEN_TTL", 15*time.Minute),
-		RefreshTokenTTL:    getDuration("GODRIVE_AUTH_REFRESH_TOKEN_TTL", 720*time.Hour),
+		TokenIssuer:        getString("GODRIVE_JWT_ISSUER", "godrive"),
+		TokenAudience:      getString("GODRIVE_JWT_AUDIENCE", "godrive-api"),
+		AccessTokenTTL:     accessTTL,
+		RefreshTokenTTL:    refreshTTL,
 		BcryptCost:         cost,
+		PasswordHasher:     strings.ToLower(getString("GODRIVE_AUTH_PASSWORD_HASHER", "bcrypt")),
+		Argon2Memory:       getInt("GODRIVE_AUTH_ARGON2_MEMORY_KB", 64*1024),
+		Argon2Time:         getInt("GODRIVE_AUTH_ARGON2_TIME", 3),
+		Argon2Parallelism:  getInt("GODRIVE_AUTH_ARGON2_PARALLELISM", 2),
+		PasswordPepper:     getString("GODRIVE_AUTH_PASSWORD_PEPPER", ""),
+		StripEmailTags:     getBool("GODRIVE_AUTH_STRIP_EMAIL_TAGS", false),
+		InviteOnly:         !getBool("GODRIVE_ALLOW_REGISTRATION", true),
+		InviteTTL:          getDuration("GODRIVE_AUTH_INVITE_TTL", 7*24*time.Hour),
+	}
+}
+
+// validateTokenTTLs keeps token lifetimes sane so a typo cannot yield tokens that never expire.
+// An access TTL outside minAccessTokenTTL..maxAccessTokenTTL, or a refresh TTL that does not
+// outlast it, is replaced by its default with a warning.
+func validateTokenTTLs(access, refresh time.Duration) (time.Duration, time.Duration) {
+	if access < minAccessTokenTTL || access > maxAccessTokenTTL {
+		log.Printf("warning: GODRIVE_AUTH_ACCESS_TOKEN_TTL %s is outside %s-%s; using %s",
+			access, minAccessTokenTTL, maxAccessTokenTTL, defaultAccessTokenTTL)
+		access = defaultAccessTokenTTL
+	}
+	if refresh <= access {
+		log.Printf("warning: GODRIVE_AUTH_REFRESH_TOKEN_TTL %s does not exceed the access token TTL %s; using %s",
+			refresh, access, defaultRefreshTokenTTL)
+		refresh = defaultRefreshTokenTTL
 	}
+	return access, refresh
 }
@@ -0,0 +1,113 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestValidateTokenTTLsFallsBackOnOutOfRangeValues(t *testing.T) {
+	cases := []struct {
+		name                    string
+		access, refresh         time.Duration
+		wantAccess, wantRefresh time.Duration
+	}{
+		{name: "valid", access: 30 * time.Minute, refresh: 48 * time.Hour, wantAccess: 30 * time.Minute, wantRefresh: 48 * time.Hour},
+		{name: "zero access", access: 0, refresh: 48 * time.Hour, wantAccess: defaultAccessTokenTTL, wantRefresh: 48 * time.Hour},
+		{name: "access too short", access: 30 * time.Second, refresh: time.Hour, wantAccess: defaultAccessTokenTTL, wantRefresh: time.Hour},
+		{name: "access too long", access: 100 * 365 * 24 * time.Hour, refresh: 200 * 365 * 24 * time.Hour, wantAccess: defaultAccessTokenTTL, wantRefresh: 200 * 365 * 24 * time.Hour},
+		{name: "refresh not longer", access: time.Hour, refresh: time.Hour, wantAccess: time.Hour, wantRefresh: defaultRefreshTokenTTL},
+		{name: "zero refresh", access: time.Hour, refresh: 0, wantAccess: time.Hour, wantRefresh: defaultRefreshTokenTTL},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			access, refresh := validateTokenTTLs(tc.access, tc.refresh)
+			if access != tc.wantAccess || refresh != tc.wantRefresh {
+				t.Fatalf("expected %s/%s, got %s/%s", tc.wantAccess, tc.wantRefresh, access, refresh)
+			}
+		})
+	}
+}
+
+func TestLoadAppliesTokenTTLValidation(t *testing.T) {
+	t.Setenv("GODRIVE_AUTH_ACCESS_TOKEN_TTL", "0s")
+	t.Setenv("GODRIVE_AUTH_REFRESH_TOKEN_TTL", "1m")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if cfg.Auth.AccessTokenTTL != defaultAccessTokenTTL || cfg.Auth.RefreshTokenTTL != defaultRefreshTokenTTL {
+		t.Fatalf("expected default TTLs, got %s/%s", cfg.Auth.AccessTokenTTL, cfg.Auth.RefreshTokenTTL)
+	}
+}
+
+func TestLoadReadsServerTuning(t *testing.T) {
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if cfg.Server.ReadHeaderTimeout != 5*time.Second || cfg.Server.MaxHeaderBytes != 1<<20 || !cfg.Server.EnableHTTP2 || cfg.Server.TLSEnabled() {
+		t.Fatalf("unexpected server defaults %+v", cfg.Server)
+	}
+
+	t.Setenv("GODRIVE_API_READ_HEADER_TIMEOUT", "2s")
+	t.Setenv("GODRIVE_API_MAX_HEADER_BYTES", "65536")
+	t.Setenv("GODRIVE_API_HTTP2", "false")
+	t.Setenv("GODRIVE_API_TLS_CERT_FILE", "/etc/godrive/tls.crt")
+	t.Setenv("GODRIVE_API_TLS_KEY_FILE", "/etc/godrive/tls.key")
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if cfg.Server.ReadHeaderTimeout != 2*time.Second || cfg.Server.MaxHeaderBytes != 65536 || cfg.Server.EnableHTTP2 || !cfg.Server.TLSEnabled() {
+		t.Fatalf("expected overrides to apply, got %+v", cfg.Server)
+	}
+
+	t.Setenv("GODRIVE_API_TLS_KEY_FILE", "")
+	if _, err := Load(); err == nil {
+		t.Fatalf("expected an error for a certificate without a key")
+	}
+}
+
+func TestLoadReadsHeaderAndStreamReadTimeouts(t *testing.T) {
+	t.Setenv("GODRIVE_API_READ_HEADER_TIMEOUT", "3s")
+	t.Setenv("GODRIVE_API_READ_TIMEOUT", "20s")
+	t.Setenv("GODRIVE_API_STREAM_READ_TIMEOUT", "2h")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if cfg.Server.ReadHeaderTimeout != 3*time.Second {
+		t.Fatalf("expected a 3s header timeout, got %s", cfg.Server.ReadHeaderTimeout)
+	}
+	if cfg.Server.ReadTimeout != 20*time.Second || cfg.Server.StreamReadTimeout != 2*time.Hour {
+		t.Fatalf("expected body timeouts of 20s and 2h, got %s and %s", cfg.Server.ReadTimeout, cfg.Server.StreamReadTimeout)
+	}
+}
+
+func TestLoadReadsRepositoryTimeouts(t *testing.T) {
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if cfg.Postgres.LookupTimeout != 5*time.Second || cfg.Postgres.ListTimeout != 5*time.Second || cfg.Postgres.WriteTimeout != 5*time.Second {
+		t.Fatalf("expected 5s defaults, got lookup %s, list %s, write %s", cfg.Postgres.LookupTimeout, cfg.Postgres.ListTimeout, cfg.Postgres.WriteTimeout)
+	}
+
+	t.Setenv("GODRIVE_DB_LOOKUP_TIMEOUT", "500ms")
+	t.Setenv("GODRIVE_DB_LIST_TIMEOUT", "1m")
+	t.Setenv("GODRIVE_DB_WRITE_TIMEOUT", "10s")
+
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if cfg.Postgres.LookupTimeout != 500*time.Millisecond {
+		t.Fatalf("expected a 500ms lookup timeout, got %s", cfg.Postgres.LookupTimeout)
+	}
+	if cfg.Postgres.ListTimeout != time.Minute || cfg.Postgres.WriteTimeout != 10*time.Second {
+		t.Fatalf("expected list and write timeouts of 1m and 10s, got %s and %s", cfg.Postgres.ListTimeout, cfg.Postgres.WriteTimeout)
+	}
+}
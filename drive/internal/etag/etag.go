@@ -0,0 +1,44 @@
+// Package etag derives entity tags from a resource's updated_at and parses If-Match headers
+// for optimistic concurrency on update endpoints.
+package etag
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidETag signals an If-Match value that was not produced by FromTime.
+var ErrInvalidETag = errors.New("invalid etag")
+
+// FromTime returns the strong ETag for a resource last updated at t. Microsecond precision
+// matches what PostgreSQL stores, so the tag round-trips through the database.
+func FromTime(t time.Time) string {
+	return `"` + strconv.FormatInt(t.UnixMicro(), 36) + `"`
+}
+
+// ParseIfMatch returns the updated_at encoded in an If-Match header. It reports false when the
+// header is empty or "*", meaning any current version is acceptable.
+func ParseIfMatch(header string) (time.Time, bool, error) {
+	header = strings.TrimSpace(header)
+	if header == "" || header == "*" {
+		return time.Time{}, false, nil
+	}
+	if strings.Contains(header, ",") || strings.HasPrefix(header, "W/") {
+		return time.Time{}, false, ErrInvalidETag
+	}
+
+	raw, ok := strings.CutPrefix(header, `"`)
+	if ok {
+		raw, ok = strings.CutSuffix(raw, `"`)
+	}
+	if !ok {
+		return time.Time{}, false, ErrInvalidETag
+	}
+	micros, err := strconv.ParseInt(raw, 36, 64)
+	if err != nil {
+		return time.Time{}, false, ErrInvalidETag
+	}
+	return time.UnixMicro(micros).UTC(), true, nil
+}
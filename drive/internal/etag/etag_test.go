@@ -0,0 +1,28 @@
+package etag
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseIfMatchRoundTrips(t *testing.T) {
+	updated := time.Date(2024, 3, 9, 12, 30, 45, 123456789, time.UTC)
+	got, ok, err := ParseIfMatch(FromTime(updated))
+	if err != nil || !ok {
+		t.Fatalf("parse: ok=%v err=%v", ok, err)
+	}
+	if !got.Equal(updated.Truncate(time.Microsecond)) {
+		t.Fatalf("expected %s, got %s", updated.Truncate(time.Microsecond), got)
+	}
+
+	for _, header := range []string{"", "*"} {
+		if _, ok, err := ParseIfMatch(header); ok || err != nil {
+			t.Fatalf("expected %q to match any version, got ok=%v err=%v", header, ok, err)
+		}
+	}
+	for _, header := range []string{"abc", `W/"abc"`, `"a", "b"`, `"!!"`} {
+		if _, _, err := ParseIfMatch(header); err != ErrInvalidETag {
+			t.Fatalf("expected ErrInvalidETag for %q, got %v", header, err)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+// Package events is an in-process bus that lets services announce what happened without
+// knowing which side effects (metrics, webhooks, reconciliation) depend on it.
+package events
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const defaultQueueSize = 256
+
+// Type names a kind of event.
+type Type string
+
+const (
+	// BucketCreated is published after a bucket is created.
+	BucketCreated Type = "bucket.created"
+	// BucketDeleted is published after a bucket and its objects are removed. It stands in for
+	// the bucket's files, which are not announced one by one; SizeBytes is the bucket's usage.
+	BucketDeleted Type = "bucket.deleted"
+	// FileUploaded is published after a file's object, metadata and usage are stored.
+	FileUploaded Type = "file.uploaded"
+	// FileDeleted is published after a file's metadata, object and usage are removed.
+	FileDeleted Type = "file.deleted"
+	// FileMoved is published after a file is moved to another bucket; BucketID is the target.
+	FileMoved Type = "file.moved"
+)
+
+// Event describes something that happened to a user's bucket or file. FileID is zero for
+// bucket events.
+type Event struct {
+	Type       Type
+	UserID     uuid.UUID
+	BucketID   uuid.UUID
+	FileID     uuid.UUID
+	Name       string
+	SizeBytes  int64
+	OccurredAt time.Time
+}
+
+// Handler reacts to an event. Handlers run on the bus worker one at a time, so a slow handler
+// delays later events but never the publisher.
+type Handler func(ctx context.Context, e Event)
+
+type subscription struct {
+	types   map[Type]bool
+	handler Handler
+}
+
+type queued struct {
+	ctx   context.Context
+	event Event
+}
+
+// Bus delivers published events to subscribers on a background worker.
+type Bus struct {
+	mu      sync.RWMutex
+	subs    []subscription
+	queue   chan queued
+	done    chan struct{}
+	closed  bool
+	nowFunc func() time.Time
+}
+
+// NewBus starts a bus whose queue holds up to queueSize undelivered events; a non-positive size
+// uses the default. Call Close on shutdown to deliver what is queued.
+func NewBus(queueSize int) *Bus {
+	if queueSize <= 0 {
+		queueSize = defaultQueueSize
+	}
+	b := &Bus{
+		queue:   make(chan queued, queueSize),
+		done:    make(chan struct{}),
+		nowFunc: time.Now,
+	}
+	go b.run()
+	return b
+}
+
+// Subscribe registers handler for the given event types, or for every event when none are
+// given. Subscribers are expected to register at startup, before events are published.
+func (b *Bus) Subscribe(handler Handler, types ...Type) {
+	sub := subscription{handler: handler}
+	if len(types) > 0 {
+		sub.types = make(map[Type]bool, len(types))
+		for _, t := range types {
+			sub.types[t] = true
+		}
+	}
+	b.mu.Lock()
+	b.subs = append(b.subs, sub)
+	b.mu.Unlock()
+}
+
+// Publish queues e for delivery without blocking. When the queue is full, or the bus is closed,
+// the event is dropped and logged: side effects must never stall the operation that caused
+// them. The context's values reach handlers but its cancellation does not.
+func (b *Bus) Publish(ctx context.Context, e Event) {
+	if e.OccurredAt.IsZero() {
+		e.OccurredAt = b.nowFunc().UTC()
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.closed {
+		log.Printf("events: bus closed, dropping %s for %s", e.Type, e.UserID)
+		return
+	}
+	select {
+	case b.queue <- queued{ctx: context.WithoutCancel(ctx), event: e}:
+	default:
+		log.Printf("events: queue full, dropping %s for %s", e.Type, e.UserID)
+	}
+}
+
+// Close stops accepting events and waits until those already queued are delivered.
+func (b *Bus) Close() {
+	b.mu.Lock()
+	if !b.closed {
+		b.closed = true
+		close(b.queue)
+	}
+	b.mu.Unlock()
+	<-b.done
+}
+
+func (b *Bus) run() {
+	defer close(b.done)
+	for q := range b.queue {
+		b.deliver(q.ctx, q.event)
+	}
+}
+
+func (b *Bus) deliver(ctx context.Context, e Event) {
+	b.mu.RLock()
+	subs := b.subs
+	b.mu.RUnlock()
+	for _, sub := range subs {
+		if sub.types == nil || sub.types[e.Type] {
+			b.call(ctx, sub.handler, e)
+		}
+	}
+}
+
+// call shields the worker from a panicking handler so one bad subscriber cannot stop delivery.
+func (b *Bus) call(ctx context.Context, handler Handler, e Event) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("events: handler for %s panicked: %v", e.Type, r)
+		}
+	}()
+	handler(ctx, e)
+}
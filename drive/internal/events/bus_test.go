@@ -0,0 +1,22 @@
+package events
+
+import (
+	"context"
+	"testing"
+)
+
+func TestCloseDeliversQueuedEventsPastAPanickingHandler(t *testing.T) {
+	bus := NewBus(4)
+	var delivered []Type
+	bus.Subscribe(func(ctx context.Context, e Event) { panic("broken subscriber") })
+	bus.Subscribe(func(ctx context.Context, e Event) { delivered = append(delivered, e.Type) })
+
+	bus.Publish(context.Background(), Event{Type: BucketCreated})
+	bus.Publish(context.Background(), Event{Type: FileUploaded})
+	bus.Close()
+	bus.Publish(context.Background(), Event{Type: FileDeleted})
+
+	if len(delivered) != 2 || delivered[0] != BucketCreated || delivered[1] != FileUploaded {
+		t.Fatalf("expected both queued events in order after Close, got %v", delivered)
+	}
+}
@@ -0,0 +1,108 @@
+package file
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+)
+
+// MaxArchiveFiles caps how many files one archive request may select.
+const MaxArchiveFiles = 1000
+
+// SelectForArchive resolves fileIDs in a bucket owned by ownerID for WriteArchive. Files are
+// returned in request order with duplicates dropped; IDs that do not name a file in the bucket
+// are returned separately so the caller can report them.
+func (s *Service) SelectForArchive(ctx context.Context, ownerID, bucketID uuid.UUID, fileIDs []uuid.UUID) ([]Metadata, []uuid.UUID, error) {
+	if len(fileIDs) == 0 {
+		return nil, nil, fmt.Errorf("missing file ids")
+	}
+	if len(fileIDs) > MaxArchiveFiles {
+		return nil, nil, ErrArchiveTooLarge
+	}
+
+	found, err := s.GetMany(ctx, ownerID, bucketID, fileIDs)
+	if err != nil {
+		return nil, nil, translateBucketError(err)
+	}
+
+	var (
+		files   []Metadata
+		missing []uuid.UUID
+	)
+	seen := make(map[uuid.UUID]bool, len(fileIDs))
+	for _, id := range fileIDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		if meta, ok := found[id]; ok {
+			files = append(files, meta)
+		} else {
+			missing = append(missing, id)
+		}
+	}
+	return files, missing, nil
+}
+
+// WriteArchive streams ownerID's files into a zip written to w, copying each object straight from
+// storage into its entry. Colliding filenames get a numeric suffix. It stops at the first error, including
+// cancellation of ctx when the client goes away.
+func (s *Service) WriteArchive(ctx context.Context, ownerID uuid.UUID, w io.Writer, files []Metadata) error {
+	objectBucket, err := s.resolveObjectBucket(ctx, ownerID)
+	if err != nil {
+		return err
+	}
+
+	zw := zip.NewWriter(w)
+	names := make(map[string]bool, len(files))
+	for _, meta := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := s.writeArchiveEntry(ctx, zw, objectBucket, uniqueArchiveName(names, meta.OriginalFilename), meta); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func (s *Service) writeArchiveEntry(ctx context.Context, zw *zip.Writer, objectBucket, name string, meta Metadata) error {
+	object, err := s.getObject(ctx, objectBucket, meta.ObjectName, minio.GetObjectOptions{})
+	if err != nil {
+		return fmt.Errorf("fetch object: %w", err)
+	}
+	defer object.Close()
+
+	entry, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: meta.CreatedAt})
+	if err != nil {
+		return fmt.Errorf("create archive entry: %w", err)
+	}
+	if _, err := io.Copy(entry, object); err != nil {
+		return fmt.Errorf("write archive entry %s: %w", name, err)
+	}
+	return nil
+}
+
+// uniqueArchiveName flattens name to a safe base name and appends " (n)" before the extension
+// until it no longer collides with an entry already in used.
+func uniqueArchiveName(used map[string]bool, name string) string {
+	base := path.Base(strings.ReplaceAll(name, "\\", "/"))
+	if base == "." || base == "/" || base == ".." {
+		base = "upload"
+	}
+
+	candidate := base
+	ext := path.Ext(base)
+	stem := strings.TrimSuffix(base, ext)
+	for n := 1; used[candidate]; n++ {
+		candidate = fmt.Sprintf("%s (%d)%s", stem, n, ext)
+	}
+	used[candidate] = true
+	return candidate
+}
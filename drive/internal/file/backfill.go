@@ -0,0 +1,100 @@
+package file
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DefaultBackfillBatchSize is how many files BackfillChecksums loads at a time when the caller
+// passes a non-positive batch size.
+const DefaultBackfillBatchSize = 100
+
+// BackfillResult summarizes a checksum backfill run.
+type BackfillResult struct {
+	Updated int `json:"updated"`
+	Failed  int `json:"failed"`
+	// Skipped counts files deleted or given a checksum by another writer while being hashed.
+	Skipped int `json:"skipped"`
+}
+
+// BackfillChecksums computes and stores the SHA-256 checksum of every file recorded without one,
+// such as files registered before checksums existed. Files are loaded batchSize at a time and
+// hashed one after another, so at most one object is read from the store at once. A file that
+// cannot be hashed is logged, counted as failed and skipped; one that was deleted or hashed by
+// another writer meanwhile is left as it is. The run stops early only when the listing fails or
+// ctx is canceled.
+func (s *Service) BackfillChecksums(ctx context.Context, batchSize int) (BackfillResult, error) {
+	if batchSize <= 0 {
+		batchSize = DefaultBackfillBatchSize
+	}
+
+	var (
+		result BackfillResult
+		after  uuid.UUID
+	)
+	for {
+		files, err := s.repo.ListUnhashed(ctx, after, batchSize)
+		if err != nil {
+			return result, err
+		}
+		for _, file := range files {
+			if err := ctx.Err(); err != nil {
+				return result, err
+			}
+			after = file.ID
+
+			checksum, err := s.hashObject(ctx, file.OwnerID, file.Metadata)
+			var (
+				updated Metadata
+				set     bool
+			)
+			if err == nil {
+				updated, set, err = s.repo.SetChecksumIfEmpty(ctx, file.OwnerID, file.BucketID, file.ID, checksum)
+			}
+			if err != nil {
+				log.Printf("backfill checksum for file %s: %v", file.ID, err)
+				result.Failed++
+				continue
+			}
+			if !set {
+				result.Skipped++
+				continue
+			}
+			s.metaCache.put(file.OwnerID, s.nowFunc(), updated)
+			result.Updated++
+		}
+		if len(files) < batchSize {
+			return result, nil
+		}
+	}
+}
+
+// RunChecksumBackfill runs BackfillChecksums immediately and then every interval until ctx is
+// canceled, logging each run that found work. A non-positive interval disables it. It blocks,
+// so callers run it in its own goroutine.
+func (s *Service) RunChecksumBackfill(ctx context.Context, interval time.Duration, batchSize int) {
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		result, err := s.BackfillChecksums(ctx, batchSize)
+		switch {
+		case err != nil && ctx.Err() == nil:
+			log.Printf("checksum backfill: %v", err)
+		case result.Updated > 0 || result.Failed > 0 || result.Skipped > 0:
+			log.Printf("checksum backfill: %d updated, %d failed, %d skipped", result.Updated, result.Failed, result.Skipped)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
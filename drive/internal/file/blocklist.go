@@ -0,0 +1,51 @@
+package file
+
+import (
+	"mime"
+	"path"
+	"strings"
+)
+
+// sniffLen is how much of the start of an upload is buffered to detect its content type.
+const sniffLen = 512
+
+// contentBlocklist rejects uploads by content type or filename extension regardless of bucket
+// rules. Types may be exact (text/html) or wildcards (application/x-*); extensions are matched
+// case-insensitively with or without a leading dot.
+type contentBlocklist struct {
+	types      []string
+	extensions map[string]bool
+}
+
+func (b contentBlocklist) empty() bool {
+	return len(b.types) == 0 && len(b.extensions) == 0
+}
+
+// blocks reports whether the declared type, the type sniffed from the content, or the filename's
+// extension is blocked. Checking the sniffed type means a mislabeled part header cannot bypass
+// the list.
+func (b contentBlocklist) blocks(filename, declaredType, sniffedType string) bool {
+	if b.empty() {
+		return false
+	}
+	if b.extensions[strings.ToLower(path.Ext(filename))] {
+		return true
+	}
+	return b.blocksType(declaredType) || b.blocksType(sniffedType)
+}
+
+func (b contentBlocklist) blocksType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = strings.ToLower(strings.TrimSpace(contentType))
+	}
+	for _, pattern := range b.types {
+		if pattern == mediaType {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok && strings.HasPrefix(mediaType, prefix) {
+			return true
+		}
+	}
+	return false
+}
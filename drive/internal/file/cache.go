@@ -0,0 +1,106 @@
+package file
+
+import (
+	"container/list"
+	"sync"
+)
+
+const defaultCacheMaxObjectBytes = 1 << 20
+
+// ObjectCache is an in-memory LRU of small object bodies keyed by object name. Each entry
+// remembers the checksum it was stored under, so an object whose metadata checksum has since
+// changed is treated as a miss and refetched.
+type ObjectCache struct {
+	mu             sync.Mutex
+	maxBytes       int64
+	maxObjectBytes int64
+	size           int64
+	order          *list.List
+	entries        map[string]*list.Element
+}
+
+type cacheEntry struct {
+	key      string
+	checksum string
+	data     []byte
+}
+
+// NewObjectCache builds a cache holding at most maxBytes of object data, admitting only objects
+// up to maxObjectBytes. A non-positive maxBytes returns nil, which disables caching.
+func NewObjectCache(maxBytes, maxObjectBytes int64) *ObjectCache {
+	if maxBytes <= 0 {
+		return nil
+	}
+	if maxObjectBytes <= 0 {
+		maxObjectBytes = defaultCacheMaxObjectBytes
+	}
+	if maxObjectBytes > maxBytes {
+		maxObjectBytes = maxBytes
+	}
+	return &ObjectCache{
+		maxBytes:       maxBytes,
+		maxObjectBytes: maxObjectBytes,
+		order:          list.New(),
+		entries:        make(map[string]*list.Element),
+	}
+}
+
+// admits reports whether an object of the given size may be cached.
+func (c *ObjectCache) admits(size int64) bool {
+	return c != nil && size >= 0 && size <= c.maxObjectBytes
+}
+
+func (c *ObjectCache) get(key, checksum string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*cacheEntry)
+	if entry.checksum != checksum {
+		c.removeElement(elem)
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	return entry.data, true
+}
+
+func (c *ObjectCache) put(key, checksum string, data []byte) {
+	if !c.admits(int64(len(data))) {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		c.removeElement(elem)
+	}
+	c.entries[key] = c.order.PushFront(&cacheEntry{key: key, checksum: checksum, data: data})
+	c.size += int64(len(data))
+
+	for c.size > c.maxBytes {
+		c.removeElement(c.order.Back())
+	}
+}
+
+func (c *ObjectCache) remove(key string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		c.removeElement(elem)
+	}
+}
+
+func (c *ObjectCache) removeElement(elem *list.Element) {
+	entry := c.order.Remove(elem).(*cacheEntry)
+	delete(c.entries, entry.key)
+	c.size -= int64(len(entry.data))
+}
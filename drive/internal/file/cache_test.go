@@ -0,0 +1,37 @@
+package file
+
+import "testing"
+
+func TestObjectCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	cache := NewObjectCache(10, 4)
+
+	cache.put("a", "sum-a", []byte("aaaa"))
+	cache.put("b", "sum-b", []byte("bbbb"))
+	if _, ok := cache.get("a", "sum-a"); !ok {
+		t.Fatalf("expected a to be cached")
+	}
+	cache.put("c", "sum-c", []byte("cccc"))
+
+	if _, ok := cache.get("b", "sum-b"); ok {
+		t.Fatalf("expected least recently used entry b to be evicted")
+	}
+	if _, ok := cache.get("a", "sum-a"); !ok {
+		t.Fatalf("expected recently used entry a to survive")
+	}
+
+	cache.put("big", "sum-big", []byte("too large"))
+	if _, ok := cache.get("big", "sum-big"); ok {
+		t.Fatalf("expected objects over the per-object limit to be skipped")
+	}
+
+	if _, ok := cache.get("a", "changed"); ok {
+		t.Fatalf("expected a checksum mismatch to miss")
+	}
+	if _, ok := cache.get("a", "sum-a"); ok {
+		t.Fatalf("expected a stale entry to be dropped after a checksum mismatch")
+	}
+
+	if NewObjectCache(0, 4) != nil {
+		t.Fatalf("expected a zero-sized cache to be disabled")
+	}
+}
@@ -0,0 +1,142 @@
+package file
+
+import (
+	"context"
+	"strings"
+
+	"github.com/abduss/godrive/internal/bucket"
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+)
+
+// DedupScope selects which of an owner's files an upload may share its object with when the
+// content is identical.
+type DedupScope string
+
+const (
+	// DedupNone stores every upload as its own object.
+	DedupNone DedupScope = "none"
+	// DedupBucket shares an object between identical files in the same bucket.
+	DedupBucket DedupScope = "bucket"
+	// DedupAccount shares an object between identical files anywhere in the owner's account.
+	DedupAccount DedupScope = "account"
+)
+
+func (d DedupScope) valid() bool {
+	switch d {
+	case DedupNone, DedupBucket, DedupAccount:
+		return true
+	}
+	return false
+}
+
+// SetDedupScope selects whether identical uploads reuse an existing object. Files already
+// sharing an object keep doing so whatever the scope, and their object is removed only with
+// the last file referencing it.
+func (s *Service) SetDedupScope(scope DedupScope) error {
+	if !scope.valid() {
+		return ErrInvalidDedupScope
+	}
+	s.dedup = scope
+	return nil
+}
+
+// findDuplicate returns a file within the dedup scope whose content matches checksum and size.
+// Lookup failures are treated as no match so the upload keeps its own object.
+func (s *Service) findDuplicate(ctx context.Context, target bucket.Bucket, checksum string, size int64) (Metadata, bool) {
+	var (
+		existing Metadata
+		err      error
+	)
+	switch s.dedup {
+	case DedupBucket:
+		existing, err = s.repo.FindByChecksum(ctx, target.OwnerID, target.ID, checksum)
+	case DedupAccount:
+		existing, err = s.repo.FindByChecksumInAccount(ctx, target.OwnerID, checksum)
+	default:
+		return Metadata{}, false
+	}
+	if err != nil || existing.SizeBytes != size || !s.objectInScope(ctx, target.OwnerID, target.ID, existing.ObjectName) {
+		return Metadata{}, false
+	}
+	return existing, true
+}
+
+// objectInScope reports whether a file in bucketID may reference objectName. Objects under the
+// bucket's own prefix always qualify. A deduplicated object may live under the prefix of another
+// bucket, which qualifies when only ownerID's files reference it. Ownership is decided by the
+// file rows rather than the bucket in the prefix, which may since have been deleted while other
+// files kept the object.
+func (s *Service) objectInScope(ctx context.Context, ownerID, bucketID uuid.UUID, objectName string) bool {
+	if objectBelongsToBucket(objectName, bucketID) {
+		return true
+	}
+	home, ok := objectHomeBucket(objectName)
+	if !ok || home == bucketID || !objectBelongsToBucket(objectName, home) {
+		return false
+	}
+	owned, err := s.repo.ObjectOwnedBy(ctx, ownerID, home, objectName)
+	return err == nil && owned
+}
+
+// objectHomeBucket returns the bucket whose prefix objectName was created under.
+func objectHomeBucket(objectName string) (uuid.UUID, bool) {
+	prefix, _, ok := strings.Cut(objectName, "/")
+	if !ok {
+		return uuid.Nil, false
+	}
+	id, err := uuid.Parse(prefix)
+	return id, err == nil
+}
+
+// releaseObject removes objectName and its derivatives once no file references it any more. The
+// last reference is decided in the database first; the store is only called after that commits,
+// so a slow store holds no lock. A missing object is already gone and is not an error.
+func (s *Service) releaseObject(ctx context.Context, objectBucket, objectName string) error {
+	released, err := s.repo.ReleaseObject(ctx, objectName)
+	if err != nil || !released {
+		return err
+	}
+	if err := s.objectStore.RemoveObject(ctx, objectBucket, objectName, minio.RemoveObjectOptions{}); err != nil {
+		if err = objectError(err, "remove object"); err != ErrFileNotFound {
+			return err
+		}
+	}
+	if s.tenants != nil && objectBucket != s.objectBucket {
+		// A copy stored before the owner was given a tenant bucket may remain in the shared one.
+		if err := s.objectStore.RemoveObject(ctx, s.objectBucket, objectName, minio.RemoveObjectOptions{}); err != nil {
+			if err = objectError(err, "remove object"); err != ErrFileNotFound {
+				return err
+			}
+		}
+	}
+	s.cache.remove(objectName)
+	s.removeDerivatives(ctx, objectBucket, objectName)
+	return nil
+}
+
+// CheckOverwritable returns ErrBucketImmutable if meta lives in an immutable bucket, and
+// ErrObjectShared if other deduplicated files share its object, so replacing the object in place
+// would change them too. Immutable buckets refuse every in-place replacement, not only during
+// retention, because a presigned PUT rewrites the object before any metadata check can run.
+//
+// A PUT URL issued before its bucket was made immutable stays valid until it expires, at most
+// the presign TTL limit; the rewritten content is then never committed, so the file keeps its
+// recorded size and checksum, which no longer match the object.
+func (s *Service) CheckOverwritable(ctx context.Context, ownerID, bucketID uuid.UUID, meta Metadata) error {
+	target, err := s.buckets.Get(ctx, ownerID, bucketID)
+	if err != nil {
+		return translateBucketError(err)
+	}
+	if target.Immutable {
+		return ErrBucketImmutable
+	}
+	refs, err := s.repo.CountObjectReferences(ctx, meta.ObjectName)
+	if err != nil {
+		return err
+	}
+	if refs > 1 {
+		return ErrObjectShared
+	}
+	return nil
+}
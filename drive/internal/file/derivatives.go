@@ -0,0 +1,46 @@
+package file
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// derivativeSuffix marks objects generated from a stored file, such as thumbnails or transcoded
+// formats. They live under the file's object name plus this suffix, e.g.
+// "<bucket>/<file>.derived/thumbnail.jpg", so they share the bucket prefix and are found by a
+// single listing. Derivatives are not charged to bucket usage, which counts only the bytes of
+// file rows, so incremental updates agree with the bucket's usage recompute.
+const derivativeSuffix = ".derived/"
+
+func derivativePrefix(objectName string) string {
+	return objectName + derivativeSuffix
+}
+
+// derivativeOf returns the object name key was derived from, if any.
+func derivativeOf(key string) (string, bool) {
+	parent, _, ok := strings.Cut(key, derivativeSuffix)
+	return parent, ok && parent != ""
+}
+
+// removeDerivatives deletes the objects in objectBucket derived from objectName. It never fails
+// the caller: derivatives that are already gone are skipped, and ones that cannot be listed or
+// removed are logged and left for the drift report to surface.
+func (s *Service) removeDerivatives(ctx context.Context, objectBucket, objectName string) {
+	objects, err := s.objectStore.ListObjects(ctx, objectBucket, derivativePrefix(objectName))
+	if err != nil {
+		log.Printf("list derivatives of %s: %v", objectName, err)
+		return
+	}
+
+	for _, obj := range objects {
+		err := s.objectStore.RemoveObject(ctx, objectBucket, obj.Key, minio.RemoveObjectOptions{})
+		if err != nil {
+			if err = objectError(err, "remove derivative"); err != ErrFileNotFound {
+				log.Printf("remove derivative %s: %v", obj.Key, err)
+			}
+		}
+	}
+}
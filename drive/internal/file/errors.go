@@ -1,6 +1,44 @@
 package file
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// SizeLimitError reports the effective upload limit that was exceeded.
+// It matches ErrFileTooLarge under errors.Is.
+type SizeLimitError struct {
+	Limit int64
+}
+
+func (e *SizeLimitError) Error() string {
+	return fmt.Sprintf("file too large: limit is %d bytes", e.Limit)
+}
+
+// Unwrap exposes ErrFileTooLarge so callers can keep matching the sentinel.
+func (e *SizeLimitError) Unwrap() error {
+	return ErrFileTooLarge
+}
+
+// RejectedError reports why a content scanner refused an upload.
+// It matches ErrUploadRejected under errors.Is.
+type RejectedError struct {
+	Reason string
+}
+
+func (e *RejectedError) Error() string {
+	if e.Reason == "" {
+		return ErrUploadRejected.Error()
+	}
+	return fmt.Sprintf("%s: %s", ErrUploadRejected, e.Reason)
+}
+
+// Unwrap exposes ErrUploadRejected so callers can keep matching the sentinel.
+func (e *RejectedError) Unwrap() error {
+	return ErrUploadRejected
+}
 
 var (
 	// ErrBucketMismatch indicates a file does not belong to the provided bucket or owner.
@@ -9,4 +47,88 @@ var (
 	ErrFileNotFound = errors.New("file not found")
 	// ErrFileTooLarge signals that the upload exceeds configured limits.
 	ErrFileTooLarge = errors.New("file too large")
+	// ErrInvalidKeyLayout signals an unknown object key layout.
+	ErrInvalidKeyLayout = errors.New("invalid object key layout")
+	// ErrInvalidDedupScope signals an unknown upload deduplication scope.
+	ErrInvalidDedupScope = errors.New("invalid dedup scope")
+	// ErrBatchTooLarge signals that a file would push a batch upload past its aggregate limit.
+	ErrBatchTooLarge = errors.New("batch size limit exceeded")
+	// ErrEmptyUpload signals a zero-byte upload or a part without a filename.
+	ErrEmptyUpload = errors.New("empty upload")
+	// ErrLengthRequired signals an upload of unknown size when sizes must be declared up front.
+	ErrLengthRequired = errors.New("upload size required")
+	// ErrInvalidOriginalCreatedAt signals a client-supplied creation time too far in the future.
+	ErrInvalidOriginalCreatedAt = errors.New("original_created_at is in the future")
+	// ErrFileNameExists signals that a no-overwrite upload collides with an existing filename.
+	ErrFileNameExists = errors.New("file name already exists")
+	// ErrUploadInProgress signals that another upload with the same idempotency key has not finished.
+	ErrUploadInProgress = errors.New("upload with this idempotency key is in progress")
+	// ErrQuotaExceeded signals that an upload would push the owner past their account storage cap.
+	ErrQuotaExceeded = errors.New("account storage quota exceeded")
+	// ErrContentTypeNotAllowed signals that the upload's content type is rejected by the bucket.
+	ErrContentTypeNotAllowed = errors.New("content type not allowed")
+	// ErrUploadRejected signals that the configured scanner flagged the upload's content.
+	ErrUploadRejected = errors.New("upload rejected by content scan")
+	// ErrSameBucket signals a move whose target is the source bucket.
+	ErrSameBucket = errors.New("source and target bucket are the same")
+	// ErrMoveBatchTooLarge signals a batch move naming more than MaxMoveBatchSize files.
+	ErrMoveBatchTooLarge = errors.New("too many files in move batch")
+	// ErrStatUnavailable signals that an object could not be served from its stat alone and the
+	// caller should fall back to a metadata lookup.
+	ErrStatUnavailable = errors.New("object stat unavailable")
+	// ErrPresignUnavailable signals that listings cannot carry presigned download URLs.
+	ErrPresignUnavailable = errors.New("presigned urls unavailable")
+	// ErrPresignRateLimited signals that the caller has used up their presign rate limit.
+	ErrPresignRateLimited = errors.New("too many presign requests")
+	// ErrInvalidChecksum signals a checksum that is not 64 hex characters.
+	ErrInvalidChecksum = errors.New("invalid checksum")
+	// ErrArchiveTooLarge signals an archive request selecting more than MaxArchiveFiles files.
+	ErrArchiveTooLarge = errors.New("too many files in archive")
+	// ErrObjectOutsideBucket signals an object name that does not live under the bucket's prefix.
+	ErrObjectOutsideBucket = errors.New("object outside bucket")
+	// ErrInvalidObjectName signals an object key that is too long or could escape its prefix.
+	ErrInvalidObjectName = errors.New("invalid object name")
+	// ErrFileRetained signals a delete or move of a file in an immutable bucket
+	// before its retention period has ended.
+	ErrFileRetained = errors.New("file is under immutable retention")
+	// ErrBucketImmutable signals an in-place replacement of a file in an immutable bucket, which
+	// is refused whatever the file's age.
+	ErrBucketImmutable = errors.New("files in an immutable bucket cannot be replaced")
+	// ErrObjectAccessDenied signals that the object store refused access to an object.
+	ErrObjectAccessDenied = errors.New("object access denied")
+	// ErrObjectShared signals an in-place replacement of an object other files also reference.
+	ErrObjectShared = errors.New("object is shared with other files")
+	// ErrNotPreviewable signals a preview of a file whose content type is not text.
+	ErrNotPreviewable = errors.New("file type cannot be previewed")
 )
+
+// objectError translates an object store failure during action. A missing object becomes
+// ErrFileNotFound and refused access ErrObjectAccessDenied, so handlers can answer 404 and 403
+// rather than 500; anything else is wrapped with action.
+func objectError(err error, action string) error {
+	switch objectErrorCode(err) {
+	case "NoSuchKey", "NotFound":
+		return ErrFileNotFound
+	case "AccessDenied", "Forbidden":
+		return ErrObjectAccessDenied
+	}
+	return fmt.Errorf("%s: %w", action, err)
+}
+
+// objectMissing reports whether err says the object does not exist.
+func objectMissing(err error) bool {
+	code := objectErrorCode(err)
+	return code == "NoSuchKey" || code == "NotFound"
+}
+
+// objectErrorCode extracts the S3 error code from MinIO and AWS SDK errors.
+func objectErrorCode(err error) string {
+	if code := minio.ToErrorResponse(err).Code; code != "" {
+		return code
+	}
+	var apiErr interface{ ErrorCode() string }
+	if errors.As(err, &apiErr) {
+		return apiErr.ErrorCode()
+	}
+	return ""
+}
@@ -1,24 +1,64 @@
 package file
 
 import (
+	"cmp"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log"
+	"mime/multipart"
 	"net/http"
+	"net/textproto"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/abduss/godrive/internal/auth"
+	"github.com/abduss/godrive/internal/bind"
+	"github.com/abduss/godrive/internal/negotiate"
+	"github.com/abduss/godrive/internal/pagination"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 )
 
 // RegisterRoutes mounts file operations under the provided router group.
-func RegisterRoutes(group *gin.RouterGroup, service *Service) {
+// uploadMiddleware is applied only to the upload routes (e.g. concurrency limiting).
+func RegisterRoutes(group *gin.RouterGroup, service *Service, uploadMiddleware ...gin.HandlerFunc) {
 	handler := &httpHandler{service: service}
-	group.POST("/buckets/:bucketID/files", handler.uploadFile)
+	group.POST("/buckets/:bucketID/files", append(uploadMiddleware, handler.uploadFile)...)
+	group.POST("/buckets/:bucketID/files/batch", append(uploadMiddleware, handler.uploadBatch)...)
+	group.POST("/buckets/:bucketID/files/batch-move", handler.moveBatch)
+	group.POST("/buckets/:bucketID/files/archive", handler.archiveFiles)
+	group.GET("/buckets/:bucketID/uploads/:uploadID/progress", handler.uploadProgress)
 	group.GET("/buckets/:bucketID/files", handler.listFiles)
+	group.GET("/buckets/:bucketID/files/by-checksum/:sha256", handler.findByChecksum)
+	group.GET("/buckets/:bucketID/objects", handler.objectDrift)
+	group.GET("/buckets/:bucketID/manifest", handler.exportManifest)
 	group.GET("/buckets/:bucketID/files/:fileID/download", handler.downloadFile)
+	group.GET("/buckets/:bucketID/files/:fileID/preview", handler.previewFile)
 	group.DELETE("/buckets/:bucketID/files/:fileID", handler.deleteFile)
+	group.POST("/buckets/:bucketID/files/:fileID/rehash", handler.rehashFile)
+	group.POST("/buckets/:bucketID/files/:fileID/committed", handler.commitReplacement)
 }
 
+// RegisterPublicRoutes mounts unauthenticated download routes for public buckets.
+func RegisterPublicRoutes(group *gin.RouterGroup, service *Service) {
+	handler := &httpHandler{service: service}
+	group.GET("/public/buckets/:bucketID/files/:fileID/download", handler.publicDownload)
+}
+
+// maxIdempotencyKeyLength bounds client-supplied Idempotency-Key headers.
+const maxIdempotencyKeyLength = 255
+
+// progressInterval spaces upload progress events; progressWait bounds how long a progress
+// stream waits for an upload that has not started yet.
+const (
+	progressInterval = 500 * time.Millisecond
+	progressWait     = 30 * time.Second
+)
+
 type httpHandler struct {
 	service *Service
 }
@@ -36,28 +76,236 @@ func (h *httpHandler) uploadFile(c *gin.Context) {
 		return
 	}
 
-	fileHeader, err := c.FormFile("file")
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "file field is required"})
+	if !h.requireLength(c) {
+		return
+	}
+
+	uploadID := strings.TrimSpace(c.GetHeader("X-Upload-Id"))
+	if len(uploadID) > MaxUploadIDLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "X-Upload-Id too long"})
+		return
+	}
+	// Progress is counted while the form is parsed, which is when the body actually arrives.
+	uploaded := false
+	if uploadID != "" {
+		body, finish := h.service.trackUpload(userID, bucketID, uploadID, c.Request.Body, c.Request.ContentLength)
+		c.Request.Body = body
+		defer func() { finish(!uploaded) }()
+	}
+
+	fileHeaders, ok := h.formFiles(c)
+	if !ok {
+		return
+	}
+	fileHeader := fileHeaders[0]
+
+	var opts UploadOptions
+	if raw, ok := c.GetPostForm("overwrite"); ok {
+		overwrite, err := strconv.ParseBool(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "overwrite must be a boolean"})
+			return
+		}
+		opts.NoOverwrite = !overwrite
+	}
+
+	if raw := strings.TrimSpace(c.PostForm("original_created_at")); raw != "" {
+		createdAt, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "original_created_at must be an RFC3339 timestamp"})
+			return
+		}
+		opts.OriginalCreatedAt = &createdAt
+	}
+
+	opts.IdempotencyKey = strings.TrimSpace(c.GetHeader("Idempotency-Key"))
+	if len(opts.IdempotencyKey) > maxIdempotencyKeyLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key too long"})
 		return
 	}
 
-	meta, err := h.service.Upload(c.Request.Context(), userID, bucketID, fileHeader)
+	meta, err := h.service.Upload(c.Request.Context(), userID, bucketID, fileHeader, opts)
 	if err != nil {
+		var limitErr *SizeLimitError
+		if errors.As(err, &limitErr) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":               "file too large",
+				"max_file_size_bytes": limitErr.Limit,
+			})
+			return
+		}
+		var rejectedErr *RejectedError
+		if errors.As(err, &rejectedErr) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{
+				"error":  ErrUploadRejected.Error(),
+				"reason": rejectedErr.Reason,
+			})
+			return
+		}
 		switch err {
 		case ErrBucketMismatch:
 			c.JSON(http.StatusNotFound, gin.H{"error": "bucket not found"})
 		case ErrFileTooLarge:
 			c.JSON(http.StatusBadRequest, gin.H{"error": "file too large"})
+		case ErrContentTypeNotAllowed:
+			c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "content type not allowed in this bucket"})
+		case ErrQuotaExceeded:
+			c.JSON(http.StatusInsufficientStorage, gin.H{"error": "account storage quota exceeded"})
+		case ErrFileNameExists:
+			c.JSON(http.StatusConflict, gin.H{"error": "file name already exists"})
+		case ErrUploadInProgress:
+			c.JSON(http.StatusConflict, gin.H{"error": "upload with this idempotency key is in progress"})
+		case ErrEmptyUpload:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "file is empty or has no filename"})
+		case ErrInvalidOriginalCreatedAt:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "original_created_at cannot be in the future"})
+		case ErrLengthRequired:
+			c.JSON(http.StatusLengthRequired, gin.H{"error": "upload size is required"})
+		case ErrInvalidObjectName:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid object name"})
+		case ErrObjectAccessDenied:
+			c.JSON(http.StatusForbidden, gin.H{"error": "access to object denied"})
 		default:
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to upload file"})
 		}
 		return
 	}
 
+	uploaded = true
 	c.JSON(http.StatusCreated, meta)
 }
 
+// requireLength answers 411 for chunked upload requests when sizes must be declared up front.
+func (h *httpHandler) requireLength(c *gin.Context) bool {
+	if h.service.RequiresKnownSize() && c.Request.ContentLength < 0 {
+		c.JSON(http.StatusLengthRequired, gin.H{"error": "Content-Length is required"})
+		return false
+	}
+	return true
+}
+
+// formFiles returns the files under the first accepted upload field present in the form. When
+// none is present it answers 400 naming the accepted fields and returns false.
+func (h *httpHandler) formFiles(c *gin.Context) ([]*multipart.FileHeader, bool) {
+	fields := h.service.UploadFields()
+	if form, err := c.MultipartForm(); err == nil {
+		for _, field := range fields {
+			if files := form.File[field]; len(files) > 0 {
+				return files, true
+			}
+		}
+	}
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error":           fmt.Sprintf("file field is required, expected one of: %s", strings.Join(fields, ", ")),
+		"expected_fields": fields,
+	})
+	return nil, false
+}
+
+func (h *httpHandler) uploadBatch(c *gin.Context) {
+	userID, _, ok := auth.RequireUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	bucketID, err := uuid.Parse(c.Param("bucketID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid bucket id"})
+		return
+	}
+
+	if !h.requireLength(c) {
+		return
+	}
+
+	fileHeaders, ok := h.formFiles(c)
+	if !ok {
+		return
+	}
+
+	results, err := h.service.UploadBatch(c.Request.Context(), userID, bucketID, fileHeaders)
+	if err != nil {
+		switch err {
+		case ErrBucketMismatch:
+			c.JSON(http.StatusNotFound, gin.H{"error": "bucket not found"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to upload files", "files": results})
+		}
+		return
+	}
+
+	stored := 0
+	for _, result := range results {
+		if result.File != nil {
+			stored++
+		}
+	}
+
+	// 207 makes partial success explicit: some files were stored and others rejected.
+	status := http.StatusCreated
+	if stored < len(results) {
+		status = http.StatusMultiStatus
+	}
+	c.JSON(status, gin.H{"files": results, "stored": stored, "rejected": len(results) - stored})
+}
+
+// uploadProgress streams Server-Sent Events for an upload sent with an X-Upload-Id header,
+// emitting a progress event whenever the count of body bytes received changes and closing once
+// the upload is done.
+func (h *httpHandler) uploadProgress(c *gin.Context) {
+	userID, _, ok := auth.RequireUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	bucketID, err := uuid.Parse(c.Param("bucketID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid bucket id"})
+		return
+	}
+	uploadID := c.Param("uploadID")
+	if len(uploadID) > MaxUploadIDLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "upload id too long"})
+		return
+	}
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+	deadline := time.Now().Add(progressWait)
+
+	var last *UploadProgress
+	for {
+		progress, ok := h.service.UploadProgress(userID, bucketID, uploadID)
+		switch {
+		case !ok && last == nil && time.Now().After(deadline):
+			c.SSEvent("error", gin.H{"error": "upload not found"})
+			c.Writer.Flush()
+			return
+		case !ok && last != nil:
+			// The entry expired after being reported; nothing more will arrive.
+			return
+		case ok && (last == nil || progress != *last):
+			c.SSEvent("progress", progress)
+			c.Writer.Flush()
+			last = &progress
+			if progress.Done {
+				return
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-c.Request.Context().Done():
+			return
+		}
+	}
+}
+
 func (h *httpHandler) listFiles(c *gin.Context) {
 	userID, _, ok := auth.RequireUser(c)
 	if !ok {
@@ -71,7 +319,42 @@ func (h *httpHandler) listFiles(c *gin.Context) {
 		return
 	}
 
-	list, err := h.service.List(c.Request.Context(), userID, bucketID)
+	var withURLs bool
+	if raw := c.Query("with_urls"); raw != "" {
+		if withURLs, err = strconv.ParseBool(raw); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "with_urls must be a boolean"})
+			return
+		}
+	}
+	var ttl time.Duration
+	if raw := c.Query("ttl"); raw != "" {
+		if ttl, err = time.ParseDuration(raw); err != nil || ttl <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid ttl"})
+			return
+		}
+	}
+
+	if c.Query("format") == "ndjson" {
+		if withURLs {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "with_urls is not supported for ndjson listings"})
+			return
+		}
+		h.streamFiles(c, userID, bucketID)
+		return
+	}
+
+	page, err := pagination.Parse(c.Request.URL.Query())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var opts ListOptions
+	paginated := pagination.Requested(c.Request.URL.Query())
+	if paginated {
+		opts = ListOptions{Limit: page.FetchLimit(), Offset: page.Offset}
+	}
+
+	list, err := h.service.List(c.Request.Context(), userID, bucketID, opts)
 	if err != nil {
 		if err == ErrBucketMismatch {
 			c.JSON(http.StatusNotFound, gin.H{"error": "bucket not found"})
@@ -81,7 +364,116 @@ func (h *httpHandler) listFiles(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"files": list})
+	if paginated {
+		result := pagination.NewPage(list, page)
+		if withURLs {
+			listed, ok := h.attachURLs(c, userID, bucketID, result.Items, ttl)
+			if ok {
+				negotiate.Respond(c, http.StatusOK, pagination.Page[ListedFile]{Items: listed, NextCursor: result.NextCursor})
+			}
+			return
+		}
+		negotiate.Respond(c, http.StatusOK, result)
+		return
+	}
+	if withURLs {
+		if listed, ok := h.attachURLs(c, userID, bucketID, list, ttl); ok {
+			negotiate.Respond(c, http.StatusOK, gin.H{"files": listed})
+		}
+		return
+	}
+	negotiate.Respond(c, http.StatusOK, gin.H{"files": list})
+}
+
+// attachURLs presigns a download URL for each file, writing the error response itself on failure.
+func (h *httpHandler) attachURLs(c *gin.Context, userID, bucketID uuid.UUID, files []Metadata, ttl time.Duration) ([]ListedFile, bool) {
+	listed, err := h.service.AttachDownloadURLs(c.Request.Context(), userID, bucketID, files, ttl)
+	if err != nil {
+		switch err {
+		case ErrPresignUnavailable:
+			c.JSON(http.StatusNotImplemented, gin.H{"error": "presigned urls are not available"})
+		case ErrPresignRateLimited:
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many presign requests"})
+		case ErrBucketMismatch:
+			c.JSON(http.StatusNotFound, gin.H{"error": "bucket not found"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate presigned urls"})
+		}
+		return nil, false
+	}
+	return listed, true
+}
+
+func (h *httpHandler) objectDrift(c *gin.Context) {
+	userID, _, ok := auth.RequireUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	bucketID, err := uuid.Parse(c.Param("bucketID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid bucket id"})
+		return
+	}
+
+	report, err := h.service.ObjectDrift(c.Request.Context(), userID, bucketID)
+	if err != nil {
+		if err == ErrBucketMismatch {
+			c.JSON(http.StatusNotFound, gin.H{"error": "bucket not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to compare objects"})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// ndjsonFlushEvery is how many NDJSON lines are buffered before flushing to the client.
+const ndjsonFlushEvery = 100
+
+// streamFiles writes one metadata object per line. Headers are sent with the first row so
+// lookup errors can still be reported as regular JSON responses.
+func (h *httpHandler) streamFiles(c *gin.Context, userID, bucketID uuid.UUID) {
+	encoder := json.NewEncoder(c.Writer)
+	written := 0
+	start := func() {
+		c.Header("Content-Type", "application/x-ndjson")
+		c.Status(http.StatusOK)
+	}
+
+	err := h.service.StreamList(c.Request.Context(), userID, bucketID, func(meta Metadata) error {
+		if written == 0 {
+			start()
+		}
+		if err := encoder.Encode(meta); err != nil {
+			return err
+		}
+		written++
+		if written%ndjsonFlushEvery == 0 {
+			c.Writer.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		if written > 0 {
+			// The status line is already out, so the failure can only be logged and the stream ended.
+			log.Printf("stream files of bucket %s: %v", bucketID, err)
+			return
+		}
+		if err == ErrBucketMismatch {
+			c.JSON(http.StatusNotFound, gin.H{"error": "bucket not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list files"})
+		return
+	}
+
+	if written == 0 {
+		start()
+	}
+	c.Writer.Flush()
 }
 
 func (h *httpHandler) downloadFile(c *gin.Context) {
@@ -102,25 +494,320 @@ func (h *httpHandler) downloadFile(c *gin.Context) {
 		return
 	}
 
+	// Clients resume an interrupted download by asking for the rest of the object with a
+	// Range header, e.g. "bytes=1048576-" after receiving the first MiB, and may name several
+	// ranges at once.
+	c.Header("Accept-Ranges", "bytes")
+	if c.GetHeader("Range") != "" {
+		h.downloadRange(c, userID, bucketID, fileID)
+		return
+	}
+	h.downloadWhole(c, userID, bucketID, fileID)
+}
+
+func (h *httpHandler) downloadWhole(c *gin.Context, userID, bucketID, fileID uuid.UUID) {
 	meta, reader, err := h.service.Download(c.Request.Context(), userID, bucketID, fileID)
+	if err != nil {
+		writeDownloadError(c, err)
+		return
+	}
+	defer reader.Close()
+
+	streamObject(c, meta, reader)
+}
+
+// maxRanges caps how many ranges one request may name. Longer lists are ignored and the whole
+// object is served, so a client cannot make one request fan out into many object reads.
+const maxRanges = 16
+
+// downloadRange serves the ranges named by the request's Range header with 206, reading only
+// those ranges from the object store: one range is sent as-is and several as a
+// multipart/byteranges body. Headers this endpoint does not honor, and an If-Range that no
+// longer matches the file, fall back to the whole object.
+func (h *httpHandler) downloadRange(c *gin.Context, userID, bucketID, fileID uuid.UUID) {
+	meta, err := h.service.ResolveDownload(c.Request.Context(), userID, bucketID, fileID)
+	if err != nil {
+		writeDownloadError(c, err)
+		return
+	}
+
+	ranges, ranged, satisfiable := parseRanges(c.GetHeader("Range"), meta.SizeBytes)
+	if !satisfiable {
+		c.Header("Content-Range", fmt.Sprintf("bytes */%d", meta.SizeBytes))
+		c.JSON(http.StatusRequestedRangeNotSatisfiable, gin.H{"error": "range not satisfiable"})
+		return
+	}
+	if ifRange := c.GetHeader("If-Range"); ifRange != "" && ifRange != downloadETag(meta) {
+		ranged = false
+	}
+	if !ranged {
+		h.downloadWhole(c, userID, bucketID, fileID)
+		return
+	}
+	if len(ranges) > 1 {
+		h.downloadMultipart(c, userID, meta, ranges)
+		return
+	}
+
+	rng := ranges[0]
+	reader, err := h.service.OpenRange(c.Request.Context(), userID, meta, rng.start, rng.end)
+	if err != nil {
+		writeDownloadError(c, err)
+		return
+	}
+	defer reader.Close()
+
+	c.Header("Content-Type", meta.ContentType)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", meta.OriginalFilename))
+	c.Header("Content-Range", rng.contentRange(meta.SizeBytes))
+	c.Header("Content-Length", strconv.FormatInt(rng.length(), 10))
+	setDownloadETag(c, meta)
+	c.Status(http.StatusPartialContent)
+	if _, err := io.Copy(c.Writer, reader); err != nil {
+		abortStream(meta, err)
+	}
+}
+
+// abortStream logs a body that failed after its status line was sent and aborts the connection,
+// so the client sees a broken transfer rather than a short body that looks complete. The server
+// recovery middleware passes http.ErrAbortHandler through to net/http.
+func abortStream(meta Metadata, err error) {
+	log.Printf("stream file %s: %v", meta.ID, err)
+	panic(http.ErrAbortHandler)
+}
+
+// downloadMultipart writes each range as a part of a multipart/byteranges body, opening the
+// ranges one at a time. A failure to open the first range is reported normally; later failures
+// abort the connection because the status line is already out.
+func (h *httpHandler) downloadMultipart(c *gin.Context, userID uuid.UUID, meta Metadata, ranges []byteRange) {
+	mw := multipart.NewWriter(c.Writer)
+	for i, rng := range ranges {
+		reader, err := h.service.OpenRange(c.Request.Context(), userID, meta, rng.start, rng.end)
+		if err != nil {
+			if i == 0 {
+				writeDownloadError(c, err)
+				return
+			}
+			abortStream(meta, err)
+		}
+		if i == 0 {
+			c.Header("Content-Type", "multipart/byteranges; boundary="+mw.Boundary())
+			c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", meta.OriginalFilename))
+			setDownloadETag(c, meta)
+			c.Status(http.StatusPartialContent)
+		}
+		part, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":  {meta.ContentType},
+			"Content-Range": {rng.contentRange(meta.SizeBytes)},
+		})
+		if err == nil {
+			_, err = io.Copy(part, reader)
+		}
+		reader.Close()
+		if err != nil {
+			abortStream(meta, err)
+		}
+	}
+	if err := mw.Close(); err != nil {
+		abortStream(meta, err)
+	}
+}
+
+// previewFile returns the start of a text, JSON, or CSV file as a string, so a file browser can
+// show it without downloading the whole object.
+func (h *httpHandler) previewFile(c *gin.Context) {
+	userID, _, ok := auth.RequireUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	bucketID, err := uuid.Parse(c.Param("bucketID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid bucket id"})
+		return
+	}
+	fileID, err := uuid.Parse(c.Param("fileID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid file id"})
+		return
+	}
+
+	preview, err := h.service.Preview(c.Request.Context(), userID, bucketID, fileID)
 	if err != nil {
 		switch err {
-		case ErrFileNotFound:
-			c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
+		case ErrNotPreviewable:
+			c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "file type cannot be previewed"})
+		case ErrFileNotFound, ErrObjectOutsideBucket, ErrObjectAccessDenied:
+			writeDownloadError(c, err)
 		default:
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to download file"})
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to preview file"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, preview)
+}
+
+func writeDownloadError(c *gin.Context, err error) {
+	switch err {
+	case ErrFileNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
+	case ErrObjectOutsideBucket:
+		c.JSON(http.StatusForbidden, gin.H{"error": "object does not belong to bucket"})
+	case ErrObjectAccessDenied:
+		c.JSON(http.StatusForbidden, gin.H{"error": "access to object denied"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to download file"})
+	}
+}
+
+// byteRange is an inclusive span of an object's bytes.
+type byteRange struct {
+	start, end int64
+}
+
+func (r byteRange) length() int64 {
+	return r.end - r.start + 1
+}
+
+func (r byteRange) contentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.start, r.end, size)
+}
+
+// parseRanges interprets a Range header against an object of size bytes. A missing or
+// malformed header, or one naming more than maxRanges ranges, yields ranged=false so the whole
+// object is served. Ranges past the end are dropped; satisfiable is false when none remain.
+// Overlapping and adjacent ranges are coalesced, as RFC 7233 allows, so repeating a range
+// cannot multiply the response.
+func parseRanges(header string, size int64) (ranges []byteRange, ranged, satisfiable bool) {
+	spec, ok := strings.CutPrefix(strings.TrimSpace(header), "bytes=")
+	if !ok {
+		return nil, false, true
+	}
+	specs := strings.Split(spec, ",")
+	if len(specs) > maxRanges {
+		return nil, false, true
+	}
+	for _, spec := range specs {
+		rng, valid, fits := parseRangeSpec(strings.TrimSpace(spec), size)
+		if !valid {
+			return nil, false, true
+		}
+		if fits {
+			ranges = append(ranges, rng)
+		}
+	}
+	return coalesceRanges(ranges), true, len(ranges) > 0
+}
+
+// coalesceRanges sorts ranges by start and merges those that overlap or touch.
+func coalesceRanges(ranges []byteRange) []byteRange {
+	if len(ranges) < 2 {
+		return ranges
+	}
+	slices.SortFunc(ranges, func(a, b byteRange) int { return cmp.Compare(a.start, b.start) })
+	merged := ranges[:1]
+	for _, rng := range ranges[1:] {
+		last := &merged[len(merged)-1]
+		if rng.start <= last.end+1 {
+			last.end = max(last.end, rng.end)
+			continue
+		}
+		merged = append(merged, rng)
+	}
+	return merged
+}
+
+// parseRangeSpec reads one "first-last", "first-" or "-suffix" range. valid is false for
+// malformed specs; fits is false when a valid range lies past the end of the object.
+func parseRangeSpec(spec string, size int64) (rng byteRange, valid, fits bool) {
+	first, last, ok := strings.Cut(spec, "-")
+	if !ok {
+		return byteRange{}, false, false
+	}
+
+	if first == "" {
+		suffix, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || suffix < 0 {
+			return byteRange{}, false, false
+		}
+		if suffix == 0 || size == 0 {
+			return byteRange{}, true, false
+		}
+		return byteRange{start: max(size-suffix, 0), end: size - 1}, true, true
+	}
+
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return byteRange{}, false, false
+	}
+	end := size - 1
+	if last != "" {
+		end, err = strconv.ParseInt(last, 10, 64)
+		if err != nil || end < start {
+			return byteRange{}, false, false
+		}
+		end = min(end, size-1)
+	}
+	if start >= size {
+		return byteRange{}, true, false
+	}
+	return byteRange{start: start, end: end}, true, true
+}
+
+// downloadETag is the strong validator clients send back in If-Range: the file's checksum, or
+// empty when it has none, in which case no If-Range matches.
+func downloadETag(meta Metadata) string {
+	if meta.Checksum == "" {
+		return ""
+	}
+	return strconv.Quote(meta.Checksum)
+}
+
+func setDownloadETag(c *gin.Context, meta Metadata) {
+	if etag := downloadETag(meta); etag != "" {
+		c.Header("ETag", etag)
+	}
+}
+
+func (h *httpHandler) publicDownload(c *gin.Context) {
+	bucketID, err := uuid.Parse(c.Param("bucketID"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
+		return
+	}
+	fileID, err := uuid.Parse(c.Param("fileID"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
+		return
+	}
+
+	meta, reader, err := h.service.PublicDownload(c.Request.Context(), bucketID, fileID)
+	if err != nil {
+		if err == ErrFileNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
+			return
 		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to download file"})
 		return
 	}
 	defer reader.Close()
 
+	streamObject(c, meta, reader)
+}
+
+// streamObject writes the whole object with 200. The status line goes out with the first body
+// bytes, so a copy failure aborts the connection instead of answering with an error status.
+func streamObject(c *gin.Context, meta Metadata, reader io.Reader) {
 	c.Header("Content-Type", meta.ContentType)
 	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", meta.OriginalFilename))
 	c.Header("Content-Length", fmt.Sprintf("%d", meta.SizeBytes))
+	setDownloadETag(c, meta)
+	c.Status(http.StatusOK)
 
 	if _, err := io.Copy(c.Writer, reader); err != nil {
-		c.Status(http.StatusInternalServerError)
-		return
+		abortStream(meta, err)
 	}
 }
 
@@ -148,6 +835,12 @@ func (h *httpHandler) deleteFile(c *gin.Context) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
 		case ErrBucketMismatch:
 			c.JSON(http.StatusNotFound, gin.H{"error": "bucket not found"})
+		case ErrObjectOutsideBucket:
+			c.JSON(http.StatusForbidden, gin.H{"error": "object does not belong to bucket"})
+		case ErrObjectAccessDenied:
+			c.JSON(http.StatusForbidden, gin.H{"error": "access to object denied"})
+		case ErrFileRetained:
+			c.JSON(http.StatusForbidden, gin.H{"error": "file is immutable until its retention period ends"})
 		default:
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete file"})
 		}
@@ -156,3 +849,231 @@ func (h *httpHandler) deleteFile(c *gin.Context) {
 
 	c.Status(http.StatusNoContent)
 }
+
+func (h *httpHandler) findByChecksum(c *gin.Context) {
+	userID, _, ok := auth.RequireUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	bucketID, err := uuid.Parse(c.Param("bucketID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid bucket id"})
+		return
+	}
+
+	meta, err := h.service.FindByChecksum(c.Request.Context(), userID, bucketID, c.Param("sha256"))
+	if err != nil {
+		switch err {
+		case ErrInvalidChecksum:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "checksum must be 64 hex characters"})
+		case ErrFileNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
+		case ErrObjectOutsideBucket:
+			c.JSON(http.StatusForbidden, gin.H{"error": "object does not belong to bucket"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to look up file"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, meta)
+}
+
+func (h *httpHandler) rehashFile(c *gin.Context) {
+	userID, _, ok := auth.RequireUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	bucketID, err := uuid.Parse(c.Param("bucketID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid bucket id"})
+		return
+	}
+	fileID, err := uuid.Parse(c.Param("fileID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid file id"})
+		return
+	}
+
+	meta, err := h.service.Rehash(c.Request.Context(), userID, bucketID, fileID)
+	if err != nil {
+		switch err {
+		case ErrFileNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
+		case ErrObjectOutsideBucket:
+			c.JSON(http.StatusForbidden, gin.H{"error": "object does not belong to bucket"})
+		case ErrObjectAccessDenied:
+			c.JSON(http.StatusForbidden, gin.H{"error": "access to object denied"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to rehash file"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"id": meta.ID, "checksum": meta.Checksum})
+}
+
+func (h *httpHandler) commitReplacement(c *gin.Context) {
+	userID, _, ok := auth.RequireUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	bucketID, err := uuid.Parse(c.Param("bucketID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid bucket id"})
+		return
+	}
+	fileID, err := uuid.Parse(c.Param("fileID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid file id"})
+		return
+	}
+
+	meta, err := h.service.CommitReplacement(c.Request.Context(), userID, bucketID, fileID)
+	if err != nil {
+		var limitErr *SizeLimitError
+		if errors.As(err, &limitErr) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":               "file too large; it was deleted",
+				"max_file_size_bytes": limitErr.Limit,
+			})
+			return
+		}
+		switch err {
+		case ErrFileNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
+		case ErrObjectOutsideBucket:
+			c.JSON(http.StatusForbidden, gin.H{"error": "object does not belong to bucket"})
+		case ErrObjectAccessDenied:
+			c.JSON(http.StatusForbidden, gin.H{"error": "access to object denied"})
+		case ErrBucketImmutable:
+			c.JSON(http.StatusForbidden, gin.H{"error": "files in an immutable bucket cannot be replaced"})
+		case ErrObjectShared:
+			c.JSON(http.StatusConflict, gin.H{"error": "file shares its content with other files and cannot be replaced in place"})
+		case ErrQuotaExceeded:
+			c.JSON(http.StatusInsufficientStorage, gin.H{"error": "account storage quota exceeded; file was deleted"})
+		case ErrBucketMismatch:
+			c.JSON(http.StatusNotFound, gin.H{"error": "bucket not found"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to commit file"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, meta)
+}
+
+type moveBatchRequest struct {
+	FileIDs        []uuid.UUID `json:"file_ids" binding:"required"`
+	TargetBucketID uuid.UUID   `json:"target_bucket_id" binding:"required"`
+}
+
+func (h *httpHandler) moveBatch(c *gin.Context) {
+	userID, _, ok := auth.RequireUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	bucketID, err := uuid.Parse(c.Param("bucketID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid bucket id"})
+		return
+	}
+
+	var req moveBatchRequest
+	if !bind.JSON(c, &req) {
+		return
+	}
+	if len(req.FileIDs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file_ids and target_bucket_id are required"})
+		return
+	}
+
+	results, err := h.service.MoveBatch(c.Request.Context(), userID, bucketID, req.TargetBucketID, req.FileIDs)
+	if err != nil {
+		switch err {
+		case ErrBucketMismatch:
+			c.JSON(http.StatusNotFound, gin.H{"error": "bucket not found"})
+		case ErrSameBucket:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "target bucket must differ from source bucket"})
+		case ErrMoveBatchTooLarge:
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("at most %d files may be moved per batch", MaxMoveBatchSize)})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to move files"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"files": results})
+}
+
+type archiveRequest struct {
+	FileIDs []uuid.UUID `json:"file_ids" binding:"required"`
+}
+
+// archiveFiles streams the selected files as a zip. IDs that do not name a file in the bucket are
+// skipped and listed in the X-Missing-File-Ids header.
+func (h *httpHandler) archiveFiles(c *gin.Context) {
+	userID, _, ok := auth.RequireUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	bucketID, err := uuid.Parse(c.Param("bucketID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid bucket id"})
+		return
+	}
+
+	var req archiveRequest
+	if !bind.JSON(c, &req) {
+		return
+	}
+	if len(req.FileIDs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file_ids is required"})
+		return
+	}
+
+	files, missing, err := h.service.SelectForArchive(c.Request.Context(), userID, bucketID, req.FileIDs)
+	if err != nil {
+		switch err {
+		case ErrBucketMismatch:
+			c.JSON(http.StatusNotFound, gin.H{"error": "bucket not found"})
+		case ErrArchiveTooLarge:
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("at most %d files may be archived at once", MaxArchiveFiles)})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to archive files"})
+		}
+		return
+	}
+	if len(files) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no files found"})
+		return
+	}
+
+	if len(missing) > 0 {
+		ids := make([]string, len(missing))
+		for i, id := range missing {
+			ids[i] = id.String()
+		}
+		c.Header("X-Missing-File-Ids", strings.Join(ids, ","))
+	}
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fmt.Sprintf("files-%s.zip", time.Now().UTC().Format("20060102-150405"))))
+	c.Status(http.StatusOK)
+
+	// The status line is already out, so a failure aborts the connection rather than leave the
+	// client a truncated zip that looks complete.
+	if err := h.service.WriteArchive(c.Request.Context(), userID, c.Writer, files); err != nil {
+		log.Printf("stream archive of bucket %s: %v", bucketID, err)
+		panic(http.ErrAbortHandler)
+	}
+}
@@ -0,0 +1,1036 @@
+package file
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/abduss/godrive/internal/auth"
+	"github.com/abduss/godrive/internal/bucket"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+)
+
+func TestPublicDownloadServesOnlyPublicBuckets(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	repo := newFakeRepo()
+	objectStore := &fakeObjectStore{}
+	service := NewService(repo, &fakeBucketStore{}, objectStore, "godrive")
+
+	router := gin.New()
+	RegisterPublicRoutes(router.Group("/v1"), service)
+
+	publicBucket, privateBucket := uuid.New(), uuid.New()
+	repo.publicBuckets[publicBucket] = true
+	publicFile, privateFile := uuid.New(), uuid.New()
+	repo.records[publicFile] = Metadata{ID: publicFile, BucketID: publicBucket, ObjectName: fmt.Sprintf("%s/%s", publicBucket, publicFile), OriginalFilename: "hello.txt", ContentType: "text/plain", SizeBytes: 5}
+	repo.records[privateFile] = Metadata{ID: privateFile, BucketID: privateBucket, ObjectName: fmt.Sprintf("%s/%s", privateBucket, privateFile), OriginalFilename: "secret.txt", ContentType: "text/plain", SizeBytes: 6}
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, fmt.Sprintf("/v1/public/buckets/%s/files/%s/download", privateBucket, privateFile), nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for private bucket, got %d", rec.Code)
+	}
+	if objectStore.getCount != 0 {
+		t.Fatalf("expected no object read for private bucket")
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, fmt.Sprintf("/v1/public/buckets/%s/files/%s/download", publicBucket, privateFile), nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for a private file addressed through a public bucket, got %d", rec.Code)
+	}
+
+	objectStore.reader = bytes.NewReader([]byte("hello"))
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, fmt.Sprintf("/v1/public/buckets/%s/files/%s/download", publicBucket, publicFile), nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 for public bucket, got %d", rec.Code)
+	}
+	if rec.Body.String() != "hello" {
+		t.Fatalf("unexpected body %q", rec.Body.String())
+	}
+}
+
+func TestDownloadAbortsWhenTheObjectFailsMidStream(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	repo := newFakeRepo()
+	buckets := &fakeBucketStore{buckets: map[uuid.UUID]bucket.Bucket{}}
+	objectStore := &fakeObjectStore{}
+	service := NewService(repo, buckets, objectStore, "godrive")
+
+	ownerID, bucketID, fileID := uuid.New(), uuid.New(), uuid.New()
+	buckets.buckets[bucketID] = bucket.Bucket{ID: bucketID, OwnerID: ownerID, Name: "photos"}
+	repo.publicBuckets[bucketID] = true
+	repo.records[fileID] = Metadata{ID: fileID, BucketID: bucketID, ObjectName: fmt.Sprintf("%s/%s", bucketID, fileID), OriginalFilename: "hello.txt", ContentType: "text/plain", SizeBytes: 11}
+
+	router := gin.New()
+	RegisterPublicRoutes(router.Group("/v1"), service)
+	RegisterRoutes(router.Group("/v1", func(c *gin.Context) {
+		auth.SetCurrentUser(c, auth.ContextUser{ID: ownerID.String()})
+	}), service)
+
+	for _, path := range []string{
+		fmt.Sprintf("/v1/buckets/%s/files/%s/download", bucketID, fileID),
+		fmt.Sprintf("/v1/public/buckets/%s/files/%s/download", bucketID, fileID),
+	} {
+		objectStore.reader = io.MultiReader(strings.NewReader("hello"), iotest.ErrReader(errors.New("connection reset")))
+		rec := httptest.NewRecorder()
+		if !serveAborted(router, rec, httptest.NewRequest(http.MethodGet, path, nil)) {
+			t.Fatalf("%s: expected the connection aborted, got %d: %q", path, rec.Code, rec.Body.String())
+		}
+		if rec.Code != http.StatusOK || rec.Body.String() != "hello" {
+			t.Fatalf("%s: expected the truncated 200 body before the abort, got %d: %q", path, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+// serveAborted serves req and reports whether the handler aborted the connection with
+// http.ErrAbortHandler, as net/http would see it.
+func serveAborted(router http.Handler, rec *httptest.ResponseRecorder, req *http.Request) (aborted bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			if r != http.ErrAbortHandler {
+				panic(r)
+			}
+			aborted = true
+		}
+	}()
+	router.ServeHTTP(rec, req)
+	return false
+}
+
+func TestListFilesStreamsNDJSON(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	repo := newFakeRepo()
+	buckets := &fakeBucketStore{buckets: map[uuid.UUID]bucket.Bucket{}}
+	service := NewService(repo, buckets, &fakeObjectStore{}, "godrive")
+
+	ownerID, bucketID := uuid.New(), uuid.New()
+	buckets.buckets[bucketID] = bucket.Bucket{ID: bucketID, OwnerID: ownerID, Name: "logs"}
+	for i := 0; i < 3; i++ {
+		id := uuid.New()
+		repo.records[id] = Metadata{ID: id, BucketID: bucketID, ObjectName: fmt.Sprintf("%s/%s", bucketID, id), OriginalFilename: fmt.Sprintf("part-%d.log", i)}
+	}
+
+	router := gin.New()
+	group := router.Group("/v1", func(c *gin.Context) {
+		auth.SetCurrentUser(c, auth.ContextUser{ID: ownerID.String()})
+	})
+	RegisterRoutes(group, service)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, fmt.Sprintf("/v1/buckets/%s/files?format=ndjson", bucketID), nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+
+	seen := make(map[uuid.UUID]bool)
+	scanner := bufio.NewScanner(rec.Body)
+	for scanner.Scan() {
+		var meta Metadata
+		if err := json.Unmarshal(scanner.Bytes(), &meta); err != nil {
+			t.Fatalf("line %q is not a JSON object: %v", scanner.Text(), err)
+		}
+		if _, ok := repo.records[meta.ID]; !ok {
+			t.Fatalf("unexpected file %s in stream", meta.ID)
+		}
+		seen[meta.ID] = true
+	}
+	if len(seen) != 3 {
+		t.Fatalf("expected 3 streamed files, got %d", len(seen))
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, fmt.Sprintf("/v1/buckets/%s/files?format=ndjson", uuid.New()), nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for unknown bucket, got %d", rec.Code)
+	}
+}
+
+func TestListFilesPaginates(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	repo := newFakeRepo()
+	buckets := &fakeBucketStore{buckets: map[uuid.UUID]bucket.Bucket{}}
+	service := NewService(repo, buckets, &fakeObjectStore{}, "godrive")
+
+	ownerID, bucketID := uuid.New(), uuid.New()
+	buckets.buckets[bucketID] = bucket.Bucket{ID: bucketID, OwnerID: ownerID, Name: "photos"}
+	for i := 0; i < 5; i++ {
+		id := uuid.New()
+		repo.records[id] = Metadata{ID: id, BucketID: bucketID, ObjectName: fmt.Sprintf("%s/%s", bucketID, id)}
+	}
+
+	router := gin.New()
+	RegisterRoutes(router.Group("/v1", func(c *gin.Context) {
+		auth.SetCurrentUser(c, auth.ContextUser{ID: ownerID.String()})
+	}), service)
+
+	seen := make(map[uuid.UUID]bool)
+	path := fmt.Sprintf("/v1/buckets/%s/files?limit=2", bucketID)
+	for pages := 0; ; pages++ {
+		if pages > 3 {
+			t.Fatalf("pagination did not terminate")
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var page struct {
+			Items      []Metadata `json:"items"`
+			NextCursor string     `json:"next_cursor"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+			t.Fatalf("decode page: %v", err)
+		}
+		if len(page.Items) > 2 {
+			t.Fatalf("expected at most 2 items per page, got %d", len(page.Items))
+		}
+		for _, meta := range page.Items {
+			seen[meta.ID] = true
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		path = fmt.Sprintf("/v1/buckets/%s/files?limit=2&cursor=%s", bucketID, page.NextCursor)
+	}
+	if len(seen) != 5 {
+		t.Fatalf("expected all 5 files across pages, got %d", len(seen))
+	}
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, fmt.Sprintf("/v1/buckets/%s/files?cursor=bogus", bucketID), nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for invalid cursor, got %d", rec.Code)
+	}
+}
+
+func TestUploadPersistsOriginalCreatedAt(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	repo := newFakeRepo()
+	buckets := &fakeBucketStore{buckets: map[uuid.UUID]bucket.Bucket{}}
+	service := NewService(repo, buckets, &fakeObjectStore{}, "godrive")
+
+	ownerID, bucketID := uuid.New(), uuid.New()
+	buckets.buckets[bucketID] = bucket.Bucket{ID: bucketID, OwnerID: ownerID, Name: "archive"}
+
+	router := gin.New()
+	group := router.Group("/v1", func(c *gin.Context) {
+		auth.SetCurrentUser(c, auth.ContextUser{ID: ownerID.String()})
+	})
+	RegisterRoutes(group, service)
+
+	upload := func(createdAt string) *httptest.ResponseRecorder {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		part, err := writer.CreateFormFile("file", "scan.tiff")
+		if err != nil {
+			t.Fatalf("create form file: %v", err)
+		}
+		part.Write([]byte("image bytes"))
+		writer.WriteField("original_created_at", createdAt)
+		writer.Close()
+
+		req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/v1/buckets/%s/files", bucketID), body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := upload("2009-02-13T23:31:30+02:00")
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp Metadata
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	want := time.Date(2009, 2, 13, 21, 31, 30, 0, time.UTC)
+	if resp.OriginalCreatedAt == nil || !resp.OriginalCreatedAt.Equal(want) {
+		t.Fatalf("expected original_created_at %s echoed, got %v", want, resp.OriginalCreatedAt)
+	}
+	if stored := repo.records[resp.ID].OriginalCreatedAt; stored == nil || !stored.Equal(want) {
+		t.Fatalf("expected original_created_at persisted, got %v", stored)
+	}
+	if resp.CreatedAt.Equal(want) {
+		t.Fatalf("expected server-managed created_at to stay independent")
+	}
+
+	if rec := upload(time.Now().Add(time.Hour).Format(time.RFC3339)); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a future timestamp, got %d", rec.Code)
+	}
+	if rec := upload("yesterday"); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a malformed timestamp, got %d", rec.Code)
+	}
+}
+
+func TestArchiveSelectedFilesProducesReadableZip(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	repo := newFakeRepo()
+	buckets := &fakeBucketStore{buckets: map[uuid.UUID]bucket.Bucket{}}
+	objectStore := &namedObjectStore{contents: map[string]string{}}
+	service := NewService(repo, buckets, objectStore, "godrive")
+
+	ownerID, bucketID := uuid.New(), uuid.New()
+	buckets.buckets[bucketID] = bucket.Bucket{ID: bucketID, OwnerID: ownerID, Name: "reports"}
+	first, second := uuid.New(), uuid.New()
+	for id, body := range map[uuid.UUID]string{first: "first quarter", second: "second quarter"} {
+		name := fmt.Sprintf("%s/%s", bucketID, id)
+		repo.records[id] = Metadata{ID: id, BucketID: bucketID, ObjectName: name, OriginalFilename: "report.txt", SizeBytes: int64(len(body))}
+		objectStore.contents[name] = body
+	}
+	missing := uuid.New()
+
+	router := gin.New()
+	RegisterRoutes(router.Group("/v1", func(c *gin.Context) {
+		auth.SetCurrentUser(c, auth.ContextUser{ID: ownerID.String()})
+	}), service)
+
+	body := fmt.Sprintf(`{"file_ids":[%q,%q,%q]}`, first, second, missing)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, fmt.Sprintf("/v1/buckets/%s/files/archive", bucketID), bytes.NewBufferString(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if got := rec.Header().Get("X-Missing-File-Ids"); got != missing.String() {
+		t.Fatalf("expected missing id reported, got %q", got)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+	if err != nil {
+		t.Fatalf("response is not a zip: %v", err)
+	}
+	want := map[string]string{"report.txt": "first quarter", "report (1).txt": "second quarter"}
+	if len(archive.File) != len(want) {
+		t.Fatalf("expected %d entries, got %d", len(want), len(archive.File))
+	}
+	for _, entry := range archive.File {
+		rc, err := entry.Open()
+		if err != nil {
+			t.Fatalf("open entry %s: %v", entry.Name, err)
+		}
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		if string(data) != want[entry.Name] {
+			t.Fatalf("entry %q: expected %q, got %q", entry.Name, want[entry.Name], data)
+		}
+	}
+}
+
+func TestArchiveAbortsWhenAnObjectCannotBeRead(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	repo := newFakeRepo()
+	buckets := &fakeBucketStore{buckets: map[uuid.UUID]bucket.Bucket{}}
+	objectStore := &namedObjectStore{contents: map[string]string{}}
+	service := NewService(repo, buckets, objectStore, "godrive")
+
+	ownerID, bucketID := uuid.New(), uuid.New()
+	buckets.buckets[bucketID] = bucket.Bucket{ID: bucketID, OwnerID: ownerID, Name: "reports"}
+	stored, lost := uuid.New(), uuid.New()
+	for _, id := range []uuid.UUID{stored, lost} {
+		repo.records[id] = Metadata{ID: id, BucketID: bucketID, ObjectName: fmt.Sprintf("%s/%s", bucketID, id), OriginalFilename: "report.txt", SizeBytes: 13}
+	}
+	objectStore.contents[repo.records[stored].ObjectName] = "first quarter"
+
+	router := gin.New()
+	RegisterRoutes(router.Group("/v1", func(c *gin.Context) {
+		auth.SetCurrentUser(c, auth.ContextUser{ID: ownerID.String()})
+	}), service)
+
+	body := fmt.Sprintf(`{"file_ids":[%q,%q]}`, stored, lost)
+	rec := httptest.NewRecorder()
+	if !serveAborted(router, rec, httptest.NewRequest(http.MethodPost, fmt.Sprintf("/v1/buckets/%s/files/archive", bucketID), bytes.NewBufferString(body))) {
+		t.Fatalf("expected the connection aborted, got %d with a %d-byte body", rec.Code, rec.Body.Len())
+	}
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected the archive status line sent before the abort, got %d", rec.Code)
+	}
+}
+
+// namedObjectStore serves object contents by name, honoring "bytes=a-b" ranges.
+type namedObjectStore struct {
+	fakeObjectStore
+	contents map[string]string
+	ranges   []string
+}
+
+func (n *namedObjectStore) GetObject(ctx context.Context, bucketName, objectName string, opts minio.GetObjectOptions) (io.ReadCloser, error) {
+	body, ok := n.contents[objectName]
+	if !ok {
+		return nil, fmt.Errorf("object %s not found", objectName)
+	}
+	if rng := opts.Header().Get("Range"); rng != "" {
+		n.ranges = append(n.ranges, rng)
+		var start, end int
+		if _, err := fmt.Sscanf(rng, "bytes=%d-%d", &start, &end); err != nil {
+			return nil, err
+		}
+		body = body[start : end+1]
+	}
+	return io.NopCloser(bytes.NewBufferString(body)), nil
+}
+
+// erroringObjectStore fails every read with err.
+type erroringObjectStore struct {
+	fakeObjectStore
+	err error
+}
+
+func (e *erroringObjectStore) GetObject(ctx context.Context, bucketName, objectName string, opts minio.GetObjectOptions) (io.ReadCloser, error) {
+	return nil, e.err
+}
+
+func TestDownloadTranslatesObjectStoreErrors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cases := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{name: "missing object", err: minio.ErrorResponse{Code: "NoSuchKey", StatusCode: http.StatusNotFound}, want: http.StatusNotFound},
+		{name: "access denied", err: minio.ErrorResponse{Code: "AccessDenied", StatusCode: http.StatusForbidden}, want: http.StatusForbidden},
+		{name: "server failure", err: errors.New("connection reset"), want: http.StatusInternalServerError},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := newFakeRepo()
+			buckets := &fakeBucketStore{buckets: map[uuid.UUID]bucket.Bucket{}}
+			ownerID, bucketID, fileID := uuid.New(), uuid.New(), uuid.New()
+			buckets.buckets[bucketID] = bucket.Bucket{ID: bucketID, OwnerID: ownerID, Name: "photos"}
+			repo.records[fileID] = Metadata{ID: fileID, BucketID: bucketID, ObjectName: fmt.Sprintf("%s/%s", bucketID, fileID), SizeBytes: 4}
+			service := NewService(repo, buckets, &erroringObjectStore{err: tc.err}, "godrive")
+
+			router := gin.New()
+			RegisterRoutes(router.Group("/v1", func(c *gin.Context) {
+				auth.SetCurrentUser(c, auth.ContextUser{ID: ownerID.String()})
+			}), service)
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, fmt.Sprintf("/v1/buckets/%s/files/%s/download", bucketID, fileID), nil))
+			if rec.Code != tc.want {
+				t.Fatalf("expected %d, got %d: %s", tc.want, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestDownloadResumesWithConsecutiveRanges(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	repo := newFakeRepo()
+	buckets := &fakeBucketStore{buckets: map[uuid.UUID]bucket.Bucket{}}
+	ownerID, bucketID, fileID := uuid.New(), uuid.New(), uuid.New()
+	buckets.buckets[bucketID] = bucket.Bucket{ID: bucketID, OwnerID: ownerID, Name: "photos"}
+	objectName := fmt.Sprintf("%s/%s", bucketID, fileID)
+	content := "the quick brown fox jumps over the lazy dog"
+	repo.records[fileID] = Metadata{ID: fileID, BucketID: bucketID, ObjectName: objectName, OriginalFilename: "fox.txt", ContentType: "text/plain", SizeBytes: int64(len(content))}
+	store := &namedObjectStore{contents: map[string]string{objectName: content}}
+	service := NewService(repo, buckets, store, "godrive")
+
+	router := gin.New()
+	RegisterRoutes(router.Group("/v1", func(c *gin.Context) {
+		auth.SetCurrentUser(c, auth.ContextUser{ID: ownerID.String()})
+	}), service)
+	download := func(rng string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/v1/buckets/%s/files/%s/download", bucketID, fileID), nil)
+		req.Header.Set("Range", rng)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	first := download("bytes=0-9")
+	if first.Code != http.StatusPartialContent {
+		t.Fatalf("expected 206 for the first range, got %d: %s", first.Code, first.Body.String())
+	}
+	if first.Header().Get("Accept-Ranges") != "bytes" {
+		t.Fatalf("expected Accept-Ranges: bytes, got %q", first.Header().Get("Accept-Ranges"))
+	}
+	if got := first.Header().Get("Content-Range"); got != fmt.Sprintf("bytes 0-9/%d", len(content)) {
+		t.Fatalf("unexpected Content-Range %q", got)
+	}
+
+	rest := download(fmt.Sprintf("bytes=%d-", first.Body.Len()))
+	if rest.Code != http.StatusPartialContent {
+		t.Fatalf("expected 206 for the resumed range, got %d", rest.Code)
+	}
+	if got := first.Body.String() + rest.Body.String(); got != content {
+		t.Fatalf("expected the ranges to concatenate to %q, got %q", content, got)
+	}
+	if len(store.ranges) != 2 || store.ranges[1] != fmt.Sprintf("bytes=10-%d", len(content)-1) {
+		t.Fatalf("expected both ranges to reach the object store, got %v", store.ranges)
+	}
+
+	if rec := download(fmt.Sprintf("bytes=%d-", len(content))); rec.Code != http.StatusRequestedRangeNotSatisfiable {
+		t.Fatalf("expected 416 past the end, got %d", rec.Code)
+	} else if got := rec.Header().Get("Content-Range"); got != fmt.Sprintf("bytes */%d", len(content)) {
+		t.Fatalf("unexpected Content-Range on 416: %q", got)
+	}
+}
+
+func TestPreviewReturnsTheStartOfTextFiles(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	repo := newFakeRepo()
+	buckets := &fakeBucketStore{buckets: map[uuid.UUID]bucket.Bucket{}}
+	ownerID, bucketID := uuid.New(), uuid.New()
+	buckets.buckets[bucketID] = bucket.Bucket{ID: bucketID, OwnerID: ownerID, Name: "docs"}
+	store := &namedObjectStore{contents: map[string]string{}}
+	addFile := func(filename, contentType, content string) uuid.UUID {
+		fileID := uuid.New()
+		objectName := fmt.Sprintf("%s/%s", bucketID, fileID)
+		store.contents[objectName] = content
+		repo.records[fileID] = Metadata{ID: fileID, BucketID: bucketID, ObjectName: objectName, OriginalFilename: filename, ContentType: contentType, SizeBytes: int64(len(content))}
+		return fileID
+	}
+	smallID := addFile("notes.txt", "text/plain; charset=utf-8", "hello, preview")
+	large := strings.Repeat("id,name\n", maxPreviewBytes/8) + strings.Repeat("1,extra\n", 100)
+	largeID := addFile("rows.csv", "text/csv", large)
+	imageID := addFile("photo.png", "image/png", "\x89PNG")
+	service := NewService(repo, buckets, store, "godrive")
+
+	router := gin.New()
+	RegisterRoutes(router.Group("/v1", func(c *gin.Context) {
+		auth.SetCurrentUser(c, auth.ContextUser{ID: ownerID.String()})
+	}), service)
+	preview := func(fileID uuid.UUID) (*httptest.ResponseRecorder, Preview) {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, fmt.Sprintf("/v1/buckets/%s/files/%s/preview", bucketID, fileID), nil))
+		var body Preview
+		if rec.Code == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatalf("decode preview: %v", err)
+			}
+		}
+		return rec, body
+	}
+
+	rec, small := preview(smallID)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 for a small text file, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if small.Content != "hello, preview" || small.Truncated {
+		t.Fatalf("expected the whole file untruncated, got %+v", small)
+	}
+
+	rec, truncated := preview(largeID)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 for a large CSV file, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if !truncated.Truncated || truncated.Content != large[:maxPreviewBytes] || truncated.SizeBytes != int64(len(large)) {
+		t.Fatalf("expected the first %d bytes marked truncated, got %d bytes, truncated=%v", maxPreviewBytes, len(truncated.Content), truncated.Truncated)
+	}
+	if want := fmt.Sprintf("bytes=0-%d", maxPreviewBytes-1); len(store.ranges) != 2 || store.ranges[1] != want {
+		t.Fatalf("expected only the prefix to be requested with %s, got %v", want, store.ranges)
+	}
+
+	if rec, _ := preview(imageID); rec.Code != http.StatusUnsupportedMediaType {
+		t.Fatalf("expected 415 for an image, got %d", rec.Code)
+	}
+	if len(store.ranges) != 2 {
+		t.Fatalf("expected no object read for an unpreviewable file, got %v", store.ranges)
+	}
+}
+
+func TestDownloadServesMultipleRangesAsMultipart(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	repo := newFakeRepo()
+	buckets := &fakeBucketStore{buckets: map[uuid.UUID]bucket.Bucket{}}
+	ownerID, bucketID, fileID := uuid.New(), uuid.New(), uuid.New()
+	buckets.buckets[bucketID] = bucket.Bucket{ID: bucketID, OwnerID: ownerID, Name: "photos"}
+	objectName := fmt.Sprintf("%s/%s", bucketID, fileID)
+	content := "the quick brown fox jumps over the lazy dog"
+	repo.records[fileID] = Metadata{ID: fileID, BucketID: bucketID, ObjectName: objectName, OriginalFilename: "fox.txt", ContentType: "text/plain", SizeBytes: int64(len(content)), Checksum: "abc123"}
+	store := &namedObjectStore{contents: map[string]string{objectName: content}}
+	service := NewService(repo, buckets, store, "godrive")
+
+	router := gin.New()
+	RegisterRoutes(router.Group("/v1", func(c *gin.Context) {
+		auth.SetCurrentUser(c, auth.ContextUser{ID: ownerID.String()})
+	}), service)
+	download := func(headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/v1/buckets/%s/files/%s/download", bucketID, fileID), nil)
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := download(map[string]string{"Range": "bytes=4-8, 16-18,-3, 500-"})
+	if rec.Code != http.StatusPartialContent {
+		t.Fatalf("expected 206, got %d: %s", rec.Code, rec.Body.String())
+	}
+	mediaType, params, err := mime.ParseMediaType(rec.Header().Get("Content-Type"))
+	if err != nil || mediaType != "multipart/byteranges" {
+		t.Fatalf("expected multipart/byteranges, got %q (%v)", rec.Header().Get("Content-Type"), err)
+	}
+
+	want := []struct{ contentRange, body string }{
+		{fmt.Sprintf("bytes 4-8/%d", len(content)), "quick"},
+		{fmt.Sprintf("bytes 16-18/%d", len(content)), "fox"},
+		{fmt.Sprintf("bytes %d-%d/%d", len(content)-3, len(content)-1, len(content)), "dog"},
+	}
+	reader := multipart.NewReader(rec.Body, params["boundary"])
+	for i, w := range want {
+		part, err := reader.NextPart()
+		if err != nil {
+			t.Fatalf("part %d: %v", i, err)
+		}
+		if got := part.Header.Get("Content-Range"); got != w.contentRange {
+			t.Fatalf("part %d: expected Content-Range %q, got %q", i, w.contentRange, got)
+		}
+		if got := part.Header.Get("Content-Type"); got != "text/plain" {
+			t.Fatalf("part %d: expected the file's content type, got %q", i, got)
+		}
+		body, _ := io.ReadAll(part)
+		if string(body) != w.body {
+			t.Fatalf("part %d: expected %q, got %q", i, w.body, body)
+		}
+	}
+	if _, err := reader.NextPart(); err != io.EOF {
+		t.Fatalf("expected exactly %d parts, got another (%v)", len(want), err)
+	}
+
+	repeated := download(map[string]string{"Range": "bytes=0-,0-,10-20,0-"})
+	if repeated.Code != http.StatusPartialContent || repeated.Body.String() != content {
+		t.Fatalf("expected repeated ranges to coalesce into one copy of the file, got %d with %d bytes", repeated.Code, repeated.Body.Len())
+	}
+	if got := repeated.Header().Get("Content-Range"); got != fmt.Sprintf("bytes 0-%d/%d", len(content)-1, len(content)) {
+		t.Fatalf("expected a single coalesced Content-Range, got %q", got)
+	}
+	if got := coalesceRanges([]byteRange{{16, 18}, {4, 8}, {9, 10}, {6, 7}}); !reflect.DeepEqual(got, []byteRange{{4, 10}, {16, 18}}) {
+		t.Fatalf("expected overlapping and adjacent ranges merged in order, got %v", got)
+	}
+
+	tooMany := strings.TrimSuffix(strings.Repeat("0-0,", maxRanges+1), ",")
+	if rec := download(map[string]string{"Range": "bytes=" + tooMany}); rec.Code != http.StatusOK || rec.Body.String() != content {
+		t.Fatalf("expected more than %d ranges to serve the whole file, got %d", maxRanges, rec.Code)
+	}
+	if rec := download(map[string]string{"Range": "bytes=0-2,4-8", "If-Range": `"stale"`}); rec.Code != http.StatusOK || rec.Body.String() != content {
+		t.Fatalf("expected a stale If-Range to serve the whole file, got %d", rec.Code)
+	}
+	if rec := download(map[string]string{"Range": "bytes=0-2", "If-Range": `"abc123"`}); rec.Code != http.StatusPartialContent || rec.Body.String() != "the" {
+		t.Fatalf("expected a matching If-Range to honor the range, got %d %q", rec.Code, rec.Body.String())
+	}
+}
+
+func TestFindByChecksumReportsHitAndMiss(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	repo := newFakeRepo()
+	buckets := &fakeBucketStore{buckets: map[uuid.UUID]bucket.Bucket{}}
+	service := NewService(repo, buckets, &fakeObjectStore{}, "godrive")
+
+	ownerID, bucketID := uuid.New(), uuid.New()
+	buckets.buckets[bucketID] = bucket.Bucket{ID: bucketID, OwnerID: ownerID, Name: "photos"}
+	fileID := uuid.New()
+	checksum := "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+	repo.records[fileID] = Metadata{ID: fileID, BucketID: bucketID, ObjectName: fmt.Sprintf("%s/%s", bucketID, fileID), Checksum: checksum}
+
+	router := gin.New()
+	RegisterRoutes(router.Group("/v1", func(c *gin.Context) {
+		auth.SetCurrentUser(c, auth.ContextUser{ID: ownerID.String()})
+	}), service)
+	lookup := func(sum string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, fmt.Sprintf("/v1/buckets/%s/files/by-checksum/%s", bucketID, sum), nil))
+		return rec
+	}
+
+	rec := lookup(strings.ToUpper(checksum))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 for a stored checksum, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var meta Metadata
+	if err := json.Unmarshal(rec.Body.Bytes(), &meta); err != nil || meta.ID != fileID {
+		t.Fatalf("expected file %s, got %+v (%v)", fileID, meta, err)
+	}
+
+	if rec := lookup(strings.Repeat("0", 64)); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for an unknown checksum, got %d", rec.Code)
+	}
+	if rec := lookup("abc123"); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a malformed checksum, got %d", rec.Code)
+	}
+}
+
+func TestUploadProgressCountsTheBodyAsItArrives(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	repo := newFakeRepo()
+	buckets := &fakeBucketStore{buckets: map[uuid.UUID]bucket.Bucket{}}
+	service := NewService(repo, buckets, &fakeObjectStore{}, "godrive")
+
+	ownerID, bucketID := uuid.New(), uuid.New()
+	buckets.buckets[bucketID] = bucket.Bucket{ID: bucketID, OwnerID: ownerID, Name: "videos"}
+
+	router := gin.New()
+	RegisterRoutes(router.Group("/v1", func(c *gin.Context) {
+		auth.SetCurrentUser(c, auth.ContextUser{ID: ownerID.String()})
+	}), service)
+
+	content := bytes.Repeat([]byte("frame"), 2000)
+	form := &bytes.Buffer{}
+	writer := multipart.NewWriter(form)
+	part, err := writer.CreateFormFile("file", "clip.mp4")
+	if err != nil {
+		t.Fatalf("create form file: %v", err)
+	}
+	part.Write(content)
+	writer.Close()
+	total := int64(form.Len())
+
+	// The body is sent in two halves so progress can be read while the client is still sending.
+	bodyR, bodyW := io.Pipe()
+	req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/v1/buckets/%s/files", bucketID), bodyR)
+	req.ContentLength = total
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("X-Upload-Id", "clip-1")
+	rec := httptest.NewRecorder()
+	served := make(chan struct{})
+	go func() {
+		defer close(served)
+		router.ServeHTTP(rec, req)
+	}()
+
+	half := form.Next(int(total / 2))
+	if _, err := bodyW.Write(half); err != nil {
+		t.Fatalf("write first half: %v", err)
+	}
+	var midway UploadProgress
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		if p, ok := service.UploadProgress(ownerID, bucketID, "clip-1"); ok && p.BytesReceived >= int64(len(half)) {
+			midway = p
+			break
+		}
+	}
+	if midway.BytesReceived != int64(len(half)) || midway.TotalBytes != total || midway.Done {
+		t.Fatalf("expected %d of %d bytes received mid-transfer, got %+v", len(half), total, midway)
+	}
+
+	bodyW.Write(form.Bytes())
+	bodyW.Close()
+	<-served
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, fmt.Sprintf("/v1/buckets/%s/uploads/clip-1/progress", bucketID), nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/event-stream") {
+		t.Fatalf("expected an event stream, got %q", ct)
+	}
+	data, ok := strings.CutPrefix(strings.Split(rec.Body.String(), "\n")[1], "data:")
+	if !ok {
+		t.Fatalf("expected a progress event, got %q", rec.Body.String())
+	}
+	var progress UploadProgress
+	if err := json.Unmarshal([]byte(data), &progress); err != nil {
+		t.Fatalf("decode progress: %v", err)
+	}
+	if progress.BytesReceived != total || progress.TotalBytes != total || !progress.Done || progress.Failed {
+		t.Fatalf("expected %d of %d bytes done, got %+v", total, total, progress)
+	}
+
+	if _, ok := service.UploadProgress(uuid.New(), bucketID, "clip-1"); ok {
+		t.Fatalf("expected progress to be hidden from other users")
+	}
+}
+
+func TestListFilesAttachesPresignedURLsWhenRequested(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	repo := newFakeRepo()
+	buckets := &fakeBucketStore{buckets: map[uuid.UUID]bucket.Bucket{}}
+	service := NewService(repo, buckets, &fakeObjectStore{}, "godrive")
+
+	ownerID, bucketID := uuid.New(), uuid.New()
+	buckets.buckets[bucketID] = bucket.Bucket{ID: bucketID, OwnerID: ownerID, Name: "gallery"}
+	for i := 0; i < 3; i++ {
+		id := uuid.New()
+		repo.records[id] = Metadata{ID: id, BucketID: bucketID, ObjectName: fmt.Sprintf("%s/%s", bucketID, id)}
+	}
+
+	router := gin.New()
+	RegisterRoutes(router.Group("/v1", func(c *gin.Context) {
+		auth.SetCurrentUser(c, auth.ContextUser{ID: ownerID.String()})
+	}), service)
+	list := func(query string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, fmt.Sprintf("/v1/buckets/%s/files%s", bucketID, query), nil))
+		return rec
+	}
+
+	if rec := list("?with_urls=true"); rec.Code != http.StatusNotImplemented {
+		t.Fatalf("expected 501 without a presigner, got %d", rec.Code)
+	}
+
+	presigner := &fakePresigner{}
+	service.SetPresigner(presigner)
+
+	rec := list("?with_urls=true&ttl=5m")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp struct {
+		Files []ListedFile `json:"files"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(resp.Files) != 3 {
+		t.Fatalf("expected 3 files, got %d", len(resp.Files))
+	}
+	for _, f := range resp.Files {
+		if f.URL != "https://objects.test/"+f.ObjectName || f.URLExpiresAt == nil {
+			t.Fatalf("expected a presigned url for %s, got %+v", f.ID, f)
+		}
+	}
+	if presigner.calls != 1 || presigner.ttl != 5*time.Minute {
+		t.Fatalf("expected one presign call with the requested ttl, got %d calls with %s", presigner.calls, presigner.ttl)
+	}
+
+	if rec := list(""); strings.Contains(rec.Body.String(), `"url"`) {
+		t.Fatalf("expected no urls without with_urls, got %s", rec.Body.String())
+	}
+	if presigner.calls != 1 {
+		t.Fatalf("expected plain listings not to presign")
+	}
+}
+
+type fakePresigner struct {
+	calls int
+	ttl   time.Duration
+}
+
+func (f *fakePresigner) PresignListing(ctx context.Context, ownerID, bucketID uuid.UUID, files []Metadata, ttl time.Duration) ([]string, time.Time, error) {
+	f.calls++
+	f.ttl = ttl
+	urls := make([]string, len(files))
+	for i, meta := range files {
+		urls[i] = "https://objects.test/" + meta.ObjectName
+	}
+	return urls, time.Now().Add(ttl), nil
+}
+
+func TestStatDownloadMatchesMetadataDownloadHeaders(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	repo := newFakeRepo()
+	buckets := &fakeBucketStore{buckets: map[uuid.UUID]bucket.Bucket{}}
+	objectStore := &statObjectStore{namedObjectStore: namedObjectStore{contents: map[string]string{}}, types: map[string]string{}}
+	service := NewService(repo, buckets, objectStore, "godrive")
+
+	ownerID, bucketID, fileID := uuid.New(), uuid.New(), uuid.New()
+	buckets.buckets[bucketID] = bucket.Bucket{ID: bucketID, OwnerID: ownerID, Name: "contracts"}
+	body := "%PDF-1.7 signed contract"
+	meta := Metadata{
+		ID:               fileID,
+		BucketID:         bucketID,
+		ObjectName:       fmt.Sprintf("%s/%s", bucketID, fileID),
+		OriginalFilename: "contract \"final\".pdf",
+		SizeBytes:        int64(len(body)),
+		ContentType:      "application/pdf",
+	}
+	repo.records[fileID] = meta
+	objectStore.contents[meta.ObjectName] = body
+	objectStore.types[meta.ObjectName] = meta.ContentType
+
+	render := func(meta Metadata, reader io.ReadCloser) *httptest.ResponseRecorder {
+		defer reader.Close()
+		rec := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(rec)
+		streamObject(c, meta, reader)
+		return rec
+	}
+
+	viaMetadata, reader, err := service.Download(context.Background(), ownerID, bucketID, fileID)
+	if err != nil {
+		t.Fatalf("Download returned error: %v", err)
+	}
+	want := render(viaMetadata, reader)
+
+	viaStat, reader, err := service.StatDownload(context.Background(), ownerID, bucketID, fileID, meta.ObjectName, meta.OriginalFilename)
+	if err != nil {
+		t.Fatalf("StatDownload returned error: %v", err)
+	}
+	got := render(viaStat, reader)
+
+	for _, header := range []string{"Content-Type", "Content-Disposition", "Content-Length"} {
+		if got.Header().Get(header) != want.Header().Get(header) {
+			t.Fatalf("%s differs: stat path %q, metadata path %q", header, got.Header().Get(header), want.Header().Get(header))
+		}
+	}
+	if got.Body.String() != body || want.Body.String() != body {
+		t.Fatalf("expected both paths to stream the object")
+	}
+
+	if _, _, err := service.StatDownload(context.Background(), ownerID, bucketID, uuid.New(), bucketID.String()+"/gone", "gone.pdf"); err != ErrStatUnavailable {
+		t.Fatalf("expected ErrStatUnavailable for a missing object, got %v", err)
+	}
+	foreign := uuid.NewString() + "/" + uuid.NewString()
+	objectStore.contents[foreign] = body
+	objectStore.types[foreign] = meta.ContentType
+	if _, _, err := service.StatDownload(context.Background(), ownerID, bucketID, uuid.New(), foreign, "shared.pdf"); err != ErrStatUnavailable {
+		t.Fatalf("expected ErrStatUnavailable for an object outside the bucket's prefix, got %v", err)
+	}
+	// The stat path reads no metadata: a service without repositories still serves it.
+	dbless := NewService(nil, nil, objectStore, "godrive")
+	if _, reader, err := dbless.StatDownload(context.Background(), ownerID, bucketID, fileID, meta.ObjectName, meta.OriginalFilename); err != nil {
+		t.Fatalf("expected a stat download without database lookups, got %v", err)
+	} else {
+		reader.Close()
+	}
+	plain := NewService(repo, buckets, &fakeObjectStore{}, "godrive")
+	if _, _, err := plain.StatDownload(context.Background(), ownerID, bucketID, fileID, meta.ObjectName, meta.OriginalFilename); err != ErrStatUnavailable {
+		t.Fatalf("expected ErrStatUnavailable from a store without stat, got %v", err)
+	}
+}
+
+// statObjectStore adds StatObject to namedObjectStore.
+type statObjectStore struct {
+	namedObjectStore
+	types map[string]string
+}
+
+func (s *statObjectStore) StatObject(ctx context.Context, bucketName, objectName string) (minio.ObjectInfo, error) {
+	body, ok := s.contents[objectName]
+	if !ok {
+		return minio.ObjectInfo{}, fmt.Errorf("object %s not found", objectName)
+	}
+	return minio.ObjectInfo{Key: objectName, Size: int64(len(body)), ContentType: s.types[objectName]}, nil
+}
+
+func TestUploadAcceptsConfiguredAlternateField(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	repo := newFakeRepo()
+	buckets := &fakeBucketStore{buckets: map[uuid.UUID]bucket.Bucket{}}
+	service := NewService(repo, buckets, &fakeObjectStore{}, "godrive")
+	service.SetUploadFields([]string{"file", "upload", "data"})
+
+	ownerID, bucketID := uuid.New(), uuid.New()
+	buckets.buckets[bucketID] = bucket.Bucket{ID: bucketID, OwnerID: ownerID, Name: "inbox"}
+
+	router := gin.New()
+	RegisterRoutes(router.Group("/v1", func(c *gin.Context) {
+		auth.SetCurrentUser(c, auth.ContextUser{ID: ownerID.String()})
+	}), service)
+
+	upload := func(field string) *httptest.ResponseRecorder {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		part, err := writer.CreateFormFile(field, "notes.txt")
+		if err != nil {
+			t.Fatalf("create form file: %v", err)
+		}
+		part.Write([]byte("meeting notes"))
+		writer.Close()
+
+		req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/v1/buckets/%s/files", bucketID), body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := upload("upload"); rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201 for an allowed alternate field, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if len(repo.records) != 1 {
+		t.Fatalf("expected the upload to be recorded, got %d records", len(repo.records))
+	}
+
+	rec := upload("attachment")
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an unknown field, got %d", rec.Code)
+	}
+	var resp struct {
+		Error          string   `json:"error"`
+		ExpectedFields []string `json:"expected_fields"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if !strings.Contains(resp.Error, "file, upload, data") || len(resp.ExpectedFields) != 3 {
+		t.Fatalf("expected the error to list the accepted fields, got %+v", resp)
+	}
+}
+
+func TestExportManifestAsCSV(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	repo := newFakeRepo()
+	buckets := &fakeBucketStore{buckets: map[uuid.UUID]bucket.Bucket{}}
+	service := NewService(repo, buckets, &fakeObjectStore{}, "godrive")
+
+	ownerID, bucketID := uuid.New(), uuid.New()
+	buckets.buckets[bucketID] = bucket.Bucket{ID: bucketID, OwnerID: ownerID, Name: "archive"}
+	for i := 0; i < 5; i++ {
+		id := uuid.New()
+		repo.records[id] = Metadata{
+			ID:               id,
+			BucketID:         bucketID,
+			ObjectName:       fmt.Sprintf("%s/%s", bucketID, id),
+			OriginalFilename: fmt.Sprintf("report, part %d.pdf", i),
+			SizeBytes:        int64(100 * i),
+			ContentType:      "application/pdf",
+			Checksum:         strings.Repeat("ab", 32),
+		}
+	}
+
+	router := gin.New()
+	RegisterRoutes(router.Group("/v1", func(c *gin.Context) {
+		auth.SetCurrentUser(c, auth.ContextUser{ID: ownerID.String()})
+	}), service)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, fmt.Sprintf("/v1/buckets/%s/manifest?format=csv", bucketID), nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/csv") {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+	if cd := rec.Header().Get("Content-Disposition"); !strings.Contains(cd, "attachment") || !strings.Contains(cd, ".csv") {
+		t.Fatalf("unexpected content disposition %q", cd)
+	}
+
+	rows, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("parse manifest: %v", err)
+	}
+	if want := []string{"id", "filename", "size_bytes", "checksum", "content_type", "created_at"}; strings.Join(rows[0], ",") != strings.Join(want, ",") {
+		t.Fatalf("unexpected header row %v", rows[0])
+	}
+	if len(rows) != 6 {
+		t.Fatalf("expected a header and 5 rows, got %d rows", len(rows))
+	}
+	for _, row := range rows[1:] {
+		if _, ok := repo.records[uuid.MustParse(row[0])]; !ok || !strings.HasPrefix(row[1], "report, part") {
+			t.Fatalf("unexpected manifest row %v", row)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, fmt.Sprintf("/v1/buckets/%s/manifest?format=xml", bucketID), nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an unknown format, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,34 @@
+package file
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// RunIdempotencyCleanup deletes expired idempotency keys immediately and then every interval
+// until ctx is canceled. A non-positive interval disables it. It blocks, so callers run it in its
+// own goroutine.
+func (s *Service) RunIdempotencyCleanup(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := s.repo.PurgeExpiredIdempotencyKeys(ctx)
+		switch {
+		case err != nil && ctx.Err() == nil:
+			log.Printf("idempotency cleanup: %v", err)
+		case purged > 0:
+			log.Printf("idempotency cleanup: %d expired keys removed", purged)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package file
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+// maxObjectNameLength is the longest key, in bytes, that S3 and MinIO accept.
+const maxObjectNameLength = 1024
+
+// KeyLayout controls how object names are derived for new uploads. Every layout keeps the
+// bucket ID as the first path segment so prefix listing and ownership checks keep working.
+type KeyLayout string
+
+const (
+	// KeyLayoutFlat stores objects as bucketID/fileID.
+	KeyLayoutFlat KeyLayout = "flat"
+	// KeyLayoutDatePartitioned stores objects as bucketID/yyyy/mm/fileID using the upload time in UTC.
+	KeyLayoutDatePartitioned KeyLayout = "date-partitioned"
+	// KeyLayoutHashed stores objects as bucketID/xx/sha256(fileID), hiding the file ID and
+	// spreading keys evenly across prefixes.
+	KeyLayoutHashed KeyLayout = "hashed"
+)
+
+func (l KeyLayout) valid() bool {
+	switch l {
+	case KeyLayoutFlat, KeyLayoutDatePartitioned, KeyLayoutHashed:
+		return true
+	}
+	return false
+}
+
+// objectName builds the object key for a file. The result depends only on its inputs, and
+// distinct file IDs always produce distinct keys.
+func (l KeyLayout) objectName(bucketID, fileID uuid.UUID, now time.Time) string {
+	switch l {
+	case KeyLayoutDatePartitioned:
+		now = now.UTC()
+		return fmt.Sprintf("%s/%04d/%02d/%s", bucketID, now.Year(), int(now.Month()), fileID)
+	case KeyLayoutHashed:
+		sum := sha256.Sum256(fileID[:])
+		digest := hex.EncodeToString(sum[:])
+		return fmt.Sprintf("%s/%s/%s", bucketID, digest[:2], digest)
+	default:
+		return fmt.Sprintf("%s/%s", bucketID, fileID)
+	}
+}
+
+// validateObjectName rejects keys the object store would refuse or that could resolve outside
+// their bucket's prefix: empty or over-long names, invalid UTF-8, a leading slash, or "..".
+func validateObjectName(name string) error {
+	switch {
+	case name == "", len(name) > maxObjectNameLength, !utf8.ValidString(name):
+		return ErrInvalidObjectName
+	case strings.HasPrefix(name, "/"), strings.Contains(name, ".."):
+		return ErrInvalidObjectName
+	}
+	return nil
+}
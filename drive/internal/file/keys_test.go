@@ -0,0 +1,102 @@
+package file
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestKeyLayoutsAreStableAndCollisionFree(t *testing.T) {
+	bucketID := uuid.MustParse("6f1c1b5e-3a7d-4d6a-9d1e-0b9f2c8a7e11")
+	fileID := uuid.MustParse("0d4b7f3a-2c5e-4f8b-a1d3-9e6c5b4a3f20")
+	now := time.Date(2024, time.March, 5, 23, 30, 0, 0, time.FixedZone("UTC+3", 3*60*60))
+
+	cases := []struct {
+		layout  KeyLayout
+		pattern string
+	}{
+		{KeyLayoutFlat, `^` + bucketID.String() + `/` + fileID.String() + `$`},
+		{KeyLayoutDatePartitioned, `^` + bucketID.String() + `/2024/03/` + fileID.String() + `$`},
+		{KeyLayoutHashed, `^` + bucketID.String() + `/([0-9a-f]{2})/([0-9a-f]{64})$`},
+	}
+
+	for _, tc := range cases {
+		t.Run(string(tc.layout), func(t *testing.T) {
+			key := tc.layout.objectName(bucketID, fileID, now)
+			if !regexp.MustCompile(tc.pattern).MatchString(key) {
+				t.Fatalf("key %q does not match %s", key, tc.pattern)
+			}
+			if again := tc.layout.objectName(bucketID, fileID, now); again != key {
+				t.Fatalf("expected stable key, got %q then %q", key, again)
+			}
+			if !objectBelongsToBucket(key, bucketID) {
+				t.Fatalf("key %q should belong to its bucket", key)
+			}
+
+			seen := map[string]bool{key: true}
+			for i := 0; i < 1000; i++ {
+				other := tc.layout.objectName(bucketID, uuid.New(), now)
+				if seen[other] {
+					t.Fatalf("collision on key %q", other)
+				}
+				seen[other] = true
+			}
+		})
+	}
+
+	hashed := KeyLayoutHashed.objectName(bucketID, fileID, now)
+	if strings.Contains(hashed, fileID.String()) {
+		t.Fatalf("hashed layout should not expose the file id: %q", hashed)
+	}
+	parts := strings.Split(hashed, "/")
+	if parts[1] != parts[2][:2] {
+		t.Fatalf("hashed prefix should match digest: %q", hashed)
+	}
+}
+
+func TestSetKeyLayoutRejectsUnknown(t *testing.T) {
+	service := NewService(newFakeRepo(), &fakeBucketStore{}, &fakeObjectStore{}, "godrive")
+	if err := service.SetKeyLayout("random"); err != ErrInvalidKeyLayout {
+		t.Fatalf("expected ErrInvalidKeyLayout, got %v", err)
+	}
+	if err := service.SetKeyLayout(KeyLayoutHashed); err != nil {
+		t.Fatalf("SetKeyLayout returned error: %v", err)
+	}
+}
+
+func TestValidateObjectNameRejectsOverlongAndTraversal(t *testing.T) {
+	bucketID := uuid.New()
+	prefix := bucketID.String() + "/"
+	cases := map[string]error{
+		prefix + uuid.NewString():                                       nil,
+		prefix + strings.Repeat("a", maxObjectNameLength-len(prefix)):   nil,
+		prefix + strings.Repeat("a", maxObjectNameLength-len(prefix)+1): ErrInvalidObjectName,
+		prefix + "../" + uuid.NewString():                               ErrInvalidObjectName,
+		prefix + "2024/..":                                              ErrInvalidObjectName,
+		"/" + prefix + uuid.NewString():                                 ErrInvalidObjectName,
+		prefix + "\xff":                                                 ErrInvalidObjectName,
+		"":                                                              ErrInvalidObjectName,
+	}
+	for name, want := range cases {
+		if got := validateObjectName(name); got != want {
+			t.Fatalf("validateObjectName(%.40q...) = %v, want %v", name, got, want)
+		}
+		if belongs := objectBelongsToBucket(name, bucketID); belongs != (want == nil) {
+			t.Fatalf("objectBelongsToBucket(%.40q...) = %v, want %v", name, belongs, want == nil)
+		}
+	}
+
+	traversal := prefix + "../" + uuid.NewString()
+	store := &statObjectStore{
+		namedObjectStore: namedObjectStore{contents: map[string]string{traversal: "secret"}},
+		types:            map[string]string{traversal: "text/plain"},
+	}
+	service := NewService(newFakeRepo(), &fakeBucketStore{}, store, "godrive")
+	if _, _, err := service.StatDownload(context.Background(), uuid.New(), bucketID, uuid.New(), traversal, "notes.txt"); err != ErrObjectOutsideBucket {
+		t.Fatalf("expected ErrObjectOutsideBucket for a traversal object name, got %v", err)
+	}
+}
@@ -0,0 +1,47 @@
+package file
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const uploadRetryAfter = 5 * time.Second
+
+// UploadLimiter caps the number of uploads processed simultaneously.
+type UploadLimiter struct {
+	slots chan struct{}
+}
+
+// NewUploadLimiter constructs a limiter admitting at most max concurrent uploads.
+// A non-positive max disables limiting.
+func NewUploadLimiter(max int) *UploadLimiter {
+	if max <= 0 {
+		return &UploadLimiter{}
+	}
+	return &UploadLimiter{slots: make(chan struct{}, max)}
+}
+
+// Middleware rejects requests with 503 once all upload slots are taken.
+// The slot is released via defer so a panicking handler cannot leak it.
+func (l *UploadLimiter) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if l.slots == nil {
+			c.Next()
+			return
+		}
+
+		select {
+		case l.slots <- struct{}{}:
+		default:
+			c.Header("Retry-After", strconv.Itoa(int(uploadRetryAfter.Seconds())))
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "too many concurrent uploads"})
+			return
+		}
+		defer func() { <-l.slots }()
+
+		c.Next()
+	}
+}
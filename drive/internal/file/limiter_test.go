@@ -0,0 +1,92 @@
+package file
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestUploadLimiterRejectsWhenSaturated(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	const limit = 2
+	limiter := NewUploadLimiter(limit)
+
+	started := make(chan struct{}, limit)
+	release := make(chan struct{})
+
+	router := gin.New()
+	router.POST("/upload", limiter.Middleware(), func(c *gin.Context) {
+		started <- struct{}{}
+		<-release
+		c.Status(http.StatusCreated)
+	})
+
+	var wg sync.WaitGroup
+	codes := make(chan int, limit)
+	for i := 0; i < limit; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/upload", nil))
+			codes <- rr.Code
+		}()
+	}
+	for i := 0; i < limit; i++ {
+		<-started
+	}
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/upload", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 while saturated, got %d", rr.Code)
+	}
+	if rr.Header().Get("Retry-After") == "" {
+		t.Fatalf("expected Retry-After header")
+	}
+
+	close(release)
+	wg.Wait()
+	close(codes)
+	for code := range codes {
+		if code != http.StatusCreated {
+			t.Fatalf("expected in-flight upload to succeed, got %d", code)
+		}
+	}
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/upload", nil))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected slot to be free after uploads finished, got %d", rr.Code)
+	}
+}
+
+func TestUploadLimiterReleasesSlotOnPanic(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	limiter := NewUploadLimiter(1)
+	router := gin.New()
+	router.Use(gin.Recovery())
+	router.POST("/upload", limiter.Middleware(), func(c *gin.Context) {
+		if c.Query("panic") == "1" {
+			panic("boom")
+		}
+		c.Status(http.StatusCreated)
+	})
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/upload?panic=1", nil))
+	if rr.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500 from panicking handler, got %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/upload", nil))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected slot released after panic, got %d", rr.Code)
+	}
+}
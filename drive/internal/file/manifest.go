@@ -0,0 +1,196 @@
+package file
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/abduss/godrive/internal/auth"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// manifestFlushEvery is how many manifest rows are written between flushes to the client.
+const manifestFlushEvery = 100
+
+// ManifestEntry is one file's row in a bucket manifest export.
+type ManifestEntry struct {
+	ID          uuid.UUID `json:"id"`
+	Filename    string    `json:"filename"`
+	SizeBytes   int64     `json:"size_bytes"`
+	Checksum    string    `json:"checksum"`
+	ContentType string    `json:"content_type"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func newManifestEntry(meta Metadata) ManifestEntry {
+	return ManifestEntry{
+		ID:          meta.ID,
+		Filename:    meta.OriginalFilename,
+		SizeBytes:   meta.SizeBytes,
+		Checksum:    meta.Checksum,
+		ContentType: meta.ContentType,
+		CreatedAt:   meta.CreatedAt.UTC(),
+	}
+}
+
+// manifestHeader names the CSV columns, matching ManifestEntry's JSON fields.
+var manifestHeader = []string{"id", "filename", "size_bytes", "checksum", "content_type", "created_at"}
+
+// manifestWriter encodes manifest entries in one output format.
+type manifestWriter interface {
+	begin() error
+	write(entry ManifestEntry) error
+	// flush pushes buffered rows to the underlying writer.
+	flush() error
+	end() error
+}
+
+type csvManifest struct {
+	w *csv.Writer
+}
+
+func (m *csvManifest) begin() error {
+	return m.w.Write(manifestHeader)
+}
+
+func (m *csvManifest) write(entry ManifestEntry) error {
+	return m.w.Write([]string{
+		entry.ID.String(),
+		entry.Filename,
+		strconv.FormatInt(entry.SizeBytes, 10),
+		entry.Checksum,
+		entry.ContentType,
+		entry.CreatedAt.Format(time.RFC3339),
+	})
+}
+
+func (m *csvManifest) flush() error {
+	m.w.Flush()
+	return m.w.Error()
+}
+
+func (m *csvManifest) end() error {
+	return m.flush()
+}
+
+// jsonManifest writes a single JSON array one element at a time.
+type jsonManifest struct {
+	w       io.Writer
+	written int
+}
+
+func (m *jsonManifest) begin() error {
+	_, err := io.WriteString(m.w, "[")
+	return err
+}
+
+func (m *jsonManifest) write(entry ManifestEntry) error {
+	encoded, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if m.written > 0 {
+		if _, err := io.WriteString(m.w, ","); err != nil {
+			return err
+		}
+	}
+	m.written++
+	_, err = m.w.Write(encoded)
+	return err
+}
+
+func (m *jsonManifest) flush() error {
+	return nil
+}
+
+func (m *jsonManifest) end() error {
+	_, err := io.WriteString(m.w, "]\n")
+	return err
+}
+
+// exportManifest streams metadata for every file in the bucket as CSV or a JSON array, read
+// through the repository cursor so large buckets are never held in memory. As with streamFiles,
+// headers are sent with the first row so lookup errors can still be answered as JSON.
+func (h *httpHandler) exportManifest(c *gin.Context) {
+	userID, _, ok := auth.RequireUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	bucketID, err := uuid.Parse(c.Param("bucketID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid bucket id"})
+		return
+	}
+
+	format := c.DefaultQuery("format", "json")
+	var (
+		writer      manifestWriter
+		contentType string
+	)
+	switch format {
+	case "csv":
+		writer, contentType = &csvManifest{w: csv.NewWriter(c.Writer)}, "text/csv; charset=utf-8"
+	case "json":
+		writer, contentType = &jsonManifest{w: c.Writer}, "application/json; charset=utf-8"
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be csv or json"})
+		return
+	}
+
+	started := false
+	start := func() error {
+		started = true
+		c.Header("Content-Type", contentType)
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fmt.Sprintf("manifest-%s.%s", bucketID, format)))
+		c.Status(http.StatusOK)
+		return writer.begin()
+	}
+
+	written := 0
+	err = h.service.StreamList(c.Request.Context(), userID, bucketID, func(meta Metadata) error {
+		if !started {
+			if err := start(); err != nil {
+				return err
+			}
+		}
+		if err := writer.write(newManifestEntry(meta)); err != nil {
+			return err
+		}
+		written++
+		if written%manifestFlushEvery == 0 {
+			if err := writer.flush(); err != nil {
+				return err
+			}
+			c.Writer.Flush()
+		}
+		return nil
+	})
+	if err == nil && !started {
+		err = start()
+	}
+	if err == nil {
+		err = writer.end()
+	}
+	if err != nil {
+		if started {
+			// The status line is already out, so the failure can only be logged and the stream ended.
+			log.Printf("export manifest of bucket %s: %v", bucketID, err)
+			return
+		}
+		if err == ErrBucketMismatch {
+			c.JSON(http.StatusNotFound, gin.H{"error": "bucket not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to export manifest"})
+		return
+	}
+	c.Writer.Flush()
+}
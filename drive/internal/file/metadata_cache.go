@@ -0,0 +1,97 @@
+package file
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// maxMetadataCacheEntries bounds the metadata cache; new entries are skipped once it is full of
+// unexpired metadata.
+const maxMetadataCacheEntries = 10000
+
+// metadataCache remembers recently read file metadata for a short TTL so downloads can proceed
+// through brief database outages. Entries are keyed by owner as well as file, so a fallback never
+// bypasses the ownership check the original read performed.
+type metadataCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[metadataKey]cachedMetadata
+}
+
+type metadataKey struct {
+	ownerID  uuid.UUID
+	bucketID uuid.UUID
+	fileID   uuid.UUID
+}
+
+type cachedMetadata struct {
+	meta      Metadata
+	expiresAt time.Time
+}
+
+func newMetadataCache(ttl time.Duration) *metadataCache {
+	if ttl <= 0 {
+		return nil
+	}
+	return &metadataCache{ttl: ttl, entries: make(map[metadataKey]cachedMetadata)}
+}
+
+func (c *metadataCache) get(ownerID, bucketID, fileID uuid.UUID, now time.Time) (Metadata, bool) {
+	if c == nil {
+		return Metadata{}, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := metadataKey{ownerID: ownerID, bucketID: bucketID, fileID: fileID}
+	entry, ok := c.entries[key]
+	if !ok {
+		return Metadata{}, false
+	}
+	if !now.Before(entry.expiresAt) {
+		delete(c.entries, key)
+		return Metadata{}, false
+	}
+	return entry.meta, true
+}
+
+func (c *metadataCache) put(ownerID uuid.UUID, now time.Time, metas ...Metadata) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, meta := range metas {
+		key := metadataKey{ownerID: ownerID, bucketID: meta.BucketID, fileID: meta.ID}
+		if _, exists := c.entries[key]; !exists && len(c.entries) >= maxMetadataCacheEntries {
+			c.pruneLocked(now)
+			if len(c.entries) >= maxMetadataCacheEntries {
+				continue
+			}
+		}
+		c.entries[key] = cachedMetadata{meta: meta, expiresAt: now.Add(c.ttl)}
+	}
+}
+
+func (c *metadataCache) remove(ownerID, bucketID, fileID uuid.UUID) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, metadataKey{ownerID: ownerID, bucketID: bucketID, fileID: fileID})
+}
+
+func (c *metadataCache) pruneLocked(now time.Time) {
+	for key, entry := range c.entries {
+		if !now.Before(entry.expiresAt) {
+			delete(c.entries, key)
+		}
+	}
+}
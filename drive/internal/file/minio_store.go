@@ -7,24 +7,113 @@ import (
 	"github.com/minio/minio-go/v7"
 )
 
-// MinIOStore adapts minio.Client to the objectStore interface.
+// minioAPI is the subset of *minio.Client used by MinIOStore.
+type minioAPI interface {
+	PutObject(ctx context.Context, bucketName, objectName string, reader io.Reader, objectSize int64, opts minio.PutObjectOptions) (minio.UploadInfo, error)
+	GetObject(ctx context.Context, bucketName, objectName string, opts minio.GetObjectOptions) (*minio.Object, error)
+	StatObject(ctx context.Context, bucketName, objectName string, opts minio.StatObjectOptions) (minio.ObjectInfo, error)
+	RemoveObject(ctx context.Context, bucketName, objectName string, opts minio.RemoveObjectOptions) error
+	CopyObject(ctx context.Context, dst minio.CopyDestOptions, src minio.CopySrcOptions) (minio.UploadInfo, error)
+	ListObjects(ctx context.Context, bucketName string, opts minio.ListObjectsOptions) <-chan minio.ObjectInfo
+	ListBuckets(ctx context.Context) ([]minio.BucketInfo, error)
+}
+
+// MinIOStore adapts minio.Client to the objectStore interface, retrying transient failures.
 type MinIOStore struct {
-	client *minio.Client
+	client minioAPI
+	retry  RetryPolicy
 }
 
-// NewMinIOStore constructs an adapter.
+// NewMinIOStore constructs an adapter using DefaultRetryPolicy.
 func NewMinIOStore(client *minio.Client) *MinIOStore {
-	return &MinIOStore{client: client}
+	return &MinIOStore{client: client, retry: DefaultRetryPolicy}
+}
+
+// SetRetryPolicy replaces the retry policy for subsequent calls.
+func (s *MinIOStore) SetRetryPolicy(policy RetryPolicy) {
+	s.retry = policy
 }
 
+// PutObject uploads the reader's contents. Only seekable readers are retried, since a partially
+// consumed stream cannot be replayed; Service uploads stream through a pipeline and are resent
+// by the service instead (see Service.SetUploadRetryPolicy).
 func (s *MinIOStore) PutObject(ctx context.Context, bucketName, objectName string, reader io.Reader, objectSize int64, opts minio.PutObjectOptions) (minio.UploadInfo, error) {
-	return s.client.PutObject(ctx, bucketName, objectName, reader, objectSize, opts)
+	seeker, ok := reader.(io.Seeker)
+	if !ok {
+		return s.client.PutObject(ctx, bucketName, objectName, reader, objectSize, opts)
+	}
+	start, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return s.client.PutObject(ctx, bucketName, objectName, reader, objectSize, opts)
+	}
+
+	var info minio.UploadInfo
+	err = s.retry.do(ctx, func() error {
+		if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+			return err
+		}
+		var putErr error
+		info, putErr = s.client.PutObject(ctx, bucketName, objectName, reader, objectSize, opts)
+		return putErr
+	})
+	return info, err
 }
 
+// GetObject opens the object for reading. minio-go defers the request until the first read, so
+// the object is stat'ed first to surface (and retry) failures here rather than mid-stream.
 func (s *MinIOStore) GetObject(ctx context.Context, bucketName, objectName string, opts minio.GetObjectOptions) (io.ReadCloser, error) {
+	err := s.retry.do(ctx, func() error {
+		_, statErr := s.client.StatObject(ctx, bucketName, objectName, minio.StatObjectOptions{})
+		return statErr
+	})
+	if err != nil {
+		return nil, err
+	}
 	return s.client.GetObject(ctx, bucketName, objectName, opts)
 }
 
+// StatObject returns the object's size and content type without fetching it.
+func (s *MinIOStore) StatObject(ctx context.Context, bucketName, objectName string) (minio.ObjectInfo, error) {
+	var info minio.ObjectInfo
+	err := s.retry.do(ctx, func() error {
+		var statErr error
+		info, statErr = s.client.StatObject(ctx, bucketName, objectName, minio.StatObjectOptions{})
+		return statErr
+	})
+	return info, err
+}
+
+// Ping verifies the MinIO endpoint answers authenticated requests.
+func (s *MinIOStore) Ping(ctx context.Context) error {
+	_, err := s.client.ListBuckets(ctx)
+	return err
+}
+
 func (s *MinIOStore) RemoveObject(ctx context.Context, bucketName, objectName string, opts minio.RemoveObjectOptions) error {
-	return s.client.RemoveObject(ctx, bucketName, objectName, opts)
+	return s.retry.do(ctx, func() error {
+		return s.client.RemoveObject(ctx, bucketName, objectName, opts)
+	})
+}
+
+// CopyObject duplicates srcObject as dstObject within the bucket on the server side.
+func (s *MinIOStore) CopyObject(ctx context.Context, bucketName, srcObject, dstObject string) error {
+	return s.retry.do(ctx, func() error {
+		_, err := s.client.CopyObject(ctx,
+			minio.CopyDestOptions{Bucket: bucketName, Object: dstObject},
+			minio.CopySrcOptions{Bucket: bucketName, Object: srcObject},
+		)
+		return err
+	})
+}
+
+// ListObjects returns every object under prefix, descending into nested prefixes.
+func (s *MinIOStore) ListObjects(ctx context.Context, bucketName, prefix string) ([]minio.ObjectInfo, error) {
+	var objects []minio.ObjectInfo
+	for obj := range s.client.ListObjects(ctx, bucketName, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if obj.Err != nil {
+			return nil, obj.Err
+		}
+		objects = append(objects, obj)
+	}
+	return objects, nil
 }
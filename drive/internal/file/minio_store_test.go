@@ -0,0 +1,98 @@
+package file
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/minio/minio-go/v7"
+)
+
+func TestMinIOStoreRetriesTransientFailures(t *testing.T) {
+	client := &flakyMinIO{failures: 2, err: minio.ErrorResponse{Code: "ServiceUnavailable", StatusCode: http.StatusServiceUnavailable}}
+	store := &MinIOStore{client: client, retry: RetryPolicy{Attempts: 3}}
+
+	info, err := store.PutObject(context.Background(), "godrive", "b/obj", bytes.NewReader([]byte("payload")), 7, minio.PutObjectOptions{})
+	if err != nil {
+		t.Fatalf("expected PutObject to succeed after retries, got %v", err)
+	}
+	if client.putCalls != 3 {
+		t.Fatalf("expected 3 attempts, got %d", client.putCalls)
+	}
+	if info.Size != 7 {
+		t.Fatalf("expected every attempt to read the full payload, got %d bytes", info.Size)
+	}
+}
+
+func TestMinIOStoreDoesNotRetryFatalErrors(t *testing.T) {
+	client := &flakyMinIO{failures: 5, err: minio.ErrorResponse{Code: "AccessDenied", StatusCode: http.StatusForbidden}}
+	store := &MinIOStore{client: client, retry: RetryPolicy{Attempts: 3}}
+
+	if err := store.RemoveObject(context.Background(), "godrive", "b/obj", minio.RemoveObjectOptions{}); err == nil {
+		t.Fatalf("expected AccessDenied to be returned")
+	}
+	if client.removeCalls != 1 {
+		t.Fatalf("expected a single attempt for a fatal error, got %d", client.removeCalls)
+	}
+
+	client = &flakyMinIO{failures: 5, err: minio.ErrorResponse{Code: "InternalError", StatusCode: http.StatusInternalServerError}}
+	store = &MinIOStore{client: client, retry: RetryPolicy{Attempts: 3}}
+	if err := store.RemoveObject(context.Background(), "godrive", "b/obj", minio.RemoveObjectOptions{}); err == nil {
+		t.Fatalf("expected error once attempts are exhausted")
+	}
+	if client.removeCalls != 3 {
+		t.Fatalf("expected attempts to stop at the configured bound, got %d", client.removeCalls)
+	}
+}
+
+// flakyMinIO fails the first `failures` calls of each operation with err.
+type flakyMinIO struct {
+	failures    int
+	err         error
+	putCalls    int
+	removeCalls int
+}
+
+func (f *flakyMinIO) PutObject(ctx context.Context, bucketName, objectName string, reader io.Reader, objectSize int64, opts minio.PutObjectOptions) (minio.UploadInfo, error) {
+	f.putCalls++
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return minio.UploadInfo{}, err
+	}
+	if f.putCalls <= f.failures {
+		return minio.UploadInfo{}, f.err
+	}
+	return minio.UploadInfo{Size: int64(len(data))}, nil
+}
+
+func (f *flakyMinIO) GetObject(ctx context.Context, bucketName, objectName string, opts minio.GetObjectOptions) (*minio.Object, error) {
+	return nil, nil
+}
+
+func (f *flakyMinIO) StatObject(ctx context.Context, bucketName, objectName string, opts minio.StatObjectOptions) (minio.ObjectInfo, error) {
+	return minio.ObjectInfo{}, nil
+}
+
+func (f *flakyMinIO) RemoveObject(ctx context.Context, bucketName, objectName string, opts minio.RemoveObjectOptions) error {
+	f.removeCalls++
+	if f.removeCalls <= f.failures {
+		return f.err
+	}
+	return nil
+}
+
+func (f *flakyMinIO) CopyObject(ctx context.Context, dst minio.CopyDestOptions, src minio.CopySrcOptions) (minio.UploadInfo, error) {
+	return minio.UploadInfo{}, nil
+}
+
+func (f *flakyMinIO) ListObjects(ctx context.Context, bucketName string, opts minio.ListObjectsOptions) <-chan minio.ObjectInfo {
+	ch := make(chan minio.ObjectInfo)
+	close(ch)
+	return ch
+}
+
+func (f *flakyMinIO) ListBuckets(ctx context.Context) ([]minio.BucketInfo, error) {
+	return nil, nil
+}
@@ -17,4 +17,69 @@ type Metadata struct {
 	Checksum         string    `json:"checksum"`
 	CreatedAt        time.Time `json:"created_at"`
 	UpdatedAt        time.Time `json:"updated_at"`
+	// OriginalCreatedAt is a client-supplied creation time, e.g. from an imported archive.
+	// CreatedAt stays server-managed.
+	OriginalCreatedAt *time.Time `json:"original_created_at,omitempty"`
+}
+
+// UnhashedFile is a file stored without a checksum, with the owner needed to locate and update it.
+type UnhashedFile struct {
+	Metadata
+	OwnerID uuid.UUID
+}
+
+// ListedFile is a file in a listing, optionally with a presigned download URL attached.
+type ListedFile struct {
+	Metadata
+	URL          string     `json:"url,omitempty"`
+	URLExpiresAt *time.Time `json:"url_expires,omitempty"`
+}
+
+// StoredObject describes an object found in object storage.
+type StoredObject struct {
+	Key       string `json:"key"`
+	SizeBytes int64  `json:"size_bytes"`
+}
+
+// DriftReport lists disagreements between object storage and file metadata for a bucket.
+type DriftReport struct {
+	BucketID uuid.UUID `json:"bucket_id"`
+	Matched  int       `json:"matched"`
+	// OrphanObjects are stored objects with no metadata row.
+	OrphanObjects []StoredObject `json:"orphan_objects"`
+	// MissingObjects are metadata rows whose object is absent.
+	MissingObjects []Metadata `json:"missing_objects"`
+}
+
+// ListOptions selects a window of a bucket's files. A zero Limit returns all files.
+type ListOptions struct {
+	Limit  int
+	Offset int
+}
+
+// ObjectMove reassigns one file to another bucket under a new object name.
+type ObjectMove struct {
+	FileID        uuid.UUID
+	NewObjectName string
+}
+
+// MoveResult is the outcome of one file in a batch move: either File or Error is set.
+type MoveResult struct {
+	FileID uuid.UUID `json:"file_id"`
+	File   *Metadata `json:"file,omitempty"`
+	Error  string    `json:"error,omitempty"`
+}
+
+// UploadOptions adjusts how a single upload is stored.
+type UploadOptions struct {
+	// NoOverwrite rejects the upload with ErrFileNameExists when the bucket already holds a
+	// file with the same original filename. By default duplicates are stored side by side.
+	NoOverwrite bool
+	// IdempotencyKey, when set, makes retries of the same upload to the same bucket return the
+	// originally stored file instead of creating a duplicate. The key is reserved before the
+	// object is stored, so a concurrent attempt gets ErrUploadInProgress rather than a second file.
+	IdempotencyKey string
+	// OriginalCreatedAt preserves the file's creation time from another system; it must not lie
+	// in the future beyond a small clock skew.
+	OriginalCreatedAt *time.Time
 }
@@ -0,0 +1,135 @@
+package file
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+)
+
+// errUploadAborted ends a running scan when the upload fails before the object is stored.
+var errUploadAborted = errors.New("upload aborted")
+
+// pipelineOptions configures an uploadPipeline. A negative limit disables the limit; a nil
+// scanner skips scanning.
+type pipelineOptions struct {
+	limit   int64
+	scanner Scanner
+}
+
+// uploadPipeline reads an upload body exactly once. Every byte the object store pulls through
+// it is hashed, counted, checked against the limit, and copied to a scanner running alongside
+// the write; the first sniffLen bytes are buffered up front for content type detection.
+type uploadPipeline struct {
+	body    *bufio.Reader
+	limited *limitReader
+	hasher  hash.Hash
+	head    []byte
+	read    int64
+
+	scanW   *io.PipeWriter
+	verdict chan scanVerdict
+	closed  bool
+}
+
+type scanVerdict struct {
+	clean  bool
+	reason string
+}
+
+// newUploadPipeline wraps src according to opts and fills the sniff window. When a scanner is
+// configured it starts reading immediately, so the caller must end the pipeline with finish or
+// abort.
+func newUploadPipeline(ctx context.Context, src io.Reader, opts pipelineOptions) (*uploadPipeline, error) {
+	p := &uploadPipeline{hasher: sha256.New()}
+	if opts.limit >= 0 {
+		p.limited = &limitReader{r: src, remaining: opts.limit}
+		src = p.limited
+	}
+	p.body = bufio.NewReaderSize(src, sniffLen)
+
+	// Peek only buffers, so the sniffed bytes still flow through Read; they are copied because
+	// the buffer is reused once reading starts. A limit crossed within the window is reported by
+	// the first Read instead.
+	head, err := p.body.Peek(sniffLen)
+	if err != nil && err != io.EOF && !errors.Is(err, ErrFileTooLarge) {
+		return nil, fmt.Errorf("read upload file: %w", err)
+	}
+	p.head = append([]byte(nil), head...)
+
+	if opts.scanner != nil {
+		if _, ok := opts.scanner.(NoopScanner); !ok {
+			p.startScan(ctx, opts.scanner)
+		}
+	}
+	return p, nil
+}
+
+// startScan runs scanner over a pipe fed by Read. Whatever the scanner leaves unread is drained
+// so a scanner that decides early never stalls the upload.
+func (p *uploadPipeline) startScan(ctx context.Context, scanner Scanner) {
+	r, w := io.Pipe()
+	p.scanW = w
+	p.verdict = make(chan scanVerdict, 1)
+	go func() {
+		clean, reason := scanner.Scan(ctx, r)
+		_, _ = io.Copy(io.Discard, r)
+		p.verdict <- scanVerdict{clean: clean, reason: reason}
+	}()
+}
+
+func (p *uploadPipeline) Read(b []byte) (int, error) {
+	n, err := p.body.Read(b)
+	if n > 0 {
+		p.hasher.Write(b[:n])
+		p.read += int64(n)
+		if p.scanW != nil {
+			_, _ = p.scanW.Write(b[:n])
+		}
+	}
+	return n, err
+}
+
+// sniffedType is the content type detected from the start of the body.
+func (p *uploadPipeline) sniffedType() string {
+	return http.DetectContentType(p.head)
+}
+
+// exceeded reports whether the body ran past the limit.
+func (p *uploadPipeline) exceeded() bool {
+	return p.limited != nil && p.limited.exceeded
+}
+
+// checksum is the hex SHA-256 of the bytes read so far.
+func (p *uploadPipeline) checksum() string {
+	return hex.EncodeToString(p.hasher.Sum(nil))
+}
+
+// finish ends the scan at the bytes read so far and returns a RejectedError if the scanner
+// flagged them.
+func (p *uploadPipeline) finish() error {
+	if p.scanW == nil || p.closed {
+		return nil
+	}
+	p.closed = true
+	p.scanW.Close()
+	if v := <-p.verdict; !v.clean {
+		return &RejectedError{Reason: v.reason}
+	}
+	return nil
+}
+
+// abort stops a running scan and discards its verdict. It does nothing after finish.
+func (p *uploadPipeline) abort() {
+	if p.scanW == nil || p.closed {
+		return
+	}
+	p.closed = true
+	p.scanW.CloseWithError(errUploadAborted)
+	<-p.verdict
+}
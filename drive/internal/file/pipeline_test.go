@@ -0,0 +1,78 @@
+package file
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"testing"
+)
+
+// onceReader fails the test if it is read past EOF, i.e. if the body is consumed twice.
+type onceReader struct {
+	t    *testing.T
+	r    io.Reader
+	n    int64
+	done bool
+}
+
+func (o *onceReader) Read(p []byte) (int, error) {
+	if o.done {
+		o.t.Fatalf("body read again after EOF")
+	}
+	n, err := o.r.Read(p)
+	o.n += int64(n)
+	if err == io.EOF {
+		o.done = true
+	}
+	return n, err
+}
+
+type recordingScanner struct {
+	seen []byte
+}
+
+func (r *recordingScanner) Scan(ctx context.Context, reader io.Reader) (bool, string) {
+	r.seen, _ = io.ReadAll(reader)
+	return true, ""
+}
+
+func TestUploadPipelineHashesSniffsAndCountsInOnePass(t *testing.T) {
+	content := append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte("pixel data "), 200)...)
+	src := &onceReader{t: t, r: bytes.NewReader(content)}
+	scanner := &recordingScanner{}
+	body, err := newUploadPipeline(context.Background(), src, pipelineOptions{
+		limit:   int64(len(content)),
+		scanner: scanner,
+	})
+	if err != nil {
+		t.Fatalf("newUploadPipeline returned error: %v", err)
+	}
+	defer body.abort()
+
+	stored, err := io.ReadAll(body)
+	if err != nil {
+		t.Fatalf("reading pipeline: %v", err)
+	}
+	if err := body.finish(); err != nil {
+		t.Fatalf("finish returned error: %v", err)
+	}
+
+	sum := sha256.Sum256(content)
+	if got, want := body.checksum(), hex.EncodeToString(sum[:]); got != want {
+		t.Fatalf("checksum = %s, want %s", got, want)
+	}
+	if got := body.sniffedType(); got != "image/png" {
+		t.Fatalf("sniffed type = %q, want image/png", got)
+	}
+	if body.read != int64(len(content)) || src.n != int64(len(content)) {
+		t.Fatalf("expected %d bytes counted once, got read=%d source=%d", len(content), body.read, src.n)
+	}
+	if !bytes.Equal(stored, content) || !bytes.Equal(scanner.seen, content) {
+		t.Fatalf("expected store and scanner to see the full body")
+	}
+	if body.exceeded() {
+		t.Fatalf("body at the limit should not be reported as exceeded")
+	}
+}
@@ -0,0 +1,98 @@
+package file
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+// maxPreviewBytes caps how much of a file a preview returns. Only this prefix is read from the
+// object store, however large the file.
+const maxPreviewBytes = 64 << 10
+
+// Preview is the leading text of a file.
+type Preview struct {
+	ID          uuid.UUID `json:"id"`
+	ContentType string    `json:"content_type"`
+	SizeBytes   int64     `json:"size_bytes"`
+	Content     string    `json:"content"`
+	// Truncated reports that Content holds only the start of the file.
+	Truncated bool `json:"truncated"`
+}
+
+// previewable reports whether contentType is text that can be shown inline: any text/* type,
+// JSON (including +json suffixes), and CSV.
+func previewable(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	switch {
+	case strings.HasPrefix(mediaType, "text/"):
+		return true
+	case mediaType == "application/json", strings.HasSuffix(mediaType, "+json"):
+		return true
+	case mediaType == "application/csv":
+		return true
+	}
+	return false
+}
+
+// Preview returns up to maxPreviewBytes from the start of a text file, reading only that prefix
+// through a range request. Files of other content types are refused with ErrNotPreviewable
+// before the object is touched.
+func (s *Service) Preview(ctx context.Context, ownerID, bucketID, fileID uuid.UUID) (Preview, error) {
+	meta, err := s.ResolveDownload(ctx, ownerID, bucketID, fileID)
+	if err != nil {
+		return Preview{}, err
+	}
+	if !previewable(meta.ContentType) {
+		return Preview{}, ErrNotPreviewable
+	}
+
+	preview := Preview{
+		ID:          meta.ID,
+		ContentType: meta.ContentType,
+		SizeBytes:   meta.SizeBytes,
+		Truncated:   meta.SizeBytes > maxPreviewBytes,
+	}
+	if meta.SizeBytes <= 0 {
+		return preview, nil
+	}
+
+	reader, err := s.OpenRange(ctx, ownerID, meta, 0, min(meta.SizeBytes, maxPreviewBytes)-1)
+	if err != nil {
+		return Preview{}, err
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(io.LimitReader(reader, maxPreviewBytes))
+	if err != nil {
+		return Preview{}, fmt.Errorf("read preview: %w", err)
+	}
+	if preview.Truncated {
+		data = trimPartialRune(data)
+	}
+	preview.Content = strings.ToValidUTF8(string(data), "\uFFFD")
+	return preview, nil
+}
+
+// trimPartialRune drops a multi-byte UTF-8 sequence cut off at the end of data, so a truncated
+// preview does not end in a replacement character.
+func trimPartialRune(data []byte) []byte {
+	for i := 1; i < utf8.UTFMax && i <= len(data); i++ {
+		if !utf8.RuneStart(data[len(data)-i]) {
+			continue
+		}
+		if !utf8.FullRune(data[len(data)-i:]) {
+			return data[:len(data)-i]
+		}
+		break
+	}
+	return data
+}
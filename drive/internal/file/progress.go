@@ -0,0 +1,125 @@
+package file
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MaxUploadIDLength bounds client-supplied upload IDs.
+const MaxUploadIDLength = 128
+
+// progressRetention is how long a finished upload's progress stays readable, so a progress
+// stream opened late still sees the final state.
+const progressRetention = time.Minute
+
+// UploadProgress reports how much of an upload request has arrived. BytesReceived counts the
+// request body as it is read from the client, multipart framing included, so it reaches
+// TotalBytes once the body is in; Done follows when the file has been stored or rejected.
+type UploadProgress struct {
+	UploadID      string `json:"upload_id"`
+	BytesReceived int64  `json:"bytes_received"`
+	// TotalBytes is the request's Content-Length, or -1 when the client sent the body chunked.
+	TotalBytes int64 `json:"total_bytes"`
+	Done       bool  `json:"done"`
+	Failed     bool  `json:"failed,omitempty"`
+}
+
+// progressTracker holds progress for uploads that carry a client-supplied ID. Entries are keyed
+// by owner and bucket so one user cannot follow another's uploads by guessing IDs.
+type progressTracker struct {
+	mu      sync.Mutex
+	entries map[progressKey]*uploadProgress
+}
+
+type progressKey struct {
+	ownerID  uuid.UUID
+	bucketID uuid.UUID
+	uploadID string
+}
+
+type uploadProgress struct {
+	received   atomic.Int64
+	total      int64
+	done       bool
+	failed     bool
+	finishedAt time.Time
+}
+
+func newProgressTracker() *progressTracker {
+	return &progressTracker{entries: make(map[progressKey]*uploadProgress)}
+}
+
+// start registers an upload, replacing any earlier upload with the same key.
+func (t *progressTracker) start(key progressKey, total int64, now time.Time) *uploadProgress {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for k, p := range t.entries {
+		if p.done && now.Sub(p.finishedAt) >= progressRetention {
+			delete(t.entries, k)
+		}
+	}
+	p := &uploadProgress{total: total}
+	t.entries[key] = p
+	return p
+}
+
+// finish marks p as complete; a nil p is ignored.
+func (t *progressTracker) finish(p *uploadProgress, failed bool, now time.Time) {
+	if p == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	p.done, p.failed, p.finishedAt = true, failed, now
+}
+
+func (t *progressTracker) snapshot(key progressKey, now time.Time) (UploadProgress, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	p, ok := t.entries[key]
+	if !ok || (p.done && now.Sub(p.finishedAt) >= progressRetention) {
+		return UploadProgress{}, false
+	}
+	return UploadProgress{
+		UploadID:      key.uploadID,
+		BytesReceived: p.received.Load(),
+		TotalBytes:    p.total,
+		Done:          p.done,
+		Failed:        p.failed,
+	}, true
+}
+
+// trackUpload registers progress for the owner's upload tagged uploadID and returns body wrapped
+// so each byte is counted as it is read from the client. total is the request's declared length,
+// or -1. The returned finish marks the upload done once it has been stored or has failed.
+func (s *Service) trackUpload(ownerID, bucketID uuid.UUID, uploadID string, body io.ReadCloser, total int64) (io.ReadCloser, func(failed bool)) {
+	p := s.progress.start(progressKey{ownerID: ownerID, bucketID: bucketID, uploadID: uploadID}, total, s.nowFunc())
+	finish := func(failed bool) {
+		s.progress.finish(p, failed, s.nowFunc())
+	}
+	return &countingBody{ReadCloser: body, received: &p.received}, finish
+}
+
+// countingBody adds every byte read from a request body to received.
+type countingBody struct {
+	io.ReadCloser
+	received *atomic.Int64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.received.Add(int64(n))
+	return n, err
+}
+
+// UploadProgress reports the progress of the owner's upload tagged uploadID in a bucket. It
+// returns false for unknown IDs and for uploads that finished over a minute ago.
+func (s *Service) UploadProgress(ownerID, bucketID uuid.UUID, uploadID string) (UploadProgress, bool) {
+	return s.progress.snapshot(progressKey{ownerID: ownerID, bucketID: bucketID, uploadID: uploadID}, s.nowFunc())
+}
@@ -2,38 +2,47 @@ package file
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/abduss/godrive/internal/bucket"
+	"github.com/abduss/godrive/internal/storage"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
-	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-const repoTimeout = 5 * time.Second
+// metadataError maps a missing row, even when wrapped, to ErrFileNotFound and annotates any
+// other failure with action.
+func metadataError(err error, action string) error {
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrFileNotFound
+	}
+	return fmt.Errorf("%s: %w", action, err)
+}
 
 // Repository provides access to file metadata storage.
 type Repository struct {
-	pool *pgxpool.Pool
+	db       storage.Querier
+	timeouts storage.QueryTimeouts
 }
 
 // NewRepository builds a new file repository.
-func NewRepository(pool *pgxpool.Pool) *Repository {
-	return &Repository{pool: pool}
+func NewRepository(db storage.Querier, timeouts storage.QueryTimeouts) *Repository {
+	return &Repository{db: db, timeouts: timeouts.WithDefaults()}
 }
 
 // Create inserts metadata for a new file.
 func (r *Repository) Create(ctx context.Context, meta Metadata) (Metadata, error) {
-	ctx, cancel := context.WithTimeout(ctx, repoTimeout)
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Write)
 	defer cancel()
 
 	query := `
-INSERT INTO files (id, bucket_id, object_name, original_filename, size_bytes, content_type, checksum, metadata)
-VALUES ($1, $2, $3, $4, $5, $6, $7, NULL)
-RETURNING id, bucket_id, object_name, original_filename, size_bytes, content_type, checksum, created_at, updated_at;`
+INSERT INTO files (id, bucket_id, object_name, original_filename, size_bytes, content_type, checksum, original_created_at, metadata)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULL)
+RETURNING id, bucket_id, object_name, original_filename, size_bytes, content_type, checksum, created_at, updated_at, original_created_at;`
 
-	row := r.pool.QueryRow(ctx, query,
+	row := r.db.QueryRow(ctx, query,
 		meta.ID,
 		meta.BucketID,
 		meta.ObjectName,
@@ -41,28 +50,35 @@ RETURNING id, bucket_id, object_name, original_filename, size_bytes, content_typ
 		meta.SizeBytes,
 		meta.ContentType,
 		meta.Checksum,
+		meta.OriginalCreatedAt,
 	)
 
 	var stored Metadata
-	if err := row.Scan(&stored.ID, &stored.BucketID, &stored.ObjectName, &stored.OriginalFilename, &stored.SizeBytes, &stored.ContentType, &stored.Checksum, &stored.CreatedAt, &stored.UpdatedAt); err != nil {
+	if err := row.Scan(&stored.ID, &stored.BucketID, &stored.ObjectName, &stored.OriginalFilename, &stored.SizeBytes, &stored.ContentType, &stored.Checksum, &stored.CreatedAt, &stored.UpdatedAt, &stored.OriginalCreatedAt); err != nil {
 		return Metadata{}, fmt.Errorf("create file metadata: %w", err)
 	}
 	return stored, nil
 }
 
-// List returns files owned by the user in a bucket.
-func (r *Repository) List(ctx context.Context, ownerID, bucketID uuid.UUID) ([]Metadata, error) {
-	ctx, cancel := context.WithTimeout(ctx, repoTimeout)
+// List returns files owned by the user in a bucket, newest first.
+func (r *Repository) List(ctx context.Context, ownerID, bucketID uuid.UUID, opts ListOptions) ([]Metadata, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.List)
 	defer cancel()
 
 	query := `
-SELECT f.id, f.bucket_id, f.object_name, f.original_filename, f.size_bytes, f.content_type, f.checksum, f.created_at, f.updated_at
+SELECT f.id, f.bucket_id, f.object_name, f.original_filename, f.size_bytes, f.content_type, f.checksum, f.created_at, f.updated_at, f.original_created_at
 FROM files f
 JOIN buckets b ON b.id = f.bucket_id
 WHERE f.bucket_id = $1 AND b.owner_id = $2
-ORDER BY f.created_at DESC;`
+ORDER BY f.created_at DESC, f.id DESC`
+
+	args := []any{bucketID, ownerID}
+	if opts.Limit > 0 {
+		query += " LIMIT $3 OFFSET $4"
+		args = append(args, opts.Limit, opts.Offset)
+	}
 
-	rows, err := r.pool.Query(ctx, query, bucketID, ownerID)
+	rows, err := r.db.Query(ctx, query+";", args...)
 	if err != nil {
 		return nil, fmt.Errorf("list files: %w", err)
 	}
@@ -71,7 +87,7 @@ ORDER BY f.created_at DESC;`
 	var files []Metadata
 	for rows.Next() {
 		var meta Metadata
-		if err := rows.Scan(&meta.ID, &meta.BucketID, &meta.ObjectName, &meta.OriginalFilename, &meta.SizeBytes, &meta.ContentType, &meta.Checksum, &meta.CreatedAt, &meta.UpdatedAt); err != nil {
+		if err := rows.Scan(&meta.ID, &meta.BucketID, &meta.ObjectName, &meta.OriginalFilename, &meta.SizeBytes, &meta.ContentType, &meta.Checksum, &meta.CreatedAt, &meta.UpdatedAt, &meta.OriginalCreatedAt); err != nil {
 			return nil, fmt.Errorf("scan file metadata: %w", err)
 		}
 		files = append(files, meta)
@@ -82,19 +98,51 @@ ORDER BY f.created_at DESC;`
 	return files, nil
 }
 
+// StreamList walks the user's files in a bucket with a cursor, calling fn for each row instead
+// of materializing the full slice. The caller's context bounds the walk, so large buckets are
+// not cut off by the per-query timeout. Iteration stops at the first error returned by fn.
+func (r *Repository) StreamList(ctx context.Context, ownerID, bucketID uuid.UUID, fn func(Metadata) error) error {
+	query := `
+SELECT f.id, f.bucket_id, f.object_name, f.original_filename, f.size_bytes, f.content_type, f.checksum, f.created_at, f.updated_at, f.original_created_at
+FROM files f
+JOIN buckets b ON b.id = f.bucket_id
+WHERE f.bucket_id = $1 AND b.owner_id = $2
+ORDER BY f.created_at DESC;`
+
+	rows, err := r.db.Query(ctx, query, bucketID, ownerID)
+	if err != nil {
+		return fmt.Errorf("stream files: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var meta Metadata
+		if err := rows.Scan(&meta.ID, &meta.BucketID, &meta.ObjectName, &meta.OriginalFilename, &meta.SizeBytes, &meta.ContentType, &meta.Checksum, &meta.CreatedAt, &meta.UpdatedAt, &meta.OriginalCreatedAt); err != nil {
+			return fmt.Errorf("scan file metadata: %w", err)
+		}
+		if err := fn(meta); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("iterate files: %w", err)
+	}
+	return nil
+}
+
 // Get fetches metadata for a single file ensuring ownership.
 func (r *Repository) Get(ctx context.Context, ownerID, bucketID, fileID uuid.UUID) (Metadata, error) {
-	ctx, cancel := context.WithTimeout(ctx, repoTimeout)
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Lookup)
 	defer cancel()
 
 	query := `
-SELECT f.id, f.bucket_id, f.object_name, f.original_filename, f.size_bytes, f.content_type, f.checksum, f.created_at, f.updated_at
+SELECT f.id, f.bucket_id, f.object_name, f.original_filename, f.size_bytes, f.content_type, f.checksum, f.created_at, f.updated_at, f.original_created_at
 FROM files f
 JOIN buckets b ON b.id = f.bucket_id
 WHERE f.id = $1 AND f.bucket_id = $2 AND b.owner_id = $3;`
 
 	var meta Metadata
-	err := r.pool.QueryRow(ctx, query, fileID, bucketID, ownerID).Scan(
+	err := r.db.QueryRow(ctx, query, fileID, bucketID, ownerID).Scan(
 		&meta.ID,
 		&meta.BucketID,
 		&meta.ObjectName,
@@ -104,19 +152,346 @@ WHERE f.id = $1 AND f.bucket_id = $2 AND b.owner_id = $3;`
 		&meta.Checksum,
 		&meta.CreatedAt,
 		&meta.UpdatedAt,
+		&meta.OriginalCreatedAt,
 	)
 	if err != nil {
-		if err == pgx.ErrNoRows {
-			return Metadata{}, ErrFileNotFound
-		}
-		return Metadata{}, fmt.Errorf("get file metadata: %w", err)
+		return Metadata{}, metadataError(err, "get file metadata")
+	}
+	return meta, nil
+}
+
+// FindByChecksum returns the newest file in the owner's bucket whose SHA-256 checksum matches.
+func (r *Repository) FindByChecksum(ctx context.Context, ownerID, bucketID uuid.UUID, checksum string) (Metadata, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Lookup)
+	defer cancel()
+
+	query := `
+SELECT f.id, f.bucket_id, f.object_name, f.original_filename, f.size_bytes, f.content_type, f.checksum, f.created_at, f.updated_at, f.original_created_at
+FROM files f
+JOIN buckets b ON b.id = f.bucket_id
+WHERE f.bucket_id = $1 AND b.owner_id = $2 AND f.checksum = $3
+ORDER BY f.created_at DESC
+LIMIT 1;`
+
+	var meta Metadata
+	err := r.db.QueryRow(ctx, query, bucketID, ownerID, checksum).Scan(
+		&meta.ID,
+		&meta.BucketID,
+		&meta.ObjectName,
+		&meta.OriginalFilename,
+		&meta.SizeBytes,
+		&meta.ContentType,
+		&meta.Checksum,
+		&meta.CreatedAt,
+		&meta.UpdatedAt,
+		&meta.OriginalCreatedAt,
+	)
+	if err != nil {
+		return Metadata{}, metadataError(err, "find file by checksum")
 	}
 	return meta, nil
 }
 
-// Delete removes metadata and returns the deleted record.
+// FindByChecksumInAccount returns the newest file in any of the owner's buckets whose SHA-256
+// checksum matches.
+func (r *Repository) FindByChecksumInAccount(ctx context.Context, ownerID uuid.UUID, checksum string) (Metadata, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Lookup)
+	defer cancel()
+
+	query := `
+SELECT f.id, f.bucket_id, f.object_name, f.original_filename, f.size_bytes, f.content_type, f.checksum, f.created_at, f.updated_at, f.original_created_at
+FROM files f
+JOIN buckets b ON b.id = f.bucket_id
+WHERE b.owner_id = $1 AND f.checksum = $2
+ORDER BY f.created_at DESC
+LIMIT 1;`
+
+	var meta Metadata
+	err := r.db.QueryRow(ctx, query, ownerID, checksum).Scan(
+		&meta.ID,
+		&meta.BucketID,
+		&meta.ObjectName,
+		&meta.OriginalFilename,
+		&meta.SizeBytes,
+		&meta.ContentType,
+		&meta.Checksum,
+		&meta.CreatedAt,
+		&meta.UpdatedAt,
+		&meta.OriginalCreatedAt,
+	)
+	if err != nil {
+		return Metadata{}, metadataError(err, "find file by checksum in account")
+	}
+	return meta, nil
+}
+
+// CountObjectReferences returns how many files point at objectName. Deduplicated files share an
+// object, which may be removed only once this reaches zero.
+func (r *Repository) CountObjectReferences(ctx context.Context, objectName string) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Lookup)
+	defer cancel()
+
+	var refs int64
+	if err := r.db.QueryRow(ctx, `SELECT COUNT(*) FROM files WHERE object_name = $1;`, objectName).Scan(&refs); err != nil {
+		return 0, fmt.Errorf("count object references: %w", err)
+	}
+	return refs, nil
+}
+
+// lockObject takes a transaction-scoped advisory lock on objectName and returns how many files
+// reference it. Creating a file on a shared object and deciding an object's release both hold
+// the lock, so an object is never released between a duplicate being found and its new row
+// being written.
+func lockObject(ctx context.Context, tx pgx.Tx, objectName string) (int64, error) {
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext('files.object_name'), hashtext($1));`, objectName); err != nil {
+		return 0, fmt.Errorf("lock object: %w", err)
+	}
+	var refs int64
+	if err := tx.QueryRow(ctx, `SELECT COUNT(*) FROM files WHERE object_name = $1;`, objectName).Scan(&refs); err != nil {
+		return 0, fmt.Errorf("count object references: %w", err)
+	}
+	return refs, nil
+}
+
+// CreateShared stores metadata for a file reusing an existing object. It returns
+// ErrFileNotFound without inserting when no file references the object any more, as the object
+// is then being or has been removed.
+func (r *Repository) CreateShared(ctx context.Context, meta Metadata) (Metadata, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	var stored Metadata
+	err := storage.WithinTx(ctx, r.db, func(tx pgx.Tx) error {
+		refs, err := lockObject(ctx, tx, meta.ObjectName)
+		if err != nil {
+			return err
+		}
+		if refs == 0 {
+			return ErrFileNotFound
+		}
+		stored, err = NewRepository(tx, r.timeouts).Create(ctx, meta)
+		return err
+	})
+	return stored, err
+}
+
+// ReleaseObject reports whether no file references objectName any more. The count is taken
+// under the object's lock, so it waits for a file being created on the object to commit; once it
+// reports true no file can come to share the object, and the caller removes it afterwards
+// without holding the lock.
+func (r *Repository) ReleaseObject(ctx context.Context, objectName string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	var refs int64
+	err := storage.WithinTx(ctx, r.db, func(tx pgx.Tx) error {
+		var err error
+		refs, err = lockObject(ctx, tx, objectName)
+		return err
+	})
+	return err == nil && refs == 0, err
+}
+
+// ObjectOwnedBy reports whether objectName, created under homeBucketID's prefix, is referenced
+// by files of ownerID and of no other owner, and its home bucket, if it still exists, belongs to
+// ownerID.
+func (r *Repository) ObjectOwnedBy(ctx context.Context, ownerID, homeBucketID uuid.UUID, objectName string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Lookup)
+	defer cancel()
+
+	query := `
+SELECT EXISTS (
+           SELECT 1 FROM files f JOIN buckets b ON b.id = f.bucket_id
+           WHERE f.object_name = $1 AND b.owner_id = $2)
+   AND NOT EXISTS (
+           SELECT 1 FROM files f JOIN buckets b ON b.id = f.bucket_id
+           WHERE f.object_name = $1 AND b.owner_id <> $2)
+   AND NOT EXISTS (SELECT 1 FROM buckets WHERE id = $3 AND owner_id <> $2);`
+
+	var owned bool
+	if err := r.db.QueryRow(ctx, query, objectName, ownerID, homeBucketID).Scan(&owned); err != nil {
+		return false, fmt.Errorf("check object owner: %w", err)
+	}
+	return owned, nil
+}
+
+// GetMany fetches metadata for the given file IDs within a bucket. Callers are expected to
+// have verified bucket ownership; missing IDs are simply absent from the result.
+func (r *Repository) GetMany(ctx context.Context, bucketID uuid.UUID, fileIDs []uuid.UUID) ([]Metadata, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.List)
+	defer cancel()
+
+	query := `
+SELECT id, bucket_id, object_name, original_filename, size_bytes, content_type, checksum, created_at, updated_at, original_created_at
+FROM files
+WHERE bucket_id = $1 AND id = ANY($2);`
+
+	rows, err := r.db.Query(ctx, query, bucketID, fileIDs)
+	if err != nil {
+		return nil, fmt.Errorf("get file metadata batch: %w", err)
+	}
+	defer rows.Close()
+
+	var files []Metadata
+	for rows.Next() {
+		var meta Metadata
+		if err := rows.Scan(
+			&meta.ID,
+			&meta.BucketID,
+			&meta.ObjectName,
+			&meta.OriginalFilename,
+			&meta.SizeBytes,
+			&meta.ContentType,
+			&meta.Checksum,
+			&meta.CreatedAt,
+			&meta.UpdatedAt,
+			&meta.OriginalCreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("scan file metadata: %w", err)
+		}
+		files = append(files, meta)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate file metadata: %w", err)
+	}
+	return files, nil
+}
+
+// ExistsByName reports whether the bucket already holds a file with the given original filename.
+func (r *Repository) ExistsByName(ctx context.Context, bucketID uuid.UUID, filename string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Lookup)
+	defer cancel()
+
+	query := `SELECT EXISTS (SELECT 1 FROM files WHERE bucket_id = $1 AND original_filename = $2);`
+
+	var exists bool
+	if err := r.db.QueryRow(ctx, query, bucketID, filename).Scan(&exists); err != nil {
+		return false, fmt.Errorf("check file name: %w", err)
+	}
+	return exists, nil
+}
+
+// ReserveIdempotencyKey claims key for an upload that is about to be stored, until expiresAt.
+// An expired entry is taken over. When the key is held by another upload, reserved is false and
+// fileID is the file it recorded, or uuid.Nil while that upload is still in progress.
+func (r *Repository) ReserveIdempotencyKey(ctx context.Context, bucketID uuid.UUID, key string, expiresAt time.Time) (uuid.UUID, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	reserve := `
+INSERT INTO idempotency_keys (bucket_id, key, file_id, expires_at)
+VALUES ($1, $2, NULL, $3)
+ON CONFLICT (bucket_id, key) DO UPDATE
+SET file_id = NULL, created_at = NOW(), expires_at = EXCLUDED.expires_at
+WHERE idempotency_keys.expires_at <= NOW()
+RETURNING true;`
+
+	var reserved bool
+	err := r.db.QueryRow(ctx, reserve, bucketID, key, expiresAt).Scan(&reserved)
+	if err == nil {
+		return uuid.Nil, true, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return uuid.Nil, false, fmt.Errorf("reserve idempotency key: %w", err)
+	}
+
+	var fileID *uuid.UUID
+	lookup := `SELECT file_id FROM idempotency_keys WHERE bucket_id = $1 AND key = $2;`
+	if err := r.db.QueryRow(ctx, lookup, bucketID, key).Scan(&fileID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			// The holder released the key between the two statements; the caller may retry.
+			return uuid.Nil, false, nil
+		}
+		return uuid.Nil, false, fmt.Errorf("find idempotency key: %w", err)
+	}
+	if fileID == nil {
+		return uuid.Nil, false, nil
+	}
+	return *fileID, false, nil
+}
+
+// CompleteIdempotencyKey records the file stored under a reserved key and keeps the key until
+// expiresAt.
+func (r *Repository) CompleteIdempotencyKey(ctx context.Context, bucketID uuid.UUID, key string, fileID uuid.UUID, expiresAt time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	query := `
+UPDATE idempotency_keys
+SET file_id = $3, expires_at = $4
+WHERE bucket_id = $1 AND key = $2 AND file_id IS NULL;`
+
+	if _, err := r.db.Exec(ctx, query, bucketID, key, fileID, expiresAt); err != nil {
+		return fmt.Errorf("complete idempotency key: %w", err)
+	}
+	return nil
+}
+
+// ReleaseIdempotencyKey drops a reservation whose upload failed, so the key can be retried.
+// Keys that already record a file are left alone.
+func (r *Repository) ReleaseIdempotencyKey(ctx context.Context, bucketID uuid.UUID, key string) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	query := `DELETE FROM idempotency_keys WHERE bucket_id = $1 AND key = $2 AND file_id IS NULL;`
+	if _, err := r.db.Exec(ctx, query, bucketID, key); err != nil {
+		return fmt.Errorf("release idempotency key: %w", err)
+	}
+	return nil
+}
+
+// PurgeExpiredIdempotencyKeys deletes every expired key and reports how many were removed.
+func (r *Repository) PurgeExpiredIdempotencyKeys(ctx context.Context) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	tag, err := r.db.Exec(ctx, `DELETE FROM idempotency_keys WHERE expires_at <= NOW();`)
+	if err != nil {
+		return 0, fmt.Errorf("purge idempotency keys: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// GetPublic fetches metadata for a file whose bucket is marked public. Files in private buckets
+// are reported as ErrFileNotFound so the public route cannot probe for them. The bucket's owner is
+// returned alongside so the object can be located in the owner's storage bucket.
+func (r *Repository) GetPublic(ctx context.Context, bucketID, fileID uuid.UUID) (Metadata, uuid.UUID, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Lookup)
+	defer cancel()
+
+	query := `
+SELECT f.id, f.bucket_id, f.object_name, f.original_filename, f.size_bytes, f.content_type, f.checksum, f.created_at, f.updated_at, f.original_created_at, b.owner_id
+FROM files f
+JOIN buckets b ON b.id = f.bucket_id
+WHERE f.id = $1 AND f.bucket_id = $2 AND b.is_public;`
+
+	var (
+		meta    Metadata
+		ownerID uuid.UUID
+	)
+	err := r.db.QueryRow(ctx, query, fileID, bucketID).Scan(
+		&meta.ID,
+		&meta.BucketID,
+		&meta.ObjectName,
+		&meta.OriginalFilename,
+		&meta.SizeBytes,
+		&meta.ContentType,
+		&meta.Checksum,
+		&meta.CreatedAt,
+		&meta.UpdatedAt,
+		&meta.OriginalCreatedAt,
+		&ownerID,
+	)
+	if err != nil {
+		return Metadata{}, uuid.Nil, metadataError(err, "get public file metadata")
+	}
+	return meta, ownerID, nil
+}
+
+// Delete removes metadata and returns the deleted record. The file is taken off its bucket's
+// usage in the same transaction, so the counters cannot drift if later cleanup fails.
 func (r *Repository) Delete(ctx context.Context, ownerID, bucketID, fileID uuid.UUID) (Metadata, error) {
-	ctx, cancel := context.WithTimeout(ctx, repoTimeout)
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Write)
 	defer cancel()
 
 	query := `
@@ -126,10 +501,62 @@ WHERE f.id = $1
   AND f.bucket_id = $2
   AND b.id = f.bucket_id
   AND b.owner_id = $3
-RETURNING f.id, f.bucket_id, f.object_name, f.original_filename, f.size_bytes, f.content_type, f.checksum, f.created_at, f.updated_at;`
+RETURNING f.id, f.bucket_id, f.object_name, f.original_filename, f.size_bytes, f.content_type, f.checksum, f.created_at, f.updated_at, f.original_created_at;`
+
+	usageQuery := `
+INSERT INTO bucket_usage (bucket_id, total_bytes, file_count, updated_at)
+VALUES ($1, $2, -1, NOW())
+ON CONFLICT (bucket_id)
+DO UPDATE SET
+    total_bytes = GREATEST(bucket_usage.total_bytes + EXCLUDED.total_bytes, 0),
+    file_count  = GREATEST(bucket_usage.file_count + EXCLUDED.file_count, 0),
+    updated_at  = NOW();`
 
 	var meta Metadata
-	err := r.pool.QueryRow(ctx, query, fileID, bucketID, ownerID).Scan(
+	err := storage.WithinTx(ctx, r.db, func(tx pgx.Tx) error {
+		err := tx.QueryRow(ctx, query, fileID, bucketID, ownerID).Scan(
+			&meta.ID,
+			&meta.BucketID,
+			&meta.ObjectName,
+			&meta.OriginalFilename,
+			&meta.SizeBytes,
+			&meta.ContentType,
+			&meta.Checksum,
+			&meta.CreatedAt,
+			&meta.UpdatedAt,
+			&meta.OriginalCreatedAt,
+		)
+		if err != nil {
+			return metadataError(err, "delete file metadata")
+		}
+		if _, err := tx.Exec(ctx, usageQuery, bucketID, -meta.SizeBytes); err != nil {
+			return fmt.Errorf("update usage: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return Metadata{}, err
+	}
+	return meta, nil
+}
+
+// UpdateChecksum replaces the stored checksum for a file and returns the updated record.
+func (r *Repository) UpdateChecksum(ctx context.Context, ownerID, bucketID, fileID uuid.UUID, checksum string) (Metadata, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	query := `
+UPDATE files f
+SET checksum = $4, updated_at = NOW()
+FROM buckets b
+WHERE f.id = $1
+  AND f.bucket_id = $2
+  AND b.id = f.bucket_id
+  AND b.owner_id = $3
+RETURNING f.id, f.bucket_id, f.object_name, f.original_filename, f.size_bytes, f.content_type, f.checksum, f.created_at, f.updated_at, f.original_created_at;`
+
+	var meta Metadata
+	err := r.db.QueryRow(ctx, query, fileID, bucketID, ownerID, checksum).Scan(
 		&meta.ID,
 		&meta.BucketID,
 		&meta.ObjectName,
@@ -139,24 +566,230 @@ RETURNING f.id, f.bucket_id, f.object_name, f.original_filename, f.size_bytes, f
 		&meta.Checksum,
 		&meta.CreatedAt,
 		&meta.UpdatedAt,
+		&meta.OriginalCreatedAt,
 	)
 	if err != nil {
-		if err == pgx.ErrNoRows {
-			return Metadata{}, ErrFileNotFound
+		return Metadata{}, metadataError(err, "update file checksum")
+	}
+	return meta, nil
+}
+
+// SetChecksumIfEmpty stores checksum for a file recorded without one and returns the updated
+// record. It reports false, changing nothing, when the file is gone or a checksum was stored in
+// the meantime, so a background backfill never overwrites one computed from newer content.
+func (r *Repository) SetChecksumIfEmpty(ctx context.Context, ownerID, bucketID, fileID uuid.UUID, checksum string) (Metadata, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	query := `
+UPDATE files f
+SET checksum = $4, updated_at = NOW()
+FROM buckets b
+WHERE f.id = $1
+  AND f.bucket_id = $2
+  AND b.id = f.bucket_id
+  AND b.owner_id = $3
+  AND COALESCE(f.checksum, '') = ''
+RETURNING f.id, f.bucket_id, f.object_name, f.original_filename, f.size_bytes, f.content_type, f.checksum, f.created_at, f.updated_at, f.original_created_at;`
+
+	var meta Metadata
+	err := r.db.QueryRow(ctx, query, fileID, bucketID, ownerID, checksum).Scan(
+		&meta.ID,
+		&meta.BucketID,
+		&meta.ObjectName,
+		&meta.OriginalFilename,
+		&meta.SizeBytes,
+		&meta.ContentType,
+		&meta.Checksum,
+		&meta.CreatedAt,
+		&meta.UpdatedAt,
+		&meta.OriginalCreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Metadata{}, false, nil
 		}
-		return Metadata{}, fmt.Errorf("delete file metadata: %w", err)
+		return Metadata{}, false, fmt.Errorf("set file checksum: %w", err)
+	}
+	return meta, true, nil
+}
+
+// ListUnhashed returns up to limit files with no stored checksum and an ID greater than after, in
+// ID order, so a caller can walk every such file in batches even if some cannot be hashed.
+func (r *Repository) ListUnhashed(ctx context.Context, after uuid.UUID, limit int) ([]UnhashedFile, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.List)
+	defer cancel()
+
+	query := `
+SELECT f.id, f.bucket_id, f.object_name, f.original_filename, f.size_bytes, f.content_type, f.created_at, f.updated_at, f.original_created_at, b.owner_id
+FROM files f
+JOIN buckets b ON b.id = f.bucket_id
+WHERE COALESCE(f.checksum, '') = '' AND f.id > $1
+ORDER BY f.id
+LIMIT $2;`
+
+	rows, err := r.db.Query(ctx, query, after, limit)
+	if err != nil {
+		return nil, fmt.Errorf("list unhashed files: %w", err)
+	}
+	defer rows.Close()
+
+	var files []UnhashedFile
+	for rows.Next() {
+		var file UnhashedFile
+		if err := rows.Scan(
+			&file.ID,
+			&file.BucketID,
+			&file.ObjectName,
+			&file.OriginalFilename,
+			&file.SizeBytes,
+			&file.ContentType,
+			&file.CreatedAt,
+			&file.UpdatedAt,
+			&file.OriginalCreatedAt,
+			&file.OwnerID,
+		); err != nil {
+			return nil, fmt.Errorf("scan unhashed file: %w", err)
+		}
+		files = append(files, file)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate unhashed files: %w", err)
+	}
+	return files, nil
+}
+
+// UpdateContent records a replaced object's size and checksum and shifts the bucket's usage by
+// the size difference in the same transaction. The previous size is read from the locked row, so
+// concurrent commits cannot apply a stale delta.
+func (r *Repository) UpdateContent(ctx context.Context, ownerID, bucketID, fileID uuid.UUID, sizeBytes int64, checksum string) (Metadata, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	query := `
+UPDATE files f
+SET size_bytes = $4, checksum = $5, updated_at = NOW()
+FROM buckets b, (SELECT id, size_bytes FROM files WHERE id = $1 AND bucket_id = $2 FOR UPDATE) old
+WHERE f.id = old.id
+  AND b.id = f.bucket_id
+  AND b.owner_id = $3
+RETURNING f.id, f.bucket_id, f.object_name, f.original_filename, f.size_bytes, f.content_type, f.checksum, f.created_at, f.updated_at, f.original_created_at, f.size_bytes - old.size_bytes;`
+
+	usageQuery := `
+INSERT INTO bucket_usage (bucket_id, total_bytes, file_count, updated_at)
+VALUES ($1, $2, 0, NOW())
+ON CONFLICT (bucket_id)
+DO UPDATE SET
+    total_bytes = GREATEST(bucket_usage.total_bytes + EXCLUDED.total_bytes, 0),
+    updated_at  = NOW();`
+
+	var meta Metadata
+	err := storage.WithinTx(ctx, r.db, func(tx pgx.Tx) error {
+		var delta int64
+		err := tx.QueryRow(ctx, query, fileID, bucketID, ownerID, sizeBytes, checksum).Scan(
+			&meta.ID,
+			&meta.BucketID,
+			&meta.ObjectName,
+			&meta.OriginalFilename,
+			&meta.SizeBytes,
+			&meta.ContentType,
+			&meta.Checksum,
+			&meta.CreatedAt,
+			&meta.UpdatedAt,
+			&meta.OriginalCreatedAt,
+			&delta,
+		)
+		if err != nil {
+			return metadataError(err, "update file content")
+		}
+		if delta == 0 {
+			return nil
+		}
+		if _, err := tx.Exec(ctx, usageQuery, bucketID, delta); err != nil {
+			return fmt.Errorf("update usage: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return Metadata{}, err
 	}
 	return meta, nil
 }
 
-// ListObjectsForBucket returns object names for external cleanup.
+// MoveFiles reassigns files from sourceID to targetID in one transaction and shifts their bytes
+// and count between the two buckets' usage, so usage cannot drift from the files table. If any
+// file is no longer in the source bucket the whole move is rolled back with ErrFileNotFound.
+func (r *Repository) MoveFiles(ctx context.Context, sourceID, targetID uuid.UUID, moves []ObjectMove) ([]Metadata, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	query := `
+UPDATE files
+SET bucket_id = $1, object_name = $2, updated_at = NOW()
+WHERE id = $3 AND bucket_id = $4
+RETURNING id, bucket_id, object_name, original_filename, size_bytes, content_type, checksum, created_at, updated_at, original_created_at;`
+
+	usageQuery := `
+INSERT INTO bucket_usage (bucket_id, total_bytes, file_count, updated_at)
+VALUES ($1, $2, $3, NOW())
+ON CONFLICT (bucket_id)
+DO UPDATE SET
+    total_bytes = GREATEST(bucket_usage.total_bytes + EXCLUDED.total_bytes, 0),
+    file_count  = GREATEST(bucket_usage.file_count + EXCLUDED.file_count, 0),
+    updated_at  = NOW();`
+
+	moved := make([]Metadata, 0, len(moves))
+	err := storage.WithinTx(ctx, r.db, func(tx pgx.Tx) error {
+		var totalBytes int64
+		for _, move := range moves {
+			var meta Metadata
+			err := tx.QueryRow(ctx, query, targetID, move.NewObjectName, move.FileID, sourceID).Scan(
+				&meta.ID,
+				&meta.BucketID,
+				&meta.ObjectName,
+				&meta.OriginalFilename,
+				&meta.SizeBytes,
+				&meta.ContentType,
+				&meta.Checksum,
+				&meta.CreatedAt,
+				&meta.UpdatedAt,
+				&meta.OriginalCreatedAt,
+			)
+			if err != nil {
+				return metadataError(err, "move file metadata")
+			}
+			totalBytes += meta.SizeBytes
+			moved = append(moved, meta)
+		}
+
+		count := int64(len(moved))
+		if _, err := tx.Exec(ctx, usageQuery, sourceID, -totalBytes, -count); err != nil {
+			return fmt.Errorf("update source usage: %w", err)
+		}
+		if _, err := tx.Exec(ctx, usageQuery, targetID, totalBytes, count); err != nil {
+			return fmt.Errorf("update target usage: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return moved, nil
+}
+
+// ListObjectsForBucket returns object names for external cleanup, once each. Objects that a
+// deduplicated file in another bucket still references are left out so they survive the bucket.
 func (r *Repository) ListObjectsForBucket(ctx context.Context, bucketID uuid.UUID) ([]bucket.FileObject, error) {
-	ctx, cancel := context.WithTimeout(ctx, repoTimeout)
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.List)
 	defer cancel()
 
-	query := `SELECT object_name, size_bytes FROM files WHERE bucket_id = $1;`
+	query := `
+SELECT DISTINCT ON (f.object_name) f.object_name, f.size_bytes
+FROM files f
+WHERE f.bucket_id = $1
+  AND NOT EXISTS (SELECT 1 FROM files o WHERE o.object_name = f.object_name AND o.bucket_id <> f.bucket_id);`
 
-	rows, err := r.pool.Query(ctx, query, bucketID)
+	rows, err := r.db.Query(ctx, query, bucketID)
 	if err != nil {
 		return nil, fmt.Errorf("list objects for bucket: %w", err)
 	}
@@ -168,6 +801,10 @@ func (r *Repository) ListObjectsForBucket(ctx context.Context, bucketID uuid.UUI
 		if err := rows.Scan(&obj.ObjectName, &obj.SizeBytes); err != nil {
 			return nil, fmt.Errorf("scan object name: %w", err)
 		}
+		if !objectBelongsToBucket(obj.ObjectName, bucketID) {
+			// never hand out another bucket's objects for cleanup
+			continue
+		}
 		objects = append(objects, obj)
 	}
 	if err := rows.Err(); err != nil {
@@ -0,0 +1,22 @@
+package file
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func TestMetadataErrorMapsWrappedNoRows(t *testing.T) {
+	wrapped := fmt.Errorf("scan file row: %w", pgx.ErrNoRows)
+	if err := metadataError(wrapped, "get file metadata"); err != ErrFileNotFound {
+		t.Fatalf("expected ErrFileNotFound for a wrapped no-rows error, got %v", err)
+	}
+
+	failure := errors.New("connection reset")
+	err := metadataError(failure, "get file metadata")
+	if !errors.Is(err, failure) || err.Error() != "get file metadata: connection reset" {
+		t.Fatalf("expected other errors to be annotated and wrapped, got %v", err)
+	}
+}
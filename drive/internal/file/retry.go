@@ -0,0 +1,69 @@
+package file
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// RetryPolicy bounds how often a transient storage failure is retried. Attempts counts the
+// first try; the wait before retry n is Backoff * 2^(n-1).
+type RetryPolicy struct {
+	Attempts int
+	Backoff  time.Duration
+}
+
+// DefaultRetryPolicy is applied by NewMinIOStore.
+var DefaultRetryPolicy = RetryPolicy{Attempts: 3, Backoff: 200 * time.Millisecond}
+
+// do runs fn until it succeeds, returns a non-retryable error, or attempts run out.
+func (p RetryPolicy) do(ctx context.Context, fn func() error) error {
+	attempts := p.Attempts
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = fn(); err == nil || attempt >= attempts || !retryable(err) {
+			return err
+		}
+
+		timer := time.NewTimer(p.Backoff << (attempt - 1))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// retryable reports whether err is a transient network or server failure. Client errors such
+// as missing objects or denied access are returned immediately.
+func retryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	resp := minio.ToErrorResponse(err)
+	switch resp.Code {
+	case "RequestTimeout", "SlowDown", "InternalError", "ServiceUnavailable":
+		return true
+	}
+	return resp.StatusCode >= http.StatusInternalServerError
+}
@@ -0,0 +1,193 @@
+package file
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/minio/minio-go/v7"
+)
+
+// s3API is the subset of *s3.Client used by S3Store.
+type s3API interface {
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+	HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
+	DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error)
+	CopyObject(ctx context.Context, params *s3.CopyObjectInput, optFns ...func(*s3.Options)) (*s3.CopyObjectOutput, error)
+	HeadBucket(ctx context.Context, params *s3.HeadBucketInput, optFns ...func(*s3.Options)) (*s3.HeadBucketOutput, error)
+	ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error)
+}
+
+// s3Presigner is the subset of *s3.PresignClient used by S3Store.
+type s3Presigner interface {
+	PresignGetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.PresignOptions)) (*v4.PresignedHTTPRequest, error)
+	PresignPutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.PresignOptions)) (*v4.PresignedHTTPRequest, error)
+}
+
+// S3Store adapts the AWS SDK S3 client to the objectStore interface and presigned URL signing.
+type S3Store struct {
+	client    s3API
+	presigner s3Presigner
+	bucket    string
+}
+
+var _ objectStore = (*S3Store)(nil)
+
+// NewS3Store constructs an adapter; bucket is the default bucket used for health checks.
+func NewS3Store(client *s3.Client, bucket string) *S3Store {
+	return &S3Store{client: client, presigner: s3.NewPresignClient(client), bucket: bucket}
+}
+
+// PutObject uploads the reader's contents. Upload bodies are streamed rather than seekable, so the
+// payload is sent unsigned and relies on TLS for integrity.
+func (s *S3Store) PutObject(ctx context.Context, bucketName, objectName string, reader io.Reader, objectSize int64, opts minio.PutObjectOptions) (minio.UploadInfo, error) {
+	input := &s3.PutObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(objectName),
+		Body:   reader,
+	}
+	if objectSize >= 0 {
+		input.ContentLength = aws.Int64(objectSize)
+	}
+	if opts.ContentType != "" {
+		input.ContentType = aws.String(opts.ContentType)
+	}
+	if len(opts.UserMetadata) > 0 {
+		input.Metadata = opts.UserMetadata
+	}
+
+	out, err := s.client.PutObject(ctx, input, s3.WithAPIOptions(v4.SwapComputePayloadSHA256ForUnsignedPayloadMiddleware))
+	if err != nil {
+		return minio.UploadInfo{}, err
+	}
+
+	return minio.UploadInfo{
+		Bucket: bucketName,
+		Key:    objectName,
+		ETag:   aws.ToString(out.ETag),
+		Size:   objectSize,
+	}, nil
+}
+
+// GetObject opens the object, honoring a byte range set with opts.SetRange.
+func (s *S3Store) GetObject(ctx context.Context, bucketName, objectName string, opts minio.GetObjectOptions) (io.ReadCloser, error) {
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(objectName),
+	}
+	if rng := opts.Header().Get("Range"); rng != "" {
+		input.Range = aws.String(rng)
+	}
+	out, err := s.client.GetObject(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	return out.Body, nil
+}
+
+// StatObject returns the object's size and content type from a HEAD request.
+func (s *S3Store) StatObject(ctx context.Context, bucketName, objectName string) (minio.ObjectInfo, error) {
+	out, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(objectName),
+	})
+	if err != nil {
+		return minio.ObjectInfo{}, err
+	}
+	return minio.ObjectInfo{
+		Key:         objectName,
+		ETag:        aws.ToString(out.ETag),
+		Size:        aws.ToInt64(out.ContentLength),
+		ContentType: aws.ToString(out.ContentType),
+	}, nil
+}
+
+func (s *S3Store) RemoveObject(ctx context.Context, bucketName, objectName string, opts minio.RemoveObjectOptions) error {
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(objectName),
+	})
+	return err
+}
+
+// CopyObject duplicates srcObject as dstObject within the bucket on the server side.
+func (s *S3Store) CopyObject(ctx context.Context, bucketName, srcObject, dstObject string) error {
+	source := (&url.URL{Path: bucketName + "/" + srcObject}).EscapedPath()
+	_, err := s.client.CopyObject(ctx, &s3.CopyObjectInput{
+		Bucket:     aws.String(bucketName),
+		Key:        aws.String(dstObject),
+		CopySource: aws.String(source),
+	})
+	return err
+}
+
+// ListObjects returns every object under prefix, following continuation tokens.
+func (s *S3Store) ListObjects(ctx context.Context, bucketName, prefix string) ([]minio.ObjectInfo, error) {
+	var objects []minio.ObjectInfo
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucketName),
+		Prefix: aws.String(prefix),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range page.Contents {
+			objects = append(objects, minio.ObjectInfo{
+				Key:          aws.ToString(obj.Key),
+				Size:         aws.ToInt64(obj.Size),
+				ETag:         aws.ToString(obj.ETag),
+				LastModified: aws.ToTime(obj.LastModified),
+			})
+		}
+	}
+	return objects, nil
+}
+
+// PresignedGetObject returns a time-limited download URL. Supported reqParams are
+// response-content-type and response-content-disposition.
+func (s *S3Store) PresignedGetObject(ctx context.Context, bucketName, objectName string, expires time.Duration, reqParams url.Values) (*url.URL, error) {
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(objectName),
+	}
+	if v := reqParams.Get("response-content-type"); v != "" {
+		input.ResponseContentType = aws.String(v)
+	}
+	if v := reqParams.Get("response-content-disposition"); v != "" {
+		input.ResponseContentDisposition = aws.String(v)
+	}
+
+	req, err := s.presigner.PresignGetObject(ctx, input, s3.WithPresignExpires(expires))
+	if err != nil {
+		return nil, err
+	}
+	return url.Parse(req.URL)
+}
+
+// PresignedPutObject returns a time-limited upload URL.
+func (s *S3Store) PresignedPutObject(ctx context.Context, bucketName, objectName string, expires time.Duration) (*url.URL, error) {
+	req, err := s.presigner.PresignPutObject(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(objectName),
+	}, s3.WithPresignExpires(expires))
+	if err != nil {
+		return nil, err
+	}
+	return url.Parse(req.URL)
+}
+
+// Ping verifies the configured bucket is reachable.
+func (s *S3Store) Ping(ctx context.Context) error {
+	if _, err := s.client.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: aws.String(s.bucket)}); err != nil {
+		return fmt.Errorf("head bucket %q: %w", s.bucket, err)
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package file
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/minio/minio-go/v7"
+)
+
+func TestS3StoreMapsObjectOperations(t *testing.T) {
+	client := &fakeS3Client{objects: map[string][]byte{}}
+	store := &S3Store{client: client, presigner: &fakeS3Presigner{}, bucket: "godrive"}
+	ctx := context.Background()
+
+	info, err := store.PutObject(ctx, "godrive", "b/f", strings.NewReader("payload"), 7, minio.PutObjectOptions{ContentType: "text/plain"})
+	if err != nil {
+		t.Fatalf("PutObject returned error: %v", err)
+	}
+	if info.Size != 7 || info.ETag != "etag" {
+		t.Fatalf("unexpected upload info: %+v", info)
+	}
+	if got := aws.ToString(client.lastPut.ContentType); got != "text/plain" {
+		t.Fatalf("expected content type to be forwarded, got %q", got)
+	}
+	if got := aws.ToInt64(client.lastPut.ContentLength); got != 7 {
+		t.Fatalf("expected content length 7, got %d", got)
+	}
+
+	reader, err := store.GetObject(ctx, "godrive", "b/f", minio.GetObjectOptions{})
+	if err != nil {
+		t.Fatalf("GetObject returned error: %v", err)
+	}
+	data, _ := io.ReadAll(reader)
+	reader.Close()
+	if string(data) != "payload" {
+		t.Fatalf("unexpected object body %q", data)
+	}
+
+	if err := store.RemoveObject(ctx, "godrive", "b/f", minio.RemoveObjectOptions{}); err != nil {
+		t.Fatalf("RemoveObject returned error: %v", err)
+	}
+	if _, ok := client.objects["godrive/b/f"]; ok {
+		t.Fatalf("expected object to be deleted")
+	}
+
+	if err := store.Ping(ctx); err != nil {
+		t.Fatalf("Ping returned error: %v", err)
+	}
+}
+
+func TestS3StorePresignsWithExpiry(t *testing.T) {
+	presigner := &fakeS3Presigner{}
+	store := &S3Store{client: &fakeS3Client{}, presigner: presigner, bucket: "godrive"}
+
+	params := url.Values{"response-content-disposition": {"attachment"}}
+	signed, err := store.PresignedGetObject(context.Background(), "godrive", "b/f", 10*time.Minute, params)
+	if err != nil {
+		t.Fatalf("PresignedGetObject returned error: %v", err)
+	}
+	if signed.Host != "s3.example.com" {
+		t.Fatalf("unexpected presigned URL %s", signed)
+	}
+	if presigner.lastExpires != 10*time.Minute {
+		t.Fatalf("expected expiry to be forwarded, got %s", presigner.lastExpires)
+	}
+	if got := aws.ToString(presigner.lastGet.ResponseContentDisposition); got != "attachment" {
+		t.Fatalf("expected content disposition override, got %q", got)
+	}
+}
+
+type fakeS3Client struct {
+	objects map[string][]byte
+	lastPut *s3.PutObjectInput
+}
+
+func (f *fakeS3Client) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	data, err := io.ReadAll(params.Body)
+	if err != nil {
+		return nil, err
+	}
+	f.lastPut = params
+	f.objects[aws.ToString(params.Bucket)+"/"+aws.ToString(params.Key)] = data
+	return &s3.PutObjectOutput{ETag: aws.String("etag")}, nil
+}
+
+func (f *fakeS3Client) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	data := f.objects[aws.ToString(params.Bucket)+"/"+aws.ToString(params.Key)]
+	return &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(data))}, nil
+}
+
+func (f *fakeS3Client) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	data, ok := f.objects[aws.ToString(params.Bucket)+"/"+aws.ToString(params.Key)]
+	if !ok {
+		return nil, fmt.Errorf("object %s not found", aws.ToString(params.Key))
+	}
+	return &s3.HeadObjectOutput{ContentLength: aws.Int64(int64(len(data)))}, nil
+}
+
+func (f *fakeS3Client) DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	delete(f.objects, aws.ToString(params.Bucket)+"/"+aws.ToString(params.Key))
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+func (f *fakeS3Client) CopyObject(ctx context.Context, params *s3.CopyObjectInput, optFns ...func(*s3.Options)) (*s3.CopyObjectOutput, error) {
+	return &s3.CopyObjectOutput{}, nil
+}
+
+func (f *fakeS3Client) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	return &s3.ListObjectsV2Output{}, nil
+}
+
+func (f *fakeS3Client) HeadBucket(ctx context.Context, params *s3.HeadBucketInput, optFns ...func(*s3.Options)) (*s3.HeadBucketOutput, error) {
+	return &s3.HeadBucketOutput{}, nil
+}
+
+type fakeS3Presigner struct {
+	lastGet     *s3.GetObjectInput
+	lastExpires time.Duration
+}
+
+func (f *fakeS3Presigner) PresignGetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.PresignOptions)) (*v4.PresignedHTTPRequest, error) {
+	f.lastGet = params
+	f.lastExpires = presignExpiry(optFns)
+	return &v4.PresignedHTTPRequest{URL: "https://s3.example.com/" + aws.ToString(params.Key) + "?X-Amz-Signature=abc", Method: "GET"}, nil
+}
+
+func (f *fakeS3Presigner) PresignPutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.PresignOptions)) (*v4.PresignedHTTPRequest, error) {
+	f.lastExpires = presignExpiry(optFns)
+	return &v4.PresignedHTTPRequest{URL: "https://s3.example.com/" + aws.ToString(params.Key), Method: "PUT"}, nil
+}
+
+func presignExpiry(optFns []func(*s3.PresignOptions)) time.Duration {
+	var opts s3.PresignOptions
+	for _, fn := range optFns {
+		fn(&opts)
+	}
+	return opts.Expires
+}
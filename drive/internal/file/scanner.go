@@ -0,0 +1,116 @@
+package file
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// Scanner inspects uploaded content before it becomes available, e.g. by forwarding it to
+// ClamAV or an external malware scanning service. Scan reports clean=false with a short reason
+// for content that must be rejected; scanners that fail to reach a verdict should also reject.
+type Scanner interface {
+	Scan(ctx context.Context, reader io.Reader) (clean bool, reason string)
+}
+
+// NoopScanner accepts all content. It is the default when no scanner is configured.
+type NoopScanner struct{}
+
+// Scan implements Scanner.
+func (NoopScanner) Scan(ctx context.Context, reader io.Reader) (bool, string) {
+	return true, ""
+}
+
+// clamdChunkSize is how many bytes ClamAVScanner sends per INSTREAM chunk. clamd's default
+// StreamMaxLength is far larger; the chunk size only bounds the buffer.
+const clamdChunkSize = 64 << 10
+
+// defaultClamAVTimeout bounds a whole scan when no timeout is configured.
+const defaultClamAVTimeout = 5 * time.Minute
+
+// ClamAVScanner streams uploads to a clamd daemon over its INSTREAM command. Content clamd
+// cannot scan, for example because it is unreachable or the stream exceeds its limits, is
+// rejected.
+type ClamAVScanner struct {
+	network string
+	address string
+	timeout time.Duration
+}
+
+// NewClamAVScanner scans against clamd at address, either "host:port" or a unix socket path.
+// timeout bounds each scan; non-positive values use five minutes.
+func NewClamAVScanner(address string, timeout time.Duration) *ClamAVScanner {
+	if timeout <= 0 {
+		timeout = defaultClamAVTimeout
+	}
+	network := "tcp"
+	if strings.HasPrefix(address, "/") {
+		network = "unix"
+	}
+	return &ClamAVScanner{network: network, address: address, timeout: timeout}
+}
+
+// Scan implements Scanner.
+func (c *ClamAVScanner) Scan(ctx context.Context, reader io.Reader) (bool, string) {
+	verdict, err := c.scan(ctx, reader)
+	if err != nil {
+		return false, "scanner unavailable"
+	}
+	if found, ok := strings.CutSuffix(verdict, " FOUND"); ok {
+		return false, strings.TrimPrefix(found, "stream: ")
+	}
+	if verdict != "stream: OK" {
+		return false, "scan failed"
+	}
+	return true, ""
+}
+
+func (c *ClamAVScanner) scan(ctx context.Context, reader io.Reader) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, c.network, c.address)
+	if err != nil {
+		return "", fmt.Errorf("dial clamd: %w", err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	if _, err := io.WriteString(conn, "zINSTREAM\x00"); err != nil {
+		return "", fmt.Errorf("start stream: %w", err)
+	}
+	buf := make([]byte, 4+clamdChunkSize)
+	for {
+		n, readErr := reader.Read(buf[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(buf[:4], uint32(n))
+			if _, err := conn.Write(buf[:4+n]); err != nil {
+				return "", fmt.Errorf("send chunk: %w", err)
+			}
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return "", fmt.Errorf("read upload: %w", readErr)
+		}
+	}
+	if _, err := conn.Write([]byte{0, 0, 0, 0}); err != nil {
+		return "", fmt.Errorf("end stream: %w", err)
+	}
+
+	reply, err := bufio.NewReader(conn).ReadBytes(0)
+	if err != nil {
+		return "", fmt.Errorf("read verdict: %w", err)
+	}
+	return string(bytes.TrimRight(reply, "\x00")), nil
+}
@@ -0,0 +1,69 @@
+package file
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClamAVScannerStreamsUploadsToClamd(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer listener.Close()
+
+	// A minimal clamd: it reads one INSTREAM and flags content containing "EICAR".
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				if cmd, err := r.ReadString(0); err != nil || cmd != "zINSTREAM\x00" {
+					return
+				}
+				var content bytes.Buffer
+				for {
+					var size uint32
+					if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+						return
+					}
+					if size == 0 {
+						break
+					}
+					if _, err := io.CopyN(&content, r, int64(size)); err != nil {
+						return
+					}
+				}
+				if strings.Contains(content.String(), "EICAR") {
+					io.WriteString(conn, "stream: Eicar-Test-Signature FOUND\x00")
+					return
+				}
+				io.WriteString(conn, "stream: OK\x00")
+			}(conn)
+		}
+	}()
+
+	scanner := NewClamAVScanner(listener.Addr().String(), time.Second)
+	if clean, reason := scanner.Scan(context.Background(), strings.NewReader(strings.Repeat("a", 3*clamdChunkSize))); !clean {
+		t.Fatalf("expected clean content to pass, got %q", reason)
+	}
+	if clean, reason := scanner.Scan(context.Background(), strings.NewReader("X5O!P%@AP EICAR")); clean || reason != "Eicar-Test-Signature" {
+		t.Fatalf("expected the signature to be reported, got clean=%v reason=%q", clean, reason)
+	}
+
+	listener.Close()
+	if clean, reason := scanner.Scan(context.Background(), strings.NewReader("data")); clean || reason != "scanner unavailable" {
+		t.Fatalf("expected an unreachable clamd to reject, got clean=%v reason=%q", clean, reason)
+	}
+}
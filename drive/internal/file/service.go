@@ -1,29 +1,65 @@
 package file
 
 import (
+	"bytes"
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"log"
 	"mime/multipart"
 	"strings"
+	"time"
 
+	"github.com/abduss/godrive/internal/audit"
 	"github.com/abduss/godrive/internal/bucket"
+	"github.com/abduss/godrive/internal/events"
+	"github.com/abduss/godrive/internal/storage"
 	"github.com/google/uuid"
 	"github.com/minio/minio-go/v7"
 )
 
 const (
-	defaultMaxFileSize = 100 * 1024 * 1024 // 100MB
+	defaultMaxFileSize    = 100 * 1024 * 1024 // 100MB
+	defaultMaxBatchSize   = 500 * 1024 * 1024 // 500MB
+	defaultIdempotencyTTL = 24 * time.Hour
+	// idempotencyReservationTTL bounds how long an unfinished upload holds its idempotency key,
+	// so a crashed upload does not block retries for the whole TTL.
+	idempotencyReservationTTL = time.Hour
+	// maxCreatedAtSkew tolerates client clocks slightly ahead of ours for OriginalCreatedAt.
+	maxCreatedAtSkew = 5 * time.Minute
 )
 
+// DefaultUploadField is the multipart field name uploads are read from unless configured otherwise.
+const DefaultUploadField = "file"
+
 // Service manages file lifecycle operations.
 type metadataStore interface {
 	Create(ctx context.Context, meta Metadata) (Metadata, error)
-	List(ctx context.Context, ownerID, bucketID uuid.UUID) ([]Metadata, error)
+	List(ctx context.Context, ownerID, bucketID uuid.UUID, opts ListOptions) ([]Metadata, error)
+	StreamList(ctx context.Context, ownerID, bucketID uuid.UUID, fn func(Metadata) error) error
 	Get(ctx context.Context, ownerID, bucketID, fileID uuid.UUID) (Metadata, error)
+	GetMany(ctx context.Context, bucketID uuid.UUID, fileIDs []uuid.UUID) ([]Metadata, error)
+	FindByChecksum(ctx context.Context, ownerID, bucketID uuid.UUID, checksum string) (Metadata, error)
+	FindByChecksumInAccount(ctx context.Context, ownerID uuid.UUID, checksum string) (Metadata, error)
+	CountObjectReferences(ctx context.Context, objectName string) (int64, error)
+	CreateShared(ctx context.Context, meta Metadata) (Metadata, error)
+	ReleaseObject(ctx context.Context, objectName string) (bool, error)
+	ObjectOwnedBy(ctx context.Context, ownerID, homeBucketID uuid.UUID, objectName string) (bool, error)
+	ExistsByName(ctx context.Context, bucketID uuid.UUID, filename string) (bool, error)
+	ReserveIdempotencyKey(ctx context.Context, bucketID uuid.UUID, key string, expiresAt time.Time) (uuid.UUID, bool, error)
+	CompleteIdempotencyKey(ctx context.Context, bucketID uuid.UUID, key string, fileID uuid.UUID, expiresAt time.Time) error
+	ReleaseIdempotencyKey(ctx context.Context, bucketID uuid.UUID, key string) error
+	PurgeExpiredIdempotencyKeys(ctx context.Context) (int64, error)
+	GetPublic(ctx context.Context, bucketID, fileID uuid.UUID) (Metadata, uuid.UUID, error)
 	Delete(ctx context.Context, ownerID, bucketID, fileID uuid.UUID) (Metadata, error)
+	UpdateChecksum(ctx context.Context, ownerID, bucketID, fileID uuid.UUID, checksum string) (Metadata, error)
+	SetChecksumIfEmpty(ctx context.Context, ownerID, bucketID, fileID uuid.UUID, checksum string) (Metadata, bool, error)
+	ListUnhashed(ctx context.Context, after uuid.UUID, limit int) ([]UnhashedFile, error)
+	UpdateContent(ctx context.Context, ownerID, bucketID, fileID uuid.UUID, sizeBytes int64, checksum string) (Metadata, error)
+	MoveFiles(ctx context.Context, sourceID, targetID uuid.UUID, moves []ObjectMove) ([]Metadata, error)
 }
 
 type Service struct {
@@ -32,18 +68,63 @@ type Service struct {
 	objectStore  objectStore
 	objectBucket string
 	maxFileSize  int64
+	maxBatchSize int64
+	maxAccount   int64
+	allowEmpty   bool
+	idemTTL      time.Duration
+	keyLayout    KeyLayout
+	dedup        DedupScope
+	cache        *ObjectCache
+	metaCache    *metadataCache
+	auditor      auditor
+	publisher    publisher
+	scanner      Scanner
+	requireSize  bool
+	uploadFields []string
+	retention    time.Duration
+	tenants      *storage.TenantBuckets
+	replica      string
+	blocklist    contentBlocklist
+	progress     *progressTracker
+	uploadRetry  RetryPolicy
+	presigner    listingPresigner
+	nowFunc      func() time.Time
 }
 
 type bucketStore interface {
 	Get(ctx context.Context, ownerID, bucketID uuid.UUID) (bucket.Bucket, error)
 	UpdateUsage(ctx context.Context, bucketID uuid.UUID, deltaBytes int64, deltaFiles int64) error
 	RecordUsageSnapshot(ctx context.Context, ownerID uuid.UUID) error
+	AggregateUsage(ctx context.Context, ownerID uuid.UUID) (bucket.AccountUsage, error)
+}
+
+// auditor records mutating operations; *audit.Service writes them asynchronously.
+type auditor interface {
+	Record(ctx context.Context, userID uuid.UUID, action, resourceType string, resourceID uuid.UUID, metadata map[string]any)
+}
+
+// publisher announces file lifecycle events; *events.Bus delivers them asynchronously.
+type publisher interface {
+	Publish(ctx context.Context, e events.Event)
+}
+
+// listingPresigner signs download URLs for listed files; *presigned.Service implements it.
+type listingPresigner interface {
+	PresignListing(ctx context.Context, ownerID, bucketID uuid.UUID, files []Metadata, ttl time.Duration) ([]string, time.Time, error)
+}
+
+// objectStater reads object attributes without fetching the body; *MinIOStore and *S3Store
+// implement it.
+type objectStater interface {
+	StatObject(ctx context.Context, bucketName, objectName string) (minio.ObjectInfo, error)
 }
 
 type objectStore interface {
 	PutObject(ctx context.Context, bucketName, objectName string, reader io.Reader, objectSize int64, opts minio.PutObjectOptions) (minio.UploadInfo, error)
 	GetObject(ctx context.Context, bucketName, objectName string, opts minio.GetObjectOptions) (io.ReadCloser, error)
 	RemoveObject(ctx context.Context, bucketName, objectName string, opts minio.RemoveObjectOptions) error
+	CopyObject(ctx context.Context, bucketName, srcObject, dstObject string) error
+	ListObjects(ctx context.Context, bucketName, prefix string) ([]minio.ObjectInfo, error)
 }
 
 // NewService constructs a file service.
@@ -54,128 +135,1283 @@ func NewService(repo metadataStore, buckets bucketStore, store objectStore, obje
 		objectStore:  store,
 		objectBucket: objectBucket,
 		maxFileSize:  defaultMaxFileSize,
+		maxBatchSize: defaultMaxBatchSize,
+		idemTTL:      defaultIdempotencyTTL,
+		keyLayout:    KeyLayoutFlat,
+		scanner:      NoopScanner{},
+		uploadFields: []string{DefaultUploadField},
+		retention:    bucket.DefaultImmutableRetention,
+		dedup:        DedupNone,
+		progress:     newProgressTracker(),
+		nowFunc:      time.Now,
+	}
+}
+
+// SetUploadRetryPolicy sets how often an upload is resent after a transient store failure.
+// The zero policy, the default, sends each upload once.
+func (s *Service) SetUploadRetryPolicy(policy RetryPolicy) {
+	s.uploadRetry = policy
+}
+
+// SetKeyLayout selects how object names are generated for new uploads. Existing objects keep
+// the name stored in their metadata.
+func (s *Service) SetKeyLayout(layout KeyLayout) error {
+	if !layout.valid() {
+		return ErrInvalidKeyLayout
+	}
+	s.keyLayout = layout
+	return nil
+}
+
+// SetPresigner lets listings attach presigned download URLs. Without one, ListWithURLs
+// returns ErrPresignUnavailable.
+func (s *Service) SetPresigner(presigner listingPresigner) {
+	s.presigner = presigner
+}
+
+// SetMaxFileSize overrides the global per-file upload limit. Non-positive values restore the default.
+func (s *Service) SetMaxFileSize(limit int64) {
+	if limit <= 0 {
+		limit = defaultMaxFileSize
+	}
+	s.maxFileSize = limit
+}
+
+// SetMaxBatchSize overrides the aggregate size limit for batch uploads. Non-positive values restore the default.
+func (s *Service) SetMaxBatchSize(limit int64) {
+	if limit <= 0 {
+		limit = defaultMaxBatchSize
+	}
+	s.maxBatchSize = limit
+}
+
+// SetMaxAccountBytes caps the total bytes a user may store across all buckets. Zero or
+// negative values disable the cap.
+func (s *Service) SetMaxAccountBytes(limit int64) {
+	if limit < 0 {
+		limit = 0
+	}
+	s.maxAccount = limit
+}
+
+// SetAllowEmptyFiles controls whether zero-byte uploads are accepted.
+func (s *Service) SetAllowEmptyFiles(allow bool) {
+	s.allowEmpty = allow
+}
+
+// SetIdempotencyTTL controls how long an upload's idempotency key is honored. Non-positive
+// values restore the default.
+func (s *Service) SetIdempotencyTTL(ttl time.Duration) {
+	if ttl <= 0 {
+		ttl = defaultIdempotencyTTL
+	}
+	s.idemTTL = ttl
+}
+
+// SetObjectCache serves small downloads from the given in-memory cache. A nil cache disables it.
+func (s *Service) SetObjectCache(cache *ObjectCache) {
+	s.cache = cache
+}
+
+// SetMetadataCacheTTL keeps metadata read by Get and List for ttl so downloads can fall back to
+// it when the database is briefly unavailable. Non-positive values disable the cache.
+func (s *Service) SetMetadataCacheTTL(ttl time.Duration) {
+	s.metaCache = newMetadataCache(ttl)
+}
+
+// SetRequireKnownSize rejects parts whose size is unknown with ErrLengthRequired instead of
+// enforcing limits while streaming them.
+func (s *Service) SetRequireKnownSize(require bool) {
+	s.requireSize = require
+}
+
+// RequiresKnownSize reports whether uploads must declare their size up front.
+func (s *Service) RequiresKnownSize() bool {
+	return s.requireSize
+}
+
+// SetUploadFields sets the multipart field names accepted for uploaded files, in order of
+// preference. Blank names are dropped; an empty list restores DefaultUploadField.
+func (s *Service) SetUploadFields(fields []string) {
+	s.uploadFields = s.uploadFields[:0]
+	for _, field := range fields {
+		if field = strings.TrimSpace(field); field != "" {
+			s.uploadFields = append(s.uploadFields, field)
+		}
+	}
+	if len(s.uploadFields) == 0 {
+		s.uploadFields = append(s.uploadFields, DefaultUploadField)
+	}
+}
+
+// UploadFields returns the multipart field names accepted for uploaded files.
+func (s *Service) UploadFields() []string {
+	return s.uploadFields
+}
+
+// SetTenantBuckets stores each owner's objects in the physical bucket t maps them to. A nil t
+// keeps every object in the bucket the service was constructed with.
+func (s *Service) SetTenantBuckets(t *storage.TenantBuckets) {
+	s.tenants = t
+}
+
+// resolveObjectBucket returns the physical bucket holding ownerID's objects.
+func (s *Service) resolveObjectBucket(ctx context.Context, ownerID uuid.UUID) (string, error) {
+	if s.tenants == nil {
+		return s.objectBucket, nil
+	}
+	objectBucket, err := s.tenants.Resolve(ctx, ownerID)
+	if err != nil {
+		return "", fmt.Errorf("resolve object bucket: %w", err)
+	}
+	return objectBucket, nil
+}
+
+// SetReplicaBucket names a secondary physical bucket that downloads fall back to when an object
+// is missing from its primary bucket, covering gaps while replication catches up. An empty name
+// disables the fallback.
+func (s *Service) SetReplicaBucket(name string) {
+	s.replica = name
+}
+
+// getObject opens objectName in objectBucket. When the object is missing it retries against the
+// shared bucket, which still holds objects stored before their owner was given a tenant bucket,
+// and then against the replica bucket.
+func (s *Service) getObject(ctx context.Context, objectBucket, objectName string, opts minio.GetObjectOptions) (io.ReadCloser, error) {
+	object, err := s.objectStore.GetObject(ctx, objectBucket, objectName, opts)
+	if err == nil {
+		return object, nil
+	}
+	if !objectMissing(err) {
+		return nil, err
+	}
+	for _, fallback := range s.fallbackBuckets(objectBucket) {
+		fallbackObject, fallbackErr := s.objectStore.GetObject(ctx, fallback, objectName, opts)
+		if fallbackErr != nil {
+			continue
+		}
+		log.Printf("object %s missing from bucket %s, serving it from %s", objectName, objectBucket, fallback)
+		return fallbackObject, nil
+	}
+	return nil, err
+}
+
+// LocateObject returns the physical bucket holding ownerID's objectName. Objects stored before
+// their owner was given a tenant bucket are still in the shared bucket, so when a stat finds the
+// object missing from the tenant bucket the shared bucket is stat'ed in turn. The tenant bucket
+// is returned when neither has the object or the store cannot stat.
+func (s *Service) LocateObject(ctx context.Context, ownerID uuid.UUID, objectName string) (string, error) {
+	objectBucket, err := s.resolveObjectBucket(ctx, ownerID)
+	if err != nil || objectBucket == s.objectBucket {
+		return objectBucket, err
 	}
+	stater, ok := s.objectStore.(objectStater)
+	if !ok {
+		return objectBucket, nil
+	}
+	located, _, err := s.statObject(ctx, stater, objectBucket, objectName)
+	if err != nil {
+		return objectBucket, nil
+	}
+	return located, nil
+}
+
+// statObject stats objectName in objectBucket, then in the shared bucket when it is missing
+// from a tenant bucket, and reports the bucket that answered.
+func (s *Service) statObject(ctx context.Context, stater objectStater, objectBucket, objectName string) (string, minio.ObjectInfo, error) {
+	info, err := stater.StatObject(ctx, objectBucket, objectName)
+	if err == nil || !objectMissing(err) || s.tenants == nil || objectBucket == s.objectBucket {
+		return objectBucket, info, err
+	}
+	shared, sharedErr := stater.StatObject(ctx, s.objectBucket, objectName)
+	if sharedErr != nil {
+		return objectBucket, info, err
+	}
+	return s.objectBucket, shared, nil
+}
+
+// fallbackBuckets lists the buckets getObject tries, in order, after objectBucket.
+func (s *Service) fallbackBuckets(objectBucket string) []string {
+	var buckets []string
+	if s.tenants != nil && objectBucket != s.objectBucket {
+		buckets = append(buckets, s.objectBucket)
+	}
+	if s.replica != "" && s.replica != objectBucket {
+		buckets = append(buckets, s.replica)
+	}
+	return buckets
+}
+
+// SetImmutableRetention sets how long after upload a file in an immutable bucket can be neither
+// deleted nor moved out; replacing it is refused for as long as the bucket is immutable.
+// Non-positive values restore bucket.DefaultImmutableRetention.
+func (s *Service) SetImmutableRetention(retention time.Duration) {
+	if retention <= 0 {
+		retention = bucket.DefaultImmutableRetention
+	}
+	s.retention = retention
+}
+
+// retained reports whether meta is still protected by its bucket's immutability.
+func (s *Service) retained(target bucket.Bucket, meta Metadata) bool {
+	return target.Immutable && s.nowFunc().Before(meta.CreatedAt.Add(s.retention))
+}
+
+// CheckMutable returns ErrFileRetained if meta, a file in the owner's bucket, may not yet be
+// overwritten or removed.
+func (s *Service) CheckMutable(ctx context.Context, ownerID, bucketID uuid.UUID, meta Metadata) error {
+	target, err := s.buckets.Get(ctx, ownerID, bucketID)
+	if err != nil {
+		return translateBucketError(err)
+	}
+	if s.retained(target, meta) {
+		return ErrFileRetained
+	}
+	return nil
+}
+
+// SetBlockedContentTypes rejects uploads whose declared or sniffed content type matches any of
+// the given types, in every bucket. Entries may end in * to match a prefix, e.g. application/x-*.
+func (s *Service) SetBlockedContentTypes(types []string) {
+	s.blocklist.types = s.blocklist.types[:0]
+	for _, t := range types {
+		if t = strings.ToLower(strings.TrimSpace(t)); t != "" {
+			s.blocklist.types = append(s.blocklist.types, t)
+		}
+	}
+}
+
+// SetBlockedExtensions rejects uploads whose filename ends in any of the given extensions, in
+// every bucket.
+func (s *Service) SetBlockedExtensions(extensions []string) {
+	s.blocklist.extensions = make(map[string]bool, len(extensions))
+	for _, ext := range extensions {
+		if ext = strings.ToLower(strings.TrimSpace(ext)); ext != "" {
+			s.blocklist.extensions["."+strings.TrimPrefix(ext, ".")] = true
+		}
+	}
+}
+
+// SetScanner inspects every upload before its metadata is recorded. A nil scanner restores
+// NoopScanner.
+func (s *Service) SetScanner(scanner Scanner) {
+	if scanner == nil {
+		scanner = NoopScanner{}
+	}
+	s.scanner = scanner
+}
+
+// SetAuditor records file creates, updates, and deletes. A nil auditor disables auditing.
+func (s *Service) SetAuditor(a auditor) {
+	s.auditor = a
+}
+
+// SetPublisher announces uploads, moves and deletions. A nil publisher disables events.
+func (s *Service) SetPublisher(p publisher) {
+	s.publisher = p
+}
+
+func (s *Service) publish(ctx context.Context, eventType events.Type, userID uuid.UUID, meta Metadata) {
+	if s.publisher == nil {
+		return
+	}
+	s.publisher.Publish(ctx, events.Event{
+		Type:      eventType,
+		UserID:    userID,
+		BucketID:  meta.BucketID,
+		FileID:    meta.ID,
+		Name:      meta.OriginalFilename,
+		SizeBytes: meta.SizeBytes,
+	})
+}
+
+func (s *Service) audit(ctx context.Context, userID uuid.UUID, action string, meta Metadata) {
+	if s.auditor == nil {
+		return
+	}
+	s.auditor.Record(ctx, userID, action, audit.ResourceFile, meta.ID, map[string]any{
+		"bucket_id":  meta.BucketID,
+		"filename":   meta.OriginalFilename,
+		"size_bytes": meta.SizeBytes,
+	})
+}
+
+// validatePart rejects parts with no filename, unless allowed zero-byte parts, and parts of
+// unknown size when a known size is required.
+func (s *Service) validatePart(fileHeader *multipart.FileHeader) error {
+	if strings.TrimSpace(fileHeader.Filename) == "" {
+		return ErrEmptyUpload
+	}
+	if fileHeader.Size == 0 && !s.allowEmpty {
+		return ErrEmptyUpload
+	}
+	if fileHeader.Size < 0 && s.requireSize {
+		return ErrLengthRequired
+	}
+	return nil
+}
+
+// accountBytesRemaining reports how many more bytes the owner may store, or -1 when the
+// account cap is disabled.
+func (s *Service) accountBytesRemaining(ctx context.Context, ownerID uuid.UUID) (int64, error) {
+	if s.maxAccount == 0 {
+		return -1, nil
+	}
+	usage, err := s.buckets.AggregateUsage(ctx, ownerID)
+	if err != nil {
+		return 0, fmt.Errorf("aggregate usage: %w", err)
+	}
+	remaining := s.maxAccount - usage.TotalBytes
+	if remaining < 0 {
+		remaining = 0
+	}
+	return remaining, nil
+}
+
+// maxFileSizeFor returns the limit for files in the bucket. A bucket's own limit can only
+// tighten the global one, so bucket owners cannot raise their cap above the operator's.
+func (s *Service) maxFileSizeFor(target bucket.Bucket) int64 {
+	if target.MaxFileSizeBytes != nil && *target.MaxFileSizeBytes > 0 {
+		return min(*target.MaxFileSizeBytes, s.maxFileSize)
+	}
+	return s.maxFileSize
 }
 
 // Upload creates metadata and stores the object contents.
-func (s *Service) Upload(ctx context.Context, ownerID, bucketID uuid.UUID, fileHeader *multipart.FileHeader) (Metadata, error) {
+func (s *Service) Upload(ctx context.Context, ownerID, bucketID uuid.UUID, fileHeader *multipart.FileHeader, opts UploadOptions) (_ Metadata, err error) {
 	if fileHeader == nil {
 		return Metadata{}, fmt.Errorf("missing file payload")
 	}
+	if err := s.validatePart(fileHeader); err != nil {
+		return Metadata{}, err
+	}
+	if opts.OriginalCreatedAt != nil && opts.OriginalCreatedAt.After(s.nowFunc().Add(maxCreatedAtSkew)) {
+		return Metadata{}, ErrInvalidOriginalCreatedAt
+	}
 
-	if _, err := s.buckets.Get(ctx, ownerID, bucketID); err != nil {
+	target, err := s.buckets.Get(ctx, ownerID, bucketID)
+	if err != nil {
 		return Metadata{}, translateBucketError(err)
 	}
 
-	size := fileHeader.Size
-	if size > s.maxFileSize {
-		return Metadata{}, ErrFileTooLarge
+	if opts.IdempotencyKey != "" {
+		fileID, reserved, reserveErr := s.repo.ReserveIdempotencyKey(ctx, bucketID, opts.IdempotencyKey, s.nowFunc().Add(min(s.idemTTL, idempotencyReservationTTL)))
+		if reserveErr != nil {
+			return Metadata{}, reserveErr
+		}
+		if !reserved {
+			if fileID == uuid.Nil {
+				return Metadata{}, ErrUploadInProgress
+			}
+			return s.repo.Get(ctx, ownerID, bucketID, fileID)
+		}
+		defer func() {
+			if err != nil {
+				// Free the key so the client can retry the upload it did not get.
+				_ = s.repo.ReleaseIdempotencyKey(context.WithoutCancel(ctx), bucketID, opts.IdempotencyKey)
+			}
+		}()
 	}
 
-	fileID := uuid.New()
-	objectName := fmt.Sprintf("%s/%s", bucketID.String(), fileID.String())
+	if opts.NoOverwrite {
+		exists, err := s.repo.ExistsByName(ctx, bucketID, sanitizeFilename(fileHeader.Filename))
+		if err != nil {
+			return Metadata{}, err
+		}
+		if exists {
+			return Metadata{}, ErrFileNameExists
+		}
+	}
 
-	file, err := fileHeader.Open()
+	remaining, err := s.accountBytesRemaining(ctx, ownerID)
 	if err != nil {
-		return Metadata{}, fmt.Errorf("open upload file: %w", err)
+		return Metadata{}, err
+	}
+	if remaining >= 0 && fileHeader.Size > remaining {
+		return Metadata{}, ErrQuotaExceeded
 	}
-	defer file.Close()
 
-	hasher := sha256.New()
-	reader := io.TeeReader(file, hasher)
+	stored, err := s.storeFile(ctx, target, fileHeader, remaining, opts.OriginalCreatedAt)
+	if err != nil {
+		return Metadata{}, err
+	}
+	s.audit(ctx, ownerID, audit.ActionCreate, stored)
 
-	putOpts := minio.PutObjectOptions{
-		ContentType: detectContentType(fileHeader),
+	if err := s.buckets.UpdateUsage(ctx, bucketID, stored.SizeBytes, 1); err != nil {
+		return Metadata{}, err
+	}
+	_ = s.buckets.RecordUsageSnapshot(ctx, ownerID)
+	s.publish(ctx, events.FileUploaded, ownerID, stored)
+
+	if opts.IdempotencyKey != "" {
+		if err := s.repo.CompleteIdempotencyKey(ctx, bucketID, opts.IdempotencyKey, stored.ID, s.nowFunc().Add(s.idemTTL)); err != nil {
+			return Metadata{}, err
+		}
+	}
+
+	return stored, nil
+}
+
+// BatchItem is the outcome of one file in a batch upload: either File or Error is set.
+type BatchItem struct {
+	Filename string    `json:"filename"`
+	File     *Metadata `json:"file,omitempty"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// UploadBatch stores each file independently and reports a result per file, so some files
+// may be stored while others are rejected. Files that would push the batch past the aggregate
+// limit are rejected with ErrBatchTooLarge, and files that would exceed the account cap with
+// ErrQuotaExceeded. Usage is updated once for all stored files.
+func (s *Service) UploadBatch(ctx context.Context, ownerID, bucketID uuid.UUID, fileHeaders []*multipart.FileHeader) ([]BatchItem, error) {
+	if len(fileHeaders) == 0 {
+		return nil, fmt.Errorf("missing file payload")
+	}
+
+	target, err := s.buckets.Get(ctx, ownerID, bucketID)
+	if err != nil {
+		return nil, translateBucketError(err)
 	}
 
-	uploadInfo, err := s.objectStore.PutObject(ctx, s.objectBucket, objectName, reader, size, putOpts)
+	remaining, err := s.accountBytesRemaining(ctx, ownerID)
 	if err != nil {
-		return Metadata{}, fmt.Errorf("store object: %w", err)
+		return nil, err
+	}
+
+	items := make([]BatchItem, 0, len(fileHeaders))
+	var totalBytes, storedFiles int64
+	for _, fileHeader := range fileHeaders {
+		item := BatchItem{Filename: sanitizeFilename(fileHeader.Filename)}
+		if err := s.validatePart(fileHeader); err != nil {
+			item.Error = err.Error()
+		} else if totalBytes+fileHeader.Size > s.maxBatchSize {
+			item.Error = ErrBatchTooLarge.Error()
+		} else if remaining >= 0 && totalBytes+fileHeader.Size > remaining {
+			item.Error = ErrQuotaExceeded.Error()
+		} else if stored, err := s.storeFile(ctx, target, fileHeader, quotaLeft(remaining, totalBytes), nil); err != nil {
+			item.Error = batchErrorMessage(err)
+		} else {
+			s.audit(ctx, ownerID, audit.ActionCreate, stored)
+			item.File = &stored
+			totalBytes += stored.SizeBytes
+			storedFiles++
+		}
+		items = append(items, item)
 	}
 
-	actualSize := uploadInfo.Size
-	if actualSize <= 0 {
-		actualSize = size
+	if storedFiles > 0 {
+		if err := s.buckets.UpdateUsage(ctx, bucketID, totalBytes, storedFiles); err != nil {
+			return items, err
+		}
+		_ = s.buckets.RecordUsageSnapshot(ctx, ownerID)
 	}
-	if s.maxFileSize > 0 && actualSize > s.maxFileSize {
-		_ = s.objectStore.RemoveObject(ctx, s.objectBucket, objectName, minio.RemoveObjectOptions{})
-		return Metadata{}, ErrFileTooLarge
+	for _, item := range items {
+		if item.File != nil {
+			s.publish(ctx, events.FileUploaded, ownerID, *item.File)
+		}
 	}
 
-	checksum := hex.EncodeToString(hasher.Sum(nil))
+	return items, nil
+}
 
+// storeFile validates a single upload against the bucket, writes the object, and records its
+// metadata. quota is the account space left for this file, or negative when uncapped. Parts of
+// unknown size are counted while streaming and aborted, with the partial object removed, as soon
+// as they cross the file size limit or the quota. originalCreatedAt, when set, is stored
+// alongside the server-managed timestamps. Usage accounting is left to the caller.
+func (s *Service) storeFile(ctx context.Context, target bucket.Bucket, fileHeader *multipart.FileHeader, quota int64, originalCreatedAt *time.Time) (Metadata, error) {
+	bucketID := target.ID
+	contentType := resolveContentType(fileHeader, target)
+	if !target.AllowsContentType(contentType) {
+		return Metadata{}, ErrContentTypeNotAllowed
+	}
+	maxSize := s.maxFileSizeFor(target)
+	size := fileHeader.Size
+	if size > maxSize {
+		return Metadata{}, &SizeLimitError{Limit: maxSize}
+	}
+
+	fileID := uuid.New()
+	objectName := s.keyLayout.objectName(bucketID, fileID, s.nowFunc())
+	if err := validateObjectName(objectName); err != nil {
+		return Metadata{}, err
+	}
+	objectBucket, err := s.resolveObjectBucket(ctx, target.OwnerID)
+	if err != nil {
+		return Metadata{}, err
+	}
+
+	opts := pipelineOptions{limit: -1, scanner: s.scanner}
+	if size < 0 {
+		opts.limit = maxSize
+		if quota >= 0 && quota < maxSize {
+			opts.limit = quota
+		}
+	}
+	body, err := s.putUpload(ctx, fileHeader, objectBucket, objectName, contentType, opts)
+	if body == nil {
+		return Metadata{}, err
+	}
+	defer body.abort()
+	if body.exceeded() {
+		_ = s.objectStore.RemoveObject(ctx, objectBucket, objectName, minio.RemoveObjectOptions{})
+		if quota >= 0 && quota < maxSize {
+			return Metadata{}, ErrQuotaExceeded
+		}
+		return Metadata{}, &SizeLimitError{Limit: maxSize}
+	}
+	if err != nil {
+		return Metadata{}, err
+	}
+
+	// The bytes counted on the way to the store are the true size: stores may report 0 for a
+	// size they did not track, and the declared size is -1 when unknown.
+	actualSize := body.read
+	if actualSize > maxSize {
+		_ = s.objectStore.RemoveObject(ctx, objectBucket, objectName, minio.RemoveObjectOptions{})
+		return Metadata{}, &SizeLimitError{Limit: maxSize}
+	}
+
+	if err := body.finish(); err != nil {
+		_ = s.objectStore.RemoveObject(ctx, objectBucket, objectName, minio.RemoveObjectOptions{})
+		return Metadata{}, err
+	}
+
+	checksum := body.checksum()
 	meta := Metadata{
 		ID:               fileID,
 		BucketID:         bucketID,
 		ObjectName:       objectName,
 		OriginalFilename: sanitizeFilename(fileHeader.Filename),
 		SizeBytes:        actualSize,
-		ContentType:      putOpts.ContentType,
+		ContentType:      contentType,
 		Checksum:         checksum,
 	}
+	if originalCreatedAt != nil {
+		utc := originalCreatedAt.UTC()
+		meta.OriginalCreatedAt = &utc
+	}
+
+	if existing, ok := s.findDuplicate(ctx, target, checksum, actualSize); ok {
+		// The content was only known once hashed, so the copy just written is dropped in favor
+		// of the object already stored. Should that object's last file go meanwhile, the upload
+		// keeps its own copy.
+		shared := meta
+		shared.ObjectName = existing.ObjectName
+		stored, err := s.repo.CreateShared(ctx, shared)
+		if err == nil {
+			_ = s.objectStore.RemoveObject(ctx, objectBucket, objectName, minio.RemoveObjectOptions{})
+			return stored, nil
+		}
+		if err != ErrFileNotFound {
+			_ = s.objectStore.RemoveObject(ctx, objectBucket, objectName, minio.RemoveObjectOptions{})
+			return Metadata{}, err
+		}
+	}
 
 	stored, err := s.repo.Create(ctx, meta)
 	if err != nil {
-		_ = s.objectStore.RemoveObject(ctx, s.objectBucket, objectName, minio.RemoveObjectOptions{})
+		_ = s.releaseObject(ctx, objectBucket, objectName)
 		return Metadata{}, err
 	}
+	return stored, nil
+}
 
-	if err := s.buckets.UpdateUsage(ctx, bucketID, stored.SizeBytes, 1); err != nil {
-		return Metadata{}, err
+// putUpload streams the upload to objectName through a fresh pipeline, retrying transient
+// store failures under the upload retry policy. The pipeline is read once and so cannot be
+// replayed by the store itself; instead each attempt reopens the multipart file and starts over,
+// hashing, counting and scanning from the first byte. The last attempt's pipeline is returned
+// with its error, or nil when the file could not be read.
+func (s *Service) putUpload(ctx context.Context, fileHeader *multipart.FileHeader, objectBucket, objectName, contentType string, opts pipelineOptions) (*uploadPipeline, error) {
+	var body *uploadPipeline
+	stored := false
+	err := s.uploadRetry.do(ctx, func() error {
+		if body != nil {
+			body.abort()
+			body = nil
+		}
+		file, err := fileHeader.Open()
+		if err != nil {
+			return fmt.Errorf("open upload file: %w", err)
+		}
+		defer file.Close()
+
+		if body, err = newUploadPipeline(ctx, file, opts); err != nil {
+			return err
+		}
+		if s.blocklist.blocks(fileHeader.Filename, contentType, body.sniffedType()) {
+			body.abort()
+			body = nil
+			return ErrContentTypeNotAllowed
+		}
+		stored = true
+		_, err = s.objectStore.PutObject(ctx, objectBucket, objectName, body, fileHeader.Size, minio.PutObjectOptions{ContentType: contentType})
+		return err
+	})
+	if err != nil && stored && !body.exceeded() {
+		err = objectError(err, "store object")
 	}
-	_ = s.buckets.RecordUsageSnapshot(ctx, ownerID)
+	return body, err
+}
 
-	return stored, nil
+// quotaLeft returns the account space left after used bytes, keeping negative (uncapped) as is.
+func quotaLeft(remaining, used int64) int64 {
+	if remaining < 0 {
+		return remaining
+	}
+	return max(remaining-used, 0)
 }
 
-// List returns file metadata for a user's bucket.
-func (s *Service) List(ctx context.Context, ownerID, bucketID uuid.UUID) ([]Metadata, error) {
+// limitReader passes reads through until more than remaining bytes have been read, then fails
+// so a stream of unknown length cannot grow past its limit.
+type limitReader struct {
+	r         io.Reader
+	remaining int64
+	exceeded  bool
+}
+
+func (l *limitReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	if l.remaining < 0 {
+		l.exceeded = true
+		return n, ErrFileTooLarge
+	}
+	return n, err
+}
+
+// List returns file metadata for a user's bucket, optionally windowed by opts.
+func (s *Service) List(ctx context.Context, ownerID, bucketID uuid.UUID, opts ListOptions) ([]Metadata, error) {
 	if _, err := s.buckets.Get(ctx, ownerID, bucketID); err != nil {
 		return nil, translateBucketError(err)
 	}
-	return s.repo.List(ctx, ownerID, bucketID)
+	files, err := s.repo.List(ctx, ownerID, bucketID, opts)
+	if err != nil {
+		return nil, err
+	}
+	s.metaCache.put(ownerID, s.nowFunc(), files...)
+	return files, nil
 }
 
-// Download retrieves metadata and object reader.
-func (s *Service) Download(ctx context.Context, ownerID, bucketID, fileID uuid.UUID) (Metadata, io.ReadCloser, error) {
+// AttachDownloadURLs pairs each listed file with a presigned download URL valid for ttl, which
+// the presigner clamps to its configured bounds. files must come from a listing of ownerID's bucket.
+func (s *Service) AttachDownloadURLs(ctx context.Context, ownerID, bucketID uuid.UUID, files []Metadata, ttl time.Duration) ([]ListedFile, error) {
+	if s.presigner == nil {
+		return nil, ErrPresignUnavailable
+	}
+	listed := make([]ListedFile, len(files))
+	if len(files) == 0 {
+		return listed, nil
+	}
+	urls, expiresAt, err := s.presigner.PresignListing(ctx, ownerID, bucketID, files, ttl)
+	if err != nil {
+		return nil, err
+	}
+	for i, meta := range files {
+		listed[i] = ListedFile{Metadata: meta, URL: urls[i], URLExpiresAt: &expiresAt}
+	}
+	return listed, nil
+}
+
+// StreamList calls fn for each file in the bucket without loading the whole listing into memory.
+func (s *Service) StreamList(ctx context.Context, ownerID, bucketID uuid.UUID, fn func(Metadata) error) error {
+	if _, err := s.buckets.Get(ctx, ownerID, bucketID); err != nil {
+		return translateBucketError(err)
+	}
+	return s.repo.StreamList(ctx, ownerID, bucketID, fn)
+}
+
+// ObjectDrift compares the objects stored under the bucket's prefix with its metadata rows.
+// It is a read-only diagnostic; nothing is repaired.
+func (s *Service) ObjectDrift(ctx context.Context, ownerID, bucketID uuid.UUID) (DriftReport, error) {
+	if _, err := s.buckets.Get(ctx, ownerID, bucketID); err != nil {
+		return DriftReport{}, translateBucketError(err)
+	}
+
+	files, err := s.repo.List(ctx, ownerID, bucketID, ListOptions{})
+	if err != nil {
+		return DriftReport{}, err
+	}
+	objectBucket, err := s.resolveObjectBucket(ctx, ownerID)
+	if err != nil {
+		return DriftReport{}, err
+	}
+	objects, err := s.objectStore.ListObjects(ctx, objectBucket, bucketID.String()+"/")
+	if err != nil {
+		return DriftReport{}, fmt.Errorf("list objects: %w", err)
+	}
+
+	// Deduplicated files may share an object stored under another bucket's prefix; that object
+	// is accounted for in its own bucket's report.
+	local := files[:0]
+	for _, meta := range files {
+		if objectBelongsToBucket(meta.ObjectName, bucketID) {
+			local = append(local, meta)
+		}
+	}
+
+	report := diffObjects(objects, local)
+	report.BucketID = bucketID
+	return report, nil
+}
+
+// diffObjects matches stored objects to metadata rows by object name. Derivatives of a known
+// file are neither matched nor orphaned.
+func diffObjects(objects []minio.ObjectInfo, files []Metadata) DriftReport {
+	report := DriftReport{
+		OrphanObjects:  []StoredObject{},
+		MissingObjects: []Metadata{},
+	}
+
+	stored := make(map[string]bool, len(objects))
+	for _, obj := range objects {
+		stored[obj.Key] = true
+	}
+	known := make(map[string]bool, len(files))
+	for _, meta := range files {
+		known[meta.ObjectName] = true
+		if stored[meta.ObjectName] {
+			report.Matched++
+		} else {
+			report.MissingObjects = append(report.MissingObjects, meta)
+		}
+	}
+	for _, obj := range objects {
+		if parent, ok := derivativeOf(obj.Key); ok && known[parent] {
+			continue
+		}
+		if !known[obj.Key] {
+			report.OrphanObjects = append(report.OrphanObjects, StoredObject{Key: obj.Key, SizeBytes: obj.Size})
+		}
+	}
+	return report
+}
+
+// Get returns metadata for a single file, verifying its object lives in the bucket.
+func (s *Service) Get(ctx context.Context, ownerID, bucketID, fileID uuid.UUID) (Metadata, error) {
 	meta, err := s.repo.Get(ctx, ownerID, bucketID, fileID)
+	if err != nil {
+		return Metadata{}, err
+	}
+	if !s.objectInScope(ctx, ownerID, bucketID, meta.ObjectName) {
+		return Metadata{}, ErrObjectOutsideBucket
+	}
+	s.metaCache.put(ownerID, s.nowFunc(), meta)
+	return meta, nil
+}
+
+// FindByChecksum returns the owner's file in the bucket with the given hex SHA-256 checksum,
+// letting clients check whether content is already stored before uploading it.
+func (s *Service) FindByChecksum(ctx context.Context, ownerID, bucketID uuid.UUID, checksum string) (Metadata, error) {
+	checksum = strings.ToLower(checksum)
+	if !validChecksum(checksum) {
+		return Metadata{}, ErrInvalidChecksum
+	}
+	meta, err := s.repo.FindByChecksum(ctx, ownerID, bucketID, checksum)
+	if err != nil {
+		return Metadata{}, err
+	}
+	if !s.objectInScope(ctx, ownerID, bucketID, meta.ObjectName) {
+		return Metadata{}, ErrObjectOutsideBucket
+	}
+	return meta, nil
+}
+
+// validChecksum reports whether checksum is a lowercase hex-encoded SHA-256 digest.
+func validChecksum(checksum string) bool {
+	if len(checksum) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(checksum)
+	return err == nil
+}
+
+// GetMany checks bucket ownership once and returns metadata for the requested files keyed
+// by ID. Files that do not exist, or whose object lies outside the bucket, are omitted.
+func (s *Service) GetMany(ctx context.Context, ownerID, bucketID uuid.UUID, fileIDs []uuid.UUID) (map[uuid.UUID]Metadata, error) {
+	if _, err := s.buckets.Get(ctx, ownerID, bucketID); err != nil {
+		return nil, err
+	}
+
+	metas, err := s.repo.GetMany(ctx, bucketID, fileIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	found := make(map[uuid.UUID]Metadata, len(metas))
+	for _, meta := range metas {
+		if s.objectInScope(ctx, ownerID, bucketID, meta.ObjectName) {
+			found[meta.ID] = meta
+		}
+	}
+	return found, nil
+}
+
+// Download retrieves metadata and object reader. If the metadata lookup fails for a reason other
+// than the file being missing, recently cached metadata is used instead when available.
+func (s *Service) Download(ctx context.Context, ownerID, bucketID, fileID uuid.UUID) (Metadata, io.ReadCloser, error) {
+	meta, err := s.ResolveDownload(ctx, ownerID, bucketID, fileID)
 	if err != nil {
 		return Metadata{}, nil, err
 	}
 
-	object, err := s.objectStore.GetObject(ctx, s.objectBucket, meta.ObjectName, minio.GetObjectOptions{})
+	object, err := s.openObject(ctx, ownerID, meta)
 	if err != nil {
-		return Metadata{}, nil, fmt.Errorf("fetch object: %w", err)
+		return Metadata{}, nil, err
 	}
 
 	return meta, object, nil
 }
 
-// Delete removes the file from storage and metadata.
-func (s *Service) Delete(ctx context.Context, ownerID, bucketID, fileID uuid.UUID) error {
-	meta, err := s.repo.Delete(ctx, ownerID, bucketID, fileID)
+// ResolveDownload returns the metadata Download would serve, without opening the object, so
+// callers can inspect the size before choosing a byte range.
+func (s *Service) ResolveDownload(ctx context.Context, ownerID, bucketID, fileID uuid.UUID) (Metadata, error) {
+	meta, err := s.Get(ctx, ownerID, bucketID, fileID)
+	if err != nil {
+		cached, ok := s.cachedMetadata(ownerID, bucketID, fileID, err)
+		if !ok {
+			return Metadata{}, err
+		}
+		log.Printf("file metadata lookup failed, serving file %s from cache: %v", fileID, err)
+		meta = cached
+	}
+	return meta, nil
+}
+
+// OpenRange reads bytes start through end, inclusive, of the file's object. Cached objects are
+// sliced in memory; otherwise the range is requested from the object store, so resuming a large
+// download does not re-read the bytes already received.
+func (s *Service) OpenRange(ctx context.Context, ownerID uuid.UUID, meta Metadata, start, end int64) (io.ReadCloser, error) {
+	if s.cache.admits(meta.SizeBytes) && meta.Checksum != "" {
+		if data, ok := s.cache.get(meta.ObjectName, meta.Checksum); ok && end < int64(len(data)) {
+			return io.NopCloser(bytes.NewReader(data[start : end+1])), nil
+		}
+	}
+
+	opts := minio.GetObjectOptions{}
+	if err := opts.SetRange(start, end); err != nil {
+		return nil, err
+	}
+	objectBucket, err := s.resolveObjectBucket(ctx, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	object, err := s.getObject(ctx, objectBucket, meta.ObjectName, opts)
+	if err != nil {
+		return nil, objectError(err, "fetch object range")
+	}
+	return object, nil
+}
+
+// cachedMetadata returns cached metadata for a download whose lookup failed with err. Definitive
+// answers such as ErrFileNotFound are never overridden by the cache.
+func (s *Service) cachedMetadata(ownerID, bucketID, fileID uuid.UUID, err error) (Metadata, bool) {
+	if errors.Is(err, ErrFileNotFound) || errors.Is(err, ErrObjectOutsideBucket) {
+		return Metadata{}, false
+	}
+	meta, ok := s.metaCache.get(ownerID, bucketID, fileID, s.nowFunc())
+	if !ok || !objectBelongsToBucket(meta.ObjectName, bucketID) {
+		return Metadata{}, false
+	}
+	return meta, true
+}
+
+// PublicDownload streams a file from a public bucket without an owner. Files in private
+// buckets, or whose object lies outside the bucket, are reported as ErrFileNotFound.
+func (s *Service) PublicDownload(ctx context.Context, bucketID, fileID uuid.UUID) (Metadata, io.ReadCloser, error) {
+	meta, ownerID, err := s.repo.GetPublic(ctx, bucketID, fileID)
+	if err != nil {
+		return Metadata{}, nil, err
+	}
+	if !s.objectInScope(ctx, ownerID, bucketID, meta.ObjectName) {
+		return Metadata{}, nil, ErrFileNotFound
+	}
+
+	object, err := s.openObject(ctx, ownerID, meta)
+	if err != nil {
+		return Metadata{}, nil, err
+	}
+
+	return meta, object, nil
+}
+
+// StatDownload opens a file whose object name and filename the caller has already confirmed
+// against the file, taking its size and content type from an object stat instead of the
+// database; share downloads load both with the share itself. No metadata is read, so objects
+// outside the bucket's own prefix, which need an ownership lookup, are left to Download. It
+// returns ErrStatUnavailable when the store cannot stat, the object lies outside the prefix,
+// the stat fails, or it lacks a content type; callers then fall back to Download.
+func (s *Service) StatDownload(ctx context.Context, ownerID, bucketID, fileID uuid.UUID, objectName, filename string) (Metadata, io.ReadCloser, error) {
+	stater, ok := s.objectStore.(objectStater)
+	if !ok || objectName == "" || filename == "" {
+		return Metadata{}, nil, ErrStatUnavailable
+	}
+	if validateObjectName(objectName) != nil {
+		return Metadata{}, nil, ErrObjectOutsideBucket
+	}
+	if !objectBelongsToBucket(objectName, bucketID) {
+		return Metadata{}, nil, ErrStatUnavailable
+	}
+	objectBucket, err := s.resolveObjectBucket(ctx, ownerID)
+	if err != nil {
+		return Metadata{}, nil, err
+	}
+
+	objectBucket, info, err := s.statObject(ctx, stater, objectBucket, objectName)
+	if err != nil || info.ContentType == "" {
+		return Metadata{}, nil, ErrStatUnavailable
+	}
+	object, err := s.getObject(ctx, objectBucket, objectName, minio.GetObjectOptions{})
+	if err != nil {
+		return Metadata{}, nil, objectError(err, "fetch object")
+	}
+
+	meta := Metadata{
+		ID:               fileID,
+		BucketID:         bucketID,
+		ObjectName:       objectName,
+		OriginalFilename: filename,
+		SizeBytes:        info.Size,
+		ContentType:      info.ContentType,
+	}
+	return meta, object, nil
+}
+
+// openObject returns a reader for the file's object, serving small objects from the cache when
+// one is configured. Fetched bytes are only cached when they match the stored checksum.
+func (s *Service) openObject(ctx context.Context, ownerID uuid.UUID, meta Metadata) (io.ReadCloser, error) {
+	cacheable := s.cache.admits(meta.SizeBytes) && meta.Checksum != ""
+	if cacheable {
+		if data, ok := s.cache.get(meta.ObjectName, meta.Checksum); ok {
+			return io.NopCloser(bytes.NewReader(data)), nil
+		}
+	}
+
+	objectBucket, err := s.resolveObjectBucket(ctx, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	object, err := s.getObject(ctx, objectBucket, meta.ObjectName, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, objectError(err, "fetch object")
+	}
+	if !cacheable {
+		return object, nil
+	}
+
+	data, err := io.ReadAll(io.LimitReader(object, s.cache.maxObjectBytes+1))
+	if err != nil {
+		object.Close()
+		return nil, fmt.Errorf("read object: %w", err)
+	}
+	if int64(len(data)) > s.cache.maxObjectBytes {
+		// The stored size understated the object; stream the remainder rather than cache it.
+		return struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(data), object), object}, nil
+	}
+	object.Close()
+
+	sum := sha256.Sum256(data)
+	if hex.EncodeToString(sum[:]) == meta.Checksum {
+		s.cache.put(meta.ObjectName, meta.Checksum, data)
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// Rehash recomputes the SHA-256 checksum of the stored object and persists it when it differs.
+// The object is streamed through the hasher, so large files are never held in memory.
+func (s *Service) Rehash(ctx context.Context, ownerID, bucketID, fileID uuid.UUID) (Metadata, error) {
+	meta, err := s.Get(ctx, ownerID, bucketID, fileID)
+	if err != nil {
+		return Metadata{}, err
+	}
+	checksum, err := s.hashObject(ctx, ownerID, meta)
+	if err != nil {
+		return Metadata{}, err
+	}
+	if checksum == meta.Checksum {
+		return meta, nil
+	}
+	updated, err := s.repo.UpdateChecksum(ctx, ownerID, bucketID, fileID, checksum)
+	if err != nil {
+		return Metadata{}, err
+	}
+	s.metaCache.put(ownerID, s.nowFunc(), updated)
+	s.audit(ctx, ownerID, audit.ActionUpdate, updated)
+	return updated, nil
+}
+
+// hashObject streams the file's object through SHA-256 and returns the hex digest.
+func (s *Service) hashObject(ctx context.Context, ownerID uuid.UUID, meta Metadata) (string, error) {
+	objectBucket, err := s.resolveObjectBucket(ctx, ownerID)
+	if err != nil {
+		return "", err
+	}
+
+	object, err := s.getObject(ctx, objectBucket, meta.ObjectName, minio.GetObjectOptions{})
+	if err != nil {
+		return "", objectError(err, "fetch object")
+	}
+	defer object.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, object); err != nil {
+		return "", fmt.Errorf("read object: %w", err)
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// CommitReplacement refreshes a file's metadata after its object was overwritten in place (for
+// example through a presigned PUT). The object is re-read to measure its size and SHA-256
+// checksum, and bucket usage is adjusted by the size difference in the same update. Objects
+// shared with other deduplicated files are refused with ErrObjectShared, and files in immutable
+// buckets with ErrBucketImmutable. A replacement larger than
+// the bucket's file size limit, or one that would push the owner past the account quota, cannot be
+// undone because the previous contents are gone, so the file is deleted and the limit error
+// returned.
+func (s *Service) CommitReplacement(ctx context.Context, ownerID, bucketID, fileID uuid.UUID) (Metadata, error) {
+	meta, err := s.Get(ctx, ownerID, bucketID, fileID)
+	if err != nil {
+		return Metadata{}, err
+	}
+	if err := s.CheckOverwritable(ctx, ownerID, bucketID, meta); err != nil {
+		return Metadata{}, err
+	}
+	target, err := s.buckets.Get(ctx, ownerID, bucketID)
+	if err != nil {
+		return Metadata{}, translateBucketError(err)
+	}
+	objectBucket, err := s.resolveObjectBucket(ctx, ownerID)
+	if err != nil {
+		return Metadata{}, err
+	}
+
+	object, err := s.getObject(ctx, objectBucket, meta.ObjectName, minio.GetObjectOptions{})
+	if err != nil {
+		return Metadata{}, objectError(err, "fetch object")
+	}
+	defer object.Close()
+
+	hasher := sha256.New()
+	size, err := io.Copy(hasher, object)
+	if err != nil {
+		return Metadata{}, fmt.Errorf("read object: %w", err)
+	}
+
+	if limitErr := s.replacementLimitError(ctx, ownerID, target, size-meta.SizeBytes, size); limitErr != nil {
+		if err := s.Delete(ctx, ownerID, bucketID, fileID); err != nil {
+			return Metadata{}, fmt.Errorf("delete oversized replacement: %w", err)
+		}
+		return Metadata{}, limitErr
+	}
+
+	updated, err := s.repo.UpdateContent(ctx, ownerID, bucketID, fileID, size, hex.EncodeToString(hasher.Sum(nil)))
+	if err != nil {
+		return Metadata{}, err
+	}
+	s.cache.remove(meta.ObjectName)
+	s.metaCache.put(ownerID, s.nowFunc(), updated)
+	s.audit(ctx, ownerID, audit.ActionUpdate, updated)
+	if updated.SizeBytes != meta.SizeBytes {
+		_ = s.buckets.RecordUsageSnapshot(ctx, ownerID)
+	}
+	return updated, nil
+}
+
+// replacementLimitError reports the limit a replacement of size bytes, growing the file by
+// growth bytes, would break, or nil when it fits.
+func (s *Service) replacementLimitError(ctx context.Context, ownerID uuid.UUID, target bucket.Bucket, growth, size int64) error {
+	if maxSize := s.maxFileSizeFor(target); maxSize > 0 && size > maxSize {
+		return &SizeLimitError{Limit: maxSize}
+	}
+	if growth <= 0 {
+		return nil
+	}
+	remaining, err := s.accountBytesRemaining(ctx, ownerID)
 	if err != nil {
 		return err
 	}
+	if remaining >= 0 && growth > remaining {
+		return ErrQuotaExceeded
+	}
+	return nil
+}
+
+// MaxMoveBatchSize caps how many files one batch move may name.
+const MaxMoveBatchSize = 100
+
+// MoveBatch moves files from sourceID to targetID, both owned by ownerID, and reports a result per
+// requested ID in request order. Objects are first copied under the target bucket's prefix; files
+// whose copy fails stay in the source. Metadata and usage for every copied file are then updated in
+// a single transaction before the source objects are removed. If that transaction fails the copies
+// are discarded and all files stay in the source.
+func (s *Service) MoveBatch(ctx context.Context, ownerID, sourceID, targetID uuid.UUID, fileIDs []uuid.UUID) ([]MoveResult, error) {
+	if sourceID == targetID {
+		return nil, ErrSameBucket
+	}
+	if len(fileIDs) == 0 {
+		return nil, fmt.Errorf("missing file ids")
+	}
+	if len(fileIDs) > MaxMoveBatchSize {
+		return nil, ErrMoveBatchTooLarge
+	}
+
+	source, err := s.buckets.Get(ctx, ownerID, sourceID)
+	if err != nil {
+		return nil, translateBucketError(err)
+	}
+	target, err := s.buckets.Get(ctx, ownerID, targetID)
+	if err != nil {
+		return nil, translateBucketError(err)
+	}
+
+	metas, err := s.repo.GetMany(ctx, sourceID, fileIDs)
+	if err != nil {
+		return nil, err
+	}
+	found := make(map[uuid.UUID]Metadata, len(metas))
+	for _, meta := range metas {
+		if s.objectInScope(ctx, ownerID, sourceID, meta.ObjectName) {
+			found[meta.ID] = meta
+		}
+	}
+
+	results := make([]MoveResult, len(fileIDs))
+	positions := make(map[uuid.UUID]int, len(fileIDs))
+	moves := make([]ObjectMove, 0, len(fileIDs))
+	// Each copy stays in the bucket its source object was found in, which for files stored before
+	// the owner had a tenant bucket is the shared one; downloads fall back to it.
+	objectBuckets := make(map[uuid.UUID]string, len(fileIDs))
+	maxSize := s.maxFileSizeFor(target)
+	for i, fileID := range fileIDs {
+		results[i].FileID = fileID
+		if _, seen := positions[fileID]; seen {
+			results[i].Error = "duplicate file id"
+			continue
+		}
+		positions[fileID] = i
+
+		meta, ok := found[fileID]
+		switch {
+		case !ok:
+			results[i].Error = ErrFileNotFound.Error()
+			continue
+		case s.retained(source, meta):
+			results[i].Error = ErrFileRetained.Error()
+			continue
+		case !target.AllowsContentType(meta.ContentType):
+			results[i].Error = ErrContentTypeNotAllowed.Error()
+			continue
+		case meta.SizeBytes > maxSize:
+			results[i].Error = (&SizeLimitError{Limit: maxSize}).Error()
+			continue
+		}
+
+		newName := s.keyLayout.objectName(targetID, fileID, s.nowFunc())
+		if err := validateObjectName(newName); err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+		objectBucket, err := s.LocateObject(ctx, ownerID, meta.ObjectName)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.objectStore.CopyObject(ctx, objectBucket, meta.ObjectName, newName); err != nil {
+			results[i].Error = "failed to copy object"
+			continue
+		}
+		objectBuckets[fileID] = objectBucket
+		moves = append(moves, ObjectMove{FileID: fileID, NewObjectName: newName})
+	}
+	if len(moves) == 0 {
+		return results, nil
+	}
+
+	moved, err := s.repo.MoveFiles(ctx, sourceID, targetID, moves)
+	if err != nil {
+		for _, move := range moves {
+			_ = s.objectStore.RemoveObject(ctx, objectBuckets[move.FileID], move.NewObjectName, minio.RemoveObjectOptions{})
+		}
+		return nil, err
+	}
 
-	if err := s.objectStore.RemoveObject(ctx, s.objectBucket, meta.ObjectName, minio.RemoveObjectOptions{}); err != nil {
-		return fmt.Errorf("remove object: %w", err)
+	for _, meta := range moved {
+		// Other files may still share the old object; it goes only with its last reference.
+		_ = s.releaseObject(ctx, objectBuckets[meta.ID], found[meta.ID].ObjectName)
+		// A listing that raced with an earlier move may have cached the file in the target bucket
+		// under its old object, so both keys go.
+		s.metaCache.remove(ownerID, sourceID, meta.ID)
+		s.metaCache.remove(ownerID, targetID, meta.ID)
+		s.audit(ctx, ownerID, audit.ActionUpdate, meta)
+		s.publish(ctx, events.FileMoved, ownerID, meta)
+
+		meta := meta
+		results[positions[meta.ID]].File = &meta
+	}
+	return results, nil
+}
+
+// Delete removes the file and its derivatives from storage and metadata. Files in an immutable
+// bucket are kept with ErrFileRetained until their retention period ends.
+func (s *Service) Delete(ctx context.Context, ownerID, bucketID, fileID uuid.UUID) error {
+	existing, err := s.Get(ctx, ownerID, bucketID, fileID)
+	if err != nil {
+		return err
+	}
+	if err := s.CheckMutable(ctx, ownerID, bucketID, existing); err != nil {
+		return err
+	}
+	objectBucket, err := s.resolveObjectBucket(ctx, ownerID)
+	if err != nil {
+		return err
 	}
 
-	if err := s.buckets.UpdateUsage(ctx, bucketID, -meta.SizeBytes, -1); err != nil {
+	meta, err := s.repo.Delete(ctx, ownerID, bucketID, fileID)
+	if err != nil {
 		return err
 	}
+	s.metaCache.remove(ownerID, bucketID, fileID)
+	s.audit(ctx, ownerID, audit.ActionDelete, meta)
+
+	// The row and its usage went together; the object and its derivatives go only once no
+	// deduplicated file still shares them. Cleanup is best-effort: an object left behind is an
+	// orphan for drift reports, not a file, so its failure does not fail the delete.
+	if err := s.releaseObject(ctx, objectBucket, meta.ObjectName); err != nil {
+		log.Printf("release object %s of deleted file %s: %v", meta.ObjectName, meta.ID, err)
+	}
 	_ = s.buckets.RecordUsageSnapshot(ctx, ownerID)
+	s.publish(ctx, events.FileDeleted, ownerID, meta)
 	return nil
 }
 
-func detectContentType(fileHeader *multipart.FileHeader) string {
-	if fileHeader == nil {
-		return "application/octet-stream"
+// batchErrorMessage describes a per-file failure without leaking storage internals.
+func batchErrorMessage(err error) string {
+	var limitErr *SizeLimitError
+	switch {
+	case errors.As(err, &limitErr):
+		return limitErr.Error()
+	case errors.Is(err, ErrContentTypeNotAllowed):
+		return ErrContentTypeNotAllowed.Error()
+	case errors.Is(err, ErrUploadRejected):
+		return err.Error()
+	case errors.Is(err, ErrQuotaExceeded):
+		return ErrQuotaExceeded.Error()
+	default:
+		return "failed to upload file"
 	}
-	contentType := fileHeader.Header.Get("Content-Type")
-	if contentType != "" {
-		return contentType
+}
+
+// resolveContentType prefers the declared part type, then the bucket default.
+func resolveContentType(fileHeader *multipart.FileHeader, target bucket.Bucket) string {
+	if fileHeader != nil {
+		if contentType := fileHeader.Header.Get("Content-Type"); contentType != "" {
+			return contentType
+		}
+	}
+	if target.DefaultContentType != nil && *target.DefaultContentType != "" {
+		return *target.DefaultContentType
 	}
 	return "application/octet-stream"
 }
@@ -188,6 +1424,15 @@ func sanitizeFilename(name string) string {
 	return name
 }
 
+// objectBelongsToBucket reports whether objectName is a valid key under the bucket's prefix.
+func objectBelongsToBucket(objectName string, bucketID uuid.UUID) bool {
+	prefix := bucketID.String() + "/"
+	if !strings.HasPrefix(objectName, prefix) {
+		return false
+	}
+	return len(objectName) > len(prefix) && validateObjectName(objectName) == nil
+}
+
 func translateBucketError(err error) error {
 	switch err {
 	case bucket.ErrBucketNotFound:
@@ -3,14 +3,24 @@ package file
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"io"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"net/textproto"
+	"reflect"
+	"sort"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/abduss/godrive/internal/bucket"
+	"github.com/abduss/godrive/internal/events"
+	"github.com/abduss/godrive/internal/storage"
 	"github.com/google/uuid"
 	"github.com/minio/minio-go/v7"
 )
@@ -29,7 +39,7 @@ func TestUploadStoresMetadataAndUpdatesUsage(t *testing.T) {
 
 	fileHeader := buildFileHeader(t, "file", "notes.txt", "text/plain", []byte("hello world"))
 
-	meta, err := service.Upload(context.Background(), ownerID, bucketID, fileHeader)
+	meta, err := service.Upload(context.Background(), ownerID, bucketID, fileHeader, UploadOptions{})
 	if err != nil {
 		t.Fatalf("Upload returned error: %v", err)
 	}
@@ -48,36 +58,1123 @@ func TestUploadStoresMetadataAndUpdatesUsage(t *testing.T) {
 	}
 }
 
+func TestUploadPublishesEventToSubscribers(t *testing.T) {
+	repo := newFakeRepo()
+	buckets := &fakeBucketStore{buckets: map[uuid.UUID]bucket.Bucket{}}
+	service := NewService(repo, buckets, &fakeObjectStore{}, "godrive")
+
+	bus := events.NewBus(8)
+	received := make(chan events.Event, 1)
+	bus.Subscribe(func(ctx context.Context, e events.Event) { received <- e }, events.FileUploaded)
+	bus.Subscribe(func(ctx context.Context, e events.Event) {
+		t.Errorf("unexpected %s delivered to a delete subscriber", e.Type)
+	}, events.FileDeleted)
+	service.SetPublisher(bus)
+
+	ownerID, bucketID := uuid.New(), uuid.New()
+	buckets.buckets[bucketID] = bucket.Bucket{ID: bucketID, OwnerID: ownerID, Name: "docs"}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	meta, err := service.Upload(ctx, ownerID, bucketID, buildFileHeader(t, "file", "notes.txt", "text/plain", []byte("hello world")), UploadOptions{})
+	cancel()
+	if err != nil {
+		t.Fatalf("Upload returned error: %v", err)
+	}
+
+	select {
+	case e := <-received:
+		if e.UserID != ownerID || e.BucketID != bucketID || e.FileID != meta.ID || e.SizeBytes != meta.SizeBytes {
+			t.Fatalf("unexpected event %+v for upload %+v", e, meta)
+		}
+		if e.OccurredAt.IsZero() {
+			t.Fatalf("expected the bus to stamp the event time")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("upload event never reached the subscriber")
+	}
+	bus.Close()
+}
+
+func TestEventsArePublishedOnlyAfterTheChangeCommits(t *testing.T) {
+	repo := newFakeRepo()
+	ownerID, sourceID, targetID := uuid.New(), uuid.New(), uuid.New()
+	buckets := &fakeBucketStore{buckets: map[uuid.UUID]bucket.Bucket{
+		sourceID: {ID: sourceID, OwnerID: ownerID, Name: "inbox"},
+		targetID: {ID: targetID, OwnerID: ownerID, Name: "archive"},
+	}}
+	service := NewService(repo, buckets, &fakeObjectStore{}, "godrive")
+	publisher := &fakePublisher{}
+	service.SetPublisher(publisher)
+
+	buckets.usageErr = errors.New("usage unavailable")
+	if _, err := service.Upload(context.Background(), ownerID, sourceID, buildFileHeader(t, "file", "notes.txt", "text/plain", []byte("hello")), UploadOptions{}); err == nil {
+		t.Fatalf("expected the usage failure to fail the upload")
+	}
+	if len(publisher.events) != 0 {
+		t.Fatalf("expected no event for an upload whose usage update failed, got %+v", publisher.events)
+	}
+	buckets.usageErr = nil
+
+	meta, err := service.Upload(context.Background(), ownerID, sourceID, buildFileHeader(t, "file", "report.txt", "text/plain", []byte("quarterly")), UploadOptions{})
+	if err != nil {
+		t.Fatalf("Upload returned error: %v", err)
+	}
+	if _, err := service.MoveBatch(context.Background(), ownerID, sourceID, targetID, []uuid.UUID{meta.ID}); err != nil {
+		t.Fatalf("move batch: %v", err)
+	}
+	if err := service.Delete(context.Background(), ownerID, targetID, meta.ID); err != nil {
+		t.Fatalf("Delete returned error: %v", err)
+	}
+
+	want := []events.Type{events.FileUploaded, events.FileMoved, events.FileDeleted}
+	if len(publisher.events) != len(want) {
+		t.Fatalf("expected events %v, got %+v", want, publisher.events)
+	}
+	for i, e := range publisher.events {
+		if e.Type != want[i] || e.FileID != meta.ID {
+			t.Fatalf("event %d: expected %s for %s, got %+v", i, want[i], meta.ID, e)
+		}
+	}
+	if publisher.events[1].BucketID != targetID {
+		t.Fatalf("expected the move event to name the target bucket, got %s", publisher.events[1].BucketID)
+	}
+}
+
 func TestDeleteRemovesMetadataAndObject(t *testing.T) {
 	repo := newFakeRepo()
-	buckets := &fakeBucketStore{
-		buckets: map[uuid.UUID]bucket.Bucket{},
+	buckets := &fakeBucketStore{
+		buckets: map[uuid.UUID]bucket.Bucket{},
+	}
+	objectStore := &fakeObjectStore{reader: bytes.NewReader([]byte("payload"))}
+	service := NewService(repo, buckets, objectStore, "godrive")
+
+	ownerID := uuid.New()
+	bucketID := uuid.New()
+	buckets.buckets[bucketID] = bucket.Bucket{ID: bucketID, OwnerID: ownerID, Name: "archive"}
+
+	fileHeader := buildFileHeader(t, "file", "data.bin", "application/octet-stream", []byte("payload"))
+	meta, err := service.Upload(context.Background(), ownerID, bucketID, fileHeader, UploadOptions{})
+	if err != nil {
+		t.Fatalf("Upload returned error: %v", err)
+	}
+
+	if err := service.Delete(context.Background(), ownerID, bucketID, meta.ID); err != nil {
+		t.Fatalf("Delete returned error: %v", err)
+	}
+
+	if objectStore.removeCount != 1 {
+		t.Fatalf("expected RemoveObject called once, got %d", objectStore.removeCount)
+	}
+	if len(repo.records) != 0 {
+		t.Fatalf("expected metadata removed, remaining %d", len(repo.records))
+	}
+	if usage := buckets.usageDelta + repo.bucketUsage[bucketID]; usage != 0 {
+		t.Fatalf("expected usage back to 0, got %d", usage)
+	}
+}
+
+func TestDeleteKeepsUsageWhenObjectCleanupFails(t *testing.T) {
+	repo := newFakeRepo()
+	buckets := &fakeBucketStore{buckets: map[uuid.UUID]bucket.Bucket{}}
+	objectStore := &fakeObjectStore{}
+	service := NewService(repo, buckets, objectStore, "godrive")
+	publisher := &fakePublisher{}
+	service.SetPublisher(publisher)
+
+	ownerID, bucketID := uuid.New(), uuid.New()
+	buckets.buckets[bucketID] = bucket.Bucket{ID: bucketID, OwnerID: ownerID, Name: "archive"}
+	meta, err := service.Upload(context.Background(), ownerID, bucketID, buildFileHeader(t, "file", "data.bin", "application/octet-stream", []byte("payload")), UploadOptions{})
+	if err != nil {
+		t.Fatalf("Upload returned error: %v", err)
+	}
+
+	objectStore.removeErr = minio.ErrorResponse{Code: "InternalError", StatusCode: http.StatusInternalServerError}
+	if err := service.Delete(context.Background(), ownerID, bucketID, meta.ID); err != nil {
+		t.Fatalf("expected the delete to succeed despite the failed cleanup, got %v", err)
+	}
+	if _, ok := repo.records[meta.ID]; ok {
+		t.Fatalf("expected metadata removed")
+	}
+	if usage := buckets.usageDelta + repo.bucketUsage[bucketID]; usage != 0 {
+		t.Fatalf("expected the usage delta applied with the metadata, got %d", usage)
+	}
+	if n := len(publisher.events); n != 2 || publisher.events[1].Type != events.FileDeleted {
+		t.Fatalf("expected the delete to be announced, got %+v", publisher.events)
+	}
+}
+
+func TestDownloadServesSmallObjectsFromCache(t *testing.T) {
+	repo := newFakeRepo()
+	buckets := &fakeBucketStore{
+		buckets: map[uuid.UUID]bucket.Bucket{},
+	}
+	objectStore := &fakeObjectStore{reader: bytes.NewReader([]byte("payload"))}
+	service := NewService(repo, buckets, objectStore, "godrive")
+	service.SetObjectCache(NewObjectCache(1024, 64))
+
+	ownerID := uuid.New()
+	bucketID := uuid.New()
+	buckets.buckets[bucketID] = bucket.Bucket{ID: bucketID, OwnerID: ownerID, Name: "archive"}
+
+	fileHeader := buildFileHeader(t, "file", "data.bin", "application/octet-stream", []byte("payload"))
+	meta, err := service.Upload(context.Background(), ownerID, bucketID, fileHeader, UploadOptions{})
+	if err != nil {
+		t.Fatalf("Upload returned error: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		_, object, err := service.Download(context.Background(), ownerID, bucketID, meta.ID)
+		if err != nil {
+			t.Fatalf("Download %d returned error: %v", i, err)
+		}
+		data, err := io.ReadAll(object)
+		object.Close()
+		if err != nil {
+			t.Fatalf("read download %d: %v", i, err)
+		}
+		if string(data) != "payload" {
+			t.Fatalf("download %d: expected payload, got %q", i, data)
+		}
+	}
+	if objectStore.getCount != 1 {
+		t.Fatalf("expected second download served from cache, got %d GetObject calls", objectStore.getCount)
+	}
+
+	if err := service.Delete(context.Background(), ownerID, bucketID, meta.ID); err != nil {
+		t.Fatalf("Delete returned error: %v", err)
+	}
+	if _, ok := service.cache.get(meta.ObjectName, meta.Checksum); ok {
+		t.Fatalf("expected cache entry invalidated on delete")
+	}
+}
+
+func TestDownloadFallsBackToCachedMetadataOnRepositoryError(t *testing.T) {
+	repo := newFakeRepo()
+	buckets := &fakeBucketStore{
+		buckets: map[uuid.UUID]bucket.Bucket{},
+	}
+	objectStore := &fakeObjectStore{reader: bytes.NewReader([]byte("payload"))}
+	service := NewService(repo, buckets, objectStore, "godrive")
+	service.SetMetadataCacheTTL(time.Minute)
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	service.nowFunc = func() time.Time { return now }
+
+	ownerID := uuid.New()
+	bucketID := uuid.New()
+	buckets.buckets[bucketID] = bucket.Bucket{ID: bucketID, OwnerID: ownerID, Name: "archive"}
+
+	cachedID, coldID := uuid.New(), uuid.New()
+	repo.records[cachedID] = Metadata{ID: cachedID, BucketID: bucketID, ObjectName: bucketID.String() + "/" + cachedID.String()}
+	if _, err := service.List(context.Background(), ownerID, bucketID, ListOptions{}); err != nil {
+		t.Fatalf("List returned error: %v", err)
+	}
+	repo.records[coldID] = Metadata{ID: coldID, BucketID: bucketID, ObjectName: bucketID.String() + "/" + coldID.String()}
+
+	repo.getErr = errors.New("connection refused")
+
+	meta, object, err := service.Download(context.Background(), ownerID, bucketID, cachedID)
+	if err != nil {
+		t.Fatalf("expected download served from cached metadata, got %v", err)
+	}
+	object.Close()
+	if meta.ID != cachedID {
+		t.Fatalf("unexpected metadata: %+v", meta)
+	}
+
+	if _, _, err := service.Download(context.Background(), ownerID, bucketID, coldID); err != repo.getErr {
+		t.Fatalf("expected repository error for uncached file, got %v", err)
+	}
+	if _, _, err := service.Download(context.Background(), uuid.New(), bucketID, cachedID); err != repo.getErr {
+		t.Fatalf("expected repository error for another owner, got %v", err)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if _, _, err := service.Download(context.Background(), ownerID, bucketID, cachedID); err != repo.getErr {
+		t.Fatalf("expected repository error once the cache expired, got %v", err)
+	}
+}
+
+func TestMoveBatchDropsCachedMetadataInBothBuckets(t *testing.T) {
+	repo := newFakeRepo()
+	ownerID, firstID, secondID := uuid.New(), uuid.New(), uuid.New()
+	buckets := &fakeBucketStore{buckets: map[uuid.UUID]bucket.Bucket{
+		firstID:  {ID: firstID, OwnerID: ownerID, Name: "inbox"},
+		secondID: {ID: secondID, OwnerID: ownerID, Name: "archive"},
+	}}
+	service := NewService(repo, buckets, &fakeObjectStore{}, "godrive")
+	service.SetMetadataCacheTTL(time.Minute)
+
+	fileID := uuid.New()
+	original := Metadata{ID: fileID, BucketID: firstID, ObjectName: firstID.String() + "/" + fileID.String()}
+	repo.records[fileID] = original
+	if _, err := service.MoveBatch(context.Background(), ownerID, firstID, secondID, []uuid.UUID{fileID}); err != nil {
+		t.Fatalf("move batch: %v", err)
+	}
+	// A listing of the first bucket that raced with the move caches the file there again.
+	service.metaCache.put(ownerID, service.nowFunc(), original)
+	if _, err := service.List(context.Background(), ownerID, secondID, ListOptions{}); err != nil {
+		t.Fatalf("List returned error: %v", err)
+	}
+	if _, err := service.MoveBatch(context.Background(), ownerID, secondID, firstID, []uuid.UUID{fileID}); err != nil {
+		t.Fatalf("move batch: %v", err)
+	}
+
+	for _, bucketID := range []uuid.UUID{firstID, secondID} {
+		if cached, ok := service.metaCache.get(ownerID, bucketID, fileID, service.nowFunc()); ok {
+			t.Fatalf("expected no cached metadata in %s after the moves, got %+v", bucketID, cached)
+		}
+	}
+}
+
+func TestDownloadFallsBackToReplicaWhenPrimaryObjectIsMissing(t *testing.T) {
+	repo := newFakeRepo()
+	buckets := &fakeBucketStore{
+		buckets: map[uuid.UUID]bucket.Bucket{},
+	}
+	objectStore := &fakeObjectStore{
+		reader:         bytes.NewReader([]byte("payload")),
+		missingBuckets: map[string]bool{"godrive": true},
+	}
+	service := NewService(repo, buckets, objectStore, "godrive")
+
+	ownerID := uuid.New()
+	bucketID := uuid.New()
+	fileID := uuid.New()
+	buckets.buckets[bucketID] = bucket.Bucket{ID: bucketID, OwnerID: ownerID, Name: "archive"}
+	repo.records[fileID] = Metadata{ID: fileID, BucketID: bucketID, ObjectName: bucketID.String() + "/" + fileID.String()}
+
+	if _, _, err := service.Download(context.Background(), ownerID, bucketID, fileID); err != ErrFileNotFound {
+		t.Fatalf("expected ErrFileNotFound without a replica, got %v", err)
+	}
+
+	service.SetReplicaBucket("godrive-replica")
+	objectStore.getBuckets = nil
+	_, object, err := service.Download(context.Background(), ownerID, bucketID, fileID)
+	if err != nil {
+		t.Fatalf("Download returned error: %v", err)
+	}
+	data, err := io.ReadAll(object)
+	object.Close()
+	if err != nil {
+		t.Fatalf("read download: %v", err)
+	}
+	if string(data) != "payload" {
+		t.Fatalf("expected payload from replica, got %q", data)
+	}
+	if len(objectStore.getBuckets) != 2 || objectStore.getBuckets[0] != "godrive" || objectStore.getBuckets[1] != "godrive-replica" {
+		t.Fatalf("expected primary then replica lookups, got %v", objectStore.getBuckets)
+	}
+
+	objectStore.missingBuckets["godrive-replica"] = true
+	if _, _, err := service.Download(context.Background(), ownerID, bucketID, fileID); err != ErrFileNotFound {
+		t.Fatalf("expected ErrFileNotFound when the replica also lacks the object, got %v", err)
+	}
+}
+
+func TestDownloadFallsBackToTheSharedBucketForTenantOwners(t *testing.T) {
+	repo := newFakeRepo()
+	buckets := &fakeBucketStore{buckets: map[uuid.UUID]bucket.Bucket{}}
+	objectStore := &fakeObjectStore{
+		reader:         bytes.NewReader([]byte("payload")),
+		missingBuckets: map[string]bool{"tenant-acme": true},
+	}
+	service := NewService(repo, buckets, objectStore, "godrive")
+
+	ownerID, bucketID, fileID := uuid.New(), uuid.New(), uuid.New()
+	service.SetTenantBuckets(storage.NewTenantBuckets("godrive", map[uuid.UUID]string{ownerID: "tenant-acme"}, nil))
+	buckets.buckets[bucketID] = bucket.Bucket{ID: bucketID, OwnerID: ownerID, Name: "archive"}
+	repo.records[fileID] = Metadata{ID: fileID, BucketID: bucketID, ObjectName: bucketID.String() + "/" + fileID.String()}
+
+	_, object, err := service.Download(context.Background(), ownerID, bucketID, fileID)
+	if err != nil {
+		t.Fatalf("expected an object stored before the tenant mapping to download, got %v", err)
+	}
+	object.Close()
+	if want := []string{"tenant-acme", "godrive"}; !reflect.DeepEqual(objectStore.getBuckets, want) {
+		t.Fatalf("expected lookups in %v, got %v", want, objectStore.getBuckets)
+	}
+
+	if err := service.Delete(context.Background(), ownerID, bucketID, fileID); err != nil {
+		t.Fatalf("Delete returned error: %v", err)
+	}
+	if objectStore.removeCount != 2 {
+		t.Fatalf("expected the object removed from the tenant and shared buckets, got %d removals", objectStore.removeCount)
+	}
+}
+
+func TestTenantOwnersReachObjectsStoredInTheSharedBucket(t *testing.T) {
+	type fixture struct {
+		service *Service
+		repo    *fakeRepo
+		buckets *fakeBucketStore
+		store   *bucketedObjectStore
+		ownerID uuid.UUID
+		legacy  Metadata
+	}
+	setup := func(t *testing.T) fixture {
+		t.Helper()
+		repo := newFakeRepo()
+		buckets := &fakeBucketStore{buckets: map[uuid.UUID]bucket.Bucket{}}
+		objectStore := newBucketedObjectStore()
+		service := NewService(repo, buckets, objectStore, "godrive")
+
+		ownerID, bucketID, fileID := uuid.New(), uuid.New(), uuid.New()
+		service.SetTenantBuckets(storage.NewTenantBuckets("godrive", map[uuid.UUID]string{ownerID: "tenant-acme"}, nil))
+		buckets.buckets[bucketID] = bucket.Bucket{ID: bucketID, OwnerID: ownerID, Name: "archive"}
+		// The object predates the owner's tenant bucket, so only the shared bucket holds it.
+		legacy := Metadata{ID: fileID, BucketID: bucketID, ObjectName: bucketID.String() + "/" + fileID.String(), OriginalFilename: "notes.txt", SizeBytes: 7}
+		repo.records[fileID] = legacy
+		objectStore.put("godrive", legacy.ObjectName, []byte("payload"))
+		return fixture{service: service, repo: repo, buckets: buckets, store: objectStore, ownerID: ownerID, legacy: legacy}
+	}
+
+	t.Run("locate", func(t *testing.T) {
+		f := setup(t)
+		service, objectStore, ownerID, legacy := f.service, f.store, f.ownerID, f.legacy
+		if got, err := service.LocateObject(context.Background(), ownerID, legacy.ObjectName); err != nil || got != "godrive" {
+			t.Fatalf("expected the legacy object in the shared bucket, got %q, %v", got, err)
+		}
+		objectStore.put("tenant-acme", "fresh", nil)
+		if got, _ := service.LocateObject(context.Background(), ownerID, "fresh"); got != "tenant-acme" {
+			t.Fatalf("expected a new object in the tenant bucket, got %q", got)
+		}
+		if got, _ := service.LocateObject(context.Background(), ownerID, "gone"); got != "tenant-acme" {
+			t.Fatalf("expected a missing object to resolve to the tenant bucket, got %q", got)
+		}
+	})
+
+	t.Run("stat download", func(t *testing.T) {
+		f := setup(t)
+		service, ownerID, legacy := f.service, f.ownerID, f.legacy
+		meta, object, err := service.StatDownload(context.Background(), ownerID, legacy.BucketID, legacy.ID, legacy.ObjectName, legacy.OriginalFilename)
+		if err != nil {
+			t.Fatalf("expected a stat download of the legacy object, got %v", err)
+		}
+		defer object.Close()
+		if data, _ := io.ReadAll(object); string(data) != "payload" || meta.SizeBytes != 7 {
+			t.Fatalf("expected the legacy object's content and size, got %q, %d bytes", data, meta.SizeBytes)
+		}
+	})
+
+	t.Run("commit replacement", func(t *testing.T) {
+		f := setup(t)
+		service, objectStore, ownerID, legacy := f.service, f.store, f.ownerID, f.legacy
+		// A presigned PUT targets the bucket the object was located in.
+		objectStore.put("godrive", legacy.ObjectName, []byte("replaced content"))
+		updated, err := service.CommitReplacement(context.Background(), ownerID, legacy.BucketID, legacy.ID)
+		if err != nil {
+			t.Fatalf("expected the replacement to commit, got %v", err)
+		}
+		if updated.SizeBytes != int64(len("replaced content")) {
+			t.Fatalf("expected the replacement's size, got %d", updated.SizeBytes)
+		}
+	})
+
+	t.Run("move", func(t *testing.T) {
+		f := setup(t)
+		service, objectStore, ownerID, legacy := f.service, f.store, f.ownerID, f.legacy
+		targetID := uuid.New()
+		f.buckets.buckets[targetID] = bucket.Bucket{ID: targetID, OwnerID: ownerID, Name: "inbox"}
+
+		results, err := service.MoveBatch(context.Background(), ownerID, legacy.BucketID, targetID, []uuid.UUID{legacy.ID})
+		if err != nil {
+			t.Fatalf("move batch: %v", err)
+		}
+		if results[0].File == nil {
+			t.Fatalf("expected the legacy file to move, got %+v", results[0])
+		}
+		moved := f.repo.records[legacy.ID]
+		if !objectStore.has("godrive", moved.ObjectName) || objectStore.has("godrive", legacy.ObjectName) {
+			t.Fatalf("expected the object copied within the shared bucket and the old one released, got %v", objectStore.objects)
+		}
+	})
+}
+
+func TestDownloadRejectsObjectOutsideBucket(t *testing.T) {
+	repo := newFakeRepo()
+	buckets := &fakeBucketStore{
+		buckets: map[uuid.UUID]bucket.Bucket{},
+	}
+	objectStore := &fakeObjectStore{}
+	service := NewService(repo, buckets, objectStore, "godrive")
+
+	ownerID := uuid.New()
+	bucketID := uuid.New()
+	otherBucketID := uuid.New()
+	fileID := uuid.New()
+	repo.bucketOwners[otherBucketID] = uuid.New()
+	repo.records[fileID] = Metadata{
+		ID:         fileID,
+		BucketID:   bucketID,
+		ObjectName: otherBucketID.String() + "/" + uuid.NewString(),
+	}
+
+	if _, _, err := service.Download(context.Background(), ownerID, bucketID, fileID); err != ErrObjectOutsideBucket {
+		t.Fatalf("expected ErrObjectOutsideBucket, got %v", err)
+	}
+	if err := service.Delete(context.Background(), ownerID, bucketID, fileID); err != ErrObjectOutsideBucket {
+		t.Fatalf("expected ErrObjectOutsideBucket on delete, got %v", err)
+	}
+	if objectStore.getCount != 0 || objectStore.removeCount != 0 {
+		t.Fatalf("expected object store untouched, got %d gets and %d removes", objectStore.getCount, objectStore.removeCount)
+	}
+	if _, ok := repo.records[fileID]; !ok {
+		t.Fatalf("expected metadata to be kept")
+	}
+}
+
+func TestUploadRejectsDisallowedContentType(t *testing.T) {
+	repo := newFakeRepo()
+	buckets := &fakeBucketStore{
+		buckets: map[uuid.UUID]bucket.Bucket{},
+	}
+	objectStore := &fakeObjectStore{}
+	service := NewService(repo, buckets, objectStore, "godrive")
+
+	ownerID := uuid.New()
+	bucketID := uuid.New()
+	defaultType := "image/png"
+	buckets.buckets[bucketID] = bucket.Bucket{
+		ID:                  bucketID,
+		OwnerID:             ownerID,
+		Name:                "images",
+		AllowedContentTypes: []string{"image/*"},
+		DefaultContentType:  &defaultType,
+	}
+
+	rejected := buildFileHeader(t, "file", "notes.txt", "text/plain", []byte("hello"))
+	if _, err := service.Upload(context.Background(), ownerID, bucketID, rejected, UploadOptions{}); err != ErrContentTypeNotAllowed {
+		t.Fatalf("expected ErrContentTypeNotAllowed, got %v", err)
+	}
+	if objectStore.putCalled {
+		t.Fatalf("expected no object stored for a rejected type")
+	}
+
+	untyped := buildFileHeader(t, "file", "photo", "", []byte("png-bytes"))
+	meta, err := service.Upload(context.Background(), ownerID, bucketID, untyped, UploadOptions{})
+	if err != nil {
+		t.Fatalf("Upload returned error: %v", err)
+	}
+	if meta.ContentType != defaultType {
+		t.Fatalf("expected bucket default content type, got %s", meta.ContentType)
+	}
+}
+
+func TestUploadEnforcesGlobalAndBucketSizeLimits(t *testing.T) {
+	repo := newFakeRepo()
+	buckets := &fakeBucketStore{
+		buckets: map[uuid.UUID]bucket.Bucket{},
+	}
+	objectStore := &fakeObjectStore{}
+	service := NewService(repo, buckets, objectStore, "godrive")
+	service.SetMaxFileSize(32)
+
+	ownerID := uuid.New()
+	globalID := uuid.New()
+	tightID := uuid.New()
+	looseID := uuid.New()
+	tightLimit, looseLimit := int64(8), int64(1024)
+	buckets.buckets[globalID] = bucket.Bucket{ID: globalID, OwnerID: ownerID, Name: "global"}
+	buckets.buckets[tightID] = bucket.Bucket{ID: tightID, OwnerID: ownerID, Name: "small", MaxFileSizeBytes: &tightLimit}
+	buckets.buckets[looseID] = bucket.Bucket{ID: looseID, OwnerID: ownerID, Name: "large", MaxFileSizeBytes: &looseLimit}
+
+	payload := []byte("sixteen byte msg")
+	oversized := bytes.Repeat([]byte("x"), 64)
+
+	if _, err := service.Upload(context.Background(), ownerID, globalID, buildFileHeader(t, "file", "a.txt", "text/plain", payload), UploadOptions{}); err != nil {
+		t.Fatalf("expected upload under the global limit, got %v", err)
+	}
+	_, err := service.Upload(context.Background(), ownerID, globalID, buildFileHeader(t, "file", "b.txt", "text/plain", oversized), UploadOptions{})
+	var limitErr *SizeLimitError
+	if !errors.As(err, &limitErr) || limitErr.Limit != 32 {
+		t.Fatalf("expected global limit of 32 bytes, got %v", err)
+	}
+	if !errors.Is(err, ErrFileTooLarge) {
+		t.Fatalf("expected error to match ErrFileTooLarge")
+	}
+
+	_, err = service.Upload(context.Background(), ownerID, tightID, buildFileHeader(t, "file", "c.txt", "text/plain", payload), UploadOptions{})
+	if !errors.As(err, &limitErr) || limitErr.Limit != tightLimit {
+		t.Fatalf("expected bucket limit of %d bytes to tighten the global one, got %v", tightLimit, err)
+	}
+
+	_, err = service.Upload(context.Background(), ownerID, looseID, buildFileHeader(t, "file", "d.txt", "text/plain", oversized), UploadOptions{})
+	if !errors.As(err, &limitErr) || limitErr.Limit != 32 {
+		t.Fatalf("expected a larger bucket limit to be capped at the global 32 bytes, got %v", err)
+	}
+}
+
+func TestRehashStreamsObjectAndUpdatesChecksum(t *testing.T) {
+	repo := newFakeRepo()
+	buckets := &fakeBucketStore{
+		buckets: map[uuid.UUID]bucket.Bucket{},
+	}
+	content := []byte("known object bytes")
+	objectStore := &fakeObjectStore{}
+	service := NewService(repo, buckets, objectStore, "godrive")
+
+	ownerID := uuid.New()
+	bucketID := uuid.New()
+	fileID := uuid.New()
+	buckets.buckets[bucketID] = bucket.Bucket{ID: bucketID, OwnerID: ownerID, Name: "docs"}
+	repo.records[fileID] = Metadata{
+		ID:         fileID,
+		BucketID:   bucketID,
+		ObjectName: fmt.Sprintf("%s/%s", bucketID, fileID),
+		Checksum:   "stale",
+	}
+
+	sum := sha256.Sum256(content)
+	want := hex.EncodeToString(sum[:])
+
+	objectStore.reader = bytes.NewReader(content)
+	meta, err := service.Rehash(context.Background(), ownerID, bucketID, fileID)
+	if err != nil {
+		t.Fatalf("Rehash returned error: %v", err)
+	}
+	if meta.Checksum != want || repo.records[fileID].Checksum != want {
+		t.Fatalf("expected checksum %s, got %s", want, meta.Checksum)
+	}
+
+	objectStore.reader = bytes.NewReader(content)
+	if _, err := service.Rehash(context.Background(), ownerID, bucketID, fileID); err != nil {
+		t.Fatalf("second Rehash returned error: %v", err)
+	}
+	if repo.checksumUpdates != 1 {
+		t.Fatalf("expected unchanged checksum to skip the update, got %d updates", repo.checksumUpdates)
+	}
+}
+
+func TestCommitReplacementAdjustsUsageBySizeDelta(t *testing.T) {
+	repo := newFakeRepo()
+	buckets := &fakeBucketStore{
+		buckets: map[uuid.UUID]bucket.Bucket{},
+	}
+	objectStore := &fakeObjectStore{}
+	service := NewService(repo, buckets, objectStore, "godrive")
+
+	ownerID := uuid.New()
+	bucketID := uuid.New()
+	buckets.buckets[bucketID] = bucket.Bucket{ID: bucketID, OwnerID: ownerID, Name: "docs"}
+
+	fileHeader := buildFileHeader(t, "file", "notes.txt", "text/plain", []byte("0123456789"))
+	meta, err := service.Upload(context.Background(), ownerID, bucketID, fileHeader, UploadOptions{})
+	if err != nil {
+		t.Fatalf("Upload returned error: %v", err)
+	}
+	if buckets.usageDelta != 10 {
+		t.Fatalf("expected usage of 10 bytes after upload, got %d", buckets.usageDelta)
+	}
+
+	steps := []struct {
+		content   string
+		wantUsage int64
+	}{
+		{content: "0123456789abcdefghij", wantUsage: 20},
+		{content: "0123", wantUsage: 4},
+		{content: "4567", wantUsage: 4},
+	}
+	for _, step := range steps {
+		objectStore.reader = strings.NewReader(step.content)
+		updated, err := service.CommitReplacement(context.Background(), ownerID, bucketID, meta.ID)
+		if err != nil {
+			t.Fatalf("CommitReplacement returned error: %v", err)
+		}
+		sum := sha256.Sum256([]byte(step.content))
+		if updated.SizeBytes != int64(len(step.content)) || updated.Checksum != hex.EncodeToString(sum[:]) {
+			t.Fatalf("unexpected metadata after replacing with %q: %+v", step.content, updated)
+		}
+		if usage := buckets.usageDelta + repo.bucketUsage[bucketID]; usage != step.wantUsage {
+			t.Fatalf("after replacing with %q expected usage %d, got %d", step.content, step.wantUsage, usage)
+		}
+	}
+	if buckets.usageCalls != 1 {
+		t.Fatalf("expected the replacement delta to be applied with the metadata update, got %d UpdateUsage calls", buckets.usageCalls)
+	}
+}
+
+func TestCommitReplacementDeletesFilesOverTheLimits(t *testing.T) {
+	repo := newFakeRepo()
+	buckets := &fakeBucketStore{buckets: map[uuid.UUID]bucket.Bucket{}}
+	objectStore := &fakeObjectStore{}
+	service := NewService(repo, buckets, objectStore, "godrive")
+
+	ownerID, bucketID := uuid.New(), uuid.New()
+	limit := int64(16)
+	buckets.buckets[bucketID] = bucket.Bucket{ID: bucketID, OwnerID: ownerID, Name: "docs", MaxFileSizeBytes: &limit}
+
+	upload := func() Metadata {
+		t.Helper()
+		meta, err := service.Upload(context.Background(), ownerID, bucketID, buildFileHeader(t, "file", "notes.txt", "text/plain", []byte("0123")), UploadOptions{})
+		if err != nil {
+			t.Fatalf("Upload returned error: %v", err)
+		}
+		return meta
+	}
+
+	oversized := upload()
+	objectStore.reader = strings.NewReader(strings.Repeat("x", 17))
+	var limitErr *SizeLimitError
+	if _, err := service.CommitReplacement(context.Background(), ownerID, bucketID, oversized.ID); !errors.As(err, &limitErr) || limitErr.Limit != limit {
+		t.Fatalf("expected a SizeLimitError of %d, got %v", limit, err)
+	}
+	if _, ok := repo.records[oversized.ID]; ok {
+		t.Fatalf("expected the oversized replacement to be deleted")
+	}
+
+	service.SetMaxAccountBytes(10)
+	overQuota := upload()
+	objectStore.reader = strings.NewReader(strings.Repeat("x", 12))
+	if _, err := service.CommitReplacement(context.Background(), ownerID, bucketID, overQuota.ID); err != ErrQuotaExceeded {
+		t.Fatalf("expected ErrQuotaExceeded, got %v", err)
+	}
+	if _, ok := repo.records[overQuota.ID]; ok {
+		t.Fatalf("expected the replacement over quota to be deleted")
+	}
+	if usage := buckets.usageDelta + repo.bucketUsage[bucketID]; usage != 0 {
+		t.Fatalf("expected usage to drop back to 0, got %d", usage)
+	}
+}
+
+func TestUploadBatchReportsPartialSuccess(t *testing.T) {
+	repo := newFakeRepo()
+	buckets := &fakeBucketStore{
+		buckets: map[uuid.UUID]bucket.Bucket{},
+	}
+	objectStore := &fakeObjectStore{}
+	service := NewService(repo, buckets, objectStore, "godrive")
+	service.SetMaxFileSize(10)
+	service.SetMaxBatchSize(12)
+
+	ownerID := uuid.New()
+	bucketID := uuid.New()
+	buckets.buckets[bucketID] = bucket.Bucket{ID: bucketID, OwnerID: ownerID, Name: "docs"}
+
+	headers := []*multipart.FileHeader{
+		buildFileHeader(t, "file", "small.txt", "text/plain", []byte("hello")),
+		buildFileHeader(t, "file", "oversized.txt", "text/plain", []byte("this is far too long")),
+		buildFileHeader(t, "file", "second.txt", "text/plain", []byte("world")),
+		buildFileHeader(t, "file", "over-aggregate.txt", "text/plain", []byte("abc")),
+	}
+
+	results, err := service.UploadBatch(context.Background(), ownerID, bucketID, headers)
+	if err != nil {
+		t.Fatalf("UploadBatch returned error: %v", err)
+	}
+	if len(results) != len(headers) {
+		t.Fatalf("expected %d results, got %d", len(headers), len(results))
+	}
+
+	if results[0].File == nil || results[2].File == nil {
+		t.Fatalf("expected small files to be stored: %+v", results)
+	}
+	if results[1].File != nil || results[1].Error == "" {
+		t.Fatalf("expected oversized file to be rejected: %+v", results[1])
+	}
+	if results[3].File != nil || results[3].Error != ErrBatchTooLarge.Error() {
+		t.Fatalf("expected aggregate limit rejection, got %+v", results[3])
+	}
+
+	if len(repo.records) != 2 {
+		t.Fatalf("expected 2 stored files, got %d", len(repo.records))
+	}
+	if buckets.usageDelta != 10 || buckets.usageCalls != 1 {
+		t.Fatalf("expected one usage update of 10 bytes, got %d bytes over %d calls", buckets.usageDelta, buckets.usageCalls)
+	}
+}
+
+func TestUploadEnforcesAccountQuota(t *testing.T) {
+	repo := newFakeRepo()
+	buckets := &fakeBucketStore{buckets: map[uuid.UUID]bucket.Bucket{}, accountBytes: 90}
+	objectStore := &fakeObjectStore{}
+	service := NewService(repo, buckets, objectStore, "godrive")
+
+	ownerID := uuid.New()
+	bucketID := uuid.New()
+	buckets.buckets[bucketID] = bucket.Bucket{ID: bucketID, OwnerID: ownerID, Name: "docs"}
+
+	unlimited := buildFileHeader(t, "file", "big.bin", "application/octet-stream", bytes.Repeat([]byte("x"), 50))
+	if _, err := service.Upload(context.Background(), ownerID, bucketID, unlimited, UploadOptions{}); err != nil {
+		t.Fatalf("expected no account cap by default, got %v", err)
 	}
-	objectStore := &fakeObjectStore{reader: bytes.NewReader([]byte("payload"))}
+	if buckets.aggregateCalls != 0 {
+		t.Fatalf("expected no aggregate query without a cap, got %d", buckets.aggregateCalls)
+	}
+
+	// 90 + 50 bytes already stored; the cap leaves room for exactly 10 more.
+	service.SetMaxAccountBytes(150)
+	fits := buildFileHeader(t, "file", "fits.txt", "text/plain", bytes.Repeat([]byte("x"), 10))
+	if _, err := service.Upload(context.Background(), ownerID, bucketID, fits, UploadOptions{}); err != nil {
+		t.Fatalf("expected upload filling the cap to succeed, got %v", err)
+	}
+
+	over := buildFileHeader(t, "file", "over.txt", "text/plain", []byte("x"))
+	if _, err := service.Upload(context.Background(), ownerID, bucketID, over, UploadOptions{}); err != ErrQuotaExceeded {
+		t.Fatalf("expected ErrQuotaExceeded, got %v", err)
+	}
+	if buckets.aggregateCalls != 2 {
+		t.Fatalf("expected one aggregate query per upload, got %d", buckets.aggregateCalls)
+	}
+	if len(repo.records) != 2 {
+		t.Fatalf("expected rejected upload not to be stored, got %d records", len(repo.records))
+	}
+}
+
+func TestUploadNoOverwriteRejectsExistingFilename(t *testing.T) {
+	repo := newFakeRepo()
+	buckets := &fakeBucketStore{buckets: map[uuid.UUID]bucket.Bucket{}}
+	service := NewService(repo, buckets, &fakeObjectStore{}, "godrive")
+
+	ownerID := uuid.New()
+	bucketID := uuid.New()
+	buckets.buckets[bucketID] = bucket.Bucket{ID: bucketID, OwnerID: ownerID, Name: "docs"}
+
+	upload := func(opts UploadOptions) error {
+		header := buildFileHeader(t, "file", "report.pdf", "application/pdf", []byte("v1"))
+		_, err := service.Upload(context.Background(), ownerID, bucketID, header, opts)
+		return err
+	}
+
+	if err := upload(UploadOptions{NoOverwrite: true}); err != nil {
+		t.Fatalf("first no-overwrite upload should succeed, got %v", err)
+	}
+	if err := upload(UploadOptions{}); err != nil {
+		t.Fatalf("default upload should allow duplicate names, got %v", err)
+	}
+	if len(repo.records) != 2 {
+		t.Fatalf("expected duplicate stored alongside original, got %d records", len(repo.records))
+	}
+	if err := upload(UploadOptions{NoOverwrite: true}); err != ErrFileNameExists {
+		t.Fatalf("expected ErrFileNameExists, got %v", err)
+	}
+	if len(repo.records) != 2 {
+		t.Fatalf("expected rejected upload not to be stored, got %d records", len(repo.records))
+	}
+}
+
+func TestUploadRejectsEmptyParts(t *testing.T) {
+	repo := newFakeRepo()
+	buckets := &fakeBucketStore{buckets: map[uuid.UUID]bucket.Bucket{}}
+	objectStore := &fakeObjectStore{}
 	service := NewService(repo, buckets, objectStore, "godrive")
 
 	ownerID := uuid.New()
 	bucketID := uuid.New()
-	buckets.buckets[bucketID] = bucket.Bucket{ID: bucketID, OwnerID: ownerID, Name: "archive"}
+	buckets.buckets[bucketID] = bucket.Bucket{ID: bucketID, OwnerID: ownerID, Name: "docs"}
 
-	fileHeader := buildFileHeader(t, "file", "data.bin", "application/octet-stream", []byte("payload"))
-	meta, err := service.Upload(context.Background(), ownerID, bucketID, fileHeader)
-	if err != nil {
-		t.Fatalf("Upload returned error: %v", err)
+	zeroByte := buildFileHeader(t, "file", "empty.txt", "text/plain", nil)
+	if _, err := service.Upload(context.Background(), ownerID, bucketID, zeroByte, UploadOptions{}); err != ErrEmptyUpload {
+		t.Fatalf("expected ErrEmptyUpload for zero-byte part, got %v", err)
 	}
 
-	if err := service.Delete(context.Background(), ownerID, bucketID, meta.ID); err != nil {
-		t.Fatalf("Delete returned error: %v", err)
+	blankName := buildFileHeader(t, "file", "   ", "text/plain", []byte("data"))
+	if _, err := service.Upload(context.Background(), ownerID, bucketID, blankName, UploadOptions{}); err != ErrEmptyUpload {
+		t.Fatalf("expected ErrEmptyUpload for blank filename, got %v", err)
+	}
+	if objectStore.putCalled {
+		t.Fatalf("expected rejected parts never to reach object storage")
+	}
+
+	service.SetAllowEmptyFiles(true)
+	if _, err := service.Upload(context.Background(), ownerID, bucketID, zeroByte, UploadOptions{}); err != nil {
+		t.Fatalf("expected zero-byte upload to be allowed when configured, got %v", err)
+	}
+	if _, err := service.Upload(context.Background(), ownerID, bucketID, blankName, UploadOptions{}); err != ErrEmptyUpload {
+		t.Fatalf("expected blank filename to stay rejected, got %v", err)
+	}
+}
+
+func TestUploadRejectsGloballyBlockedContentTypes(t *testing.T) {
+	repo := newFakeRepo()
+	buckets := &fakeBucketStore{buckets: map[uuid.UUID]bucket.Bucket{}}
+	objectStore := &fakeObjectStore{}
+	service := NewService(repo, buckets, objectStore, "godrive")
+	service.SetBlockedContentTypes([]string{"text/html", "application/x-*"})
+	service.SetBlockedExtensions([]string{"EXE"})
+
+	ownerID := uuid.New()
+	bucketID := uuid.New()
+	buckets.buckets[bucketID] = bucket.Bucket{ID: bucketID, OwnerID: ownerID, Name: "inbox"}
+
+	disguised := buildFileHeader(t, "file", "cat.png", "image/png", []byte("<!DOCTYPE html><script>alert(1)</script>"))
+	if _, err := service.Upload(context.Background(), ownerID, bucketID, disguised, UploadOptions{}); err != ErrContentTypeNotAllowed {
+		t.Fatalf("expected sniffed html to be rejected, got %v", err)
+	}
+	declared := buildFileHeader(t, "file", "run.sh", "application/x-sh", []byte("echo hi"))
+	if _, err := service.Upload(context.Background(), ownerID, bucketID, declared, UploadOptions{}); err != ErrContentTypeNotAllowed {
+		t.Fatalf("expected wildcard-blocked type to be rejected, got %v", err)
+	}
+	renamed := buildFileHeader(t, "file", "setup.Exe", "text/plain", []byte("plain text"))
+	if _, err := service.Upload(context.Background(), ownerID, bucketID, renamed, UploadOptions{}); err != ErrContentTypeNotAllowed {
+		t.Fatalf("expected blocked extension to be rejected, got %v", err)
+	}
+	if objectStore.putCalled || len(repo.records) != 0 {
+		t.Fatalf("expected blocked uploads to never reach storage")
 	}
 
+	benign := buildFileHeader(t, "file", "notes.txt", "text/plain", []byte("just notes"))
+	if _, err := service.Upload(context.Background(), ownerID, bucketID, benign, UploadOptions{}); err != nil {
+		t.Fatalf("expected benign upload to succeed, got %v", err)
+	}
+}
+
+func TestUploadRejectedByScannerRemovesObject(t *testing.T) {
+	repo := newFakeRepo()
+	buckets := &fakeBucketStore{buckets: map[uuid.UUID]bucket.Bucket{}}
+	objectStore := &fakeObjectStore{}
+	service := NewService(repo, buckets, objectStore, "godrive")
+	service.SetScanner(&fakeScanner{signature: "EICAR"})
+
+	ownerID := uuid.New()
+	bucketID := uuid.New()
+	buckets.buckets[bucketID] = bucket.Bucket{ID: bucketID, OwnerID: ownerID, Name: "inbox"}
+
+	infected := buildFileHeader(t, "file", "invoice.pdf", "application/pdf", []byte("X5O!P%@AP EICAR test"))
+	_, err := service.Upload(context.Background(), ownerID, bucketID, infected, UploadOptions{})
+	var rejectedErr *RejectedError
+	if !errors.As(err, &rejectedErr) || !errors.Is(err, ErrUploadRejected) {
+		t.Fatalf("expected ErrUploadRejected, got %v", err)
+	}
+	if rejectedErr.Reason != "signature EICAR found" {
+		t.Fatalf("unexpected rejection reason %q", rejectedErr.Reason)
+	}
 	if objectStore.removeCount != 1 {
-		t.Fatalf("expected RemoveObject called once, got %d", objectStore.removeCount)
+		t.Fatalf("expected the stored object to be removed, got %d removes", objectStore.removeCount)
+	}
+	if len(repo.records) != 0 || buckets.usageCalls != 0 {
+		t.Fatalf("expected no metadata or usage for a rejected upload")
+	}
+
+	clean := buildFileHeader(t, "file", "notes.txt", "text/plain", []byte("quarterly notes"))
+	if _, err := service.Upload(context.Background(), ownerID, bucketID, clean, UploadOptions{}); err != nil {
+		t.Fatalf("expected clean upload to succeed, got %v", err)
+	}
+	if len(repo.records) != 1 {
+		t.Fatalf("expected clean upload to be recorded, got %d records", len(repo.records))
+	}
+}
+
+func TestUploadOfUnknownSizeAbortsPastLimits(t *testing.T) {
+	repo := newFakeRepo()
+	buckets := &fakeBucketStore{buckets: map[uuid.UUID]bucket.Bucket{}}
+	objectStore := &fakeObjectStore{}
+	service := NewService(repo, buckets, objectStore, "godrive")
+	service.SetMaxFileSize(64)
+	service.SetMaxAccountBytes(40)
+
+	ownerID := uuid.New()
+	bucketID := uuid.New()
+	buckets.buckets[bucketID] = bucket.Bucket{ID: bucketID, OwnerID: ownerID, Name: "stream"}
+	buckets.accountBytes = 10
+
+	unknownSize := func(name string, content []byte) *multipart.FileHeader {
+		header := buildFileHeader(t, "file", name, "application/octet-stream", content)
+		header.Size = -1
+		return header
+	}
+
+	_, err := service.Upload(context.Background(), ownerID, bucketID, unknownSize("big.bin", bytes.Repeat([]byte("q"), 31)), UploadOptions{})
+	if err != ErrQuotaExceeded {
+		t.Fatalf("expected ErrQuotaExceeded for unknown-size upload over quota, got %v", err)
+	}
+	if objectStore.removeCount != 1 {
+		t.Fatalf("expected the partial object to be removed, got %d removes", objectStore.removeCount)
+	}
+	if len(repo.records) != 0 || buckets.usageCalls != 0 {
+		t.Fatalf("expected no metadata or usage for an aborted upload")
+	}
+
+	service.SetMaxAccountBytes(0)
+	_, err = service.Upload(context.Background(), ownerID, bucketID, unknownSize("huge.bin", bytes.Repeat([]byte("q"), 65)), UploadOptions{})
+	var limitErr *SizeLimitError
+	if !errors.As(err, &limitErr) || limitErr.Limit != 64 {
+		t.Fatalf("expected file size limit for unknown-size upload, got %v", err)
+	}
+	if objectStore.removeCount != 2 {
+		t.Fatalf("expected the partial object to be removed, got %d removes", objectStore.removeCount)
+	}
+
+	stored, err := service.Upload(context.Background(), ownerID, bucketID, unknownSize("ok.bin", []byte("fits")), UploadOptions{})
+	if err != nil {
+		t.Fatalf("expected unknown-size upload within limits to succeed, got %v", err)
+	}
+	if stored.SizeBytes != 4 {
+		t.Fatalf("expected measured size of 4 bytes, got %d", stored.SizeBytes)
+	}
+
+	service.SetRequireKnownSize(true)
+	if _, err := service.Upload(context.Background(), ownerID, bucketID, unknownSize("ok.bin", []byte("fits")), UploadOptions{}); err != ErrLengthRequired {
+		t.Fatalf("expected ErrLengthRequired when sizes are mandatory, got %v", err)
+	}
+}
+
+func TestObjectDriftFlagsOrphansAndMissingObjects(t *testing.T) {
+	repo := newFakeRepo()
+	buckets := &fakeBucketStore{buckets: map[uuid.UUID]bucket.Bucket{}}
+	objectStore := &fakeObjectStore{}
+	service := NewService(repo, buckets, objectStore, "godrive")
+
+	ownerID, bucketID, otherBucketID := uuid.New(), uuid.New(), uuid.New()
+	buckets.buckets[bucketID] = bucket.Bucket{ID: bucketID, OwnerID: ownerID, Name: "docs"}
+
+	matched, missing := uuid.New(), uuid.New()
+	repo.records[matched] = Metadata{ID: matched, BucketID: bucketID, ObjectName: bucketID.String() + "/" + matched.String()}
+	repo.records[missing] = Metadata{ID: missing, BucketID: bucketID, ObjectName: bucketID.String() + "/" + missing.String()}
+	orphanKey := bucketID.String() + "/" + uuid.NewString()
+	objectStore.objects = []minio.ObjectInfo{
+		{Key: bucketID.String() + "/" + matched.String(), Size: 10},
+		{Key: derivativePrefix(bucketID.String()+"/"+matched.String()) + "thumbnail.jpg", Size: 2},
+		{Key: orphanKey, Size: 7},
+		{Key: otherBucketID.String() + "/" + uuid.NewString(), Size: 3},
+	}
+
+	report, err := service.ObjectDrift(context.Background(), ownerID, bucketID)
+	if err != nil {
+		t.Fatalf("ObjectDrift returned error: %v", err)
+	}
+	if report.Matched != 1 {
+		t.Fatalf("expected 1 matched object, got %d", report.Matched)
+	}
+	if len(report.OrphanObjects) != 1 || report.OrphanObjects[0].Key != orphanKey || report.OrphanObjects[0].SizeBytes != 7 {
+		t.Fatalf("unexpected orphan objects %+v", report.OrphanObjects)
+	}
+	if len(report.MissingObjects) != 1 || report.MissingObjects[0].ID != missing {
+		t.Fatalf("unexpected missing objects %+v", report.MissingObjects)
+	}
+
+	if _, err := service.ObjectDrift(context.Background(), uuid.New(), bucketID); err != ErrBucketMismatch {
+		t.Fatalf("expected ErrBucketMismatch for non-owner, got %v", err)
+	}
+}
+
+func TestUploadReplaysIdempotencyKey(t *testing.T) {
+	repo := newFakeRepo()
+	buckets := &fakeBucketStore{buckets: map[uuid.UUID]bucket.Bucket{}}
+	service := NewService(repo, buckets, &fakeObjectStore{}, "godrive")
+
+	ownerID, bucketID, otherBucketID := uuid.New(), uuid.New(), uuid.New()
+	buckets.buckets[bucketID] = bucket.Bucket{ID: bucketID, OwnerID: ownerID, Name: "docs"}
+	buckets.buckets[otherBucketID] = bucket.Bucket{ID: otherBucketID, OwnerID: ownerID, Name: "other"}
+
+	upload := func(bucketID uuid.UUID, key string) Metadata {
+		t.Helper()
+		header := buildFileHeader(t, "file", "retry.txt", "text/plain", []byte("payload"))
+		meta, err := service.Upload(context.Background(), ownerID, bucketID, header, UploadOptions{IdempotencyKey: key})
+		if err != nil {
+			t.Fatalf("Upload returned error: %v", err)
+		}
+		return meta
+	}
+
+	first := upload(bucketID, "req-1")
+	second := upload(bucketID, "req-1")
+	if first.ID != second.ID {
+		t.Fatalf("expected replay to return file %s, got %s", first.ID, second.ID)
+	}
+	if len(repo.records) != 1 {
+		t.Fatalf("expected a single stored file, got %d", len(repo.records))
+	}
+	if buckets.usageCalls != 1 {
+		t.Fatalf("expected usage updated once, got %d", buckets.usageCalls)
+	}
+
+	if other := upload(otherBucketID, "req-1"); other.ID == first.ID {
+		t.Fatalf("expected keys to be scoped per bucket")
+	}
+	if fresh := upload(bucketID, "req-2"); fresh.ID == first.ID {
+		t.Fatalf("expected a new key to create a new file")
+	}
+}
+
+func TestUploadReservesIdempotencyKeyBeforeStoring(t *testing.T) {
+	repo := newFakeRepo()
+	buckets := &fakeBucketStore{buckets: map[uuid.UUID]bucket.Bucket{}}
+	service := NewService(repo, buckets, &fakeObjectStore{}, "godrive")
+
+	ownerID, bucketID := uuid.New(), uuid.New()
+	buckets.buckets[bucketID] = bucket.Bucket{ID: bucketID, OwnerID: ownerID, Name: "docs"}
+
+	upload := func(opts UploadOptions) (Metadata, error) {
+		header := buildFileHeader(t, "file", "retry.txt", "text/plain", []byte("payload"))
+		return service.Upload(context.Background(), ownerID, bucketID, header, opts)
+	}
+
+	// A first attempt that is still storing its object holds the key.
+	repo.idempotencyKeys[bucketID.String()+"/req-1"] = uuid.Nil
+	if _, err := upload(UploadOptions{IdempotencyKey: "req-1"}); err != ErrUploadInProgress {
+		t.Fatalf("expected ErrUploadInProgress while the first attempt runs, got %v", err)
 	}
 	if len(repo.records) != 0 {
-		t.Fatalf("expected metadata removed, remaining %d", len(repo.records))
+		t.Fatalf("expected the concurrent attempt not to store a file, got %d", len(repo.records))
+	}
+
+	// A failed attempt releases its key so the retry can go through.
+	buckets.buckets[bucketID] = bucket.Bucket{ID: bucketID, OwnerID: ownerID, Name: "docs", AllowedContentTypes: []string{"image/png"}}
+	if _, err := upload(UploadOptions{IdempotencyKey: "req-2"}); err == nil {
+		t.Fatalf("expected the upload to be rejected by the bucket")
+	}
+	if _, held := repo.idempotencyKeys[bucketID.String()+"/req-2"]; held {
+		t.Fatalf("expected a failed upload to release its idempotency key")
+	}
+	buckets.buckets[bucketID] = bucket.Bucket{ID: bucketID, OwnerID: ownerID, Name: "docs"}
+	stored, err := upload(UploadOptions{IdempotencyKey: "req-2"})
+	if err != nil {
+		t.Fatalf("retry after failure: %v", err)
+	}
+	if repo.idempotencyKeys[bucketID.String()+"/req-2"] != stored.ID {
+		t.Fatalf("expected the key to record the stored file")
+	}
+}
+
+func TestUploadRetriesTransientStoreFailures(t *testing.T) {
+	repo := newFakeRepo()
+	buckets := &fakeBucketStore{buckets: map[uuid.UUID]bucket.Bucket{}}
+	unavailable := minio.ErrorResponse{Code: "ServiceUnavailable", StatusCode: http.StatusServiceUnavailable}
+	objectStore := &fakeObjectStore{putFailures: []error{unavailable}}
+	service := NewService(repo, buckets, objectStore, "godrive")
+	service.SetUploadRetryPolicy(RetryPolicy{Attempts: 2})
+
+	ownerID := uuid.New()
+	bucketID := uuid.New()
+	buckets.buckets[bucketID] = bucket.Bucket{ID: bucketID, OwnerID: ownerID, Name: "docs"}
+
+	content := []byte("hello world")
+	meta, err := service.Upload(context.Background(), ownerID, bucketID, buildFileHeader(t, "file", "notes.txt", "text/plain", content), UploadOptions{})
+	if err != nil {
+		t.Fatalf("expected the upload to succeed on retry, got %v", err)
+	}
+	if objectStore.putCount != 2 {
+		t.Fatalf("expected 2 store attempts, got %d", objectStore.putCount)
+	}
+	sum := sha256.Sum256(content)
+	if meta.SizeBytes != int64(len(content)) || meta.Checksum != hex.EncodeToString(sum[:]) {
+		t.Fatalf("expected the retry to hash and count the whole body once, got %d bytes, checksum %s", meta.SizeBytes, meta.Checksum)
+	}
+
+	objectStore = &fakeObjectStore{putFailures: []error{minio.ErrorResponse{Code: "AccessDenied", StatusCode: http.StatusForbidden}}}
+	service = NewService(repo, buckets, objectStore, "godrive")
+	service.SetUploadRetryPolicy(RetryPolicy{Attempts: 2})
+	if _, err := service.Upload(context.Background(), ownerID, bucketID, buildFileHeader(t, "file", "other.txt", "text/plain", content), UploadOptions{}); err != ErrObjectAccessDenied {
+		t.Fatalf("expected ErrObjectAccessDenied, got %v", err)
+	}
+	if objectStore.putCount != 1 {
+		t.Fatalf("expected a fatal error not to be retried, got %d attempts", objectStore.putCount)
 	}
-	if buckets.usageDelta != 0 {
-		t.Fatalf("expected usage delta reset to 0, got %d", buckets.usageDelta)
+}
+
+func TestObjectBelongsToBucket(t *testing.T) {
+	bucketID := uuid.New()
+	cases := map[string]bool{
+		bucketID.String() + "/" + uuid.NewString():    true,
+		uuid.NewString() + "/" + uuid.NewString():     false,
+		bucketID.String() + "/":                       false,
+		bucketID.String() + "/../" + uuid.NewString(): false,
+		bucketID.String() + uuid.NewString():          false,
+	}
+	for name, want := range cases {
+		if got := objectBelongsToBucket(name, bucketID); got != want {
+			t.Fatalf("objectBelongsToBucket(%q) = %v, want %v", name, got, want)
+		}
 	}
 }
 
@@ -87,9 +1184,14 @@ func buildFileHeader(t *testing.T, fieldName, filename, contentType string, cont
 	t.Helper()
 	body := &bytes.Buffer{}
 	writer := multipart.NewWriter(body)
-	part, err := writer.CreateFormFile(fieldName, filename)
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name=%q; filename=%q`, fieldName, filename))
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	part, err := writer.CreatePart(header)
 	if err != nil {
-		t.Fatalf("CreateFormFile error: %v", err)
+		t.Fatalf("CreatePart error: %v", err)
 	}
 	if _, err := part.Write(content); err != nil {
 		t.Fatalf("write part: %v", err)
@@ -105,32 +1207,220 @@ func buildFileHeader(t *testing.T, fieldName, filename, contentType string, cont
 	return req.MultipartForm.File[fieldName][0]
 }
 
+func TestMoveBatchKeepsFailedCopiesInSource(t *testing.T) {
+	repo := newFakeRepo()
+	ownerID, sourceID, targetID := uuid.New(), uuid.New(), uuid.New()
+	buckets := &fakeBucketStore{buckets: map[uuid.UUID]bucket.Bucket{
+		sourceID: {ID: sourceID, OwnerID: ownerID, Name: "inbox"},
+		targetID: {ID: targetID, OwnerID: ownerID, Name: "archive"},
+	}}
+	objectStore := &fakeObjectStore{copyFail: make(map[string]bool)}
+	service := NewService(repo, buckets, objectStore, "godrive")
+
+	var ids []uuid.UUID
+	for i, size := range []int64{10, 20, 40} {
+		id := uuid.New()
+		name := fmt.Sprintf("%s/%s", sourceID, id)
+		repo.records[id] = Metadata{ID: id, BucketID: sourceID, ObjectName: name, OriginalFilename: fmt.Sprintf("doc-%d.txt", i), SizeBytes: size}
+		ids = append(ids, id)
+	}
+	objectStore.copyFail[repo.records[ids[1]].ObjectName] = true
+	missing := uuid.New()
+
+	results, err := service.MoveBatch(context.Background(), ownerID, sourceID, targetID, append(ids, missing))
+	if err != nil {
+		t.Fatalf("move batch: %v", err)
+	}
+	if len(results) != 4 {
+		t.Fatalf("expected a result per requested id, got %d", len(results))
+	}
+	for i, want := range []bool{true, false, true, false} {
+		if moved := results[i].File != nil; moved != want {
+			t.Fatalf("result %d: expected moved=%v, got %+v", i, want, results[i])
+		}
+	}
+	if results[1].Error == "" || results[3].Error != ErrFileNotFound.Error() {
+		t.Fatalf("expected per-id errors for the failed copy and missing file, got %+v", results)
+	}
+
+	if got := repo.records[ids[1]]; got.BucketID != sourceID || got.ObjectName != fmt.Sprintf("%s/%s", sourceID, ids[1]) {
+		t.Fatalf("expected failed copy to stay in source, got %+v", got)
+	}
+	for _, id := range []uuid.UUID{ids[0], ids[2]} {
+		got := repo.records[id]
+		if got.BucketID != targetID || !objectBelongsToBucket(got.ObjectName, targetID) {
+			t.Fatalf("expected %s moved under the target prefix, got %+v", id, got)
+		}
+	}
+	if repo.bucketUsage[sourceID] != -50 || repo.bucketUsage[targetID] != 50 {
+		t.Fatalf("expected usage to move 50 bytes, got source %d target %d", repo.bucketUsage[sourceID], repo.bucketUsage[targetID])
+	}
+	if objectStore.removeCount != 2 {
+		t.Fatalf("expected only the moved source objects removed, got %d removals", objectStore.removeCount)
+	}
+
+	if _, err := service.MoveBatch(context.Background(), ownerID, sourceID, sourceID, ids); err != ErrSameBucket {
+		t.Fatalf("expected ErrSameBucket, got %v", err)
+	}
+	if _, err := service.MoveBatch(context.Background(), uuid.New(), sourceID, targetID, ids); err != ErrBucketMismatch {
+		t.Fatalf("expected ErrBucketMismatch for a foreign owner, got %v", err)
+	}
+}
+
 type fakeRepo struct {
-	records map[uuid.UUID]Metadata
+	records         map[uuid.UUID]Metadata
+	publicBuckets   map[uuid.UUID]bool
+	idempotencyKeys map[string]uuid.UUID
+	checksumUpdates int
+	getErr          error
+	bucketUsage     map[uuid.UUID]int64
+	// bucketOwners records the owner of buckets the ownership checks should see.
+	bucketOwners map[uuid.UUID]uuid.UUID
+	// beforeCreateShared runs ahead of CreateShared, to interleave a concurrent operation.
+	beforeCreateShared func()
+	// beforeSetChecksum runs ahead of SetChecksumIfEmpty, to interleave a concurrent commit.
+	beforeSetChecksum func(fileID uuid.UUID)
+}
+
+func newFakeRepo() *fakeRepo {
+	return &fakeRepo{
+		records:         make(map[uuid.UUID]Metadata),
+		publicBuckets:   make(map[uuid.UUID]bool),
+		idempotencyKeys: make(map[string]uuid.UUID),
+		bucketUsage:     make(map[uuid.UUID]int64),
+		bucketOwners:    make(map[uuid.UUID]uuid.UUID),
+	}
+}
+
+func (f *fakeRepo) ReserveIdempotencyKey(ctx context.Context, bucketID uuid.UUID, key string, expiresAt time.Time) (uuid.UUID, bool, error) {
+	if fileID, ok := f.idempotencyKeys[bucketID.String()+"/"+key]; ok {
+		return fileID, false, nil
+	}
+	f.idempotencyKeys[bucketID.String()+"/"+key] = uuid.Nil
+	return uuid.Nil, true, nil
+}
+
+func (f *fakeRepo) CompleteIdempotencyKey(ctx context.Context, bucketID uuid.UUID, key string, fileID uuid.UUID, expiresAt time.Time) error {
+	if existing, ok := f.idempotencyKeys[bucketID.String()+"/"+key]; ok && existing == uuid.Nil {
+		f.idempotencyKeys[bucketID.String()+"/"+key] = fileID
+	}
+	return nil
+}
+
+func (f *fakeRepo) ReleaseIdempotencyKey(ctx context.Context, bucketID uuid.UUID, key string) error {
+	if existing, ok := f.idempotencyKeys[bucketID.String()+"/"+key]; ok && existing == uuid.Nil {
+		delete(f.idempotencyKeys, bucketID.String()+"/"+key)
+	}
+	return nil
+}
+
+func (f *fakeRepo) PurgeExpiredIdempotencyKeys(ctx context.Context) (int64, error) {
+	return 0, nil
+}
+
+func (f *fakeRepo) Create(ctx context.Context, meta Metadata) (Metadata, error) {
+	meta.CreatedAt = time.Now()
+	meta.UpdatedAt = meta.CreatedAt
+	f.records[meta.ID] = meta
+	return meta, nil
+}
+
+func (f *fakeRepo) ExistsByName(ctx context.Context, bucketID uuid.UUID, filename string) (bool, error) {
+	for _, meta := range f.records {
+		if meta.BucketID == bucketID && meta.OriginalFilename == filename {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (f *fakeRepo) GetPublic(ctx context.Context, bucketID, fileID uuid.UUID) (Metadata, uuid.UUID, error) {
+	meta, ok := f.records[fileID]
+	if !ok || meta.BucketID != bucketID || !f.publicBuckets[bucketID] {
+		return Metadata{}, uuid.Nil, ErrFileNotFound
+	}
+	return meta, uuid.Nil, nil
+}
+
+func (f *fakeRepo) UpdateChecksum(ctx context.Context, ownerID, bucketID, fileID uuid.UUID, checksum string) (Metadata, error) {
+	meta, ok := f.records[fileID]
+	if !ok {
+		return Metadata{}, ErrFileNotFound
+	}
+	f.checksumUpdates++
+	meta.Checksum = checksum
+	f.records[fileID] = meta
+	return meta, nil
+}
+
+func (f *fakeRepo) SetChecksumIfEmpty(ctx context.Context, ownerID, bucketID, fileID uuid.UUID, checksum string) (Metadata, bool, error) {
+	if f.beforeSetChecksum != nil {
+		f.beforeSetChecksum(fileID)
+	}
+	meta, ok := f.records[fileID]
+	if !ok || meta.Checksum != "" {
+		return Metadata{}, false, nil
+	}
+	f.checksumUpdates++
+	meta.Checksum = checksum
+	f.records[fileID] = meta
+	return meta, true, nil
 }
 
-func newFakeRepo() *fakeRepo {
-	return &fakeRepo{records: make(map[uuid.UUID]Metadata)}
+func (f *fakeRepo) ListUnhashed(ctx context.Context, after uuid.UUID, limit int) ([]UnhashedFile, error) {
+	var files []UnhashedFile
+	for _, meta := range f.records {
+		if meta.Checksum == "" && meta.ID.String() > after.String() {
+			files = append(files, UnhashedFile{Metadata: meta})
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].ID.String() < files[j].ID.String() })
+	if len(files) > limit {
+		files = files[:limit]
+	}
+	return files, nil
 }
 
-func (f *fakeRepo) Create(ctx context.Context, meta Metadata) (Metadata, error) {
-	f.records[meta.ID] = meta
-	meta.CreatedAt = time.Now()
-	meta.UpdatedAt = meta.CreatedAt
+func (f *fakeRepo) UpdateContent(ctx context.Context, ownerID, bucketID, fileID uuid.UUID, sizeBytes int64, checksum string) (Metadata, error) {
+	meta, ok := f.records[fileID]
+	if !ok {
+		return Metadata{}, ErrFileNotFound
+	}
+	f.bucketUsage[bucketID] += sizeBytes - meta.SizeBytes
+	meta.SizeBytes = sizeBytes
+	meta.Checksum = checksum
+	f.records[fileID] = meta
 	return meta, nil
 }
 
-func (f *fakeRepo) List(ctx context.Context, ownerID, bucketID uuid.UUID) ([]Metadata, error) {
+func (f *fakeRepo) List(ctx context.Context, ownerID, bucketID uuid.UUID, opts ListOptions) ([]Metadata, error) {
 	var list []Metadata
 	for _, m := range f.records {
 		if m.BucketID == bucketID {
 			list = append(list, m)
 		}
 	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID.String() < list[j].ID.String() })
+	if opts.Limit > 0 {
+		list = list[min(opts.Offset, len(list)):min(opts.Offset+opts.Limit, len(list))]
+	}
 	return list, nil
 }
 
+func (f *fakeRepo) StreamList(ctx context.Context, ownerID, bucketID uuid.UUID, fn func(Metadata) error) error {
+	list, _ := f.List(ctx, ownerID, bucketID, ListOptions{})
+	for _, meta := range list {
+		if err := fn(meta); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (f *fakeRepo) Get(ctx context.Context, ownerID, bucketID, fileID uuid.UUID) (Metadata, error) {
+	if f.getErr != nil {
+		return Metadata{}, f.getErr
+	}
 	meta, ok := f.records[fileID]
 	if !ok {
 		return Metadata{}, ErrFileNotFound
@@ -138,18 +1428,104 @@ func (f *fakeRepo) Get(ctx context.Context, ownerID, bucketID, fileID uuid.UUID)
 	return meta, nil
 }
 
+func (f *fakeRepo) FindByChecksum(ctx context.Context, ownerID, bucketID uuid.UUID, checksum string) (Metadata, error) {
+	for _, meta := range f.records {
+		if meta.BucketID == bucketID && meta.Checksum == checksum {
+			return meta, nil
+		}
+	}
+	return Metadata{}, ErrFileNotFound
+}
+
+func (f *fakeRepo) FindByChecksumInAccount(ctx context.Context, ownerID uuid.UUID, checksum string) (Metadata, error) {
+	for _, meta := range f.records {
+		if meta.Checksum == checksum {
+			return meta, nil
+		}
+	}
+	return Metadata{}, ErrFileNotFound
+}
+
+func (f *fakeRepo) CountObjectReferences(ctx context.Context, objectName string) (int64, error) {
+	var refs int64
+	for _, meta := range f.records {
+		if meta.ObjectName == objectName {
+			refs++
+		}
+	}
+	return refs, nil
+}
+
+func (f *fakeRepo) CreateShared(ctx context.Context, meta Metadata) (Metadata, error) {
+	if f.beforeCreateShared != nil {
+		f.beforeCreateShared()
+	}
+	if refs, _ := f.CountObjectReferences(ctx, meta.ObjectName); refs == 0 {
+		return Metadata{}, ErrFileNotFound
+	}
+	return f.Create(ctx, meta)
+}
+
+func (f *fakeRepo) ReleaseObject(ctx context.Context, objectName string) (bool, error) {
+	refs, err := f.CountObjectReferences(ctx, objectName)
+	return refs == 0, err
+}
+
+func (f *fakeRepo) ObjectOwnedBy(ctx context.Context, ownerID, homeBucketID uuid.UUID, objectName string) (bool, error) {
+	if owner, ok := f.bucketOwners[homeBucketID]; ok && owner != ownerID {
+		return false, nil
+	}
+	refs, err := f.CountObjectReferences(ctx, objectName)
+	return refs > 0, err
+}
+
+func (f *fakeRepo) GetMany(ctx context.Context, bucketID uuid.UUID, fileIDs []uuid.UUID) ([]Metadata, error) {
+	var metas []Metadata
+	for _, id := range fileIDs {
+		if meta, ok := f.records[id]; ok && meta.BucketID == bucketID {
+			metas = append(metas, meta)
+		}
+	}
+	return metas, nil
+}
+
 func (f *fakeRepo) Delete(ctx context.Context, ownerID, bucketID, fileID uuid.UUID) (Metadata, error) {
 	meta, ok := f.records[fileID]
 	if !ok {
 		return Metadata{}, ErrFileNotFound
 	}
 	delete(f.records, fileID)
+	f.bucketUsage[bucketID] -= meta.SizeBytes
 	return meta, nil
 }
 
+func (f *fakeRepo) MoveFiles(ctx context.Context, sourceID, targetID uuid.UUID, moves []ObjectMove) ([]Metadata, error) {
+	moved := make([]Metadata, 0, len(moves))
+	for _, move := range moves {
+		meta, ok := f.records[move.FileID]
+		if !ok || meta.BucketID != sourceID {
+			return nil, ErrFileNotFound
+		}
+		meta.BucketID = targetID
+		meta.ObjectName = move.NewObjectName
+		moved = append(moved, meta)
+	}
+	for _, meta := range moved {
+		f.records[meta.ID] = meta
+		f.bucketUsage[sourceID] -= meta.SizeBytes
+		f.bucketUsage[targetID] += meta.SizeBytes
+	}
+	return moved, nil
+}
+
 type fakeBucketStore struct {
 	buckets    map[uuid.UUID]bucket.Bucket
 	usageDelta int64
+	usageCalls int
+	usageErr   error
+
+	accountBytes   int64
+	aggregateCalls int
 }
 
 func (f *fakeBucketStore) Get(ctx context.Context, ownerID, bucketID uuid.UUID) (bucket.Bucket, error) {
@@ -161,30 +1537,465 @@ func (f *fakeBucketStore) Get(ctx context.Context, ownerID, bucketID uuid.UUID)
 }
 
 func (f *fakeBucketStore) UpdateUsage(ctx context.Context, bucketID uuid.UUID, deltaBytes int64, deltaFiles int64) error {
+	if f.usageErr != nil {
+		return f.usageErr
+	}
 	f.usageDelta += deltaBytes
+	f.usageCalls++
 	return nil
 }
 
+func (f *fakeBucketStore) AggregateUsage(ctx context.Context, ownerID uuid.UUID) (bucket.AccountUsage, error) {
+	f.aggregateCalls++
+	return bucket.AccountUsage{TotalBytes: f.accountBytes + f.usageDelta}, nil
+}
+
 func (f *fakeBucketStore) RecordUsageSnapshot(ctx context.Context, ownerID uuid.UUID) error {
 	return nil
 }
 
+func TestDeleteRemovesThumbnailAndDerivedObjects(t *testing.T) {
+	repo := newFakeRepo()
+	buckets := &fakeBucketStore{buckets: map[uuid.UUID]bucket.Bucket{}}
+	objectStore := &fakeObjectStore{}
+	service := NewService(repo, buckets, objectStore, "godrive")
+
+	ownerID := uuid.New()
+	bucketID := uuid.New()
+	buckets.buckets[bucketID] = bucket.Bucket{ID: bucketID, OwnerID: ownerID, Name: "photos"}
+
+	fileHeader := buildFileHeader(t, "file", "cat.png", "image/png", []byte("payload"))
+	meta, err := service.Upload(context.Background(), ownerID, bucketID, fileHeader, UploadOptions{})
+	if err != nil {
+		t.Fatalf("Upload returned error: %v", err)
+	}
+
+	thumbnail := derivativePrefix(meta.ObjectName) + "thumbnail.jpg"
+	webp := derivativePrefix(meta.ObjectName) + "full.webp"
+	objectStore.objects = []minio.ObjectInfo{
+		{Key: meta.ObjectName, Size: meta.SizeBytes},
+		{Key: thumbnail, Size: 120},
+		{Key: webp, Size: 300},
+	}
+	objectStore.missing = map[string]bool{webp: true}
+
+	if err := service.Delete(context.Background(), ownerID, bucketID, meta.ID); err != nil {
+		t.Fatalf("Delete returned error: %v", err)
+	}
+
+	if want := []string{meta.ObjectName, thumbnail}; !reflect.DeepEqual(objectStore.removed, want) {
+		t.Fatalf("expected removed objects %v, got %v", want, objectStore.removed)
+	}
+	// Usage counts file rows only, as RecomputeUsage does, so derivatives release nothing.
+	if usage := buckets.usageDelta + repo.bucketUsage[bucketID]; usage != 0 {
+		t.Fatalf("expected usage to drop by the file's own bytes, usage is %d", usage)
+	}
+}
+
+func TestDeleteImmutableFileIsRejectedDuringRetention(t *testing.T) {
+	repo := newFakeRepo()
+	buckets := &fakeBucketStore{buckets: map[uuid.UUID]bucket.Bucket{}}
+	objectStore := &fakeObjectStore{}
+	service := NewService(repo, buckets, objectStore, "godrive")
+	service.SetImmutableRetention(24 * time.Hour)
+
+	ownerID, bucketID, otherID := uuid.New(), uuid.New(), uuid.New()
+	buckets.buckets[bucketID] = bucket.Bucket{ID: bucketID, OwnerID: ownerID, Name: "ledger", Immutable: true}
+	buckets.buckets[otherID] = bucket.Bucket{ID: otherID, OwnerID: ownerID, Name: "scratch"}
+
+	fileHeader := buildFileHeader(t, "file", "q3.csv", "text/csv", []byte("id,amount"))
+	meta, err := service.Upload(context.Background(), ownerID, bucketID, fileHeader, UploadOptions{})
+	if err != nil {
+		t.Fatalf("expected uploads to immutable buckets to succeed, got %v", err)
+	}
+
+	if err := service.Delete(context.Background(), ownerID, bucketID, meta.ID); err != ErrFileRetained {
+		t.Fatalf("expected ErrFileRetained, got %v", err)
+	}
+	if _, err := service.CommitReplacement(context.Background(), ownerID, bucketID, meta.ID); err != ErrBucketImmutable {
+		t.Fatalf("expected ErrBucketImmutable for a replacement, got %v", err)
+	}
+	results, err := service.MoveBatch(context.Background(), ownerID, bucketID, otherID, []uuid.UUID{meta.ID})
+	if err != nil || results[0].Error != ErrFileRetained.Error() {
+		t.Fatalf("expected the move to be refused per file, got %+v, %v", results, err)
+	}
+	if objectStore.removeCount != 0 || len(repo.records) != 1 {
+		t.Fatalf("expected the file to be kept, got %d removes and %d records", objectStore.removeCount, len(repo.records))
+	}
+
+	service.nowFunc = func() time.Time { return meta.CreatedAt.Add(25 * time.Hour) }
+	if err := service.CheckOverwritable(context.Background(), ownerID, bucketID, meta); err != ErrBucketImmutable {
+		t.Fatalf("expected replacements to stay refused after retention, got %v", err)
+	}
+	if err := service.Delete(context.Background(), ownerID, bucketID, meta.ID); err != nil {
+		t.Fatalf("expected delete to succeed after retention, got %v", err)
+	}
+}
+
+func TestUploadRecordsCountedSizeWhenStoreReportsZero(t *testing.T) {
+	repo := newFakeRepo()
+	buckets := &fakeBucketStore{buckets: map[uuid.UUID]bucket.Bucket{}}
+	objectStore := &fakeObjectStore{untrackedSize: true}
+	service := NewService(repo, buckets, objectStore, "godrive")
+	service.SetAllowEmptyFiles(true)
+
+	ownerID, bucketID := uuid.New(), uuid.New()
+	buckets.buckets[bucketID] = bucket.Bucket{ID: bucketID, OwnerID: ownerID, Name: "inbox"}
+
+	empty, err := service.Upload(context.Background(), ownerID, bucketID, buildFileHeader(t, "file", "empty.txt", "text/plain", nil), UploadOptions{})
+	if err != nil {
+		t.Fatalf("expected empty upload to succeed, got %v", err)
+	}
+	if empty.SizeBytes != 0 {
+		t.Fatalf("expected an empty file to be recorded as 0 bytes, got %d", empty.SizeBytes)
+	}
+
+	content := []byte("bytes flowed even though the store reported none")
+	header := buildFileHeader(t, "file", "notes.txt", "text/plain", content)
+	header.Size = -1
+	meta, err := service.Upload(context.Background(), ownerID, bucketID, header, UploadOptions{})
+	if err != nil {
+		t.Fatalf("Upload returned error: %v", err)
+	}
+	if meta.SizeBytes != int64(len(content)) {
+		t.Fatalf("expected the counted size %d, got %d", len(content), meta.SizeBytes)
+	}
+	if buckets.usageDelta != int64(len(content)) {
+		t.Fatalf("expected usage to grow by %d, got %d", len(content), buckets.usageDelta)
+	}
+}
+
+func TestUploadWritesToOwnersTenantBucket(t *testing.T) {
+	repo := newFakeRepo()
+	buckets := &fakeBucketStore{buckets: map[uuid.UUID]bucket.Bucket{}}
+	objectStore := &fakeObjectStore{putBuckets: map[string]string{}}
+	service := NewService(repo, buckets, objectStore, "godrive")
+
+	tenantID, sharedID := uuid.New(), uuid.New()
+	var ensured []string
+	service.SetTenantBuckets(storage.NewTenantBuckets("godrive", map[uuid.UUID]string{tenantID: "tenant-acme"}, func(ctx context.Context, name string) error {
+		ensured = append(ensured, name)
+		return nil
+	}))
+
+	upload := func(ownerID uuid.UUID, filename string) Metadata {
+		bucketID := uuid.New()
+		buckets.buckets[bucketID] = bucket.Bucket{ID: bucketID, OwnerID: ownerID, Name: "docs"}
+		meta, err := service.Upload(context.Background(), ownerID, bucketID, buildFileHeader(t, "file", filename, "text/plain", []byte("hello")), UploadOptions{})
+		if err != nil {
+			t.Fatalf("Upload returned error: %v", err)
+		}
+		return meta
+	}
+
+	first := upload(tenantID, "a.txt")
+	second := upload(tenantID, "b.txt")
+	shared := upload(sharedID, "c.txt")
+
+	for _, meta := range []Metadata{first, second} {
+		if got := objectStore.putBuckets[meta.ObjectName]; got != "tenant-acme" {
+			t.Fatalf("expected tenant upload in tenant-acme, got %q", got)
+		}
+	}
+	if got := objectStore.putBuckets[shared.ObjectName]; got != "godrive" {
+		t.Fatalf("expected unmapped owner's upload in the shared bucket, got %q", got)
+	}
+	if !reflect.DeepEqual(ensured, []string{"tenant-acme"}) {
+		t.Fatalf("expected the tenant bucket to be ensured once, got %v", ensured)
+	}
+}
+
+func TestDedupScopeDecidesWhenUploadsShareAnObject(t *testing.T) {
+	cases := []struct {
+		scope DedupScope
+		// sameBucket and otherBucket report whether a repeat upload to the first upload's bucket,
+		// and then to another bucket, reuse the first upload's object.
+		sameBucket, otherBucket bool
+	}{
+		{scope: DedupNone},
+		{scope: DedupBucket, sameBucket: true},
+		{scope: DedupAccount, sameBucket: true, otherBucket: true},
+	}
+	for _, tc := range cases {
+		t.Run(string(tc.scope), func(t *testing.T) {
+			repo := newFakeRepo()
+			buckets := &fakeBucketStore{buckets: map[uuid.UUID]bucket.Bucket{}}
+			objectStore := &fakeObjectStore{}
+			service := NewService(repo, buckets, objectStore, "godrive")
+			if err := service.SetDedupScope(tc.scope); err != nil {
+				t.Fatalf("SetDedupScope returned error: %v", err)
+			}
+
+			ownerID, docsID, backupID := uuid.New(), uuid.New(), uuid.New()
+			buckets.buckets[docsID] = bucket.Bucket{ID: docsID, OwnerID: ownerID, Name: "docs"}
+			buckets.buckets[backupID] = bucket.Bucket{ID: backupID, OwnerID: ownerID, Name: "backup"}
+			upload := func(bucketID uuid.UUID) Metadata {
+				meta, err := service.Upload(context.Background(), ownerID, bucketID, buildFileHeader(t, "file", "report.txt", "text/plain", []byte("identical bytes")), UploadOptions{})
+				if err != nil {
+					t.Fatalf("Upload returned error: %v", err)
+				}
+				return meta
+			}
+
+			first := upload(docsID)
+			again := upload(docsID)
+			elsewhere := upload(backupID)
+			if got := again.ObjectName == first.ObjectName; got != tc.sameBucket {
+				t.Fatalf("same bucket: expected shared object %v, got %v", tc.sameBucket, got)
+			}
+			if got := elsewhere.ObjectName == first.ObjectName; got != tc.otherBucket {
+				t.Fatalf("other bucket: expected shared object %v, got %v", tc.otherBucket, got)
+			}
+			if _, err := service.Get(context.Background(), ownerID, backupID, elsewhere.ID); err != nil {
+				t.Fatalf("expected the file in the other bucket to be readable, got %v", err)
+			}
+
+			removedFirst := func() bool {
+				for _, name := range objectStore.removed {
+					if name == first.ObjectName {
+						return true
+					}
+				}
+				return false
+			}
+			if err := service.Delete(context.Background(), ownerID, docsID, first.ID); err != nil {
+				t.Fatalf("Delete returned error: %v", err)
+			}
+			if got, want := removedFirst(), !tc.sameBucket && !tc.otherBucket; got != want {
+				t.Fatalf("after deleting the first file: expected object removed %v, got %v", want, got)
+			}
+			for _, meta := range []Metadata{again, elsewhere} {
+				if err := service.Delete(context.Background(), ownerID, meta.BucketID, meta.ID); err != nil {
+					t.Fatalf("Delete returned error: %v", err)
+				}
+			}
+			if !removedFirst() {
+				t.Fatalf("expected the shared object to be removed with its last file")
+			}
+		})
+	}
+
+	if err := NewService(newFakeRepo(), &fakeBucketStore{}, &fakeObjectStore{}, "godrive").SetDedupScope("global"); err != ErrInvalidDedupScope {
+		t.Fatalf("expected ErrInvalidDedupScope, got %v", err)
+	}
+}
+
+func TestDedupedFileOutlivesTheBucketHoldingItsObject(t *testing.T) {
+	repo := newFakeRepo()
+	buckets := &fakeBucketStore{buckets: map[uuid.UUID]bucket.Bucket{}}
+	objectStore := &fakeObjectStore{reader: bytes.NewReader([]byte("identical bytes"))}
+	service := NewService(repo, buckets, objectStore, "godrive")
+	if err := service.SetDedupScope(DedupAccount); err != nil {
+		t.Fatalf("SetDedupScope returned error: %v", err)
+	}
+
+	ownerID, docsID, backupID := uuid.New(), uuid.New(), uuid.New()
+	buckets.buckets[docsID] = bucket.Bucket{ID: docsID, OwnerID: ownerID, Name: "docs"}
+	buckets.buckets[backupID] = bucket.Bucket{ID: backupID, OwnerID: ownerID, Name: "backup"}
+	var uploaded []Metadata
+	for _, bucketID := range []uuid.UUID{docsID, backupID} {
+		meta, err := service.Upload(context.Background(), ownerID, bucketID, buildFileHeader(t, "file", "report.txt", "text/plain", []byte("identical bytes")), UploadOptions{})
+		if err != nil {
+			t.Fatalf("Upload returned error: %v", err)
+		}
+		uploaded = append(uploaded, meta)
+	}
+	survivor := uploaded[1]
+	if !objectBelongsToBucket(survivor.ObjectName, docsID) {
+		t.Fatalf("expected the backup file to share the docs object, got %s", survivor.ObjectName)
+	}
+
+	// Deleting the docs bucket drops its rows but keeps the object the backup file still uses.
+	delete(repo.records, uploaded[0].ID)
+	delete(buckets.buckets, docsID)
+
+	if _, err := service.Get(context.Background(), ownerID, backupID, survivor.ID); err != nil {
+		t.Fatalf("expected the surviving file to stay readable, got %v", err)
+	}
+	if _, object, err := service.Download(context.Background(), ownerID, backupID, survivor.ID); err != nil {
+		t.Fatalf("expected the surviving file to download, got %v", err)
+	} else {
+		object.Close()
+	}
+}
+
+func TestDedupUploadKeepsItsObjectWhenTheDuplicateIsDeletedMeanwhile(t *testing.T) {
+	repo := newFakeRepo()
+	buckets := &fakeBucketStore{buckets: map[uuid.UUID]bucket.Bucket{}}
+	objectStore := &fakeObjectStore{}
+	service := NewService(repo, buckets, objectStore, "godrive")
+	if err := service.SetDedupScope(DedupBucket); err != nil {
+		t.Fatalf("SetDedupScope returned error: %v", err)
+	}
+
+	ownerID, bucketID := uuid.New(), uuid.New()
+	buckets.buckets[bucketID] = bucket.Bucket{ID: bucketID, OwnerID: ownerID, Name: "docs"}
+	upload := func() Metadata {
+		meta, err := service.Upload(context.Background(), ownerID, bucketID, buildFileHeader(t, "file", "report.txt", "text/plain", []byte("identical bytes")), UploadOptions{})
+		if err != nil {
+			t.Fatalf("Upload returned error: %v", err)
+		}
+		return meta
+	}
+
+	first := upload()
+	repo.beforeCreateShared = func() {
+		repo.beforeCreateShared = nil
+		if err := service.Delete(context.Background(), ownerID, bucketID, first.ID); err != nil {
+			t.Fatalf("Delete returned error: %v", err)
+		}
+	}
+	second := upload()
+	if second.ObjectName == first.ObjectName {
+		t.Fatalf("expected the upload to keep its own object once the duplicate was deleted")
+	}
+	for _, name := range objectStore.removed {
+		if name == second.ObjectName {
+			t.Fatalf("expected the upload's own object to be kept, removed %v", objectStore.removed)
+		}
+	}
+}
+
+func TestCommitReplacementRefusesSharedObjects(t *testing.T) {
+	repo := newFakeRepo()
+	buckets := &fakeBucketStore{buckets: map[uuid.UUID]bucket.Bucket{}}
+	service := NewService(repo, buckets, &fakeObjectStore{}, "godrive")
+	if err := service.SetDedupScope(DedupBucket); err != nil {
+		t.Fatalf("SetDedupScope returned error: %v", err)
+	}
+
+	ownerID, bucketID := uuid.New(), uuid.New()
+	buckets.buckets[bucketID] = bucket.Bucket{ID: bucketID, OwnerID: ownerID, Name: "docs"}
+	var uploaded []Metadata
+	for i := 0; i < 2; i++ {
+		meta, err := service.Upload(context.Background(), ownerID, bucketID, buildFileHeader(t, "file", "report.txt", "text/plain", []byte("identical bytes")), UploadOptions{})
+		if err != nil {
+			t.Fatalf("Upload returned error: %v", err)
+		}
+		uploaded = append(uploaded, meta)
+	}
+
+	if _, err := service.CommitReplacement(context.Background(), ownerID, bucketID, uploaded[0].ID); err != ErrObjectShared {
+		t.Fatalf("expected ErrObjectShared, got %v", err)
+	}
+	if err := service.CheckOverwritable(context.Background(), ownerID, bucketID, uploaded[1]); err != ErrObjectShared {
+		t.Fatalf("expected presigned uploads to be refused too, got %v", err)
+	}
+
+	if err := service.Delete(context.Background(), ownerID, bucketID, uploaded[1].ID); err != nil {
+		t.Fatalf("Delete returned error: %v", err)
+	}
+	if err := service.CheckOverwritable(context.Background(), ownerID, bucketID, uploaded[0]); err != nil {
+		t.Fatalf("expected a sole reference to be overwritable, got %v", err)
+	}
+}
+
+func TestBackfillChecksumsPopulatesEmptyChecksums(t *testing.T) {
+	repo := newFakeRepo()
+	bucketID := uuid.New()
+	store := &namedObjectStore{contents: map[string]string{}}
+	service := NewService(repo, &fakeBucketStore{buckets: map[uuid.UUID]bucket.Bucket{}}, store, "godrive")
+
+	seed := func(content, checksum string, stored bool) uuid.UUID {
+		id := uuid.New()
+		objectName := fmt.Sprintf("%s/%s", bucketID, id)
+		repo.records[id] = Metadata{ID: id, BucketID: bucketID, ObjectName: objectName, Checksum: checksum}
+		if stored {
+			store.contents[objectName] = content
+		}
+		return id
+	}
+	unhashed := map[uuid.UUID]string{}
+	for _, content := range []string{"alpha", "beta", "gamma"} {
+		unhashed[seed(content, "", true)] = content
+	}
+	hashed := seed("delta", "already-set", true)
+	missing := seed("", "", false)
+
+	// This file is committed with fresh content while the backfill hashes its old object.
+	replaced := seed("stale", "", true)
+	repo.beforeSetChecksum = func(id uuid.UUID) {
+		if id == replaced {
+			meta := repo.records[id]
+			meta.Checksum = "fresh"
+			repo.records[id] = meta
+		}
+	}
+
+	result, err := service.BackfillChecksums(context.Background(), 2)
+	if err != nil {
+		t.Fatalf("BackfillChecksums returned error: %v", err)
+	}
+	if result.Updated != len(unhashed) || result.Failed != 1 || result.Skipped != 1 {
+		t.Fatalf("expected %d updated, 1 failed and 1 skipped, got %+v", len(unhashed), result)
+	}
+	if got := repo.records[replaced].Checksum; got != "fresh" {
+		t.Fatalf("expected a concurrently stored checksum to win, got %q", got)
+	}
+	for id, content := range unhashed {
+		sum := sha256.Sum256([]byte(content))
+		if got := repo.records[id].Checksum; got != hex.EncodeToString(sum[:]) {
+			t.Fatalf("expected checksum of %q, got %q", content, got)
+		}
+	}
+	if got := repo.records[hashed].Checksum; got != "already-set" {
+		t.Fatalf("expected an existing checksum to be left alone, got %q", got)
+	}
+	if got := repo.records[missing].Checksum; got != "" {
+		t.Fatalf("expected a file without an object to stay unhashed, got %q", got)
+	}
+}
+
 type fakeObjectStore struct {
-	putCalled   bool
-	removeCount int
-	reader      io.Reader
+	putCalled bool
+	putCount  int
+	// putFailures are returned, in order, by the first PutObject calls once they read the body.
+	putFailures []error
+	// untrackedSize makes PutObject report a size of 0, as some stores do when they did not count.
+	untrackedSize bool
+	// putBuckets records the physical bucket each object was written to, by object name.
+	putBuckets map[string]string
+	// missingBuckets makes GetObject answer NoSuchKey for every object in the named buckets.
+	missingBuckets map[string]bool
+	getBuckets     []string
+	getCount       int
+	removeCount    int
+	removed        []string
+	missing        map[string]bool
+	// removeErr fails every RemoveObject call.
+	removeErr error
+	reader    io.Reader
+	objects   []minio.ObjectInfo
+	copied    []string
+	copyFail  map[string]bool
 }
 
 func (f *fakeObjectStore) PutObject(ctx context.Context, bucketName, objectName string, reader io.Reader, objectSize int64, opts minio.PutObjectOptions) (minio.UploadInfo, error) {
 	f.putCalled = true
+	if f.putBuckets != nil {
+		f.putBuckets[objectName] = bucketName
+	}
+	f.putCount++
 	data, err := io.ReadAll(reader)
 	if err != nil {
 		return minio.UploadInfo{}, err
 	}
+	if len(f.putFailures) > 0 {
+		err, f.putFailures = f.putFailures[0], f.putFailures[1:]
+		return minio.UploadInfo{}, err
+	}
+	if f.untrackedSize {
+		return minio.UploadInfo{}, nil
+	}
 	return minio.UploadInfo{Size: int64(len(data))}, nil
 }
 
 func (f *fakeObjectStore) GetObject(ctx context.Context, bucketName, objectName string, opts minio.GetObjectOptions) (io.ReadCloser, error) {
+	f.getCount++
+	f.getBuckets = append(f.getBuckets, bucketName)
+	if f.missingBuckets[bucketName] {
+		return nil, minio.ErrorResponse{Code: "NoSuchKey"}
+	}
 	if f.reader == nil {
 		f.reader = bytes.NewReader([]byte{})
 	}
@@ -193,5 +2004,118 @@ func (f *fakeObjectStore) GetObject(ctx context.Context, bucketName, objectName
 
 func (f *fakeObjectStore) RemoveObject(ctx context.Context, bucketName, objectName string, opts minio.RemoveObjectOptions) error {
 	f.removeCount++
+	if f.removeErr != nil {
+		return f.removeErr
+	}
+	if f.missing[objectName] {
+		return minio.ErrorResponse{Code: "NoSuchKey"}
+	}
+	f.removed = append(f.removed, objectName)
+	return nil
+}
+
+func (f *fakeObjectStore) CopyObject(ctx context.Context, bucketName, srcObject, dstObject string) error {
+	if f.copyFail[srcObject] {
+		return fmt.Errorf("copy %s failed", srcObject)
+	}
+	f.copied = append(f.copied, dstObject)
+	return nil
+}
+
+func (f *fakeObjectStore) ListObjects(ctx context.Context, bucketName, prefix string) ([]minio.ObjectInfo, error) {
+	var objects []minio.ObjectInfo
+	for _, obj := range f.objects {
+		if strings.HasPrefix(obj.Key, prefix) {
+			objects = append(objects, obj)
+		}
+	}
+	return objects, nil
+}
+
+type fakeScanner struct {
+	signature string
+}
+
+func (f *fakeScanner) Scan(ctx context.Context, reader io.Reader) (bool, string) {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return false, "unreadable"
+	}
+	if bytes.Contains(data, []byte(f.signature)) {
+		return false, "signature " + f.signature + " found"
+	}
+	return true, ""
+}
+
+type fakePublisher struct {
+	events []events.Event
+}
+
+func (f *fakePublisher) Publish(ctx context.Context, e events.Event) {
+	f.events = append(f.events, e)
+}
+
+// bucketedObjectStore keeps objects per physical bucket and can stat them, so tests can tell
+// which bucket an operation reached.
+type bucketedObjectStore struct {
+	objects map[string]map[string][]byte
+}
+
+func newBucketedObjectStore() *bucketedObjectStore {
+	return &bucketedObjectStore{objects: make(map[string]map[string][]byte)}
+}
+
+func (f *bucketedObjectStore) put(bucketName, objectName string, data []byte) {
+	if f.objects[bucketName] == nil {
+		f.objects[bucketName] = make(map[string][]byte)
+	}
+	f.objects[bucketName][objectName] = data
+}
+
+func (f *bucketedObjectStore) has(bucketName, objectName string) bool {
+	_, ok := f.objects[bucketName][objectName]
+	return ok
+}
+
+func (f *bucketedObjectStore) PutObject(ctx context.Context, bucketName, objectName string, reader io.Reader, objectSize int64, opts minio.PutObjectOptions) (minio.UploadInfo, error) {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return minio.UploadInfo{}, err
+	}
+	f.put(bucketName, objectName, data)
+	return minio.UploadInfo{Size: int64(len(data))}, nil
+}
+
+func (f *bucketedObjectStore) GetObject(ctx context.Context, bucketName, objectName string, opts minio.GetObjectOptions) (io.ReadCloser, error) {
+	data, ok := f.objects[bucketName][objectName]
+	if !ok {
+		return nil, minio.ErrorResponse{Code: "NoSuchKey"}
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (f *bucketedObjectStore) StatObject(ctx context.Context, bucketName, objectName string) (minio.ObjectInfo, error) {
+	data, ok := f.objects[bucketName][objectName]
+	if !ok {
+		return minio.ObjectInfo{}, minio.ErrorResponse{Code: "NoSuchKey"}
+	}
+	return minio.ObjectInfo{Key: objectName, Size: int64(len(data)), ContentType: "text/plain"}, nil
+}
+
+func (f *bucketedObjectStore) RemoveObject(ctx context.Context, bucketName, objectName string, opts minio.RemoveObjectOptions) error {
+	delete(f.objects[bucketName], objectName)
+	return nil
+}
+
+func (f *bucketedObjectStore) CopyObject(ctx context.Context, bucketName, srcObject, dstObject string) error {
+	data, ok := f.objects[bucketName][srcObject]
+	if !ok {
+		return minio.ErrorResponse{Code: "NoSuchKey"}
+	}
+	f.put(bucketName, dstObject, data)
 	return nil
 }
+
+func (f *bucketedObjectStore) ListObjects(ctx context.Context, bucketName, prefix string) ([]minio.ObjectInfo, error) {
+	return nil, nil
+}
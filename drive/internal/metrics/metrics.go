@@ -1,8 +1,11 @@
 package metrics
 
 import (
+	"context"
 	"fmt"
+	"time"
 
+	"github.com/abduss/godrive/internal/events"
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -46,11 +49,49 @@ var FileOperationSizeBytes = prometheus.NewHistogramVec(
 	[]string{"operation"}, // upload | download
 )
 
+var DependencyUp = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "dependency_up",
+		Help: "Whether a backing dependency answered its last health check (1) or not (0)",
+	},
+	[]string{"component"}, // postgres | minio
+)
+
+var DependencyLastCheck = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "dependency_last_check_timestamp_seconds",
+		Help: "Unix time of the last dependency health check",
+	},
+	[]string{"component"},
+)
+
+var DBQueryDuration = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Name:    "db_query_duration_seconds",
+		Help:    "Duration of database statements by repository operation",
+		Buckets: prometheus.ExponentialBuckets(0.0005, 2, 14), // 0.5ms..~4s
+	},
+	[]string{"operation"}, // e.g. file.Create, bucket.List
+)
+
+// ObserveDBQuery records one statement; it matches storage.QueryObserver.
+func ObserveDBQuery(operation string, elapsed time.Duration) {
+	DBQueryDuration.WithLabelValues(operation).Observe(elapsed.Seconds())
+}
+
+// ObserveUpload records an uploaded file's size; subscribe it to events.FileUploaded.
+func ObserveUpload(ctx context.Context, e events.Event) {
+	FileOperationSizeBytes.WithLabelValues("upload").Observe(float64(e.SizeBytes))
+}
+
 func InitMetrics() {
 	prometheus.MustRegister(HTTPRequestsTotal)
 	prometheus.MustRegister(HTTPRequestDuration)
 	prometheus.MustRegister(AuthAttemptsTotal)
 	prometheus.MustRegister(FileOperationSizeBytes)
+	prometheus.MustRegister(DependencyUp)
+	prometheus.MustRegister(DependencyLastCheck)
+	prometheus.MustRegister(DBQueryDuration)
 }
 
 func Middleware() gin.HandlerFunc {
@@ -0,0 +1,57 @@
+// Package negotiate picks a response encoding from the request's Accept header, so listings can
+// answer in compact MessagePack for clients that ask for it and in JSON for everyone else.
+package negotiate
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/gin-gonic/gin/render"
+)
+
+// Encoder writes a response body in one wire format.
+type Encoder interface {
+	// ContentType is the media type the encoder answers to in an Accept header.
+	ContentType() string
+	Encode(c *gin.Context, status int, obj any)
+}
+
+type jsonEncoder struct{}
+
+func (jsonEncoder) ContentType() string { return binding.MIMEJSON }
+
+func (jsonEncoder) Encode(c *gin.Context, status int, obj any) {
+	c.JSON(status, obj)
+}
+
+// msgpackEncoder encodes with the same field names as JSON: the codec reads json struct tags.
+type msgpackEncoder struct{}
+
+func (msgpackEncoder) ContentType() string { return binding.MIMEMSGPACK2 }
+
+func (msgpackEncoder) Encode(c *gin.Context, status int, obj any) {
+	c.Render(status, render.MsgPack{Data: obj})
+}
+
+var (
+	// JSON is the default encoding.
+	JSON Encoder = jsonEncoder{}
+	// MsgPack answers Accept: application/msgpack (or the older application/x-msgpack).
+	MsgPack Encoder = msgpackEncoder{}
+)
+
+// For returns the encoder the request accepts, preferring JSON when the Accept header is
+// missing, a wildcard, or names neither format.
+func For(c *gin.Context) Encoder {
+	switch c.NegotiateFormat(binding.MIMEJSON, binding.MIMEMSGPACK2, binding.MIMEMSGPACK) {
+	case binding.MIMEMSGPACK2, binding.MIMEMSGPACK:
+		return MsgPack
+	default:
+		return JSON
+	}
+}
+
+// Respond writes obj with status in the encoding the request accepts.
+func Respond(c *gin.Context, status int, obj any) {
+	c.Header("Vary", "Accept")
+	For(c).Encode(c, status, obj)
+}
@@ -0,0 +1,90 @@
+package negotiate
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/google/uuid"
+)
+
+type listedItem struct {
+	ID        uuid.UUID  `json:"id"`
+	Name      string     `json:"name"`
+	SizeBytes int64      `json:"size_bytes"`
+	Tags      []string   `json:"tags"`
+	CreatedAt time.Time  `json:"created_at"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+type listing struct {
+	Items      []listedItem `json:"items"`
+	NextCursor string       `json:"next_cursor,omitempty"`
+}
+
+func TestRespondRoundTripsJSONAndMsgPack(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	want := listing{
+		Items: []listedItem{
+			{ID: uuid.New(), Name: "notes.txt", SizeBytes: 11, Tags: []string{"a", "b"}, CreatedAt: time.Date(2024, 5, 1, 9, 30, 0, 0, time.UTC)},
+			{ID: uuid.New(), Name: "photo.jpg", SizeBytes: 1 << 20, Tags: []string{}, CreatedAt: time.Date(2024, 5, 2, 10, 0, 0, 0, time.UTC)},
+		},
+		NextCursor: "bzoy",
+	}
+
+	router := gin.New()
+	router.GET("/items", func(c *gin.Context) { Respond(c, http.StatusOK, want) })
+	get := func(accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/items", nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("accept %q: expected 200, got %d", accept, rec.Code)
+		}
+		return rec
+	}
+
+	for _, accept := range []string{"", "*/*", "application/json", "text/html"} {
+		rec := get(accept)
+		if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, binding.MIMEJSON) {
+			t.Fatalf("accept %q: expected JSON, got %q", accept, ct)
+		}
+		var got listing
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+			t.Fatalf("accept %q: decode JSON: %v", accept, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("accept %q: JSON round trip mismatch:\n got %+v\nwant %+v", accept, got, want)
+		}
+	}
+
+	for _, accept := range []string{"application/msgpack", "application/x-msgpack"} {
+		rec := get(accept)
+		if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, binding.MIMEMSGPACK2) {
+			t.Fatalf("accept %q: expected MessagePack, got %q", accept, ct)
+		}
+		jsonBody := get("application/json").Body.Len()
+		if rec.Body.Len() >= jsonBody {
+			t.Fatalf("accept %q: expected a body smaller than JSON's %d bytes, got %d", accept, jsonBody, rec.Body.Len())
+		}
+		var got listing
+		if err := binding.MsgPack.BindBody(rec.Body.Bytes(), &got); err != nil {
+			t.Fatalf("accept %q: decode MessagePack: %v", accept, err)
+		}
+		for i := range got.Items {
+			got.Items[i].CreatedAt = got.Items[i].CreatedAt.UTC()
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("accept %q: MessagePack round trip mismatch:\n got %+v\nwant %+v", accept, got, want)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+// Package pagination parses limit/cursor query parameters and builds paged response
+// envelopes shared by the listing endpoints.
+package pagination
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// DefaultLimit applies when a paginated request omits limit.
+	DefaultLimit = 50
+	// MaxLimit caps how many items a single page may hold.
+	MaxLimit = 200
+
+	cursorPrefix = "o:"
+	keysetPrefix = "k:"
+)
+
+var (
+	// ErrInvalidLimit signals a limit that is not a positive integer.
+	ErrInvalidLimit = errors.New("invalid limit")
+	// ErrInvalidCursor signals a cursor that was not produced by this package.
+	ErrInvalidCursor = errors.New("invalid cursor")
+)
+
+// Params describes the requested page.
+type Params struct {
+	Limit  int
+	Offset int
+}
+
+// Page is the response envelope for paginated listings.
+type Page[T any] struct {
+	Items      []T    `json:"items"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// Requested reports whether the query asks for a paginated response. Listings keep their
+// unpaginated shape when neither limit nor cursor is present.
+func Requested(query url.Values) bool {
+	return query.Has("limit") || query.Has("cursor")
+}
+
+// Parse reads limit and cursor from the query. Limits above MaxLimit are clamped.
+func Parse(query url.Values) (Params, error) {
+	limit, err := ParseLimit(query)
+	if err != nil {
+		return Params{}, err
+	}
+	params := Params{Limit: limit}
+
+	if raw := strings.TrimSpace(query.Get("cursor")); raw != "" {
+		offset, err := DecodeCursor(raw)
+		if err != nil {
+			return Params{}, err
+		}
+		params.Offset = offset
+	}
+
+	return params, nil
+}
+
+// ParseLimit reads only the limit from the query, for listings whose cursor is not an offset.
+// A missing limit yields DefaultLimit and limits above MaxLimit are clamped.
+func ParseLimit(query url.Values) (int, error) {
+	raw := strings.TrimSpace(query.Get("limit"))
+	if raw == "" {
+		return DefaultLimit, nil
+	}
+	limit, err := strconv.Atoi(raw)
+	if err != nil || limit <= 0 {
+		return 0, ErrInvalidLimit
+	}
+	return ClampLimit(limit), nil
+}
+
+// ClampLimit bounds limit to [1, MaxLimit], substituting DefaultLimit for non-positive values.
+func ClampLimit(limit int) int {
+	switch {
+	case limit <= 0:
+		return DefaultLimit
+	case limit > MaxLimit:
+		return MaxLimit
+	default:
+		return limit
+	}
+}
+
+// FetchLimit is the number of rows to request from storage: one more than the page size so
+// NewPage can tell whether another page follows.
+func (p Params) FetchLimit() int {
+	return p.Limit + 1
+}
+
+// EncodeCursor produces an opaque cursor pointing at offset.
+func EncodeCursor(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(cursorPrefix + strconv.Itoa(offset)))
+}
+
+// DecodeCursor reverses EncodeCursor.
+func DecodeCursor(cursor string) (int, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, ErrInvalidCursor
+	}
+	value, ok := strings.CutPrefix(string(raw), cursorPrefix)
+	if !ok {
+		return 0, ErrInvalidCursor
+	}
+	offset, err := strconv.Atoi(value)
+	if err != nil || offset < 0 {
+		return 0, ErrInvalidCursor
+	}
+	return offset, nil
+}
+
+// NewPage trims items fetched with FetchLimit to the page size and sets the next cursor when
+// more items remain.
+func NewPage[T any](items []T, params Params) Page[T] {
+	page := Page[T]{Items: items}
+	if page.Items == nil {
+		page.Items = []T{}
+	}
+	if len(page.Items) > params.Limit {
+		page.Items = page.Items[:params.Limit]
+		page.NextCursor = EncodeCursor(params.Offset + params.Limit)
+	}
+	return page
+}
+
+// Keyset is the position of the last item on a page ordered by creation time, with the ID
+// breaking ties. Unlike an offset it stays valid while rows are inserted ahead of it.
+type Keyset struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+}
+
+// EncodeKeyset produces an opaque cursor continuing after key.
+func EncodeKeyset(key Keyset) string {
+	raw := keysetPrefix + strconv.FormatInt(key.CreatedAt.UnixNano(), 10) + ":" + key.ID.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeKeyset reverses EncodeKeyset.
+func DecodeKeyset(cursor string) (Keyset, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return Keyset{}, ErrInvalidCursor
+	}
+	value, ok := strings.CutPrefix(string(raw), keysetPrefix)
+	if !ok {
+		return Keyset{}, ErrInvalidCursor
+	}
+	nanos, id, ok := strings.Cut(value, ":")
+	if !ok {
+		return Keyset{}, ErrInvalidCursor
+	}
+	unixNano, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return Keyset{}, ErrInvalidCursor
+	}
+	parsedID, err := uuid.Parse(id)
+	if err != nil {
+		return Keyset{}, ErrInvalidCursor
+	}
+	return Keyset{CreatedAt: time.Unix(0, unixNano).UTC(), ID: parsedID}, nil
+}
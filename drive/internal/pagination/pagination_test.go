@@ -0,0 +1,92 @@
+package pagination
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestParseClampsLimit(t *testing.T) {
+	cases := map[string]int{
+		"":      DefaultLimit,
+		"10":    10,
+		"200":   MaxLimit,
+		"10000": MaxLimit,
+	}
+	for raw, want := range cases {
+		query := url.Values{}
+		if raw != "" {
+			query.Set("limit", raw)
+		}
+		params, err := Parse(query)
+		if err != nil {
+			t.Fatalf("limit %q: unexpected error %v", raw, err)
+		}
+		if params.Limit != want {
+			t.Fatalf("limit %q: expected %d, got %d", raw, want, params.Limit)
+		}
+	}
+
+	for _, raw := range []string{"0", "-5", "ten"} {
+		if _, err := Parse(url.Values{"limit": {raw}}); err != ErrInvalidLimit {
+			t.Fatalf("limit %q: expected ErrInvalidLimit, got %v", raw, err)
+		}
+	}
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	for _, offset := range []int{0, 1, 50, 123456} {
+		got, err := DecodeCursor(EncodeCursor(offset))
+		if err != nil {
+			t.Fatalf("offset %d: decode error %v", offset, err)
+		}
+		if got != offset {
+			t.Fatalf("expected offset %d, got %d", offset, got)
+		}
+	}
+
+	for _, cursor := range []string{"not base64!", EncodeCursor(-1), "MTA"} {
+		if _, err := DecodeCursor(cursor); err != ErrInvalidCursor {
+			t.Fatalf("cursor %q: expected ErrInvalidCursor, got %v", cursor, err)
+		}
+	}
+}
+
+func TestNewPageSetsNextCursorOnlyWhenMoreRemain(t *testing.T) {
+	params := Params{Limit: 2, Offset: 4}
+
+	page := NewPage([]int{1, 2, 3}, params)
+	if len(page.Items) != 2 {
+		t.Fatalf("expected page trimmed to 2 items, got %d", len(page.Items))
+	}
+	if next, err := DecodeCursor(page.NextCursor); err != nil || next != 6 {
+		t.Fatalf("expected next cursor at offset 6, got %d (%v)", next, err)
+	}
+
+	last := NewPage([]int{1}, params)
+	if last.NextCursor != "" {
+		t.Fatalf("expected no next cursor on the last page, got %q", last.NextCursor)
+	}
+	if empty := NewPage[int](nil, params); empty.Items == nil {
+		t.Fatalf("expected empty items to encode as an array")
+	}
+}
+
+func TestKeysetRoundTrip(t *testing.T) {
+	key := Keyset{CreatedAt: time.Date(2024, 3, 1, 12, 30, 0, 123456789, time.UTC), ID: uuid.New()}
+	got, err := DecodeKeyset(EncodeKeyset(key))
+	if err != nil {
+		t.Fatalf("decode error %v", err)
+	}
+	if !got.CreatedAt.Equal(key.CreatedAt) || got.ID != key.ID {
+		t.Fatalf("expected %+v, got %+v", key, got)
+	}
+
+	for _, cursor := range []string{"not base64!", EncodeCursor(10), "azox"} {
+		if _, err := DecodeKeyset(cursor); err != ErrInvalidCursor {
+			t.Fatalf("cursor %q: expected ErrInvalidCursor, got %v", cursor, err)
+		}
+	}
+}
@@ -0,0 +1,14 @@
+package presigned
+
+import "errors"
+
+var (
+	// ErrInvalidMethod indicates the HTTP method can never be presigned (e.g. DELETE or POST).
+	ErrInvalidMethod = errors.New("invalid presign method")
+	// ErrMethodNotAllowed indicates the method is valid but disabled by configuration.
+	ErrMethodNotAllowed = errors.New("presign method not allowed")
+	// ErrEmptyBatch indicates a batch request named no files.
+	ErrEmptyBatch = errors.New("presign batch is empty")
+	// ErrBatchTooLarge indicates a batch request exceeded MaxBatchSize.
+	ErrBatchTooLarge = errors.New("presign batch too large")
+)
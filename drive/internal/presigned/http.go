@@ -0,0 +1,229 @@
+package presigned
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/abduss/godrive/internal/auth"
+	"github.com/abduss/godrive/internal/bind"
+	"github.com/abduss/godrive/internal/bucket"
+	"github.com/abduss/godrive/internal/file"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// RegisterRoutes mounts presigned URL endpoints under the provided router group.
+// middleware runs on these routes only (e.g. RateLimiter.Middleware).
+func RegisterRoutes(group *gin.RouterGroup, service *Service, middleware ...gin.HandlerFunc) {
+	handler := &httpHandler{service: service}
+	group.POST("/buckets/:bucketID/files/:fileID/presigned", append(middleware, handler.generateURL)...)
+	group.GET("/buckets/:bucketID/files/:fileID/presigned-download", append(middleware, handler.presignedDownload)...)
+	group.PUT("/buckets/:bucketID/files/:fileID/presigned-upload", append(middleware, handler.presignedUpload)...)
+	group.POST("/buckets/:bucketID/presigned-batch", append(middleware, handler.generateBatch)...)
+}
+
+type httpHandler struct {
+	service *Service
+}
+
+type presignTarget struct {
+	userID   uuid.UUID
+	bucketID uuid.UUID
+	fileID   uuid.UUID
+	ttl      time.Duration
+}
+
+func (h *httpHandler) generateURL(c *gin.Context) {
+	target, ok := parseTarget(c)
+	if !ok {
+		return
+	}
+
+	method, err := h.service.ValidateMethod(c.Query("method"))
+	if err != nil {
+		h.writeMethodError(c, method, err)
+		return
+	}
+
+	presignedURL, err := h.service.GenerateURL(c.Request.Context(), target.userID, target.bucketID, target.fileID, method, target.ttl)
+	if err != nil {
+		h.writeGenerateError(c, method, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, presignedURL)
+}
+
+func (h *httpHandler) presignedDownload(c *gin.Context) {
+	target, ok := parseTarget(c)
+	if !ok {
+		return
+	}
+
+	presignedURL, err := h.service.GenerateURL(c.Request.Context(), target.userID, target.bucketID, target.fileID, http.MethodGet, target.ttl)
+	if err != nil {
+		h.writeGenerateError(c, http.MethodGet, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"url":     presignedURL.URL,
+		"expires": presignedURL.ExpiresAt,
+	})
+}
+
+// presignedUpload returns a PUT URL for replacing the file's bytes in place. The URL targets the
+// object name stored in metadata; clients call .../committed afterwards to refresh size and checksum.
+func (h *httpHandler) presignedUpload(c *gin.Context) {
+	target, ok := parseTarget(c)
+	if !ok {
+		return
+	}
+
+	presignedURL, err := h.service.GenerateURL(c.Request.Context(), target.userID, target.bucketID, target.fileID, http.MethodPut, target.ttl)
+	if err != nil {
+		h.writeGenerateError(c, http.MethodPut, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"url":     presignedURL.URL,
+		"expires": presignedURL.ExpiresAt,
+	})
+}
+
+type batchRequest struct {
+	FileIDs []string `json:"file_ids"`
+	Method  string   `json:"method"`
+	TTL     string   `json:"ttl"`
+}
+
+func (h *httpHandler) generateBatch(c *gin.Context) {
+	userID, _, ok := auth.RequireUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	bucketID, err := uuid.Parse(c.Param("bucketID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid bucket id"})
+		return
+	}
+
+	var req batchRequest
+	if !bind.JSON(c, &req) {
+		return
+	}
+	if len(req.FileIDs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file_ids is required"})
+		return
+	}
+	if len(req.FileIDs) > MaxBatchSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("at most %d files may be presigned per batch", MaxBatchSize)})
+		return
+	}
+
+	var ttl time.Duration
+	if req.TTL != "" {
+		ttl, err = time.ParseDuration(req.TTL)
+		if err != nil || ttl <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid ttl"})
+			return
+		}
+	}
+
+	method, err := h.service.ValidateMethod(req.Method)
+	if err != nil {
+		h.writeMethodError(c, method, err)
+		return
+	}
+
+	results := make(map[string]BatchResult, len(req.FileIDs))
+	fileIDs := make([]uuid.UUID, 0, len(req.FileIDs))
+	for _, raw := range req.FileIDs {
+		fileID, err := uuid.Parse(raw)
+		if err != nil {
+			results[raw] = BatchResult{Error: "invalid file id"}
+			continue
+		}
+		fileIDs = append(fileIDs, fileID)
+	}
+
+	if len(fileIDs) > 0 {
+		signed, err := h.service.GenerateBatch(c.Request.Context(), userID, bucketID, fileIDs, method, ttl)
+		if err != nil {
+			h.writeGenerateError(c, method, err)
+			return
+		}
+		for fileID, result := range signed {
+			results[fileID.String()] = result
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"method": method,
+		"files":  results,
+	})
+}
+
+func parseTarget(c *gin.Context) (presignTarget, bool) {
+	userID, _, ok := auth.RequireUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return presignTarget{}, false
+	}
+
+	bucketID, err := uuid.Parse(c.Param("bucketID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid bucket id"})
+		return presignTarget{}, false
+	}
+	fileID, err := uuid.Parse(c.Param("fileID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid file id"})
+		return presignTarget{}, false
+	}
+
+	var ttl time.Duration
+	if raw := c.Query("ttl"); raw != "" {
+		ttl, err = time.ParseDuration(raw)
+		if err != nil || ttl <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid ttl"})
+			return presignTarget{}, false
+		}
+	}
+
+	return presignTarget{userID: userID, bucketID: bucketID, fileID: fileID, ttl: ttl}, true
+}
+
+func (h *httpHandler) writeGenerateError(c *gin.Context, method string, err error) {
+	switch err {
+	case ErrInvalidMethod, ErrMethodNotAllowed:
+		h.writeMethodError(c, method, err)
+	case file.ErrFileNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
+	case bucket.ErrBucketNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": "bucket not found"})
+	case file.ErrObjectOutsideBucket:
+		c.JSON(http.StatusForbidden, gin.H{"error": "object does not belong to bucket"})
+	case file.ErrBucketImmutable:
+		c.JSON(http.StatusForbidden, gin.H{"error": "files in an immutable bucket cannot be replaced"})
+	case file.ErrObjectShared:
+		c.JSON(http.StatusConflict, gin.H{"error": "file shares its content with other files and cannot be replaced in place"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate presigned url"})
+	}
+}
+
+func (h *httpHandler) writeMethodError(c *gin.Context, method string, err error) {
+	message := fmt.Sprintf("method %s cannot be presigned", method)
+	if err == ErrMethodNotAllowed {
+		message = fmt.Sprintf("presigning %s urls is disabled", method)
+	}
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error":   message,
+		"allowed": h.service.AllowedMethods(),
+	})
+}
@@ -0,0 +1,395 @@
+package presigned
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/abduss/godrive/internal/auth"
+	"github.com/abduss/godrive/internal/config"
+	"github.com/abduss/godrive/internal/file"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+func TestGenerateURLRejectsDisallowedMethods(t *testing.T) {
+	ownerID := uuid.New()
+	bucketID := uuid.New()
+	fileID := uuid.New()
+	files := &fakeFileLookup{records: map[uuid.UUID]file.Metadata{
+		fileID: {ID: fileID, BucketID: bucketID, ObjectName: bucketID.String() + "/" + fileID.String()},
+	}}
+	signer := &fakeSigner{}
+	service := NewService(files, signer, config.PresignConfig{AllowedMethods: []string{"GET"}})
+	router := newTestRouter(service, ownerID)
+
+	for _, method := range []string{"DELETE", "POST", "PUT", "PATCH"} {
+		path := fmt.Sprintf("/buckets/%s/files/%s/presigned?method=%s", bucketID, fileID, method)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, path, nil))
+
+		if rr.Code != http.StatusBadRequest {
+			t.Fatalf("method %s: expected 400, got %d", method, rr.Code)
+		}
+	}
+	if signer.calls != 0 {
+		t.Fatalf("expected no presign calls for rejected methods, got %d", signer.calls)
+	}
+
+	path := fmt.Sprintf("/buckets/%s/files/%s/presigned?method=get", bucketID, fileID)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, path, nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 for allowed method, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var resp URL
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if resp.Method != http.MethodGet || resp.URL == "" {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+}
+
+func TestPresignedDownloadClampsTTLAndChecksOwnership(t *testing.T) {
+	ownerID := uuid.New()
+	bucketID := uuid.New()
+	fileID := uuid.New()
+	files := &fakeFileLookup{records: map[uuid.UUID]file.Metadata{
+		fileID: {ID: fileID, BucketID: bucketID, ObjectName: bucketID.String() + "/" + fileID.String()},
+	}}
+	signer := &fakeSigner{}
+	service := NewService(files, signer, config.PresignConfig{
+		AllowedMethods: []string{"GET"},
+		MaxTTL:         time.Hour,
+	})
+	router := newTestRouter(service, ownerID)
+
+	path := fmt.Sprintf("/buckets/%s/files/%s/presigned-download?ttl=48h", bucketID, fileID)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if signer.lastExpiry != time.Hour {
+		t.Fatalf("expected ttl clamped to 1h, got %s", signer.lastExpiry)
+	}
+
+	var resp struct {
+		URL     string    `json:"url"`
+		Expires time.Time `json:"expires"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if resp.URL == "" || resp.Expires.IsZero() {
+		t.Fatalf("unexpected response: %s", rr.Body.String())
+	}
+
+	path = fmt.Sprintf("/buckets/%s/files/%s/presigned-download", uuid.New(), fileID)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for file outside bucket, got %d", rr.Code)
+	}
+}
+
+func TestPresignedUploadTargetsStoredObjectName(t *testing.T) {
+	ownerID := uuid.New()
+	bucketID := uuid.New()
+	fileID := uuid.New()
+	objectName := bucketID.String() + "/" + fileID.String()
+	files := &fakeFileLookup{records: map[uuid.UUID]file.Metadata{
+		fileID: {ID: fileID, BucketID: bucketID, ObjectName: objectName},
+	}}
+	signer := &fakeSigner{}
+	service := NewService(files, signer, config.PresignConfig{AllowedMethods: []string{"GET", "PUT"}})
+	router := newTestRouter(service, ownerID)
+
+	path := fmt.Sprintf("/buckets/%s/files/%s/presigned-upload?object=evil", bucketID, fileID)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodPut, path, nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if signer.lastObject != objectName {
+		t.Fatalf("expected presigned PUT for %q, got %q", objectName, signer.lastObject)
+	}
+
+	getOnly := NewService(files, &fakeSigner{}, config.PresignConfig{AllowedMethods: []string{"GET"}})
+	rr = httptest.NewRecorder()
+	newTestRouter(getOnly, ownerID).ServeHTTP(rr, httptest.NewRequest(http.MethodPut, path, nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 when PUT presigning is disabled, got %d", rr.Code)
+	}
+}
+
+func TestPresignedBatchReturnsPartialResults(t *testing.T) {
+	ownerID := uuid.New()
+	bucketID := uuid.New()
+	otherBucketID := uuid.New()
+	first, second, foreign, missing := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	files := &fakeFileLookup{records: map[uuid.UUID]file.Metadata{
+		first:   {ID: first, BucketID: bucketID, ObjectName: bucketID.String() + "/" + first.String()},
+		second:  {ID: second, BucketID: bucketID, ObjectName: bucketID.String() + "/" + second.String()},
+		foreign: {ID: foreign, BucketID: otherBucketID, ObjectName: otherBucketID.String() + "/" + foreign.String()},
+	}}
+	signer := &fakeSigner{}
+	audit := &fakeAuditLog{}
+	service := NewService(files, signer, config.PresignConfig{AllowedMethods: []string{"GET"}})
+	service.SetAuditLog(audit)
+	router := newTestRouter(service, ownerID)
+
+	body := fmt.Sprintf(`{"file_ids":[%q,%q,%q,%q,"not-a-uuid"],"method":"GET","ttl":"10m"}`, first, missing, second, foreign)
+	req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/buckets/%s/presigned-batch", bucketID), strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var resp struct {
+		Method string                 `json:"method"`
+		Files  map[string]BatchResult `json:"files"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(resp.Files) != 5 {
+		t.Fatalf("expected a result for every requested id, got %d: %s", len(resp.Files), rr.Body.String())
+	}
+	for _, id := range []uuid.UUID{first, second} {
+		result := resp.Files[id.String()]
+		if result.URL == "" || result.ExpiresAt == nil || result.Error != "" {
+			t.Fatalf("expected url for %s, got %+v", id, result)
+		}
+	}
+	for _, id := range []uuid.UUID{missing, foreign} {
+		if result := resp.Files[id.String()]; result.Error != "file not found" || result.URL != "" {
+			t.Fatalf("expected not found for %s, got %+v", id, result)
+		}
+	}
+	if result := resp.Files["not-a-uuid"]; result.Error != "invalid file id" {
+		t.Fatalf("expected invalid id error, got %+v", result)
+	}
+
+	if files.getManyCalls != 1 {
+		t.Fatalf("expected a single metadata lookup, got %d", files.getManyCalls)
+	}
+	if signer.calls != 2 {
+		t.Fatalf("expected 2 presign calls, got %d", signer.calls)
+	}
+	if len(audit.batches) != 1 || len(audit.batches[0]) != 2 {
+		t.Fatalf("expected one audit batch with 2 entries, got %+v", audit.batches)
+	}
+
+	ids := make([]string, MaxBatchSize+1)
+	for i := range ids {
+		ids[i] = uuid.NewString()
+	}
+	payload, _ := json.Marshal(map[string]any{"file_ids": ids})
+	req = httptest.NewRequest(http.MethodPost, fmt.Sprintf("/buckets/%s/presigned-batch", bucketID), strings.NewReader(string(payload)))
+	req.Header.Set("Content-Type", "application/json")
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for oversized batch, got %d", rr.Code)
+	}
+}
+
+func TestPresignListingSignsEveryFileInOrder(t *testing.T) {
+	ownerID, bucketID := uuid.New(), uuid.New()
+	files := make([]file.Metadata, 20)
+	for i := range files {
+		id := uuid.New()
+		files[i] = file.Metadata{ID: id, BucketID: bucketID, ObjectName: bucketID.String() + "/" + id.String()}
+	}
+	signer := &fakeSigner{}
+	audit := &fakeAuditLog{}
+	service := NewService(&fakeFileLookup{}, signer, config.PresignConfig{AllowedMethods: []string{"GET"}, MaxTTL: time.Hour})
+	service.SetAuditLog(audit)
+
+	urls, expiresAt, err := service.PresignListing(context.Background(), ownerID, bucketID, files, 48*time.Hour)
+	if err != nil {
+		t.Fatalf("PresignListing returned error: %v", err)
+	}
+	for i, meta := range files {
+		if urls[i] != "http://minio:9000/godrive/"+meta.ObjectName {
+			t.Fatalf("url %d does not match its file: %q", i, urls[i])
+		}
+	}
+	if signer.lastExpiry != time.Hour || time.Until(expiresAt) > time.Hour {
+		t.Fatalf("expected ttl clamped to 1h, got %s", signer.lastExpiry)
+	}
+	if len(audit.batches) != 1 || len(audit.batches[0]) != len(files) {
+		t.Fatalf("expected one audit batch covering every file, got %d batches", len(audit.batches))
+	}
+
+	putOnly := NewService(&fakeFileLookup{}, signer, config.PresignConfig{AllowedMethods: []string{"PUT"}})
+	if _, _, err := putOnly.PresignListing(context.Background(), ownerID, bucketID, files, 0); err != file.ErrPresignUnavailable {
+		t.Fatalf("expected ErrPresignUnavailable when GET is disabled, got %v", err)
+	}
+}
+
+func TestPresignedURLsTargetTheBucketHoldingEachObject(t *testing.T) {
+	ownerID, bucketID := uuid.New(), uuid.New()
+	legacyID, freshID := uuid.New(), uuid.New()
+	legacy := file.Metadata{ID: legacyID, BucketID: bucketID, ObjectName: bucketID.String() + "/" + legacyID.String()}
+	fresh := file.Metadata{ID: freshID, BucketID: bucketID, ObjectName: bucketID.String() + "/" + freshID.String()}
+	files := &fakeFileLookup{
+		records: map[uuid.UUID]file.Metadata{legacyID: legacy, freshID: fresh},
+		// The legacy object predates the owner's tenant bucket and stayed in the shared one.
+		objectBuckets: map[string]string{fresh.ObjectName: "tenant-acme"},
+	}
+	service := NewService(files, &fakeSigner{}, config.PresignConfig{AllowedMethods: []string{"GET", "PUT"}})
+	wantURL := map[uuid.UUID]string{
+		legacyID: "http://minio:9000/godrive/" + legacy.ObjectName,
+		freshID:  "http://minio:9000/tenant-acme/" + fresh.ObjectName,
+	}
+
+	for _, method := range []string{http.MethodGet, http.MethodPut} {
+		for fileID, want := range wantURL {
+			signed, err := service.GenerateURL(context.Background(), ownerID, bucketID, fileID, method, 0)
+			if err != nil {
+				t.Fatalf("GenerateURL %s: %v", method, err)
+			}
+			if signed.URL != want {
+				t.Fatalf("expected %s URL %q, got %q", method, want, signed.URL)
+			}
+		}
+	}
+
+	results, err := service.GenerateBatch(context.Background(), ownerID, bucketID, []uuid.UUID{legacyID, freshID}, http.MethodGet, 0)
+	if err != nil {
+		t.Fatalf("GenerateBatch: %v", err)
+	}
+	for fileID, want := range wantURL {
+		if results[fileID].URL != want {
+			t.Fatalf("expected batch URL %q, got %+v", want, results[fileID])
+		}
+	}
+
+	urls, _, err := service.PresignListing(context.Background(), ownerID, bucketID, []file.Metadata{legacy, fresh}, 0)
+	if err != nil {
+		t.Fatalf("PresignListing: %v", err)
+	}
+	if urls[0] != wantURL[legacyID] || urls[1] != wantURL[freshID] {
+		t.Fatalf("expected listing URLs %q and %q, got %v", wantURL[legacyID], wantURL[freshID], urls)
+	}
+}
+
+func TestPresignListingDrawsFromTheRateLimit(t *testing.T) {
+	ownerID, bucketID := uuid.New(), uuid.New()
+	files := []file.Metadata{{ID: uuid.New(), BucketID: bucketID, ObjectName: bucketID.String() + "/a"}}
+	service := NewService(&fakeFileLookup{}, &fakeSigner{}, config.PresignConfig{AllowedMethods: []string{"GET"}, RateLimit: 0.001, RateBurst: 1})
+
+	// The route middleware spends the only token; the listing then has none left.
+	rr := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(rr)
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	auth.SetCurrentUser(c, auth.ContextUser{ID: ownerID.String()})
+	service.RateLimiter().Middleware()(c)
+	if c.IsAborted() {
+		t.Fatalf("expected the first request to be allowed")
+	}
+
+	if _, _, err := service.PresignListing(context.Background(), ownerID, bucketID, files, 0); err != file.ErrPresignRateLimited {
+		t.Fatalf("expected ErrPresignRateLimited once the caller is over the limit, got %v", err)
+	}
+	if _, _, err := service.PresignListing(context.Background(), uuid.New(), bucketID, files, 0); err != nil {
+		t.Fatalf("expected other users to keep their own tokens, got %v", err)
+	}
+}
+
+// --- helpers & fakes ---
+
+func newTestRouter(service *Service, userID uuid.UUID) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	group := router.Group("/")
+	group.Use(func(c *gin.Context) {
+		auth.SetCurrentUser(c, auth.ContextUser{ID: userID.String()})
+		c.Next()
+	})
+	RegisterRoutes(group, service)
+	return router
+}
+
+type fakeFileLookup struct {
+	records      map[uuid.UUID]file.Metadata
+	getManyCalls int
+	// objectBuckets names the physical bucket of an object; others are in "godrive".
+	objectBuckets map[string]string
+}
+
+func (f *fakeFileLookup) Get(ctx context.Context, ownerID, bucketID, fileID uuid.UUID) (file.Metadata, error) {
+	meta, ok := f.records[fileID]
+	if !ok || meta.BucketID != bucketID {
+		return file.Metadata{}, file.ErrFileNotFound
+	}
+	return meta, nil
+}
+
+func (f *fakeFileLookup) GetMany(ctx context.Context, ownerID, bucketID uuid.UUID, fileIDs []uuid.UUID) (map[uuid.UUID]file.Metadata, error) {
+	f.getManyCalls++
+	found := make(map[uuid.UUID]file.Metadata)
+	for _, id := range fileIDs {
+		if meta, ok := f.records[id]; ok && meta.BucketID == bucketID {
+			found[id] = meta
+		}
+	}
+	return found, nil
+}
+
+func (f *fakeFileLookup) CheckOverwritable(ctx context.Context, ownerID, bucketID uuid.UUID, meta file.Metadata) error {
+	return nil
+}
+
+func (f *fakeFileLookup) LocateObject(ctx context.Context, ownerID uuid.UUID, objectName string) (string, error) {
+	if objectBucket, ok := f.objectBuckets[objectName]; ok {
+		return objectBucket, nil
+	}
+	return "godrive", nil
+}
+
+type fakeAuditLog struct {
+	batches [][]AuditEntry
+}
+
+func (f *fakeAuditLog) RecordPresigns(ctx context.Context, entries []AuditEntry) error {
+	f.batches = append(f.batches, entries)
+	return nil
+}
+
+type fakeSigner struct {
+	mu         sync.Mutex
+	calls      int
+	lastExpiry time.Duration
+	lastObject string
+}
+
+func (f *fakeSigner) PresignedGetObject(ctx context.Context, bucketName, objectName string, expires time.Duration, reqParams url.Values) (*url.URL, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	f.lastExpiry = expires
+	return &url.URL{Scheme: "http", Host: "minio:9000", Path: "/" + bucketName + "/" + objectName}, nil
+}
+
+func (f *fakeSigner) PresignedPutObject(ctx context.Context, bucketName, objectName string, expires time.Duration) (*url.URL, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	f.lastExpiry = expires
+	f.lastObject = objectName
+	return &url.URL{Scheme: "http", Host: "minio:9000", Path: "/" + bucketName + "/" + objectName}, nil
+}
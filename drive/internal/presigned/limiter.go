@@ -0,0 +1,113 @@
+package presigned
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/abduss/godrive/internal/auth"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// maxTrackedUsers bounds the limiter's memory; past it, users whose buckets have refilled
+// are forgotten since a fresh bucket is equivalent.
+const maxTrackedUsers = 10000
+
+// RateLimiter caps how quickly each user may mint presigned URLs with a token bucket per
+// user ID. It is separate from any other limits so URL minting cannot flood the audit table
+// or the object store.
+type RateLimiter struct {
+	mu      sync.Mutex
+	rate    float64
+	burst   float64
+	users   map[uuid.UUID]*tokenBucket
+	nowFunc func() time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter allows each user rate requests per second with bursts of up to burst.
+// A non-positive rate disables limiting; a burst below 1 is raised to 1.
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	if rate <= 0 {
+		return &RateLimiter{}
+	}
+	return &RateLimiter{
+		rate:    rate,
+		burst:   math.Max(float64(burst), 1),
+		users:   make(map[uuid.UUID]*tokenBucket),
+		nowFunc: time.Now,
+	}
+}
+
+// Middleware answers 429 with Retry-After once the authenticated user has used up their
+// tokens. Requests without a user pass through for the handler to reject.
+func (l *RateLimiter) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if l.users == nil {
+			c.Next()
+			return
+		}
+		userID, _, ok := auth.RequireUser(c)
+		if !ok {
+			c.Next()
+			return
+		}
+
+		if wait, allowed := l.take(userID); !allowed {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "too many presign requests"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// Allow spends one of userID's tokens for URLs minted outside Middleware, such as the download
+// URLs attached to a file listing, and reports whether one was available.
+func (l *RateLimiter) Allow(userID uuid.UUID) bool {
+	if l.users == nil {
+		return true
+	}
+	_, allowed := l.take(userID)
+	return allowed
+}
+
+// take spends one of userID's tokens, or reports how long until one is available.
+func (l *RateLimiter) take(userID uuid.UUID) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.nowFunc()
+	bucket, ok := l.users[userID]
+	if !ok {
+		if len(l.users) >= maxTrackedUsers {
+			l.forgetRefilled(now)
+		}
+		bucket = &tokenBucket{tokens: l.burst, last: now}
+		l.users[userID] = bucket
+	}
+
+	bucket.tokens = math.Min(l.burst, bucket.tokens+now.Sub(bucket.last).Seconds()*l.rate)
+	bucket.last = now
+	if bucket.tokens < 1 {
+		wait := time.Duration((1 - bucket.tokens) / l.rate * float64(time.Second))
+		return max(wait, time.Second), false
+	}
+	bucket.tokens--
+	return 0, true
+}
+
+func (l *RateLimiter) forgetRefilled(now time.Time) {
+	for userID, bucket := range l.users {
+		if bucket.tokens+now.Sub(bucket.last).Seconds()*l.rate >= l.burst {
+			delete(l.users, userID)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package presigned
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/abduss/godrive/internal/auth"
+	"github.com/abduss/godrive/internal/config"
+	"github.com/abduss/godrive/internal/file"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+func TestRateLimiterThrottlesPresignsButNotDownloads(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	ownerID, otherID, bucketID, fileID := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	files := &fakeFileLookup{records: map[uuid.UUID]file.Metadata{
+		fileID: {ID: fileID, BucketID: bucketID, ObjectName: bucketID.String() + "/" + fileID.String()},
+	}}
+	service := NewService(files, &fakeSigner{}, config.PresignConfig{AllowedMethods: []string{"GET"}})
+
+	const burst = 3
+	limiter := NewRateLimiter(1, burst)
+	now := time.Now()
+	limiter.nowFunc = func() time.Time { return now }
+
+	currentUser := ownerID
+	router := gin.New()
+	group := router.Group("/", func(c *gin.Context) {
+		auth.SetCurrentUser(c, auth.ContextUser{ID: currentUser.String()})
+	})
+	RegisterRoutes(group, service, limiter.Middleware())
+	group.GET("/buckets/:bucketID/files/:fileID/download", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	request := func(path string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, fmt.Sprintf(path, bucketID, fileID), nil))
+		return rr
+	}
+	presign := "/buckets/%s/files/%s/presigned-download"
+	download := "/buckets/%s/files/%s/download"
+
+	for i := 0; i < burst; i++ {
+		if rr := request(presign); rr.Code != http.StatusOK {
+			t.Fatalf("presign %d: expected 200 within the burst, got %d", i+1, rr.Code)
+		}
+	}
+	rr := request(presign)
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 once the burst is spent, got %d", rr.Code)
+	}
+	if rr.Header().Get("Retry-After") != "1" {
+		t.Fatalf("expected Retry-After of 1s at 1 rps, got %q", rr.Header().Get("Retry-After"))
+	}
+
+	if rr := request(download); rr.Code != http.StatusOK {
+		t.Fatalf("expected downloads to be unaffected, got %d", rr.Code)
+	}
+
+	currentUser = otherID
+	if rr := request(presign); rr.Code != http.StatusOK {
+		t.Fatalf("expected another user to keep their own budget, got %d", rr.Code)
+	}
+
+	currentUser = ownerID
+	now = now.Add(time.Second)
+	if rr := request(presign); rr.Code != http.StatusOK {
+		t.Fatalf("expected a token to refill after a second, got %d", rr.Code)
+	}
+}
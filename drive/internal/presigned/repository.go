@@ -0,0 +1,41 @@
+package presigned
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/abduss/godrive/internal/storage"
+	"github.com/jackc/pgx/v5"
+)
+
+// Repository persists the presign audit trail.
+type Repository struct {
+	db       storage.Querier
+	timeouts storage.QueryTimeouts
+}
+
+// NewRepository builds a new presign audit repository.
+func NewRepository(db storage.Querier, timeouts storage.QueryTimeouts) *Repository {
+	return &Repository{db: db, timeouts: timeouts.WithDefaults()}
+}
+
+// RecordPresigns writes one audit row per entry using a single COPY round trip.
+func (r *Repository) RecordPresigns(ctx context.Context, entries []AuditEntry) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	rows := make([][]any, 0, len(entries))
+	for _, entry := range entries {
+		rows = append(rows, []any{entry.OwnerID, entry.BucketID, entry.FileID, entry.Method, entry.ExpiresAt})
+	}
+
+	_, err := r.db.CopyFrom(ctx,
+		pgx.Identifier{"presign_audit"},
+		[]string{"owner_id", "bucket_id", "file_id", "method", "expires_at"},
+		pgx.CopyFromRows(rows),
+	)
+	if err != nil {
+		return fmt.Errorf("insert presign audit: %w", err)
+	}
+	return nil
+}
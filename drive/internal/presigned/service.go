@@ -0,0 +1,340 @@
+package presigned
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/abduss/godrive/internal/config"
+	"github.com/abduss/godrive/internal/file"
+	"github.com/google/uuid"
+)
+
+const defaultTTL = 15 * time.Minute
+
+// MaxBatchSize caps how many files a single batch request may presign.
+const MaxBatchSize = 100
+
+// listingConcurrency bounds how many URLs PresignListing signs at once.
+const listingConcurrency = 8
+
+// supportedMethods lists the methods object storage can presign for file access.
+var supportedMethods = map[string]bool{
+	http.MethodGet: true,
+	http.MethodPut: true,
+}
+
+// fileLookup resolves file metadata and the physical bucket holding each object; *file.Service
+// enforces object/bucket ownership.
+type fileLookup interface {
+	Get(ctx context.Context, ownerID, bucketID, fileID uuid.UUID) (file.Metadata, error)
+	GetMany(ctx context.Context, ownerID, bucketID uuid.UUID, fileIDs []uuid.UUID) (map[uuid.UUID]file.Metadata, error)
+	CheckOverwritable(ctx context.Context, ownerID, bucketID uuid.UUID, meta file.Metadata) error
+	LocateObject(ctx context.Context, ownerID uuid.UUID, objectName string) (string, error)
+}
+
+// auditLog persists presign events; *Repository writes them in a single batch.
+type auditLog interface {
+	RecordPresigns(ctx context.Context, entries []AuditEntry) error
+}
+
+// urlSigner is implemented by *minio.Client and *file.S3Store.
+type urlSigner interface {
+	PresignedGetObject(ctx context.Context, bucketName, objectName string, expires time.Duration, reqParams url.Values) (*url.URL, error)
+	PresignedPutObject(ctx context.Context, bucketName, objectName string, expires time.Duration) (*url.URL, error)
+}
+
+var _ urlSigner = (*file.S3Store)(nil)
+
+// URL describes a generated presigned URL.
+type URL struct {
+	URL       string    `json:"url"`
+	Method    string    `json:"method"`
+	ExpiresAt time.Time `json:"expires"`
+}
+
+// BatchResult is the outcome for one file in a batch request. Exactly one of URL or Error is set.
+type BatchResult struct {
+	URL       string     `json:"url,omitempty"`
+	ExpiresAt *time.Time `json:"expires,omitempty"`
+	Error     string     `json:"error,omitempty"`
+}
+
+// AuditEntry records a presigned URL handed out for a file.
+type AuditEntry struct {
+	OwnerID   uuid.UUID
+	BucketID  uuid.UUID
+	FileID    uuid.UUID
+	Method    string
+	ExpiresAt time.Time
+}
+
+// Service issues presigned URLs for files owned by the caller.
+type Service struct {
+	files      fileLookup
+	signer     urlSigner
+	allowed    map[string]bool
+	defaultTTL time.Duration
+	maxTTL     time.Duration
+	audit      auditLog
+	nowFunc    func() time.Time
+	limiter    *RateLimiter
+}
+
+// NewService constructs a presigned URL service. URLs are signed against the physical bucket
+// files reports for each object.
+func NewService(files fileLookup, signer urlSigner, cfg config.PresignConfig) *Service {
+	allowed := make(map[string]bool, len(cfg.AllowedMethods))
+	for _, method := range cfg.AllowedMethods {
+		allowed[strings.ToUpper(strings.TrimSpace(method))] = true
+	}
+
+	ttl := cfg.DefaultTTL
+	if ttl <= 0 {
+		ttl = defaultTTL
+	}
+
+	return &Service{
+		files:      files,
+		signer:     signer,
+		allowed:    allowed,
+		defaultTTL: ttl,
+		maxTTL:     cfg.MaxTTL,
+		nowFunc:    time.Now,
+		limiter:    NewRateLimiter(cfg.RateLimit, cfg.RateBurst),
+	}
+}
+
+// RateLimiter returns the per-user limiter built from the service's config. Its Middleware
+// guards the presign routes, and listings with download URLs draw from the same tokens.
+func (s *Service) RateLimiter() *RateLimiter {
+	return s.limiter
+}
+
+// SetAuditLog records batch presigns to the given log. A nil log disables auditing.
+func (s *Service) SetAuditLog(log auditLog) {
+	s.audit = log
+}
+
+// AllowedMethods returns the configured methods that may be presigned.
+func (s *Service) AllowedMethods() []string {
+	methods := make([]string, 0, len(s.allowed))
+	for _, method := range []string{http.MethodGet, http.MethodPut} {
+		if s.allowed[method] {
+			methods = append(methods, method)
+		}
+	}
+	return methods
+}
+
+// ValidateMethod normalizes the method and checks it against the supported set and the allowlist.
+func (s *Service) ValidateMethod(method string) (string, error) {
+	method = strings.ToUpper(strings.TrimSpace(method))
+	if method == "" {
+		method = http.MethodGet
+	}
+	if !supportedMethods[method] {
+		return method, ErrInvalidMethod
+	}
+	if !s.allowed[method] {
+		return method, ErrMethodNotAllowed
+	}
+	return method, nil
+}
+
+// GenerateURL returns a presigned URL for the file using the requested method and TTL.
+func (s *Service) GenerateURL(ctx context.Context, ownerID, bucketID, fileID uuid.UUID, method string, ttl time.Duration) (URL, error) {
+	method, err := s.ValidateMethod(method)
+	if err != nil {
+		return URL{}, err
+	}
+
+	meta, err := s.files.Get(ctx, ownerID, bucketID, fileID)
+	if err != nil {
+		return URL{}, err
+	}
+	if method == http.MethodPut {
+		if err := s.files.CheckOverwritable(ctx, ownerID, bucketID, meta); err != nil {
+			return URL{}, err
+		}
+	}
+
+	objectBucket, err := s.files.LocateObject(ctx, ownerID, meta.ObjectName)
+	if err != nil {
+		return URL{}, err
+	}
+
+	ttl = s.clampTTL(ttl)
+
+	var signed *url.URL
+	switch method {
+	case http.MethodPut:
+		signed, err = s.signer.PresignedPutObject(ctx, objectBucket, meta.ObjectName, ttl)
+	default:
+		signed, err = s.signer.PresignedGetObject(ctx, objectBucket, meta.ObjectName, ttl, nil)
+	}
+	if err != nil {
+		return URL{}, fmt.Errorf("presign object: %w", err)
+	}
+
+	return URL{
+		URL:       signed.String(),
+		Method:    method,
+		ExpiresAt: s.nowFunc().Add(ttl).UTC(),
+	}, nil
+}
+
+// GenerateBatch presigns URLs for several files in one bucket. Bucket ownership is checked once
+// and file metadata is fetched in a single lookup; files that cannot be found, or that a PUT may
+// not overwrite because its bucket is immutable or its object is shared, get a per-ID error instead of failing the whole
+// batch. Every issued URL is audited in one batched write.
+func (s *Service) GenerateBatch(ctx context.Context, ownerID, bucketID uuid.UUID, fileIDs []uuid.UUID, method string, ttl time.Duration) (map[uuid.UUID]BatchResult, error) {
+	method, err := s.ValidateMethod(method)
+	if err != nil {
+		return nil, err
+	}
+	if len(fileIDs) == 0 {
+		return nil, ErrEmptyBatch
+	}
+	if len(fileIDs) > MaxBatchSize {
+		return nil, ErrBatchTooLarge
+	}
+
+	metas, err := s.files.GetMany(ctx, ownerID, bucketID, fileIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	ttl = s.clampTTL(ttl)
+	expiresAt := s.nowFunc().Add(ttl).UTC()
+
+	results := make(map[uuid.UUID]BatchResult, len(fileIDs))
+	entries := make([]AuditEntry, 0, len(metas))
+	for _, fileID := range fileIDs {
+		if _, done := results[fileID]; done {
+			continue
+		}
+		meta, ok := metas[fileID]
+		if !ok {
+			results[fileID] = BatchResult{Error: "file not found"}
+			continue
+		}
+		if method == http.MethodPut {
+			if err := s.files.CheckOverwritable(ctx, ownerID, bucketID, meta); err != nil {
+				results[fileID] = BatchResult{Error: err.Error()}
+				continue
+			}
+		}
+
+		objectBucket, err := s.files.LocateObject(ctx, ownerID, meta.ObjectName)
+		if err != nil {
+			return nil, err
+		}
+		var signed *url.URL
+		switch method {
+		case http.MethodPut:
+			signed, err = s.signer.PresignedPutObject(ctx, objectBucket, meta.ObjectName, ttl)
+		default:
+			signed, err = s.signer.PresignedGetObject(ctx, objectBucket, meta.ObjectName, ttl, nil)
+		}
+		if err != nil {
+			results[fileID] = BatchResult{Error: "failed to generate presigned url"}
+			continue
+		}
+
+		results[fileID] = BatchResult{URL: signed.String(), ExpiresAt: &expiresAt}
+		entries = append(entries, AuditEntry{
+			OwnerID:   ownerID,
+			BucketID:  bucketID,
+			FileID:    fileID,
+			Method:    method,
+			ExpiresAt: expiresAt,
+		})
+	}
+
+	if s.audit != nil && len(entries) > 0 {
+		if err := s.audit.RecordPresigns(ctx, entries); err != nil {
+			return nil, fmt.Errorf("record presign audit: %w", err)
+		}
+	}
+	return results, nil
+}
+
+// PresignListing signs a GET URL for each listed file, in the same order, with at most
+// listingConcurrency signatures in flight. The files come from an owner-scoped listing, so no
+// further lookup is made; all URLs are audited in one batched write. Like a batch request, the
+// listing spends one of the owner's rate limit tokens and fails with file.ErrPresignRateLimited
+// when none is left.
+func (s *Service) PresignListing(ctx context.Context, ownerID, bucketID uuid.UUID, files []file.Metadata, ttl time.Duration) ([]string, time.Time, error) {
+	if !s.allowed[http.MethodGet] {
+		return nil, time.Time{}, file.ErrPresignUnavailable
+	}
+	if !s.limiter.Allow(ownerID) {
+		return nil, time.Time{}, file.ErrPresignRateLimited
+	}
+
+	ttl = s.clampTTL(ttl)
+	expiresAt := s.nowFunc().Add(ttl).UTC()
+
+	urls := make([]string, len(files))
+	errs := make([]error, len(files))
+	sem := make(chan struct{}, listingConcurrency)
+	var wg sync.WaitGroup
+	for i, meta := range files {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, objectName string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			objectBucket, err := s.files.LocateObject(ctx, ownerID, objectName)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			signed, err := s.signer.PresignedGetObject(ctx, objectBucket, objectName, ttl, nil)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			urls[i] = signed.String()
+		}(i, meta.ObjectName)
+	}
+	wg.Wait()
+
+	entries := make([]AuditEntry, 0, len(files))
+	for i, meta := range files {
+		if errs[i] != nil {
+			return nil, time.Time{}, fmt.Errorf("presign object: %w", errs[i])
+		}
+		entries = append(entries, AuditEntry{
+			OwnerID:   ownerID,
+			BucketID:  bucketID,
+			FileID:    meta.ID,
+			Method:    http.MethodGet,
+			ExpiresAt: expiresAt,
+		})
+	}
+
+	if s.audit != nil && len(entries) > 0 {
+		if err := s.audit.RecordPresigns(ctx, entries); err != nil {
+			return nil, time.Time{}, fmt.Errorf("record presign audit: %w", err)
+		}
+	}
+	return urls, expiresAt, nil
+}
+
+func (s *Service) clampTTL(ttl time.Duration) time.Duration {
+	if ttl <= 0 {
+		ttl = s.defaultTTL
+	}
+	if s.maxTTL > 0 && ttl > s.maxTTL {
+		ttl = s.maxTTL
+	}
+	return ttl
+}
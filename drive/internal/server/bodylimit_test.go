@@ -0,0 +1,67 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/abduss/godrive/internal/auth"
+	"github.com/abduss/godrive/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+func TestOversizedJSONLoginIsRejected(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var cfg config.Config
+	cfg.Metrics.PrometheusPath = "/metrics"
+	cfg.Server.MaxJSONBodyBytes = 1024
+	router := NewRouter(Dependencies{Config: cfg, AuthService: auth.NewService(nil, cfg.Auth)})
+
+	body := `{"email":"a@example.com","password":"` + strings.Repeat("x", 4096) + `"}`
+	for _, chunked := range []bool{false, true} {
+		req := httptest.NewRequest(http.MethodPost, "/v1/auth/login", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if chunked {
+			req.ContentLength = -1
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusRequestEntityTooLarge {
+			t.Fatalf("chunked=%v: expected 413, got %d: %s", chunked, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestJSONBodyLimitSkipsMultipart(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(JSONBodyLimit(16))
+	router.POST("/upload", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	router.POST("/json", func(c *gin.Context) {
+		var payload map[string]string
+		if err := c.ShouldBindJSON(&payload); err != nil {
+			c.Status(http.StatusBadRequest)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader(strings.Repeat("x", 64)))
+	req.Header.Set("Content-Type", "multipart/form-data; boundary=xyz")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("expected multipart body to bypass the limit, got %d", rec.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/json", strings.NewReader(`{"a":"b"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("expected small JSON body to reach the handler intact, got %d", rec.Code)
+	}
+}
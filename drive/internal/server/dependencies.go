@@ -0,0 +1,66 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/abduss/godrive/internal/config"
+	"github.com/abduss/godrive/internal/metrics"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// dependencyCheck probes a single backing service.
+type dependencyCheck func(ctx context.Context) error
+
+// MonitorDependencies periodically pings Postgres and the object store and publishes the results as
+// dependency_up gauges, independent of the on-demand readiness probe. The object store is labelled
+// with its storage provider. It blocks until ctx is canceled, so callers run it in its own
+// goroutine tied to the root context.
+func MonitorDependencies(ctx context.Context, interval time.Duration, db *pgxpool.Pool, store ObjectStorePinger, provider string) {
+	checks := map[string]dependencyCheck{
+		"postgres":                     db.Ping,
+		objectStoreComponent(provider): store.Ping,
+	}
+	monitorDependencies(ctx, interval, checks)
+}
+
+// objectStoreComponent names the object store in probes after its storage provider, falling
+// back to MinIO, the default provider, when none is configured.
+func objectStoreComponent(provider string) string {
+	if provider == "" {
+		return config.StorageProviderMinIO
+	}
+	return provider
+}
+
+func monitorDependencies(ctx context.Context, interval time.Duration, checks map[string]dependencyCheck) {
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		runDependencyChecks(ctx, checks)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func runDependencyChecks(ctx context.Context, checks map[string]dependencyCheck) {
+	for component, check := range checks {
+		checkCtx, cancel := context.WithTimeout(ctx, readinessTimeout)
+		up := 1.0
+		if err := check(checkCtx); err != nil {
+			up = 0
+		}
+		cancel()
+
+		metrics.DependencyUp.WithLabelValues(component).Set(up)
+		metrics.DependencyLastCheck.WithLabelValues(component).SetToCurrentTime()
+	}
+}
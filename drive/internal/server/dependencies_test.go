@@ -0,0 +1,66 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/abduss/godrive/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRunDependencyChecksSetsGauges(t *testing.T) {
+	checks := map[string]dependencyCheck{
+		"postgres": func(context.Context) error { return nil },
+		"minio":    func(context.Context) error { return errors.New("connection refused") },
+	}
+
+	runDependencyChecks(context.Background(), checks)
+
+	if got := testutil.ToFloat64(metrics.DependencyUp.WithLabelValues("postgres")); got != 1 {
+		t.Fatalf("expected postgres up, got %v", got)
+	}
+	if got := testutil.ToFloat64(metrics.DependencyUp.WithLabelValues("minio")); got != 0 {
+		t.Fatalf("expected minio down, got %v", got)
+	}
+	if got := testutil.ToFloat64(metrics.DependencyLastCheck.WithLabelValues("minio")); got == 0 {
+		t.Fatalf("expected last check timestamp to be recorded")
+	}
+}
+
+func TestMonitorDependenciesStopsWithContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	calls := 0
+	checks := map[string]dependencyCheck{
+		"postgres": func(context.Context) error {
+			calls++
+			cancel()
+			return nil
+		},
+	}
+
+	go func() {
+		monitorDependencies(ctx, time.Hour, checks)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("monitor did not stop after context cancellation")
+	}
+	if calls != 1 {
+		t.Fatalf("expected one check before stopping, got %d", calls)
+	}
+}
+
+func TestObjectStoreComponentNamesTheProvider(t *testing.T) {
+	if got := objectStoreComponent("s3"); got != "s3" {
+		t.Fatalf("expected the s3 provider label, got %q", got)
+	}
+	if got := objectStoreComponent(""); got != "minio" {
+		t.Fatalf("expected the default provider label, got %q", got)
+	}
+}
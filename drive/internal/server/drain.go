@@ -0,0 +1,63 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const drainPollInterval = 100 * time.Millisecond
+
+// Drainer tracks in-flight requests so shutdown can wait for active transfers to finish.
+type Drainer struct {
+	active   atomic.Int64
+	draining atomic.Bool
+}
+
+// NewDrainer constructs a Drainer.
+func NewDrainer() *Drainer {
+	return &Drainer{}
+}
+
+// Middleware counts in-flight requests and rejects new ones once draining has started.
+func (d *Drainer) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if d.draining.Load() {
+			c.Header("Connection", "close")
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "server is shutting down"})
+			return
+		}
+
+		d.active.Add(1)
+		defer d.active.Add(-1)
+
+		c.Next()
+	}
+}
+
+// Active reports the number of requests currently being served.
+func (d *Drainer) Active() int64 {
+	return d.active.Load()
+}
+
+// Drain stops accepting new requests and waits until in-flight requests complete or ctx expires.
+// It returns the number of requests that were in flight when draining began.
+func (d *Drainer) Drain(ctx context.Context) (int64, error) {
+	d.draining.Store(true)
+	inFlight := d.active.Load()
+
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+
+	for d.active.Load() > 0 {
+		select {
+		case <-ctx.Done():
+			return inFlight, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return inFlight, nil
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/abduss/godrive/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+// featureRoutes lists the routes, as "METHOD /path/pattern", that belong to each optional
+// feature. Keep it in step with the packages' RegisterRoutes functions;
+// TestEveryGatedFeatureRouteIsRegistered fails when an entry no longer matches a route.
+var featureRoutes = map[string][]string{
+	config.FeatureSharing: {
+		"POST /v1/buckets/:bucketID/files/:fileID/share",
+		"DELETE /v1/buckets/:bucketID/files/:fileID/share/:shareID",
+		"GET /v1/share/:token/download",
+	},
+	config.FeaturePublicBuckets: {
+		"GET /v1/public/buckets/:bucketID/files/:fileID/download",
+	},
+	config.FeatureDedup: {
+		"GET /v1/buckets/:bucketID/files/by-checksum/:sha256",
+	},
+}
+
+// FeatureGate answers requests to routes of disabled features with the configured status,
+// before authentication runs, so a disabled feature looks the same to every caller.
+func FeatureGate(features config.FeaturesConfig) gin.HandlerFunc {
+	disabled := make(map[string]struct{})
+	for name, enabled := range features.Enabled() {
+		if enabled {
+			continue
+		}
+		for _, route := range featureRoutes[name] {
+			disabled[route] = struct{}{}
+		}
+	}
+	status := features.DisabledStatus
+	if status == 0 {
+		status = http.StatusNotFound
+	}
+
+	return func(c *gin.Context) {
+		if _, ok := disabled[c.Request.Method+" "+c.FullPath()]; ok {
+			c.AbortWithStatusJSON(status, gin.H{"error": "feature disabled"})
+			return
+		}
+		c.Next()
+	}
+}
+
+func registerFeatureRoutes(api *gin.RouterGroup, features config.FeaturesConfig) {
+	enabled := features.Enabled()
+	api.GET("/features", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"features": enabled})
+	})
+}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/abduss/godrive/internal/auth"
+	"github.com/abduss/godrive/internal/config"
+	"github.com/abduss/godrive/internal/file"
+	"github.com/abduss/godrive/internal/share"
+	"github.com/gin-gonic/gin"
+)
+
+func TestDisabledFeatureRoutesAnswerWithConfiguredStatus(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var cfg config.Config
+	cfg.Metrics.PrometheusPath = "/metrics"
+	cfg.Features = config.FeaturesConfig{Sharing: false, PublicBuckets: true, Dedup: true, DisabledStatus: http.StatusForbidden}
+	router := NewRouter(Dependencies{Config: cfg})
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	router.GET("/v1/share/:token/download", ok)
+	router.GET("/v1/buckets/:bucketID/files/by-checksum/:sha256", ok)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	if rec := get("/v1/share/abc/download"); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected the disabled sharing route to return 403, got %d", rec.Code)
+	}
+	if rec := get("/v1/buckets/b/files/by-checksum/c"); rec.Code != http.StatusOK {
+		t.Fatalf("expected the enabled dedup route to pass through, got %d", rec.Code)
+	}
+
+	rec := get("/v1/features")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 from /v1/features, got %d", rec.Code)
+	}
+	var body struct {
+		Features map[string]bool `json:"features"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode features: %v", err)
+	}
+	if body.Features[config.FeatureSharing] || !body.Features[config.FeatureDedup] || !body.Features[config.FeaturePublicBuckets] {
+		t.Fatalf("unexpected feature set %v", body.Features)
+	}
+}
+
+func TestEveryGatedFeatureRouteIsRegistered(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var cfg config.Config
+	cfg.Metrics.PrometheusPath = "/metrics"
+	router := NewRouter(Dependencies{
+		Config:       cfg,
+		AuthService:  auth.NewService(nil, cfg.Auth),
+		FileService:  file.NewService(nil, nil, nil, "godrive"),
+		ShareService: share.NewService(nil, nil),
+	})
+	registered := make(map[string]bool)
+	for _, route := range router.Routes() {
+		registered[route.Method+" "+route.Path] = true
+	}
+
+	for feature, routes := range featureRoutes {
+		for _, route := range routes {
+			if !registered[route] {
+				t.Errorf("%s gates %q, which no package registers", feature, route)
+			}
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/abduss/godrive/internal/buildinfo"
 	"github.com/gin-gonic/gin"
 )
 
@@ -15,6 +16,20 @@ func registerHealthRoutes(router *gin.Engine, deps Dependencies) {
 		c.JSON(http.StatusOK, gin.H{"status": "ok"})
 	})
 
+	// info exposes build metadata only; it must stay free of configuration and secrets.
+	router.GET("/health/info", func(c *gin.Context) {
+		var uptime int64
+		if !deps.StartedAt.IsZero() {
+			uptime = int64(time.Since(deps.StartedAt).Seconds())
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"version":        buildinfo.Version,
+			"commit":         buildinfo.Commit,
+			"build_time":     buildinfo.BuildTime,
+			"uptime_seconds": uptime,
+		})
+	})
+
 	router.GET("/health/ready", func(c *gin.Context) {
 		ctx, cancel := context.WithTimeout(c.Request.Context(), readinessTimeout)
 		defer cancel()
@@ -28,10 +43,10 @@ func registerHealthRoutes(router *gin.Engine, deps Dependencies) {
 			return
 		}
 
-		if err := checkMinIO(ctx, deps); err != nil {
+		if err := deps.ObjectStore.Ping(ctx); err != nil {
 			c.JSON(http.StatusServiceUnavailable, gin.H{
 				"status":    "degraded",
-				"component": "minio",
+				"component": objectStoreComponent(deps.Config.Storage.Provider),
 				"error":     err.Error(),
 			})
 			return
@@ -40,8 +55,3 @@ func registerHealthRoutes(router *gin.Engine, deps Dependencies) {
 		c.JSON(http.StatusOK, gin.H{"status": "ok"})
 	})
 }
-
-func checkMinIO(ctx context.Context, deps Dependencies) error {
-	_, err := deps.ObjectStore.ListBuckets(ctx)
-	return err
-}
@@ -0,0 +1,43 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/abduss/godrive/internal/buildinfo"
+	"github.com/gin-gonic/gin"
+)
+
+func TestHealthInfoReportsBuildMetadata(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	registerHealthRoutes(router, Dependencies{StartedAt: time.Now().Add(-90 * time.Second)})
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health/info", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+
+	var body map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode body: %v", err)
+	}
+	for _, field := range []string{"version", "commit", "build_time", "uptime_seconds"} {
+		if _, ok := body[field]; !ok {
+			t.Fatalf("expected field %q in %v", field, body)
+		}
+	}
+	if len(body) != 4 {
+		t.Fatalf("expected only build metadata, got %v", body)
+	}
+	if body["version"] != buildinfo.Version {
+		t.Fatalf("expected version %q, got %v", buildinfo.Version, body["version"])
+	}
+	if uptime, _ := body["uptime_seconds"].(float64); uptime < 90 {
+		t.Fatalf("expected uptime of at least 90s, got %v", body["uptime_seconds"])
+	}
+}
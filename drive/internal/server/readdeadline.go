@@ -0,0 +1,32 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// StreamReadDeadline moves the connection's read deadline to timeout from now on the listed
+// routes, written as "METHOD /path/pattern", so request bodies there may stream for longer
+// than the server's ReadTimeout allows. Headers have already been read under
+// ReadHeaderTimeout by then. A non-positive timeout leaves the server's deadline in place.
+func StreamReadDeadline(timeout time.Duration, routes []string) gin.HandlerFunc {
+	streaming := make(map[string]struct{}, len(routes))
+	for _, route := range routes {
+		if route = strings.TrimSpace(route); route != "" {
+			streaming[route] = struct{}{}
+		}
+	}
+
+	return func(c *gin.Context) {
+		if timeout > 0 {
+			if _, ok := streaming[c.Request.Method+" "+c.FullPath()]; ok {
+				// Writers that cannot set deadlines, such as test recorders, keep the default.
+				_ = http.NewResponseController(c.Writer).SetReadDeadline(time.Now().Add(timeout))
+			}
+		}
+		c.Next()
+	}
+}
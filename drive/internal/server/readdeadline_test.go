@@ -0,0 +1,57 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestStreamReadDeadlineOutlastsServerReadTimeout(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(StreamReadDeadline(time.Minute, []string{"POST /upload"}))
+	consume := func(c *gin.Context) {
+		if _, err := io.Copy(io.Discard, c.Request.Body); err != nil {
+			c.Status(http.StatusRequestTimeout)
+			return
+		}
+		c.Status(http.StatusOK)
+	}
+	router.POST("/upload", consume)
+	router.POST("/form", consume)
+
+	server := httptest.NewUnstartedServer(router)
+	server.Config.ReadTimeout = 100 * time.Millisecond
+	server.Start()
+	defer server.Close()
+
+	slowPost := func(path string) (int, error) {
+		body, writer := io.Pipe()
+		go func() {
+			for i := 0; i < 4; i++ {
+				time.Sleep(75 * time.Millisecond)
+				if _, err := writer.Write([]byte("chunk")); err != nil {
+					return
+				}
+			}
+			writer.Close()
+		}()
+		resp, err := http.Post(server.URL+path, "application/octet-stream", body)
+		if err != nil {
+			return 0, err
+		}
+		resp.Body.Close()
+		return resp.StatusCode, nil
+	}
+
+	if code, err := slowPost("/upload"); err != nil || code != http.StatusOK {
+		t.Fatalf("expected the streaming route to finish a slow body, got %d (%v)", code, err)
+	}
+	if code, err := slowPost("/form"); err == nil && code == http.StatusOK {
+		t.Fatalf("expected the server read timeout to cut off a slow body elsewhere")
+	}
+}
@@ -0,0 +1,29 @@
+package server
+
+import (
+	"log"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Recovery answers 500 for a handler that panicked and logs the panic, as gin.Recovery does,
+// except that http.ErrAbortHandler is re-raised: handlers panic with it to abort a connection
+// whose response is already under way, and only net/http can do that.
+func Recovery() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+			if rec == http.ErrAbortHandler {
+				panic(rec)
+			}
+			log.Printf("panic recovered on %s %s: %v\n%s", c.Request.Method, c.Request.URL.Path, rec, debug.Stack())
+			c.AbortWithStatus(http.StatusInternalServerError)
+		}()
+		c.Next()
+	}
+}
@@ -1,49 +1,96 @@
 package server
 
 import (
+	"context"
+	"time"
+
+	"github.com/abduss/godrive/internal/audit"
 	"github.com/abduss/godrive/internal/auth"
 	"github.com/abduss/godrive/internal/bucket"
 	"github.com/abduss/godrive/internal/config"
 	"github.com/abduss/godrive/internal/file"
+	"github.com/abduss/godrive/internal/logger"
 	"github.com/abduss/godrive/internal/metrics"
+	"github.com/abduss/godrive/internal/presigned"
+	"github.com/abduss/godrive/internal/share"
 	"github.com/gin-gonic/gin"
 	"github.com/jackc/pgx/v5/pgxpool"
-	"github.com/minio/minio-go/v7"
-	"github.com/abduss/godrive/internal/logger"
 )
 
+// ObjectStorePinger reports whether the object store backend is reachable.
+type ObjectStorePinger interface {
+	Ping(ctx context.Context) error
+}
+
 // Dependencies groups the services required by the HTTP router.
 type Dependencies struct {
-	Config        config.Config
-	DB            *pgxpool.Pool
-	ObjectStore   *minio.Client
-	AuthService   *auth.Service
-	BucketService *bucket.Service
-	FileService   *file.Service
+	Config         config.Config
+	DB             *pgxpool.Pool
+	ObjectStore    ObjectStorePinger
+	AuthService    *auth.Service
+	BucketService  *bucket.Service
+	FileService    *file.Service
+	PresignService *presigned.Service
+	AuditService   *audit.Service
+	ShareService   *share.Service
+	Drainer        *Drainer
+	StartedAt      time.Time // process start, reported as uptime by /health/info
 }
 
 // NewRouter builds a Gin engine with foundational middleware and routes.
 func NewRouter(deps Dependencies) *gin.Engine {
 	router := gin.New()
-	router.Use(gin.Recovery())
+	if err := router.SetTrustedProxies(deps.Config.Server.TrustedProxies); err != nil {
+		// config.Load validates the list, so only hand-built configs end up here;
+		// trust nobody rather than everybody.
+		_ = router.SetTrustedProxies(nil)
+	}
+	router.Use(Recovery())
 	router.Use(gin.Logger())
 	router.Use(loggerMiddleware())
+	if deps.Drainer != nil {
+		router.Use(deps.Drainer.Middleware())
+	}
+	router.Use(StreamReadDeadline(deps.Config.Server.StreamReadTimeout, deps.Config.Server.RequestTimeoutExempt))
+	router.Use(RequestTimeout(deps.Config.Server.RequestTimeout, deps.Config.Server.RequestTimeoutExempt))
+	router.Use(JSONBodyLimit(deps.Config.Server.MaxJSONBodyBytes))
+	router.Use(FeatureGate(deps.Config.Features))
 
 	registerHealthRoutes(router, deps)
 	metrics.Register(router, deps.Config.Metrics.PrometheusPath)
 
 	api := router.Group("/v1")
+	registerFeatureRoutes(api, deps.Config.Features)
+	if deps.FileService != nil {
+		file.RegisterPublicRoutes(api, deps.FileService)
+	}
+	if deps.ShareService != nil {
+		share.RegisterPublicRoutes(api, deps.ShareService)
+	}
 	if deps.AuthService != nil {
 		auth.RegisterRoutes(api, deps.AuthService)
 
 		protected := api.Group("/")
 		protected.Use(auth.AuthMiddleware(deps.AuthService))
+		auth.RegisterSessionRoutes(protected, deps.AuthService)
+		auth.RegisterAdminRoutes(protected, deps.AuthService)
 
 		if deps.BucketService != nil {
 			bucket.RegisterRoutes(protected, deps.BucketService)
 		}
 		if deps.FileService != nil {
-			file.RegisterRoutes(protected, deps.FileService)
+			uploadLimiter := file.NewUploadLimiter(deps.Config.Upload.MaxConcurrentUploads)
+			file.RegisterRoutes(protected, deps.FileService, uploadLimiter.Middleware())
+		}
+		if deps.PresignService != nil {
+			presigned.RegisterRoutes(protected, deps.PresignService, deps.PresignService.RateLimiter().Middleware())
+		}
+		if deps.ShareService != nil {
+			share.RegisterRoutes(protected, deps.ShareService)
+		}
+		if deps.AuditService != nil {
+			audit.RegisterRoutes(protected, deps.AuditService)
+			audit.RegisterAdminRoutes(protected, deps.AuditService)
 		}
 	}
 
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abduss/godrive/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+func TestNewRouterHonorsForwardedForOnlyFromTrustedProxies(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var cfg config.Config
+	cfg.Server.TrustedProxies = []string{"10.0.0.0/8"}
+	cfg.Metrics.PrometheusPath = "/metrics"
+	router := NewRouter(Dependencies{Config: cfg})
+	router.GET("/ip", func(c *gin.Context) {
+		c.String(http.StatusOK, c.ClientIP())
+	})
+
+	cases := []struct {
+		name       string
+		remoteAddr string
+		want       string
+	}{
+		{name: "trusted proxy", remoteAddr: "10.1.2.3:5000", want: "198.51.100.9"},
+		{name: "untrusted peer", remoteAddr: "192.0.2.50:5000", want: "192.0.2.50"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/ip", nil)
+			req.RemoteAddr = tc.remoteAddr
+			req.Header.Set("X-Forwarded-For", "198.51.100.9")
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if got := rec.Body.String(); got != tc.want {
+				t.Fatalf("expected client IP %s, got %s", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestNewRouterLetsStreamingRoutesOutlastTheRequestTimeout(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	cfg.Server.RequestTimeout = 20 * time.Millisecond
+	router := NewRouter(Dependencies{Config: cfg})
+
+	// slowStream writes its body in chunks spaced past the request timeout and stops early
+	// once its context is canceled, as the archive and download handlers do.
+	slowStream := func(c *gin.Context) {
+		c.Status(http.StatusOK)
+		for i := 0; i < 3; i++ {
+			select {
+			case <-c.Request.Context().Done():
+				return
+			case <-time.After(15 * time.Millisecond):
+			}
+			c.Writer.WriteString("chunk;")
+			c.Writer.Flush()
+		}
+	}
+
+	routes := []struct {
+		method string
+		path   string
+		target string
+	}{
+		{method: http.MethodPost, path: "/v1/buckets/:bucketID/files/archive", target: "/v1/buckets/b1/files/archive"},
+		{method: http.MethodGet, path: "/v1/share/:token/download", target: "/v1/share/t1/download"},
+		{method: http.MethodGet, path: "/v1/buckets/:bucketID/files", target: "/v1/buckets/b1/files"},
+		{method: http.MethodGet, path: "/v1/buckets/:bucketID/manifest", target: "/v1/buckets/b1/manifest"},
+	}
+	for _, route := range routes {
+		router.Handle(route.method, route.path, slowStream)
+	}
+
+	for _, route := range routes {
+		t.Run(route.method+" "+route.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(route.method, route.target, nil))
+			if got := rec.Body.String(); got != strings.Repeat("chunk;", 3) {
+				t.Fatalf("expected the whole stream, got %q", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestTimeout bounds each request with a deadline on its context so slow database
+// or object store calls are canceled. Routes listed in exempt, written as
+// "METHOD /path/pattern", run without a deadline. A non-positive timeout disables
+// the middleware.
+//
+// Handlers run synchronously and are expected to return once their context is done;
+// any response they attempt after the deadline is discarded in favor of a 504.
+func RequestTimeout(timeout time.Duration, exempt []string) gin.HandlerFunc {
+	skip := make(map[string]struct{}, len(exempt))
+	for _, route := range exempt {
+		if route = strings.TrimSpace(route); route != "" {
+			skip[route] = struct{}{}
+		}
+	}
+
+	return func(c *gin.Context) {
+		if timeout <= 0 {
+			c.Next()
+			return
+		}
+		if _, ok := skip[c.Request.Method+" "+c.FullPath()]; ok {
+			c.Next()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+
+		original := c.Writer
+		writer := &deadlineWriter{ResponseWriter: original, ctx: ctx}
+		c.Request = c.Request.WithContext(ctx)
+		c.Writer = writer
+
+		c.Next()
+
+		c.Writer = original
+		if writer.discarded || (!original.Written() && errors.Is(ctx.Err(), context.DeadlineExceeded)) {
+			c.AbortWithStatusJSON(http.StatusGatewayTimeout, gin.H{"error": "request timed out"})
+		}
+	}
+}
+
+// deadlineWriter drops response bodies written after the request deadline has passed,
+// leaving the middleware free to answer with 504 instead.
+type deadlineWriter struct {
+	gin.ResponseWriter
+	ctx       context.Context
+	discarded bool
+}
+
+func (w *deadlineWriter) expired() bool {
+	if w.ResponseWriter.Written() {
+		return false
+	}
+	if errors.Is(w.ctx.Err(), context.DeadlineExceeded) {
+		w.discarded = true
+		return true
+	}
+	return false
+}
+
+func (w *deadlineWriter) WriteHeaderNow() {
+	if w.expired() {
+		return
+	}
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *deadlineWriter) Write(data []byte) (int, error) {
+	if w.expired() {
+		return len(data), nil
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *deadlineWriter) WriteString(s string) (int, error) {
+	if w.expired() {
+		return len(s), nil
+	}
+	return w.ResponseWriter.WriteString(s)
+}
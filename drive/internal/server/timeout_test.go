@@ -0,0 +1,39 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequestTimeoutReturnsGatewayTimeout(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(RequestTimeout(20*time.Millisecond, []string{"GET /exempt"}))
+
+	slow := func(c *gin.Context) {
+		select {
+		case <-c.Request.Context().Done():
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "canceled"})
+		case <-time.After(100 * time.Millisecond):
+			c.JSON(http.StatusOK, gin.H{"status": "done"})
+		}
+	}
+	router.GET("/slow", slow)
+	router.GET("/exempt", slow)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/slow", nil))
+	if rec.Code != http.StatusGatewayTimeout {
+		t.Fatalf("expected 504, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/exempt", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected exempt route to finish, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,24 @@
+package share
+
+import "errors"
+
+var (
+	// ErrShareNotFound indicates the token or share does not exist or has been revoked.
+	ErrShareNotFound = errors.New("share not found")
+	// ErrShareExpired indicates the share is past its expiry.
+	ErrShareExpired = errors.New("share expired")
+	// ErrShareExhausted indicates the share has reached its download limit.
+	ErrShareExhausted = errors.New("share download limit reached")
+	// ErrPasswordRequired indicates a password-protected share was used without a password.
+	ErrPasswordRequired = errors.New("share password required")
+	// ErrWrongPassword indicates the supplied share password does not match.
+	ErrWrongPassword = errors.New("wrong share password")
+	// ErrTooManyPasswordAttempts indicates a share refusing passwords after repeated wrong ones.
+	ErrTooManyPasswordAttempts = errors.New("too many wrong share passwords")
+	// ErrPasswordTooLong indicates a share password longer than MaxPasswordBytes.
+	ErrPasswordTooLong = errors.New("share password too long")
+	// ErrInvalidTTL indicates a requested lifetime outside (0, MaxTTL].
+	ErrInvalidTTL = errors.New("invalid share ttl")
+	// ErrInvalidMaxDownloads indicates a non-positive download limit.
+	ErrInvalidMaxDownloads = errors.New("invalid max downloads")
+)
@@ -0,0 +1,172 @@
+package share
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/abduss/godrive/internal/auth"
+	"github.com/abduss/godrive/internal/bind"
+	"github.com/abduss/godrive/internal/bucket"
+	"github.com/abduss/godrive/internal/file"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// RegisterRoutes mounts share management endpoints under the provided router group.
+func RegisterRoutes(group *gin.RouterGroup, service *Service) {
+	handler := &httpHandler{service: service}
+	group.POST("/buckets/:bucketID/files/:fileID/share", handler.createShare)
+	group.DELETE("/buckets/:bucketID/files/:fileID/share/:shareID", handler.revokeShare)
+}
+
+// RegisterPublicRoutes mounts the unauthenticated share download route.
+func RegisterPublicRoutes(group *gin.RouterGroup, service *Service) {
+	handler := &httpHandler{service: service}
+	group.GET("/share/:token/download", handler.download)
+}
+
+type httpHandler struct {
+	service *Service
+}
+
+// passwordHeader carries the password for a protected share; the password query parameter is
+// accepted as a fallback for plain links.
+const passwordHeader = "X-Share-Password"
+
+type createShareRequest struct {
+	TTL          string `json:"ttl"`
+	MaxDownloads *int   `json:"max_downloads"`
+	Password     string `json:"password"`
+}
+
+func (h *httpHandler) createShare(c *gin.Context) {
+	userID, bucketID, fileID, ok := parseFileTarget(c)
+	if !ok {
+		return
+	}
+
+	var req createShareRequest
+	if c.Request.ContentLength != 0 {
+		if !bind.JSON(c, &req) {
+			return
+		}
+	}
+	var ttl time.Duration
+	if req.TTL != "" {
+		parsed, err := time.ParseDuration(req.TTL)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid ttl"})
+			return
+		}
+		ttl = parsed
+	}
+
+	link, err := h.service.Create(c.Request.Context(), userID, bucketID, fileID, Options{
+		TTL:          ttl,
+		MaxDownloads: req.MaxDownloads,
+		Password:     req.Password,
+	})
+	if err != nil {
+		switch err {
+		case ErrInvalidTTL:
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("ttl must be positive and at most %s", MaxTTL)})
+		case ErrInvalidMaxDownloads:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "max_downloads must be positive"})
+		case ErrPasswordTooLong:
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("password must be at most %d bytes", MaxPasswordBytes)})
+		case file.ErrFileNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
+		case bucket.ErrBucketNotFound, file.ErrBucketMismatch:
+			c.JSON(http.StatusNotFound, gin.H{"error": "bucket not found"})
+		case file.ErrObjectOutsideBucket:
+			c.JSON(http.StatusForbidden, gin.H{"error": "object does not belong to bucket"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create share"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, link)
+}
+
+func (h *httpHandler) revokeShare(c *gin.Context) {
+	userID, bucketID, fileID, ok := parseFileTarget(c)
+	if !ok {
+		return
+	}
+	shareID, err := uuid.Parse(c.Param("shareID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid share id"})
+		return
+	}
+
+	if err := h.service.Revoke(c.Request.Context(), userID, bucketID, fileID, shareID); err != nil {
+		if err == ErrShareNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "share not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke share"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *httpHandler) download(c *gin.Context) {
+	password := c.GetHeader(passwordHeader)
+	if password == "" {
+		password = c.Query("password")
+	}
+
+	meta, reader, err := h.service.Download(c.Request.Context(), c.Param("token"), password)
+	if err != nil {
+		switch err {
+		case ErrPasswordRequired:
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "share password required"})
+		case ErrWrongPassword:
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "wrong share password"})
+		case ErrTooManyPasswordAttempts:
+			c.Header("Retry-After", strconv.Itoa(int(passwordFailureWindow.Seconds())))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many wrong share passwords"})
+		case ErrShareExpired:
+			c.JSON(http.StatusGone, gin.H{"error": "share expired"})
+		case ErrShareExhausted:
+			c.JSON(http.StatusGone, gin.H{"error": "share download limit reached"})
+		case ErrShareNotFound, file.ErrFileNotFound, file.ErrObjectOutsideBucket, file.ErrBucketMismatch, bucket.ErrBucketNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": "share not found"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to download file"})
+		}
+		return
+	}
+	defer reader.Close()
+
+	c.Header("Content-Type", meta.ContentType)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", meta.OriginalFilename))
+	c.Header("Content-Length", fmt.Sprintf("%d", meta.SizeBytes))
+	if _, err := io.Copy(c.Writer, reader); err != nil {
+		c.Status(http.StatusInternalServerError)
+	}
+}
+
+func parseFileTarget(c *gin.Context) (userID, bucketID, fileID uuid.UUID, ok bool) {
+	userID, _, ok = auth.RequireUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var err error
+	if bucketID, err = uuid.Parse(c.Param("bucketID")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid bucket id"})
+		return userID, bucketID, fileID, false
+	}
+	if fileID, err = uuid.Parse(c.Param("fileID")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid file id"})
+		return userID, bucketID, fileID, false
+	}
+	return userID, bucketID, fileID, true
+}
@@ -0,0 +1,44 @@
+package share
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Share grants unauthenticated read access to a single file until it expires, is revoked, or
+// runs out of downloads. Only a hash of its token is stored.
+type Share struct {
+	ID            uuid.UUID  `json:"id"`
+	OwnerID       uuid.UUID  `json:"owner_id"`
+	BucketID      uuid.UUID  `json:"bucket_id"`
+	FileID        uuid.UUID  `json:"file_id"`
+	ExpiresAt     time.Time  `json:"expires_at"`
+	MaxDownloads  *int       `json:"max_downloads,omitempty"` // nil means unlimited
+	DownloadCount int        `json:"download_count"`
+	RevokedAt     *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+
+	PasswordProtected bool `json:"password_protected"`
+	passwordHash      string
+
+	// objectName and filename are copied from the file when the share is created so downloads
+	// can be served from an object stat. They are empty for shares created before they were
+	// recorded and once the file no longer refers to the object.
+	objectName string
+	filename   string
+}
+
+// Options configures a new share.
+type Options struct {
+	TTL          time.Duration // zero means DefaultTTL
+	MaxDownloads *int          // nil means unlimited
+	Password     string        // empty means no password
+}
+
+// Link is a newly created share. Token and URL are only ever returned at creation.
+type Link struct {
+	Share
+	Token string `json:"token"`
+	URL   string `json:"url"`
+}
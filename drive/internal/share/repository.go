@@ -0,0 +1,133 @@
+package share
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/abduss/godrive/internal/storage"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+const shareColumns = `id, owner_id, bucket_id, file_id, expires_at, max_downloads, download_count, revoked_at, created_at, password_hash, object_name, filename`
+
+// Repository persists file shares.
+type Repository struct {
+	db       storage.Querier
+	timeouts storage.QueryTimeouts
+}
+
+// NewRepository builds a new share repository.
+func NewRepository(db storage.Querier, timeouts storage.QueryTimeouts) *Repository {
+	return &Repository{db: db, timeouts: timeouts.WithDefaults()}
+}
+
+// Create stores a share under the hash of its token, along with its password hash if any and
+// the shared file's object name and filename.
+func (r *Repository) Create(ctx context.Context, s Share, tokenHash string) (Share, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	query := `
+INSERT INTO file_shares (owner_id, bucket_id, file_id, token_hash, expires_at, max_downloads, password_hash, object_name, filename)
+VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''), NULLIF($8, ''), NULLIF($9, ''))
+RETURNING ` + shareColumns + `;`
+
+	created, err := scanShare(r.db.QueryRow(ctx, query, s.OwnerID, s.BucketID, s.FileID, tokenHash, s.ExpiresAt, s.MaxDownloads, s.passwordHash, s.objectName, s.filename))
+	if err != nil {
+		return Share{}, fmt.Errorf("insert share: %w", err)
+	}
+	return created, nil
+}
+
+// GetByTokenHash returns the unrevoked share stored under tokenHash. The recorded object name
+// and filename are returned only while the shared file still refers to that object, checked in
+// the same query, so a download can trust them without a further lookup.
+func (r *Repository) GetByTokenHash(ctx context.Context, tokenHash string) (Share, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Lookup)
+	defer cancel()
+
+	query := `
+SELECT s.id, s.owner_id, s.bucket_id, s.file_id, s.expires_at, s.max_downloads, s.download_count, s.revoked_at, s.created_at, s.password_hash, f.object_name, s.filename
+FROM file_shares s
+LEFT JOIN files f ON f.id = s.file_id AND f.bucket_id = s.bucket_id AND f.object_name = s.object_name
+WHERE s.token_hash = $1 AND s.revoked_at IS NULL;`
+
+	s, err := scanShare(r.db.QueryRow(ctx, query, tokenHash))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Share{}, ErrShareNotFound
+	}
+	if err != nil {
+		return Share{}, fmt.Errorf("get share: %w", err)
+	}
+	return s, nil
+}
+
+// ConsumeDownload counts one download against the share, reporting false when the share has
+// expired, been revoked, or reached its limit in the meantime. The check and increment are a
+// single statement, so concurrent downloads cannot overshoot the limit.
+func (r *Repository) ConsumeDownload(ctx context.Context, shareID uuid.UUID, now time.Time) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	query := `
+UPDATE file_shares
+SET download_count = download_count + 1
+WHERE id = $1
+  AND revoked_at IS NULL
+  AND expires_at > $2
+  AND (max_downloads IS NULL OR download_count < max_downloads);`
+
+	tag, err := r.db.Exec(ctx, query, shareID, now)
+	if err != nil {
+		return false, fmt.Errorf("consume share download: %w", err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// Revoke marks a share of the owner's file as revoked.
+func (r *Repository) Revoke(ctx context.Context, ownerID, bucketID, fileID, shareID uuid.UUID) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	query := `
+UPDATE file_shares
+SET revoked_at = NOW()
+WHERE id = $1 AND owner_id = $2 AND bucket_id = $3 AND file_id = $4 AND revoked_at IS NULL;`
+
+	tag, err := r.db.Exec(ctx, query, shareID, ownerID, bucketID, fileID)
+	if err != nil {
+		return fmt.Errorf("revoke share: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrShareNotFound
+	}
+	return nil
+}
+
+func scanShare(row pgx.Row) (Share, error) {
+	var (
+		s            Share
+		maxDownloads *int32
+		passwordHash *string
+		objectName   *string
+		filename     *string
+	)
+	if err := row.Scan(&s.ID, &s.OwnerID, &s.BucketID, &s.FileID, &s.ExpiresAt, &maxDownloads, &s.DownloadCount, &s.RevokedAt, &s.CreatedAt, &passwordHash, &objectName, &filename); err != nil {
+		return Share{}, err
+	}
+	if objectName != nil && filename != nil {
+		s.objectName, s.filename = *objectName, *filename
+	}
+	if passwordHash != nil {
+		s.passwordHash = *passwordHash
+		s.PasswordProtected = true
+	}
+	if maxDownloads != nil {
+		limit := int(*maxDownloads)
+		s.MaxDownloads = &limit
+	}
+	return s, nil
+}
@@ -0,0 +1,81 @@
+package share
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/abduss/godrive/internal/storage"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// testPool connects to the database named by GODRIVE_TEST_DATABASE_URL, which must
+// already be migrated. Repository tests are skipped when it is unset.
+func testPool(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+	dsn := os.Getenv("GODRIVE_TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("GODRIVE_TEST_DATABASE_URL not set")
+	}
+	pool, err := pgxpool.New(context.Background(), dsn)
+	if err != nil {
+		t.Fatalf("connect test database: %v", err)
+	}
+	t.Cleanup(pool.Close)
+	return pool
+}
+
+func TestRepositoryReturnsTheObjectOnlyWhileTheFileRefersToIt(t *testing.T) {
+	pool := testPool(t)
+	repo := NewRepository(pool, storage.QueryTimeouts{})
+	ctx := context.Background()
+
+	var userID, bucketID, fileID uuid.UUID
+	if err := pool.QueryRow(ctx, `INSERT INTO users (email, password_hash) VALUES ($1, 'x') RETURNING id;`,
+		"share-"+uuid.NewString()+"@example.com").Scan(&userID); err != nil {
+		t.Fatalf("seed user: %v", err)
+	}
+	t.Cleanup(func() { _, _ = pool.Exec(context.Background(), `DELETE FROM users WHERE id = $1;`, userID) })
+	if err := pool.QueryRow(ctx, `INSERT INTO buckets (owner_id, name) VALUES ($1, 'shares') RETURNING id;`, userID).Scan(&bucketID); err != nil {
+		t.Fatalf("seed bucket: %v", err)
+	}
+	objectName := bucketID.String() + "/report"
+	if err := pool.QueryRow(ctx, `
+INSERT INTO files (bucket_id, object_name, original_filename, size_bytes, content_type)
+VALUES ($1, $2, 'report.pdf', 10, 'application/pdf') RETURNING id;`, bucketID, objectName).Scan(&fileID); err != nil {
+		t.Fatalf("seed file: %v", err)
+	}
+
+	tokenHash := hashToken(uuid.NewString())
+	if _, err := repo.Create(ctx, Share{
+		OwnerID:    userID,
+		BucketID:   bucketID,
+		FileID:     fileID,
+		ExpiresAt:  time.Now().Add(time.Hour),
+		objectName: objectName,
+		filename:   "report.pdf",
+	}, tokenHash); err != nil {
+		t.Fatalf("create share: %v", err)
+	}
+
+	sh, err := repo.GetByTokenHash(ctx, tokenHash)
+	if err != nil {
+		t.Fatalf("get share: %v", err)
+	}
+	if sh.objectName != objectName || sh.filename != "report.pdf" {
+		t.Fatalf("expected the recorded object, got %q, %q", sh.objectName, sh.filename)
+	}
+
+	if _, err := pool.Exec(ctx, `UPDATE files SET object_name = $2 WHERE id = $1;`, fileID, bucketID.String()+"/moved"); err != nil {
+		t.Fatalf("move file object: %v", err)
+	}
+	sh, err = repo.GetByTokenHash(ctx, tokenHash)
+	if err != nil {
+		t.Fatalf("get share after move: %v", err)
+	}
+	if sh.objectName != "" || sh.filename != "" {
+		t.Fatalf("expected no object once the file refers to another, got %q, %q", sh.objectName, sh.filename)
+	}
+}
@@ -0,0 +1,197 @@
+package share
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/abduss/godrive/internal/file"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// DefaultTTL applies when a share is created without a lifetime.
+	DefaultTTL = 24 * time.Hour
+	// MaxTTL is the longest lifetime a share may be given.
+	MaxTTL = 30 * 24 * time.Hour
+
+	// MaxPasswordBytes is the longest share password accepted; bcrypt ignores anything longer.
+	MaxPasswordBytes = 72
+
+	tokenLength = 32
+)
+
+// store persists shares; *Repository is the production implementation.
+type store interface {
+	Create(ctx context.Context, s Share, tokenHash string) (Share, error)
+	GetByTokenHash(ctx context.Context, tokenHash string) (Share, error)
+	ConsumeDownload(ctx context.Context, shareID uuid.UUID, now time.Time) (bool, error)
+	Revoke(ctx context.Context, ownerID, bucketID, fileID, shareID uuid.UUID) error
+}
+
+// fileAccess reads files on behalf of their owner; *file.Service enforces bucket ownership.
+type fileAccess interface {
+	Get(ctx context.Context, ownerID, bucketID, fileID uuid.UUID) (file.Metadata, error)
+	Download(ctx context.Context, ownerID, bucketID, fileID uuid.UUID) (file.Metadata, io.ReadCloser, error)
+	StatDownload(ctx context.Context, ownerID, bucketID, fileID uuid.UUID, objectName, filename string) (file.Metadata, io.ReadCloser, error)
+}
+
+// Service creates, resolves, and revokes file shares.
+type Service struct {
+	store    store
+	files    fileAccess
+	throttle *passwordThrottle
+	nowFunc  func() time.Time
+}
+
+// NewService constructs a share service.
+func NewService(store store, files fileAccess) *Service {
+	return &Service{store: store, files: files, throttle: newPasswordThrottle(), nowFunc: time.Now}
+}
+
+// Create shares a file owned by ownerID. A password, when given, is stored as a bcrypt hash and
+// must accompany every download; passwords longer than MaxPasswordBytes are refused with
+// ErrPasswordTooLong. The returned token is not stored and cannot be recovered later.
+func (s *Service) Create(ctx context.Context, ownerID, bucketID, fileID uuid.UUID, opts Options) (Link, error) {
+	ttl, maxDownloads := opts.TTL, opts.MaxDownloads
+	if ttl == 0 {
+		ttl = DefaultTTL
+	}
+	if ttl < 0 || ttl > MaxTTL {
+		return Link{}, ErrInvalidTTL
+	}
+	if maxDownloads != nil && *maxDownloads <= 0 {
+		return Link{}, ErrInvalidMaxDownloads
+	}
+	if len(opts.Password) > MaxPasswordBytes {
+		return Link{}, ErrPasswordTooLong
+	}
+
+	meta, err := s.files.Get(ctx, ownerID, bucketID, fileID)
+	if err != nil {
+		return Link{}, err
+	}
+
+	token, err := generateToken()
+	if err != nil {
+		return Link{}, fmt.Errorf("generate share token: %w", err)
+	}
+
+	sh := Share{
+		OwnerID:      ownerID,
+		BucketID:     bucketID,
+		FileID:       fileID,
+		ExpiresAt:    s.nowFunc().Add(ttl).UTC(),
+		MaxDownloads: maxDownloads,
+		objectName:   meta.ObjectName,
+		filename:     meta.OriginalFilename,
+	}
+	if opts.Password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(opts.Password), bcrypt.DefaultCost)
+		if err != nil {
+			return Link{}, fmt.Errorf("hash share password: %w", err)
+		}
+		sh.passwordHash = string(hash)
+		sh.PasswordProtected = true
+	}
+
+	created, err := s.store.Create(ctx, sh, hashToken(token))
+	if err != nil {
+		return Link{}, err
+	}
+
+	return Link{Share: created, Token: token, URL: "/v1/share/" + token + "/download"}, nil
+}
+
+// Download resolves a share token and opens the shared file, counting the download against
+// the share's limit once the object has opened, so a missing or unreadable file does not use up
+// a download. password is checked only for password-protected shares, and before the
+// share's expiry or limit is revealed. After maxPasswordFailures wrong passwords within
+// passwordFailureWindow the share answers ErrTooManyPasswordAttempts, even to the right one,
+// until the window ends.
+func (s *Service) Download(ctx context.Context, token, password string) (file.Metadata, io.ReadCloser, error) {
+	if token == "" {
+		return file.Metadata{}, nil, ErrShareNotFound
+	}
+	sh, err := s.store.GetByTokenHash(ctx, hashToken(token))
+	if err != nil {
+		return file.Metadata{}, nil, err
+	}
+	now := s.nowFunc()
+	if err := s.checkPassword(sh, password, now); err != nil {
+		return file.Metadata{}, nil, err
+	}
+
+	if !now.Before(sh.ExpiresAt) {
+		return file.Metadata{}, nil, ErrShareExpired
+	}
+	if sh.MaxDownloads != nil && sh.DownloadCount >= *sh.MaxDownloads {
+		return file.Metadata{}, nil, ErrShareExhausted
+	}
+
+	// The share row names the object and was loaded only if the file still refers to it, so try
+	// serving it from a stat before paying for a metadata lookup.
+	meta, reader, err := s.files.StatDownload(ctx, sh.OwnerID, sh.BucketID, sh.FileID, sh.objectName, sh.filename)
+	if errors.Is(err, file.ErrStatUnavailable) {
+		meta, reader, err = s.files.Download(ctx, sh.OwnerID, sh.BucketID, sh.FileID)
+	}
+	if err != nil {
+		return file.Metadata{}, nil, err
+	}
+
+	ok, err := s.store.ConsumeDownload(ctx, sh.ID, now)
+	if err != nil {
+		reader.Close()
+		return file.Metadata{}, nil, err
+	}
+	if !ok {
+		// Another download used the last slot, or the share expired, since it was read.
+		reader.Close()
+		return file.Metadata{}, nil, ErrShareExhausted
+	}
+	return meta, reader, nil
+}
+
+// Revoke disables a share of the owner's file.
+func (s *Service) Revoke(ctx context.Context, ownerID, bucketID, fileID, shareID uuid.UUID) error {
+	return s.store.Revoke(ctx, ownerID, bucketID, fileID, shareID)
+}
+
+func (s *Service) checkPassword(sh Share, password string, now time.Time) error {
+	if sh.passwordHash == "" {
+		return nil
+	}
+	if password == "" {
+		return ErrPasswordRequired
+	}
+	if s.throttle.blocked(sh.ID, now) {
+		return ErrTooManyPasswordAttempts
+	}
+	if bcrypt.CompareHashAndPassword([]byte(sh.passwordHash), []byte(password)) != nil {
+		s.throttle.fail(sh.ID, now)
+		return ErrWrongPassword
+	}
+	return nil
+}
+
+func generateToken() (string, error) {
+	raw := make([]byte, tokenLength)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// hashToken derives the stored form of a token. Tokens carry 256 bits of entropy, so a plain
+// SHA-256 is enough to make a leaked table useless.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,330 @@
+package share
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abduss/godrive/internal/file"
+	"github.com/google/uuid"
+)
+
+func TestDownloadStopsAtMaxDownloads(t *testing.T) {
+	store := newFakeStore()
+	files := &fakeFiles{}
+	service := NewService(store, files)
+
+	ownerID, bucketID, fileID := uuid.New(), uuid.New(), uuid.New()
+	limit := 2
+	link, err := service.Create(context.Background(), ownerID, bucketID, fileID, Options{TTL: time.Hour, MaxDownloads: &limit})
+	if err != nil {
+		t.Fatalf("create share: %v", err)
+	}
+	if _, ok := store.byHash[link.Token]; ok {
+		t.Fatalf("expected the token to be stored hashed")
+	}
+	if link.URL != "/v1/share/"+link.Token+"/download" {
+		t.Fatalf("unexpected share url %q", link.URL)
+	}
+
+	for i := 0; i < limit; i++ {
+		meta, reader, err := service.Download(context.Background(), link.Token, "")
+		if err != nil {
+			t.Fatalf("download %d: %v", i+1, err)
+		}
+		reader.Close()
+		if meta.ID != fileID {
+			t.Fatalf("expected shared file %s, got %s", fileID, meta.ID)
+		}
+	}
+
+	if _, _, err := service.Download(context.Background(), link.Token, ""); err != ErrShareExhausted {
+		t.Fatalf("expected ErrShareExhausted after %d downloads, got %v", limit, err)
+	}
+	if files.statDownloads != limit {
+		t.Fatalf("expected %d object reads, got %d", limit, files.statDownloads)
+	}
+}
+
+func TestDownloadRejectsExpiredAndRevokedShares(t *testing.T) {
+	store := newFakeStore()
+	files := &fakeFiles{}
+	service := NewService(store, files)
+	now := time.Now()
+	service.nowFunc = func() time.Time { return now }
+
+	ownerID, bucketID, fileID := uuid.New(), uuid.New(), uuid.New()
+	link, err := service.Create(context.Background(), ownerID, bucketID, fileID, Options{TTL: time.Minute})
+	if err != nil {
+		t.Fatalf("create share: %v", err)
+	}
+	if _, reader, err := service.Download(context.Background(), link.Token, ""); err != nil {
+		t.Fatalf("download before expiry: %v", err)
+	} else {
+		reader.Close()
+	}
+
+	now = now.Add(time.Minute)
+	if _, _, err := service.Download(context.Background(), link.Token, ""); err != ErrShareExpired {
+		t.Fatalf("expected ErrShareExpired, got %v", err)
+	}
+
+	revoked, err := service.Create(context.Background(), ownerID, bucketID, fileID, Options{TTL: time.Hour})
+	if err != nil {
+		t.Fatalf("create share: %v", err)
+	}
+	if err := service.Revoke(context.Background(), ownerID, bucketID, fileID, revoked.ID); err != nil {
+		t.Fatalf("revoke: %v", err)
+	}
+	if _, _, err := service.Download(context.Background(), revoked.Token, ""); err != ErrShareNotFound {
+		t.Fatalf("expected ErrShareNotFound for a revoked share, got %v", err)
+	}
+	if _, _, err := service.Download(context.Background(), "not-a-token", ""); err != ErrShareNotFound {
+		t.Fatalf("expected ErrShareNotFound for an unknown token, got %v", err)
+	}
+
+	if _, err := service.Create(context.Background(), ownerID, bucketID, fileID, Options{TTL: MaxTTL + time.Second}); err != ErrInvalidTTL {
+		t.Fatalf("expected ErrInvalidTTL, got %v", err)
+	}
+	zero := 0
+	if _, err := service.Create(context.Background(), ownerID, bucketID, fileID, Options{TTL: time.Hour, MaxDownloads: &zero}); err != ErrInvalidMaxDownloads {
+		t.Fatalf("expected ErrInvalidMaxDownloads, got %v", err)
+	}
+}
+
+func TestDownloadRequiresSharePassword(t *testing.T) {
+	store := newFakeStore()
+	files := &fakeFiles{}
+	service := NewService(store, files)
+	now := time.Now()
+	service.nowFunc = func() time.Time { return now }
+
+	ownerID, bucketID, fileID := uuid.New(), uuid.New(), uuid.New()
+	link, err := service.Create(context.Background(), ownerID, bucketID, fileID, Options{TTL: time.Hour, Password: "hunter2"})
+	if err != nil {
+		t.Fatalf("create share: %v", err)
+	}
+	if !link.PasswordProtected {
+		t.Fatalf("expected share to report password protection")
+	}
+	if stored := store.byHash[hashToken(link.Token)].passwordHash; stored == "" || stored == "hunter2" {
+		t.Fatalf("expected a bcrypt hash to be stored, got %q", stored)
+	}
+
+	if _, _, err := service.Download(context.Background(), link.Token, ""); err != ErrPasswordRequired {
+		t.Fatalf("expected ErrPasswordRequired, got %v", err)
+	}
+	if _, _, err := service.Download(context.Background(), link.Token, "hunter3"); err != ErrWrongPassword {
+		t.Fatalf("expected ErrWrongPassword, got %v", err)
+	}
+	if files.statDownloads != 0 || store.byHash[hashToken(link.Token)].DownloadCount != 0 {
+		t.Fatalf("expected rejected attempts not to read the file or count as downloads")
+	}
+
+	_, reader, err := service.Download(context.Background(), link.Token, "hunter2")
+	if err != nil {
+		t.Fatalf("download with correct password: %v", err)
+	}
+	reader.Close()
+
+	now = now.Add(time.Hour)
+	if _, _, err := service.Download(context.Background(), link.Token, "hunter2"); err != ErrShareExpired {
+		t.Fatalf("expected ErrShareExpired with the correct password, got %v", err)
+	}
+}
+
+func TestDownloadThrottlesWrongSharePasswords(t *testing.T) {
+	store := newFakeStore()
+	files := &fakeFiles{}
+	service := NewService(store, files)
+	now := time.Now()
+	service.nowFunc = func() time.Time { return now }
+
+	ownerID, bucketID, fileID := uuid.New(), uuid.New(), uuid.New()
+	if _, err := service.Create(context.Background(), ownerID, bucketID, fileID, Options{Password: strings.Repeat("x", MaxPasswordBytes+1)}); err != ErrPasswordTooLong {
+		t.Fatalf("expected ErrPasswordTooLong for a password bcrypt cannot hash, got %v", err)
+	}
+	link, err := service.Create(context.Background(), ownerID, bucketID, fileID, Options{TTL: 24 * time.Hour, Password: "hunter2"})
+	if err != nil {
+		t.Fatalf("create share: %v", err)
+	}
+	other, err := service.Create(context.Background(), ownerID, bucketID, fileID, Options{TTL: 24 * time.Hour, Password: "hunter2"})
+	if err != nil {
+		t.Fatalf("create share: %v", err)
+	}
+
+	for i := 0; i < maxPasswordFailures; i++ {
+		if _, _, err := service.Download(context.Background(), link.Token, "guess"); err != ErrWrongPassword {
+			t.Fatalf("attempt %d: expected ErrWrongPassword, got %v", i, err)
+		}
+	}
+	if _, _, err := service.Download(context.Background(), link.Token, "hunter2"); err != ErrTooManyPasswordAttempts {
+		t.Fatalf("expected the share to refuse even the right password once throttled, got %v", err)
+	}
+	_, reader, err := service.Download(context.Background(), other.Token, "hunter2")
+	if err != nil {
+		t.Fatalf("expected other shares to be unaffected, got %v", err)
+	}
+	reader.Close()
+
+	now = now.Add(passwordFailureWindow)
+	_, reader, err = service.Download(context.Background(), link.Token, "hunter2")
+	if err != nil {
+		t.Fatalf("expected the share to accept passwords once the window ended, got %v", err)
+	}
+	reader.Close()
+}
+
+func TestDownloadFallsBackToMetadataWhenStatIsUnavailable(t *testing.T) {
+	store := newFakeStore()
+	files := &fakeFiles{}
+	service := NewService(store, files)
+
+	ownerID, bucketID, fileID := uuid.New(), uuid.New(), uuid.New()
+	link, err := service.Create(context.Background(), ownerID, bucketID, fileID, Options{TTL: time.Hour})
+	if err != nil {
+		t.Fatalf("create share: %v", err)
+	}
+
+	meta, reader, err := service.Download(context.Background(), link.Token, "")
+	if err != nil {
+		t.Fatalf("download: %v", err)
+	}
+	reader.Close()
+	if files.statDownloads != 1 || files.downloads != 0 {
+		t.Fatalf("expected the stat path without a metadata lookup, got %d stat and %d metadata reads", files.statDownloads, files.downloads)
+	}
+	if meta.OriginalFilename != "shared.txt" {
+		t.Fatalf("expected the filename recorded at share creation, got %q", meta.OriginalFilename)
+	}
+
+	files.statMissing = true
+	if _, reader, err := service.Download(context.Background(), link.Token, ""); err != nil {
+		t.Fatalf("download with stat unavailable: %v", err)
+	} else {
+		reader.Close()
+	}
+
+	// Shares created before object names were recorded go straight to metadata.
+	store.byHash[hashToken(link.Token)].objectName = ""
+	files.statMissing = false
+	if _, reader, err := service.Download(context.Background(), link.Token, ""); err != nil {
+		t.Fatalf("download of a legacy share: %v", err)
+	} else {
+		reader.Close()
+	}
+	if files.statDownloads != 1 || files.downloads != 2 {
+		t.Fatalf("expected both fallbacks to use metadata, got %d stat and %d metadata reads", files.statDownloads, files.downloads)
+	}
+}
+
+func TestDownloadKeepsTheSlotWhenTheFileCannotBeOpened(t *testing.T) {
+	store := newFakeStore()
+	files := &fakeFiles{}
+	service := NewService(store, files)
+
+	ownerID, bucketID, fileID := uuid.New(), uuid.New(), uuid.New()
+	limit := 1
+	link, err := service.Create(context.Background(), ownerID, bucketID, fileID, Options{TTL: time.Hour, MaxDownloads: &limit})
+	if err != nil {
+		t.Fatalf("create share: %v", err)
+	}
+
+	files.openErr = file.ErrFileNotFound
+	if _, _, err := service.Download(context.Background(), link.Token, ""); err != file.ErrFileNotFound {
+		t.Fatalf("expected ErrFileNotFound, got %v", err)
+	}
+	if count := store.byHash[hashToken(link.Token)].DownloadCount; count != 0 {
+		t.Fatalf("expected a failed open to leave the share unused, got %d downloads", count)
+	}
+
+	files.openErr = nil
+	_, reader, err := service.Download(context.Background(), link.Token, "")
+	if err != nil {
+		t.Fatalf("expected the download to succeed once the file opens, got %v", err)
+	}
+	reader.Close()
+}
+
+type fakeStore struct {
+	byHash map[string]*Share
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{byHash: make(map[string]*Share)}
+}
+
+func (f *fakeStore) Create(ctx context.Context, s Share, tokenHash string) (Share, error) {
+	s.ID = uuid.New()
+	s.CreatedAt = time.Now()
+	f.byHash[tokenHash] = &s
+	return s, nil
+}
+
+func (f *fakeStore) GetByTokenHash(ctx context.Context, tokenHash string) (Share, error) {
+	s, ok := f.byHash[tokenHash]
+	if !ok || s.RevokedAt != nil {
+		return Share{}, ErrShareNotFound
+	}
+	return *s, nil
+}
+
+func (f *fakeStore) ConsumeDownload(ctx context.Context, shareID uuid.UUID, now time.Time) (bool, error) {
+	for _, s := range f.byHash {
+		if s.ID != shareID {
+			continue
+		}
+		if s.RevokedAt != nil || !now.Before(s.ExpiresAt) || (s.MaxDownloads != nil && s.DownloadCount >= *s.MaxDownloads) {
+			return false, nil
+		}
+		s.DownloadCount++
+		return true, nil
+	}
+	return false, nil
+}
+
+func (f *fakeStore) Revoke(ctx context.Context, ownerID, bucketID, fileID, shareID uuid.UUID) error {
+	for _, s := range f.byHash {
+		if s.ID == shareID && s.OwnerID == ownerID && s.RevokedAt == nil {
+			now := time.Now()
+			s.RevokedAt = &now
+			return nil
+		}
+	}
+	return ErrShareNotFound
+}
+
+type fakeFiles struct {
+	downloads     int
+	statDownloads int
+	statMissing   bool
+	// openErr fails every object read when set.
+	openErr error
+}
+
+func (f *fakeFiles) Get(ctx context.Context, ownerID, bucketID, fileID uuid.UUID) (file.Metadata, error) {
+	return file.Metadata{ID: fileID, BucketID: bucketID, ObjectName: bucketID.String() + "/" + fileID.String(), OriginalFilename: "shared.txt"}, nil
+}
+
+func (f *fakeFiles) StatDownload(ctx context.Context, ownerID, bucketID, fileID uuid.UUID, objectName, filename string) (file.Metadata, io.ReadCloser, error) {
+	if objectName == "" || f.statMissing {
+		return file.Metadata{}, nil, file.ErrStatUnavailable
+	}
+	if f.openErr != nil {
+		return file.Metadata{}, nil, f.openErr
+	}
+	f.statDownloads++
+	meta := file.Metadata{ID: fileID, BucketID: bucketID, ObjectName: objectName, OriginalFilename: filename}
+	return meta, io.NopCloser(bytes.NewReader([]byte("shared"))), nil
+}
+
+func (f *fakeFiles) Download(ctx context.Context, ownerID, bucketID, fileID uuid.UUID) (file.Metadata, io.ReadCloser, error) {
+	f.downloads++
+	if f.openErr != nil {
+		return file.Metadata{}, nil, f.openErr
+	}
+	return file.Metadata{ID: fileID, BucketID: bucketID}, io.NopCloser(bytes.NewReader([]byte("shared"))), nil
+}
@@ -0,0 +1,75 @@
+package share
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// maxPasswordFailures is how many wrong passwords a share accepts per passwordFailureWindow
+	// before further attempts are refused with ErrTooManyPasswordAttempts.
+	maxPasswordFailures = 5
+	// passwordFailureWindow is how long failures count against a share, measured from the first.
+	passwordFailureWindow = 15 * time.Minute
+	// maxTrackedShares bounds the throttle's memory; past it, shares whose window has ended are
+	// forgotten since they would start afresh anyway.
+	maxTrackedShares = 10000
+)
+
+// passwordThrottle counts wrong passwords per share so a link cannot be brute-forced. It is
+// in-memory, so each replica counts separately and the counts reset on restart.
+type passwordThrottle struct {
+	mu       sync.Mutex
+	failures map[uuid.UUID]*failureWindow
+}
+
+type failureWindow struct {
+	count int
+	since time.Time
+}
+
+func newPasswordThrottle() *passwordThrottle {
+	return &passwordThrottle{failures: make(map[uuid.UUID]*failureWindow)}
+}
+
+// blocked reports whether shareID has used up its wrong passwords for the current window.
+func (t *passwordThrottle) blocked(shareID uuid.UUID, now time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	window, ok := t.failures[shareID]
+	if !ok {
+		return false
+	}
+	if !now.Before(window.since.Add(passwordFailureWindow)) {
+		delete(t.failures, shareID)
+		return false
+	}
+	return window.count >= maxPasswordFailures
+}
+
+// fail records a wrong password for shareID.
+func (t *passwordThrottle) fail(shareID uuid.UUID, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	window, ok := t.failures[shareID]
+	if !ok || !now.Before(window.since.Add(passwordFailureWindow)) {
+		if !ok && len(t.failures) >= maxTrackedShares {
+			t.forgetExpired(now)
+		}
+		window = &failureWindow{since: now}
+		t.failures[shareID] = window
+	}
+	window.count++
+}
+
+func (t *passwordThrottle) forgetExpired(now time.Time) {
+	for shareID, window := range t.failures {
+		if !now.Before(window.since.Add(passwordFailureWindow)) {
+			delete(t.failures, shareID)
+		}
+	}
+}
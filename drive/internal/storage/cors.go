@@ -0,0 +1,121 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/abduss/godrive/internal/config"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/signer"
+)
+
+// defaultSigningRegion is what MinIO assumes when no region is configured.
+const defaultSigningRegion = "us-east-1"
+
+// CORSRule is one rule of a storage bucket's CORS configuration.
+type CORSRule struct {
+	AllowedOrigins []string `xml:"AllowedOrigin"`
+	AllowedMethods []string `xml:"AllowedMethod"`
+	AllowedHeaders []string `xml:"AllowedHeader,omitempty"`
+	ExposeHeaders  []string `xml:"ExposeHeader,omitempty"`
+	MaxAgeSeconds  int      `xml:"MaxAgeSeconds,omitempty"`
+}
+
+type corsConfiguration struct {
+	XMLName xml.Name   `xml:"CORSConfiguration"`
+	Rules   []CORSRule `xml:"CORSRule"`
+}
+
+// bucketCORSSetter replaces the CORS configuration of a storage bucket.
+type bucketCORSSetter interface {
+	SetBucketCORS(ctx context.Context, bucket string, rules []CORSRule) error
+}
+
+// EnsureBucketCORS lets browsers on origins send presigned GET and PUT requests straight to
+// the storage bucket. This is the object store's CORS policy, not the API's own. The call
+// replaces the bucket's whole configuration, so repeating it is harmless; no origins means
+// the bucket is left untouched.
+func EnsureBucketCORS(ctx context.Context, client bucketCORSSetter, bucket string, origins []string) error {
+	if len(origins) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, defaultObjectStoreTimeout)
+	defer cancel()
+
+	rule := CORSRule{
+		AllowedOrigins: origins,
+		AllowedMethods: []string{http.MethodGet, http.MethodHead, http.MethodPut},
+		AllowedHeaders: []string{"*"},
+		ExposeHeaders:  []string{"ETag"},
+		MaxAgeSeconds:  3600,
+	}
+	if err := client.SetBucketCORS(ctx, bucket, []CORSRule{rule}); err != nil {
+		return fmt.Errorf("set cors on bucket %q: %w", bucket, err)
+	}
+	return nil
+}
+
+// MinIOCORSClient sets bucket CORS configurations on a MinIO server. The SDK version in use
+// has no CORS call, so it sends the signed S3 PutBucketCors request itself.
+type MinIOCORSClient struct {
+	client *minio.Client
+	cfg    config.MinIOConfig
+	http   *http.Client
+}
+
+// NewMinIOCORSClient wraps client, signing requests with the credentials in cfg.
+func NewMinIOCORSClient(client *minio.Client, cfg config.MinIOConfig) (*MinIOCORSClient, error) {
+	transport, err := newMinIOTransport(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("create minio transport: %w", err)
+	}
+	return &MinIOCORSClient{client: client, cfg: cfg, http: &http.Client{Transport: transport}}, nil
+}
+
+// SetBucketCORS implements bucketCORSSetter.
+func (c *MinIOCORSClient) SetBucketCORS(ctx context.Context, bucket string, rules []CORSRule) error {
+	body, err := xml.Marshal(corsConfiguration{Rules: rules})
+	if err != nil {
+		return fmt.Errorf("encode cors configuration: %w", err)
+	}
+
+	target := *c.client.EndpointURL()
+	target.Path = "/" + bucket
+	target.RawQuery = "cors="
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, target.String(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	md5Sum := md5.Sum(body)
+	shaSum := sha256.Sum256(body)
+	req.Header.Set("Content-Type", "application/xml")
+	req.Header.Set("Content-MD5", base64.StdEncoding.EncodeToString(md5Sum[:]))
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(shaSum[:]))
+
+	region := c.cfg.Region
+	if region == "" {
+		region = defaultSigningRegion
+	}
+	req = signer.SignV4(*req, c.cfg.AccessKeyID, c.cfg.SecretAccessKey, "", region)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("put bucket cors: %s: %s", resp.Status, bytes.TrimSpace(detail))
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"context"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/abduss/godrive/internal/config"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+func TestEnsureBucketCORSAppliesConfiguredOrigins(t *testing.T) {
+	setter := &fakeCORSSetter{}
+	if err := EnsureBucketCORS(context.Background(), setter, "godrive", nil); err != nil {
+		t.Fatalf("EnsureBucketCORS returned error: %v", err)
+	}
+	if setter.calls != 0 {
+		t.Fatalf("expected no cors call without configured origins")
+	}
+
+	origins := []string{"https://app.example.com"}
+	if err := EnsureBucketCORS(context.Background(), setter, "godrive", origins); err != nil {
+		t.Fatalf("EnsureBucketCORS returned error: %v", err)
+	}
+	if setter.calls != 1 || setter.bucket != "godrive" || len(setter.rules) != 1 {
+		t.Fatalf("expected one rule set on godrive, got %d calls on %q with %+v", setter.calls, setter.bucket, setter.rules)
+	}
+	rule := setter.rules[0]
+	if len(rule.AllowedOrigins) != 1 || rule.AllowedOrigins[0] != origins[0] {
+		t.Fatalf("expected origins %v, got %v", origins, rule.AllowedOrigins)
+	}
+	if !strings.Contains(strings.Join(rule.AllowedMethods, ","), http.MethodPut) {
+		t.Fatalf("expected PUT to be allowed for presigned uploads, got %v", rule.AllowedMethods)
+	}
+}
+
+func TestMinIOCORSClientSendsSignedPutBucketCors(t *testing.T) {
+	var got struct {
+		method, query, md5, auth string
+		body                     corsConfiguration
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got.method, got.query = r.Method, r.URL.RawQuery
+		got.md5, got.auth = r.Header.Get("Content-MD5"), r.Header.Get("Authorization")
+		raw, _ := io.ReadAll(r.Body)
+		_ = xml.Unmarshal(raw, &got.body)
+	}))
+	defer server.Close()
+
+	cfg := config.MinIOConfig{Endpoint: strings.TrimPrefix(server.URL, "http://"), AccessKeyID: "key", SecretAccessKey: "secret"}
+	client, err := minio.New(cfg.Endpoint, &minio.Options{Creds: credentials.NewStaticV4(cfg.AccessKeyID, cfg.SecretAccessKey, "")})
+	if err != nil {
+		t.Fatalf("create minio client: %v", err)
+	}
+	corsClient, err := NewMinIOCORSClient(client, cfg)
+	if err != nil {
+		t.Fatalf("NewMinIOCORSClient returned error: %v", err)
+	}
+
+	if err := EnsureBucketCORS(context.Background(), corsClient, "godrive", []string{"https://app.example.com"}); err != nil {
+		t.Fatalf("EnsureBucketCORS returned error: %v", err)
+	}
+	if got.method != http.MethodPut || got.query != "cors=" {
+		t.Fatalf("expected PUT ?cors, got %s ?%s", got.method, got.query)
+	}
+	if got.md5 == "" || !strings.HasPrefix(got.auth, "AWS4-HMAC-SHA256") {
+		t.Fatalf("expected a signed request with Content-MD5, got md5=%q auth=%q", got.md5, got.auth)
+	}
+	if len(got.body.Rules) != 1 || got.body.Rules[0].AllowedOrigins[0] != "https://app.example.com" {
+		t.Fatalf("unexpected cors body %+v", got.body)
+	}
+}
+
+type fakeCORSSetter struct {
+	calls  int
+	bucket string
+	rules  []CORSRule
+}
+
+func (f *fakeCORSSetter) SetBucketCORS(ctx context.Context, bucket string, rules []CORSRule) error {
+	f.calls++
+	f.bucket = bucket
+	f.rules = rules
+	return nil
+}
@@ -0,0 +1,122 @@
+package storage
+
+import (
+	"context"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// QueryObserver receives the duration of one statement and the repository operation that ran it.
+type QueryObserver func(operation string, elapsed time.Duration)
+
+// Instrument wraps db so every statement is timed and reported to observe. The operation is the
+// calling repository method, e.g. "file.Create", so labels stay bounded by the code rather than
+// by the SQL. Transactions begun on the result are instrumented too. For Query the duration
+// covers the round trip to the first row, not iteration by the caller.
+func Instrument(db Querier, observe QueryObserver) Querier {
+	return &instrumented{db: db, observe: observe}
+}
+
+type instrumented struct {
+	db      Querier
+	observe QueryObserver
+}
+
+func (q *instrumented) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	defer q.track(time.Now())
+	return q.db.Exec(ctx, sql, args...)
+}
+
+func (q *instrumented) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	defer q.track(time.Now())
+	return q.db.Query(ctx, sql, args...)
+}
+
+func (q *instrumented) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	defer q.track(time.Now())
+	return q.db.QueryRow(ctx, sql, args...)
+}
+
+func (q *instrumented) CopyFrom(ctx context.Context, tableName pgx.Identifier, columnNames []string, rowSrc pgx.CopyFromSource) (int64, error) {
+	defer q.track(time.Now())
+	return q.db.CopyFrom(ctx, tableName, columnNames, rowSrc)
+}
+
+func (q *instrumented) Begin(ctx context.Context) (pgx.Tx, error) {
+	tx, err := q.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedTx{Tx: tx, q: &instrumented{db: tx, observe: q.observe}}, nil
+}
+
+// track must be deferred directly from a statement method so the caller lookup lands on the
+// repository frame.
+func (q *instrumented) track(start time.Time) {
+	q.observe(callerOperation(3), time.Since(start))
+}
+
+// instrumentedTx times statements run on a transaction while leaving Commit and Rollback to pgx.
+type instrumentedTx struct {
+	pgx.Tx
+	q *instrumented
+}
+
+func (t *instrumentedTx) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	defer t.q.track(time.Now())
+	return t.Tx.Exec(ctx, sql, args...)
+}
+
+func (t *instrumentedTx) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	defer t.q.track(time.Now())
+	return t.Tx.Query(ctx, sql, args...)
+}
+
+func (t *instrumentedTx) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	defer t.q.track(time.Now())
+	return t.Tx.QueryRow(ctx, sql, args...)
+}
+
+func (t *instrumentedTx) CopyFrom(ctx context.Context, tableName pgx.Identifier, columnNames []string, rowSrc pgx.CopyFromSource) (int64, error) {
+	defer t.q.track(time.Now())
+	return t.Tx.CopyFrom(ctx, tableName, columnNames, rowSrc)
+}
+
+func (t *instrumentedTx) Begin(ctx context.Context) (pgx.Tx, error) {
+	return t.q.Begin(ctx)
+}
+
+// callerOperation names the function skip frames up as "package.Method", dropping the module
+// path, the receiver type and closure suffixes.
+func callerOperation(skip int) string {
+	pc, _, _, ok := runtime.Caller(skip)
+	if !ok {
+		return "unknown"
+	}
+	fn := runtime.FuncForPC(pc)
+	if fn == nil {
+		return "unknown"
+	}
+	return operationName(fn.Name())
+}
+
+// operationName turns "example.com/app/internal/file.(*Repository).Create.func1" into
+// "file.Create".
+func operationName(function string) string {
+	if slash := strings.LastIndex(function, "/"); slash >= 0 {
+		function = function[slash+1:]
+	}
+	parts := strings.Split(function, ".")
+	name := parts[0]
+	for _, part := range parts[1:] {
+		if strings.HasPrefix(part, "(") || strings.HasPrefix(part, "func") && strings.Trim(part[4:], "0123456789") == "" {
+			continue
+		}
+		return name + "." + part
+	}
+	return name
+}
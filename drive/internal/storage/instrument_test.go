@@ -0,0 +1,18 @@
+package storage
+
+import "testing"
+
+func TestOperationNameDropsPathReceiverAndClosures(t *testing.T) {
+	cases := map[string]string{
+		"github.com/abduss/godrive/internal/file.(*Repository).Create":           "file.Create",
+		"github.com/abduss/godrive/internal/file.(*Repository).MoveFiles.func1":  "file.MoveFiles",
+		"github.com/abduss/godrive/internal/bucket.scanBucket":                   "bucket.scanBucket",
+		"github.com/abduss/godrive/internal/audit.(*Repository).Activity.func12": "audit.Activity",
+		"main.main": "main.main",
+	}
+	for function, want := range cases {
+		if got := operationName(function); got != want {
+			t.Fatalf("operationName(%q) = %q, want %q", function, got, want)
+		}
+	}
+}
@@ -3,6 +3,8 @@ package storage
 import (
 	"context"
 	"fmt"
+	"net"
+	"net/http"
 	"strings"
 	"time"
 
@@ -21,10 +23,16 @@ func NewMinIOClient(cfg config.MinIOConfig) (*minio.Client, error) {
 		endpoint = fmt.Sprintf("%s:9000", endpoint)
 	}
 
+	transport, err := newMinIOTransport(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("create minio transport: %w", err)
+	}
+
 	client, err := minio.New(endpoint, &minio.Options{
-		Creds:  credentials.NewStaticV4(cfg.AccessKeyID, cfg.SecretAccessKey, ""),
-		Secure: cfg.UseSSL,
-		Region: cfg.Region,
+		Creds:     credentials.NewStaticV4(cfg.AccessKeyID, cfg.SecretAccessKey, ""),
+		Secure:    cfg.UseSSL,
+		Region:    cfg.Region,
+		Transport: transport,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("create minio client: %w", err)
@@ -33,8 +41,37 @@ func NewMinIOClient(cfg config.MinIOConfig) (*minio.Client, error) {
 	return client, nil
 }
 
-// EnsureBucket ensures the target bucket exists, creating it if necessary.
-func EnsureBucket(ctx context.Context, client *minio.Client, bucket, region string) error {
+// newMinIOTransport starts from the SDK's default transport and applies the configured
+// connection timeouts; zero values keep the SDK defaults.
+func newMinIOTransport(cfg config.MinIOConfig) (*http.Transport, error) {
+	transport, err := minio.DefaultTransport(cfg.UseSSL)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.DialTimeout > 0 {
+		transport.DialContext = (&net.Dialer{
+			Timeout:   cfg.DialTimeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext
+	}
+	if cfg.TLSHandshakeTimeout > 0 {
+		transport.TLSHandshakeTimeout = cfg.TLSHandshakeTimeout
+	}
+	if cfg.ResponseHeaderTimeout > 0 {
+		transport.ResponseHeaderTimeout = cfg.ResponseHeaderTimeout
+	}
+	return transport, nil
+}
+
+// bucketMaker is the subset of *minio.Client used by EnsureBucket.
+type bucketMaker interface {
+	BucketExists(ctx context.Context, bucketName string) (bool, error)
+	MakeBucket(ctx context.Context, bucketName string, opts minio.MakeBucketOptions) error
+}
+
+// EnsureBucket ensures the target bucket exists, creating it in region if necessary.
+// An empty region leaves the choice to the server's default.
+func EnsureBucket(ctx context.Context, client bucketMaker, bucket, region string) error {
 	ctx, cancel := context.WithTimeout(ctx, defaultObjectStoreTimeout)
 	defer cancel()
 
@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/abduss/godrive/internal/config"
+	"github.com/minio/minio-go/v7"
+)
+
+func TestEnsureBucketCreatesInConfiguredRegion(t *testing.T) {
+	maker := &fakeBucketMaker{}
+	if err := EnsureBucket(context.Background(), maker, "godrive", "eu-central-1"); err != nil {
+		t.Fatalf("EnsureBucket returned error: %v", err)
+	}
+	if maker.made != "godrive" || maker.region != "eu-central-1" {
+		t.Fatalf("expected godrive created in eu-central-1, got %q in %q", maker.made, maker.region)
+	}
+
+	existing := &fakeBucketMaker{exists: true}
+	if err := EnsureBucket(context.Background(), existing, "godrive", "eu-central-1"); err != nil {
+		t.Fatalf("EnsureBucket returned error: %v", err)
+	}
+	if existing.made != "" {
+		t.Fatalf("expected existing bucket to be left alone")
+	}
+}
+
+func TestMinIOTransportAppliesConfiguredTimeouts(t *testing.T) {
+	transport, err := newMinIOTransport(config.MinIOConfig{
+		DialTimeout:           50 * time.Millisecond,
+		TLSHandshakeTimeout:   3 * time.Second,
+		ResponseHeaderTimeout: 7 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("newMinIOTransport returned error: %v", err)
+	}
+	if transport.TLSHandshakeTimeout != 3*time.Second {
+		t.Fatalf("expected TLS handshake timeout 3s, got %s", transport.TLSHandshakeTimeout)
+	}
+	if transport.ResponseHeaderTimeout != 7*time.Second {
+		t.Fatalf("expected response header timeout 7s, got %s", transport.ResponseHeaderTimeout)
+	}
+
+	// A server that accepts connections but never answers holds the request until the response
+	// header timeout fires.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	silent, err := newMinIOTransport(config.MinIOConfig{ResponseHeaderTimeout: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("newMinIOTransport returned error: %v", err)
+	}
+	client := &http.Client{Transport: silent}
+	start := time.Now()
+	resp, err := client.Get("http://" + listener.Addr().String() + "/godrive")
+	if err == nil {
+		resp.Body.Close()
+		t.Fatalf("expected the silent server to time out")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("expected the request to give up after the configured timeout, took %s", elapsed)
+	}
+
+	defaults, err := newMinIOTransport(config.MinIOConfig{})
+	if err != nil {
+		t.Fatalf("newMinIOTransport returned error: %v", err)
+	}
+	if defaults.ResponseHeaderTimeout != time.Minute || defaults.TLSHandshakeTimeout != 10*time.Second {
+		t.Fatalf("expected SDK defaults for unset timeouts, got %s/%s", defaults.ResponseHeaderTimeout, defaults.TLSHandshakeTimeout)
+	}
+}
+
+type fakeBucketMaker struct {
+	exists bool
+	made   string
+	region string
+}
+
+func (f *fakeBucketMaker) BucketExists(ctx context.Context, bucketName string) (bool, error) {
+	return f.exists, nil
+}
+
+func (f *fakeBucketMaker) MakeBucket(ctx context.Context, bucketName string, opts minio.MakeBucketOptions) error {
+	f.made = bucketName
+	f.region = opts.Region
+	return nil
+}
@@ -11,6 +11,30 @@ import (
 
 const defaultDBTimeout = 5 * time.Second
 
+// DefaultQueryTimeout bounds a repository query whose operation class has no configured timeout.
+const DefaultQueryTimeout = 5 * time.Second
+
+// QueryTimeouts bounds repository queries by operation class, so a large listing can be given
+// longer than a lookup by primary key.
+type QueryTimeouts struct {
+	// Lookup bounds single-row reads and existence checks.
+	Lookup time.Duration
+	// List bounds multi-row reads such as listings, aggregates, and archive selections.
+	List time.Duration
+	// Write bounds inserts, updates, and deletes.
+	Write time.Duration
+}
+
+// WithDefaults returns t with every non-positive timeout replaced by DefaultQueryTimeout.
+func (t QueryTimeouts) WithDefaults() QueryTimeouts {
+	for _, timeout := range []*time.Duration{&t.Lookup, &t.List, &t.Write} {
+		if *timeout <= 0 {
+			*timeout = DefaultQueryTimeout
+		}
+	}
+	return t
+}
+
 // NewPostgresPool connects to PostgreSQL using pgx.
 func NewPostgresPool(ctx context.Context, cfg config.PostgresConfig) (*pgxpool.Pool, error) {
 	poolCfg, err := pgxpool.ParseConfig(cfg.DSN())
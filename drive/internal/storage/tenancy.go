@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// EnsureFunc makes sure a physical bucket exists before it is first used.
+type EnsureFunc func(ctx context.Context, bucket string) error
+
+// TenantBuckets maps owners to the physical object store bucket that holds their files. Owners
+// without a mapping use the shared bucket; several owners may share a tenant bucket to isolate
+// a group. Each tenant bucket is ensured once, on first use, so new tenants need no restart.
+type TenantBuckets struct {
+	shared  string
+	byOwner map[uuid.UUID]string
+	ensure  EnsureFunc
+
+	mu       sync.Mutex
+	ensured  map[string]bool
+	inflight map[string]*ensureCall
+}
+
+// ensureCall is one in-progress ensure of a tenant bucket that concurrent resolvers wait on.
+type ensureCall struct {
+	done chan struct{}
+	err  error
+}
+
+// NewTenantBuckets routes byOwner's owners to their buckets and everyone else to shared. A nil
+// ensure skips bucket creation.
+func NewTenantBuckets(shared string, byOwner map[uuid.UUID]string, ensure EnsureFunc) *TenantBuckets {
+	return &TenantBuckets{
+		shared:   shared,
+		byOwner:  byOwner,
+		ensure:   ensure,
+		ensured:  map[string]bool{shared: true},
+		inflight: make(map[string]*ensureCall),
+	}
+}
+
+// Shared returns the bucket used by owners without a mapping.
+func (t *TenantBuckets) Shared() string {
+	return t.shared
+}
+
+// ParseTenantBuckets reads "ownerID=bucket" entries into an owner to bucket mapping.
+func ParseTenantBuckets(entries []string) (map[uuid.UUID]string, error) {
+	byOwner := make(map[uuid.UUID]string, len(entries))
+	for _, entry := range entries {
+		owner, bucket, ok := strings.Cut(entry, "=")
+		bucket = strings.TrimSpace(bucket)
+		if !ok || bucket == "" {
+			return nil, fmt.Errorf("tenant bucket %q: want ownerID=bucket", entry)
+		}
+		ownerID, err := uuid.Parse(strings.TrimSpace(owner))
+		if err != nil {
+			return nil, fmt.Errorf("tenant bucket %q: %w", entry, err)
+		}
+		byOwner[ownerID] = bucket
+	}
+	return byOwner, nil
+}
+
+// Resolve returns the physical bucket for ownerID, creating it first if this is its first use.
+// The ensure call runs without holding the lock, so owners of other buckets are not held up;
+// concurrent first uses of the same bucket wait for a single call. A failed ensure is retried by
+// the next Resolve.
+func (t *TenantBuckets) Resolve(ctx context.Context, ownerID uuid.UUID) (string, error) {
+	bucket, ok := t.byOwner[ownerID]
+	if !ok || bucket == "" {
+		return t.shared, nil
+	}
+	if t.ensure == nil {
+		return bucket, nil
+	}
+
+	t.mu.Lock()
+	if t.ensured[bucket] {
+		t.mu.Unlock()
+		return bucket, nil
+	}
+	if call, ok := t.inflight[bucket]; ok {
+		t.mu.Unlock()
+		select {
+		case <-call.done:
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+		if call.err != nil {
+			return "", call.err
+		}
+		return bucket, nil
+	}
+	call := &ensureCall{done: make(chan struct{})}
+	t.inflight[bucket] = call
+	t.mu.Unlock()
+
+	call.err = t.ensure(ctx, bucket)
+
+	t.mu.Lock()
+	if call.err == nil {
+		t.ensured[bucket] = true
+	}
+	delete(t.inflight, bucket)
+	t.mu.Unlock()
+	close(call.done)
+
+	if call.err != nil {
+		return "", call.err
+	}
+	return bucket, nil
+}
@@ -0,0 +1,51 @@
+package storage
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestTenantBucketsEnsureOncePerBucketWithoutBlockingOthers(t *testing.T) {
+	slowOwner, otherSlowOwner, fastOwner := uuid.New(), uuid.New(), uuid.New()
+	release := make(chan struct{})
+	var slowCalls atomic.Int32
+	tenants := NewTenantBuckets("shared", map[uuid.UUID]string{
+		slowOwner:      "slow",
+		otherSlowOwner: "slow",
+		fastOwner:      "fast",
+	}, func(ctx context.Context, bucket string) error {
+		if bucket == "slow" {
+			slowCalls.Add(1)
+			<-release
+		}
+		return nil
+	})
+
+	var wg sync.WaitGroup
+	for _, owner := range []uuid.UUID{slowOwner, otherSlowOwner} {
+		wg.Add(1)
+		go func(owner uuid.UUID) {
+			defer wg.Done()
+			if bucket, err := tenants.Resolve(context.Background(), owner); err != nil || bucket != "slow" {
+				t.Errorf("resolve slow tenant: got %q, %v", bucket, err)
+			}
+		}(owner)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if bucket, err := tenants.Resolve(ctx, fastOwner); err != nil || bucket != "fast" {
+		t.Fatalf("expected another tenant to resolve while the slow ensure runs, got %q, %v", bucket, err)
+	}
+
+	close(release)
+	wg.Wait()
+	if calls := slowCalls.Load(); calls != 1 {
+		t.Fatalf("expected one ensure for the shared tenant bucket, got %d", calls)
+	}
+}
@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func TestWithinTxRollsBackOnError(t *testing.T) {
+	failure := errors.New("second step failed")
+	tx := &fakeTx{}
+	err := WithinTx(context.Background(), &fakeBeginner{tx: tx}, func(pgx.Tx) error {
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Fatalf("expected fn's error to be returned, got %v", err)
+	}
+	if tx.committed || !tx.rolledBack {
+		t.Fatalf("expected a rollback without commit, got committed=%v rolledBack=%v", tx.committed, tx.rolledBack)
+	}
+
+	tx = &fakeTx{}
+	if err := WithinTx(context.Background(), &fakeBeginner{tx: tx}, func(pgx.Tx) error { return nil }); err != nil {
+		t.Fatalf("WithinTx returned error: %v", err)
+	}
+	if !tx.committed {
+		t.Fatalf("expected the transaction to be committed")
+	}
+
+	tx = &fakeTx{}
+	func() {
+		defer func() { _ = recover() }()
+		_ = WithinTx(context.Background(), &fakeBeginner{tx: tx}, func(pgx.Tx) error { panic("boom") })
+	}()
+	if tx.committed || !tx.rolledBack {
+		t.Fatalf("expected a panic to roll back, got committed=%v rolledBack=%v", tx.committed, tx.rolledBack)
+	}
+}
+
+type fakeBeginner struct {
+	tx *fakeTx
+}
+
+func (f *fakeBeginner) Begin(ctx context.Context) (pgx.Tx, error) {
+	return f.tx, nil
+}
+
+// fakeTx records how a transaction ended; statements are not expected.
+type fakeTx struct {
+	pgx.Tx
+	committed  bool
+	rolledBack bool
+}
+
+func (f *fakeTx) Commit(ctx context.Context) error {
+	f.committed = true
+	return nil
+}
+
+func (f *fakeTx) Rollback(ctx context.Context) error {
+	if f.committed {
+		return pgx.ErrTxClosed
+	}
+	f.rolledBack = true
+	return nil
+}
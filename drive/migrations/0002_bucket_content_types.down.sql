@@ -0,0 +1,3 @@
+ALTER TABLE buckets
+    DROP COLUMN IF EXISTS default_content_type,
+    DROP COLUMN IF EXISTS allowed_content_types;
@@ -0,0 +1,3 @@
+ALTER TABLE buckets
+    ADD COLUMN IF NOT EXISTS allowed_content_types TEXT[] NOT NULL DEFAULT '{}',
+    ADD COLUMN IF NOT EXISTS default_content_type TEXT;
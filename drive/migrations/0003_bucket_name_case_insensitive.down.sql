@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_buckets_owner_lower_name;
@@ -0,0 +1,8 @@
+UPDATE buckets b
+SET name = b.name || '-' || left(b.id::text, 8), updated_at = NOW()
+FROM (
+    SELECT id, row_number() OVER (PARTITION BY owner_id, lower(name) ORDER BY created_at, id) AS rank
+    FROM buckets
+) ranked
+WHERE ranked.id = b.id AND ranked.rank > 1;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_buckets_owner_lower_name ON buckets (owner_id, lower(name));
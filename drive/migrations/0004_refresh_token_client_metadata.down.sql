@@ -0,0 +1,3 @@
+ALTER TABLE refresh_tokens
+    DROP COLUMN IF EXISTS ip_address,
+    DROP COLUMN IF EXISTS user_agent;
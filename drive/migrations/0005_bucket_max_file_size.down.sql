@@ -0,0 +1,2 @@
+ALTER TABLE buckets
+    DROP COLUMN IF EXISTS max_file_size_bytes;
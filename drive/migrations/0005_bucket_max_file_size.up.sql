@@ -0,0 +1,2 @@
+ALTER TABLE buckets
+    ADD COLUMN IF NOT EXISTS max_file_size_bytes BIGINT CHECK (max_file_size_bytes > 0);
@@ -0,0 +1,2 @@
+ALTER TABLE buckets
+    ADD COLUMN IF NOT EXISTS is_public BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,2 @@
+ALTER TABLE buckets
+    DROP COLUMN IF EXISTS region;
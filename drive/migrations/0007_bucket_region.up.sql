@@ -0,0 +1,2 @@
+ALTER TABLE buckets
+    ADD COLUMN IF NOT EXISTS region TEXT;
@@ -0,0 +1,2 @@
+ALTER TABLE file_shares
+    ADD COLUMN IF NOT EXISTS password_hash TEXT;
@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS idx_files_bucket_checksum ON files (bucket_id, checksum);
@@ -0,0 +1,3 @@
+ALTER TABLE file_shares
+    DROP COLUMN IF EXISTS filename,
+    DROP COLUMN IF EXISTS object_name;
@@ -0,0 +1,3 @@
+ALTER TABLE file_shares
+    ADD COLUMN IF NOT EXISTS object_name TEXT,
+    ADD COLUMN IF NOT EXISTS filename TEXT;
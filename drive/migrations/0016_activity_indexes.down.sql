@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_file_shares_owner_created;
+DROP INDEX IF EXISTS idx_presign_audit_owner_created;
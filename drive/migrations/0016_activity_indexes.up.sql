@@ -0,0 +1,2 @@
+CREATE INDEX IF NOT EXISTS idx_presign_audit_owner_created ON presign_audit (owner_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_file_shares_owner_created ON file_shares (owner_id, created_at DESC);
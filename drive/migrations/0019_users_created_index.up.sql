@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS idx_users_created ON users (created_at DESC, id DESC);
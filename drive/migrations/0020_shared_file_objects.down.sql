@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_files_object_name;
+ALTER TABLE files
+    ADD CONSTRAINT files_bucket_id_object_name_key UNIQUE (bucket_id, object_name);
@@ -0,0 +1,3 @@
+ALTER TABLE files
+    DROP CONSTRAINT IF EXISTS files_bucket_id_object_name_key;
+CREATE INDEX IF NOT EXISTS idx_files_object_name ON files (object_name);
@@ -0,0 +1,3 @@
+DELETE FROM idempotency_keys WHERE file_id IS NULL;
+ALTER TABLE idempotency_keys
+    ALTER COLUMN file_id SET NOT NULL;
@@ -0,0 +1,2 @@
+ALTER TABLE idempotency_keys
+    ALTER COLUMN file_id DROP NOT NULL;
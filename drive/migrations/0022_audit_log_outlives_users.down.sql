@@ -0,0 +1,4 @@
+DELETE FROM audit_log a
+WHERE NOT EXISTS (SELECT 1 FROM users u WHERE u.id = a.user_id);
+ALTER TABLE audit_log
+    ADD CONSTRAINT audit_log_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
@@ -0,0 +1,2 @@
+ALTER TABLE audit_log
+    DROP CONSTRAINT IF EXISTS audit_log_user_id_fkey;
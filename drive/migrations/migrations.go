@@ -0,0 +1,160 @@
+// Package migrations embeds the SQL schema migrations and applies pending ones at startup.
+//
+// Files are named NNNN_description.up.sql / NNNN_description.down.sql. Applied state is kept in
+// the same schema_migrations table (one row of version and dirty flag) that the golang-migrate
+// CLI used by `make migrate-up` maintains, so databases migrated either way stay interchangeable.
+package migrations
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+//go:embed *.sql
+var files embed.FS
+
+// advisoryLockID serializes runners when several instances boot at once.
+const advisoryLockID = 0x676f6472697665
+
+// ErrDirty reports that a previous migration failed part-way and needs manual repair.
+var ErrDirty = errors.New("schema_migrations is marked dirty")
+
+// Migration is a single versioned schema change.
+type Migration struct {
+	Version uint64
+	Name    string
+	UpSQL   string
+}
+
+// Load returns the embedded up migrations in version order.
+func Load() ([]Migration, error) {
+	return load(files)
+}
+
+func load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("read migrations: %w", err)
+	}
+
+	var migrations []Migration
+	seen := make(map[uint64]string)
+	for _, entry := range entries {
+		name := entry.Name()
+		base, ok := strings.CutSuffix(name, ".up.sql")
+		if !ok {
+			continue
+		}
+		prefix, _, _ := strings.Cut(base, "_")
+		version, err := strconv.ParseUint(prefix, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migration %q: invalid version prefix", name)
+		}
+		if other, dup := seen[version]; dup {
+			return nil, fmt.Errorf("migrations %q and %q share version %d", other, name, version)
+		}
+		seen[version] = name
+
+		body, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, fmt.Errorf("read migration %q: %w", name, err)
+		}
+		migrations = append(migrations, Migration{Version: version, Name: base, UpSQL: string(body)})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Up applies every embedded migration newer than the database's current version, each in its
+// own transaction, and returns the resulting version.
+func Up(ctx context.Context, pool *pgxpool.Pool) (uint64, error) {
+	migrations, err := Load()
+	if err != nil {
+		return 0, err
+	}
+	return apply(ctx, pool, migrations)
+}
+
+func apply(ctx context.Context, pool *pgxpool.Pool, migrations []Migration) (uint64, error) {
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, `SELECT pg_advisory_lock($1)`, advisoryLockID); err != nil {
+		return 0, fmt.Errorf("lock migrations: %w", err)
+	}
+	defer conn.Exec(context.Background(), `SELECT pg_advisory_unlock($1)`, advisoryLockID)
+
+	if _, err := conn.Exec(ctx,
+		`CREATE TABLE IF NOT EXISTS schema_migrations (version BIGINT NOT NULL PRIMARY KEY, dirty BOOLEAN NOT NULL)`,
+	); err != nil {
+		return 0, fmt.Errorf("create schema_migrations: %w", err)
+	}
+
+	current, err := currentVersion(ctx, conn.Conn())
+	if err != nil {
+		return 0, err
+	}
+
+	for _, m := range migrations {
+		if m.Version <= current {
+			continue
+		}
+		if err := applyOne(ctx, conn.Conn(), m); err != nil {
+			return current, err
+		}
+		current = m.Version
+	}
+	return current, nil
+}
+
+func currentVersion(ctx context.Context, conn *pgx.Conn) (uint64, error) {
+	var (
+		version int64
+		dirty   bool
+	)
+	err := conn.QueryRow(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&version, &dirty)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("read schema version: %w", err)
+	}
+	if dirty {
+		return 0, fmt.Errorf("%w at version %d", ErrDirty, version)
+	}
+	return uint64(version), nil
+}
+
+func applyOne(ctx context.Context, conn *pgx.Conn, m Migration) error {
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin migration %s: %w", m.Name, err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, m.UpSQL); err != nil {
+		return fmt.Errorf("apply migration %s: %w", m.Name, err)
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM schema_migrations`); err != nil {
+		return fmt.Errorf("record migration %s: %w", m.Name, err)
+	}
+	if _, err := tx.Exec(ctx,
+		`INSERT INTO schema_migrations (version, dirty) VALUES ($1, FALSE)`, int64(m.Version),
+	); err != nil {
+		return fmt.Errorf("record migration %s: %w", m.Name, err)
+	}
+	return tx.Commit(ctx)
+}
@@ -0,0 +1,80 @@
+package migrations
+
+import (
+	"context"
+	"os"
+	"testing"
+	"testing/fstest"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func TestLoadOrdersEmbeddedMigrations(t *testing.T) {
+	migrations, err := Load()
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if len(migrations) == 0 || migrations[0].Version != 1 || migrations[0].Name != "0001_init" {
+		t.Fatalf("expected the baseline schema first, got %+v", migrations)
+	}
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].Version <= migrations[i-1].Version {
+			t.Fatalf("migrations out of order: %s after %s", migrations[i].Name, migrations[i-1].Name)
+		}
+	}
+}
+
+func TestLoadRejectsDuplicateVersions(t *testing.T) {
+	fsys := fstest.MapFS{
+		"0001_a.up.sql":   {Data: []byte("SELECT 1")},
+		"0001_a.down.sql": {Data: []byte("SELECT 1")},
+		"0001_b.up.sql":   {Data: []byte("SELECT 1")},
+	}
+	if _, err := load(fsys); err == nil {
+		t.Fatalf("expected duplicate versions to be rejected")
+	}
+}
+
+// TestUpAppliesMigrations runs against the database named by GODRIVE_TEST_DATABASE_URL, which
+// may be empty or already migrated. It is skipped when the variable is unset.
+func TestUpAppliesMigrations(t *testing.T) {
+	dsn := os.Getenv("GODRIVE_TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("GODRIVE_TEST_DATABASE_URL not set")
+	}
+	ctx := context.Background()
+	pool, err := pgxpool.New(ctx, dsn)
+	if err != nil {
+		t.Fatalf("connect test database: %v", err)
+	}
+	t.Cleanup(pool.Close)
+
+	migrations, err := Load()
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	latest := migrations[len(migrations)-1].Version
+
+	version, err := Up(ctx, pool)
+	if err != nil {
+		t.Fatalf("up: %v", err)
+	}
+	if version != latest {
+		t.Fatalf("expected version %d, got %d", latest, version)
+	}
+
+	// A second run finds nothing pending.
+	if version, err = Up(ctx, pool); err != nil || version != latest {
+		t.Fatalf("expected idempotent rerun at %d, got %d, %v", latest, version, err)
+	}
+
+	for _, table := range []string{"users", "buckets", "bucket_usage", "files", "refresh_tokens", "usage_snapshots"} {
+		var exists bool
+		if err := pool.QueryRow(ctx, `SELECT to_regclass($1) IS NOT NULL`, table).Scan(&exists); err != nil {
+			t.Fatalf("check table %s: %v", table, err)
+		}
+		if !exists {
+			t.Fatalf("expected table %s after migrating", table)
+		}
+	}
+}